@@ -1,21 +1,22 @@
 package main
 
 import (
-	"flag"
+	"fmt"
 	"os"
 
 	"github.com/Azure/kubelogin/pkg/cmd"
-	"github.com/spf13/pflag"
-	"k8s.io/klog"
+	"github.com/Azure/kubelogin/pkg/token"
 )
 
 func main() {
-	klog.InitFlags(nil)
-	pflag.CommandLine.AddGoFlag(flag.CommandLine.Lookup("v"))
-	pflag.CommandLine.AddGoFlag(flag.CommandLine.Lookup("logtostderr"))
-	_ = pflag.CommandLine.Set("logtostderr", "true")
 	root := cmd.NewRootCmd(v.String())
-	if err := root.Execute(); err != nil {
-		os.Exit(1)
+	c, err := root.ExecuteC()
+	if err != nil {
+		if c.Annotations[cmd.ErrorOutputAnnotation] == "json" {
+			if werr := token.WriteErrorOutput(os.Stderr, err); werr != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+		}
+		os.Exit(token.GetExitCode(err))
 	}
 }
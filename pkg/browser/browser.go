@@ -0,0 +1,127 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when no browser can be opened in the current session.
+// Callers are expected to print the URL for the user instead.
+var ErrUnavailable = errors.New("browser is unavailable")
+
+// linux browser launchers in the order of preference
+var linuxLaunchers = []string{"xdg-open", "x-www-browser", "www-browser"}
+
+type environment struct {
+	goos       string
+	getenv     func(string) string
+	readFile   func(string) ([]byte, error)
+	fileExists func(string) bool
+	lookPath   func(string) (string, error)
+}
+
+func newEnvironment() *environment {
+	return &environment{
+		goos:     runtime.GOOS,
+		getenv:   os.Getenv,
+		readFile: os.ReadFile,
+		fileExists: func(name string) bool {
+			_, err := os.Stat(name)
+			return err == nil
+		},
+		lookPath: exec.LookPath,
+	}
+}
+
+// Check returns an error wrapping ErrUnavailable when a browser cannot be opened,
+// e.g. in an SSH session, in a container, or when no browser launcher is installed
+func Check() error {
+	_, _, err := newEnvironment().launcher("")
+	return err
+}
+
+// Open opens the url in the default browser.
+// It handles WSL by delegating to the Windows host, and refuses to open a browser
+// in SSH sessions and containers where it would not be visible to the user.
+func Open(url string) error {
+	name, args, err := newEnvironment().launcher(url)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	// standard output is reserved for the ExecCredential
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to open browser using %s: %w", name, err)
+	}
+	return nil
+}
+
+// launcher returns the command and its arguments which open the url
+func (e *environment) launcher(url string) (string, []string, error) {
+	switch e.goos {
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}, nil
+	case "darwin":
+		if e.isSSHSession() {
+			return "", nil, fmt.Errorf("%w: running in an SSH session", ErrUnavailable)
+		}
+		return "open", []string{url}, nil
+	case "linux":
+		if e.isSSHSession() {
+			return "", nil, fmt.Errorf("%w: running in an SSH session", ErrUnavailable)
+		}
+		if e.isWSL() {
+			if _, err := e.lookPath("wslview"); err == nil {
+				return "wslview", []string{url}, nil
+			}
+			if _, err := e.lookPath("powershell.exe"); err == nil {
+				return "powershell.exe", []string{"-NoProfile", "-NonInteractive", "-Command", "Start-Process", quotePowerShell(url)}, nil
+			}
+			return "", nil, fmt.Errorf("%w: neither wslview nor powershell.exe is found in WSL", ErrUnavailable)
+		}
+		if e.isContainer() {
+			return "", nil, fmt.Errorf("%w: running in a container", ErrUnavailable)
+		}
+		if e.getenv("DISPLAY") == "" && e.getenv("WAYLAND_DISPLAY") == "" {
+			return "", nil, fmt.Errorf("%w: no display is available", ErrUnavailable)
+		}
+		for _, l := range linuxLaunchers {
+			if _, err := e.lookPath(l); err == nil {
+				return l, []string{url}, nil
+			}
+		}
+		return "", nil, fmt.Errorf("%w: none of %s is found", ErrUnavailable, strings.Join(linuxLaunchers, ", "))
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported platform %s", ErrUnavailable, e.goos)
+	}
+}
+
+func (e *environment) isSSHSession() bool {
+	return e.getenv("SSH_CONNECTION") != "" || e.getenv("SSH_CLIENT") != "" || e.getenv("SSH_TTY") != ""
+}
+
+func (e *environment) isWSL() bool {
+	if e.getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	data, err := e.readFile("/proc/version")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+func (e *environment) isContainer() bool {
+	return e.fileExists("/.dockerenv") || e.fileExists("/run/.containerenv") || e.getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// quotePowerShell quotes s as a single-quoted PowerShell string literal
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
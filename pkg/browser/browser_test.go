@@ -0,0 +1,152 @@
+package browser
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLauncher(t *testing.T) {
+	const url = "https://microsoft.com/devicelogin"
+	testData := []struct {
+		name         string
+		goos         string
+		env          map[string]string
+		procVersion  string
+		files        []string
+		paths        []string
+		expectedName string
+		expectedArgs []string
+		unavailable  bool
+	}{
+		{
+			name:         "windows",
+			goos:         "windows",
+			expectedName: "rundll32",
+			expectedArgs: []string{"url.dll,FileProtocolHandler", url},
+		},
+		{
+			name:         "macOS",
+			goos:         "darwin",
+			expectedName: "open",
+			expectedArgs: []string{url},
+		},
+		{
+			name:        "macOS in SSH session",
+			goos:        "darwin",
+			env:         map[string]string{"SSH_CONNECTION": "10.0.0.1 22 10.0.0.2 22"},
+			unavailable: true,
+		},
+		{
+			name:         "linux desktop",
+			goos:         "linux",
+			env:          map[string]string{"DISPLAY": ":0"},
+			paths:        []string{"xdg-open"},
+			expectedName: "xdg-open",
+			expectedArgs: []string{url},
+		},
+		{
+			name:        "linux without display",
+			goos:        "linux",
+			paths:       []string{"xdg-open"},
+			unavailable: true,
+		},
+		{
+			name:        "linux without launcher",
+			goos:        "linux",
+			env:         map[string]string{"DISPLAY": ":0"},
+			unavailable: true,
+		},
+		{
+			name:        "linux in SSH session",
+			goos:        "linux",
+			env:         map[string]string{"DISPLAY": ":0", "SSH_TTY": "/dev/pts/0"},
+			paths:       []string{"xdg-open"},
+			unavailable: true,
+		},
+		{
+			name:        "linux in container",
+			goos:        "linux",
+			env:         map[string]string{"DISPLAY": ":0"},
+			files:       []string{"/.dockerenv"},
+			paths:       []string{"xdg-open"},
+			unavailable: true,
+		},
+		{
+			name:         "WSL with wslview",
+			goos:         "linux",
+			env:          map[string]string{"WSL_DISTRO_NAME": "Ubuntu"},
+			paths:        []string{"wslview", "powershell.exe"},
+			expectedName: "wslview",
+			expectedArgs: []string{url},
+		},
+		{
+			name:         "WSL detected from /proc/version falls back to powershell.exe",
+			goos:         "linux",
+			procVersion:  "Linux version 5.15.90.1-microsoft-standard-WSL2",
+			paths:        []string{"powershell.exe"},
+			expectedName: "powershell.exe",
+			expectedArgs: []string{"-NoProfile", "-NonInteractive", "-Command", "Start-Process", "'" + url + "'"},
+		},
+		{
+			name:        "WSL without wslview and powershell.exe",
+			goos:        "linux",
+			env:         map[string]string{"WSL_DISTRO_NAME": "Ubuntu"},
+			unavailable: true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			e := &environment{
+				goos:   data.goos,
+				getenv: func(k string) string { return data.env[k] },
+				readFile: func(string) ([]byte, error) {
+					if data.procVersion == "" {
+						return nil, os.ErrNotExist
+					}
+					return []byte(data.procVersion), nil
+				},
+				fileExists: func(name string) bool { return contains(data.files, name) },
+				lookPath: func(file string) (string, error) {
+					if contains(data.paths, file) {
+						return "/usr/bin/" + file, nil
+					}
+					return "", os.ErrNotExist
+				},
+			}
+			name, args, err := e.launcher(url)
+			if data.unavailable {
+				if !errors.Is(err, ErrUnavailable) {
+					t.Fatalf("expected ErrUnavailable, actual: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if name != data.expectedName {
+				t.Fatalf("expected launcher: %s, actual: %s", data.expectedName, name)
+			}
+			if !reflect.DeepEqual(args, data.expectedArgs) {
+				t.Fatalf("expected args: %v, actual: %v", data.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestQuotePowerShell(t *testing.T) {
+	if s := quotePowerShell("https://foo/?a='b'"); s != "'https://foo/?a=''b'''" {
+		t.Fatalf("unexpected quoted string: %s", s)
+	}
+}
+
+func contains(a []string, x string) bool {
+	for _, n := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package clientgo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// Options contains the cluster information and the login options used to build a rest.Config
+type Options struct {
+	// Host is the address of the API server
+	Host string
+	// TLSClientConfig contains the settings to connect to the API server, e.g. the cluster CA
+	TLSClientConfig rest.TLSClientConfig
+	// TokenOptions are the same options get-token accepts, except the ones only applied to the ExecCredential,
+	// e.g. TokenPrefix and signing, which are rejected
+	TokenOptions token.Options
+	// ResolveFromEnv resolves TokenOptions from environment variables and --rules-file the same way get-token does,
+	// with the environment variables taking precedence over the values set in code. TokenOptions are used as set by default.
+	ResolveFromEnv bool
+	// TokenHeader is the header the token is sent in, for an authenticating proxy in front of the API server.
+	// When it is empty, the token is sent as a bearer token in the Authorization header.
+	TokenHeader string
+	// TokenPrefix is prepended to the token sent in either header, the same as get-token --token-prefix does
+	TokenPrefix string
+	// Logger receives the log lines of kubelogin instead of klog when it is set. See token.WithLogger.
+	Logger *logr.Logger
+}
+
+// NewAzureRESTConfig returns a rest.Config which authenticates requests with AAD tokens acquired by kubelogin.
+// The token options are validated the same way get-token does, and tokens are cached
+// in memory until expiry on top of kubelogin's token cache.
+func NewAzureRESTConfig(o *Options) (*rest.Config, error) {
+	if o == nil {
+		return nil, errors.New("options cannot be nil")
+	}
+	if o.Host == "" {
+		return nil, errors.New("host cannot be empty")
+	}
+
+	if o.ResolveFromEnv {
+		o.TokenOptions.UpdateFromEnv()
+	} else {
+		o.TokenOptions.Complete()
+	}
+	if err := o.TokenOptions.Validate(); err != nil {
+		return nil, err
+	}
+	var opts []token.Option
+	if o.Logger != nil {
+		opts = append(opts, token.WithLogger(*o.Logger))
+	}
+	provider, err := token.NewTokenProvider(&o.TokenOptions, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token provider: %w", err)
+	}
+
+	ts := transport.NewCachedTokenSource(&tokenSource{provider: provider, prefix: o.TokenPrefix})
+	wrapTransport := transport.TokenSourceWrapTransport(ts)
+	if o.TokenHeader != "" {
+		wrapTransport = headerWrapTransport(o.TokenHeader, ts)
+	}
+	return &rest.Config{
+		Host:            o.Host,
+		TLSClientConfig: o.TLSClientConfig,
+		WrapTransport:   wrapTransport,
+	}, nil
+}
+
+// tokenSource adapts a kubelogin TokenProvider to oauth2.TokenSource
+type tokenSource struct {
+	provider token.TokenProvider
+	prefix   string
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.provider.Token()
+	if err != nil {
+		return nil, err
+	}
+	t.AccessToken = s.prefix + t.AccessToken
+	return toOAuth2Token(t), nil
+}
+
+// headerWrapTransport returns a transport.WrapperFunc which sends the token in the given header
+func headerWrapTransport(header string, ts oauth2.TokenSource) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &headerRoundTripper{header: header, source: ts, base: rt}
+	}
+}
+
+type headerRoundTripper struct {
+	header string
+	source oauth2.TokenSource
+	base   http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get(rt.header)) != 0 {
+		return rt.base.RoundTrip(req)
+	}
+	t, err := rt.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(rt.header, t.AccessToken)
+	return rt.base.RoundTrip(req)
+}
+
+func toOAuth2Token(t adal.Token) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken: t.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      t.Expires(),
+	}
+}
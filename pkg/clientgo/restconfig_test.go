@@ -0,0 +1,169 @@
+package clientgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/Azure/kubelogin/pkg/token/mock_token"
+	"github.com/golang/mock/gomock"
+	"k8s.io/client-go/transport"
+)
+
+func TestNewAzureRESTConfig(t *testing.T) {
+	t.Run("empty host should return error", func(t *testing.T) {
+		_, err := NewAzureRESTConfig(&Options{TokenOptions: token.NewOptions()})
+		if err == nil || err.Error() != "host cannot be empty" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid login method should return error", func(t *testing.T) {
+		o := &Options{
+			Host:         "https://anything.com",
+			TokenOptions: token.NewOptions(),
+		}
+		o.TokenOptions.LoginMethod = "unsupported"
+		if _, err := NewAzureRESTConfig(o); err == nil {
+			t.Fatal("expected error for unsupported login method")
+		}
+	})
+
+	t.Run("rest config should wrap transport", func(t *testing.T) {
+		o := &Options{
+			Host:         "https://anything.com",
+			TokenOptions: token.NewOptions(),
+		}
+		o.TokenOptions.LoginMethod = token.AzureCLILogin
+		o.TokenOptions.ServerID = "serverID"
+		config, err := NewAzureRESTConfig(o)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if config.Host != o.Host {
+			t.Fatalf("expected host: %s, actual: %s", o.Host, config.Host)
+		}
+		if config.WrapTransport == nil {
+			t.Fatal("expected WrapTransport to be set")
+		}
+	})
+
+	t.Run("environment variables should only override options with ResolveFromEnv", func(t *testing.T) {
+		t.Setenv("AAD_SERVER_ID", "envServerID")
+		for _, resolveFromEnv := range []bool{false, true} {
+			o := &Options{
+				Host:           "https://anything.com",
+				TokenOptions:   token.NewOptions(),
+				ResolveFromEnv: resolveFromEnv,
+			}
+			o.TokenOptions.LoginMethod = token.AzureCLILogin
+			o.TokenOptions.ServerID = "serverID"
+			if _, err := NewAzureRESTConfig(o); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected := "serverID"
+			if resolveFromEnv {
+				expected = "envServerID"
+			}
+			if o.TokenOptions.ServerID != expected {
+				t.Fatalf("expected server ID %s with ResolveFromEnv %t, actual: %s", expected, resolveFromEnv, o.TokenOptions.ServerID)
+			}
+		}
+	})
+
+	t.Run("token prefix of token options should return error", func(t *testing.T) {
+		o := &Options{
+			Host:         "https://anything.com",
+			TokenOptions: token.NewOptions(),
+		}
+		o.TokenOptions.LoginMethod = token.AzureCLILogin
+		o.TokenOptions.ServerID = "serverID"
+		o.TokenOptions.TokenPrefix = "Pomerium-"
+		if _, err := NewAzureRESTConfig(o); err == nil || !strings.Contains(err.Error(), "--token-prefix is not supported") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestTokenSource(t *testing.T) {
+	const accessToken = "accessToken"
+
+	t.Run("token from provider should be sent as bearer token", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		provider := mock_token.NewMockTokenProvider(ctrl)
+		provider.EXPECT().Token().Return(adal.Token{
+			AccessToken: accessToken,
+			ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+		}, nil)
+
+		var authHeader string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader = r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		rt := transport.TokenSourceWrapTransport(&tokenSource{provider: provider})(http.DefaultTransport)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp.Body.Close()
+		if authHeader != "Bearer "+accessToken {
+			t.Fatalf("expected Authorization header: Bearer %s, actual: %s", accessToken, authHeader)
+		}
+	})
+
+	t.Run("token should be sent in custom header with prefix", func(t *testing.T) {
+		const header = "X-Proxy-Token"
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		provider := mock_token.NewMockTokenProvider(ctrl)
+		provider.EXPECT().Token().Return(adal.Token{
+			AccessToken: accessToken,
+			ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+		}, nil)
+
+		var authHeader, proxyHeader string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader = r.Header.Get("Authorization")
+			proxyHeader = r.Header.Get(header)
+		}))
+		defer server.Close()
+
+		ts := &tokenSource{provider: provider, prefix: "Pomerium-"}
+		rt := headerWrapTransport(header, ts)(http.DefaultTransport)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp.Body.Close()
+		if authHeader != "" {
+			t.Fatalf("expected no Authorization header, actual: %s", authHeader)
+		}
+		if proxyHeader != "Pomerium-"+accessToken {
+			t.Fatalf("expected %s header: Pomerium-%s, actual: %s", header, accessToken, proxyHeader)
+		}
+	})
+
+	t.Run("provider error should be returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		provider := mock_token.NewMockTokenProvider(ctrl)
+		provider.EXPECT().Token().Return(adal.Token{}, errors.New("fail"))
+
+		ts := &tokenSource{provider: provider}
+		if _, err := ts.Token(); err == nil || err.Error() != "fail" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
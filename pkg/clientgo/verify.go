@@ -0,0 +1,147 @@
+package clientgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	authenticationv1alpha1 "k8s.io/api/authentication/v1alpha1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/rest"
+)
+
+// selfSubjectReviewVersions are the versions of SelfSubjectReview tried in order:
+// GA in Kubernetes 1.28, beta in 1.27, and alpha behind the APISelfSubjectReview feature gate in 1.26
+var selfSubjectReviewVersions = []string{"v1", "v1beta1", "v1alpha1"}
+
+// VerifyResult is the user the API server authenticated the credential of the rest.Config as
+type VerifyResult struct {
+	// Username, UID, Groups, and Extra are the user attributes returned by SelfSubjectReview.
+	// They are empty when the API server does not serve SelfSubjectReview.
+	Username string
+	UID      string
+	Groups   []string
+	Extra    map[string][]string
+	// SelfSubjectReview is the API version of SelfSubjectReview served by the API server, empty when none is served
+	SelfSubjectReview string
+	// CanListNamespaces is whether the user may list namespaces, reported by SelfSubjectAccessReview
+	// when the API server does not serve SelfSubjectReview
+	CanListNamespaces bool
+}
+
+func (r *VerifyResult) String() string {
+	if r.SelfSubjectReview == "" {
+		return fmt.Sprintf("authenticated, the API server does not serve SelfSubjectReview to tell the username\nallowed to list namespaces: %t", r.CanListNamespaces)
+	}
+	lines := []string{
+		"username: " + r.Username,
+		"uid: " + r.UID,
+		"groups: " + strings.Join(r.Groups, ", "),
+	}
+	keys := make([]string, 0, len(r.Extra))
+	for k := range r.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("extra %s: %s", k, strings.Join(r.Extra[k], ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Verify sends a SelfSubjectReview to the API server of config, authenticated with the credential of config,
+// e.g. the exec plugin of a kubeconfig context, and returns the user it is authenticated as.
+// When the API server does not serve SelfSubjectReview, a SelfSubjectAccessReview verifies the credential is accepted instead.
+func Verify(ctx context.Context, config *rest.Config) (*VerifyResult, error) {
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	host := strings.TrimSuffix(config.Host, "/")
+
+	for _, version := range selfSubjectReviewVersions {
+		review := authenticationv1alpha1.SelfSubjectReview{}
+		review.APIVersion = "authentication.k8s.io/" + version
+		review.Kind = "SelfSubjectReview"
+		status, err := post(ctx, client, host+"/apis/authentication.k8s.io/"+version+"/selfsubjectreviews", &review)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusNotFound {
+			continue
+		}
+		user := review.Status.UserInfo
+		result := &VerifyResult{
+			Username:          user.Username,
+			UID:               user.UID,
+			Groups:            user.Groups,
+			SelfSubjectReview: version,
+		}
+		if len(user.Extra) > 0 {
+			result.Extra = map[string][]string{}
+			for k, v := range user.Extra {
+				result.Extra[k] = v
+			}
+		}
+		return result, nil
+	}
+
+	review := authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "list", Resource: "namespaces"},
+		},
+	}
+	review.APIVersion = "authorization.k8s.io/v1"
+	review.Kind = "SelfSubjectAccessReview"
+	status, err := post(ctx, client, host+"/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", &review)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("the API server serves neither SelfSubjectReview nor SelfSubjectAccessReview")
+	}
+	return &VerifyResult{CanListNamespaces: review.Status.Allowed}, nil
+}
+
+// post creates the review and decodes the response into it. It returns the status code when the review is created
+// or not found, and an error for the other status codes, e.g. when the credential is rejected.
+func post(ctx context.Context, client *http.Client, url string, review interface{}) (int, error) {
+	body, err := json.Marshal(review)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal review: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request to the API server: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response of the API server: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		if err := json.Unmarshal(data, review); err != nil {
+			return 0, fmt.Errorf("failed to decode response of the API server: %w", err)
+		}
+		return resp.StatusCode, nil
+	case http.StatusNotFound:
+		return resp.StatusCode, nil
+	case http.StatusUnauthorized:
+		return 0, fmt.Errorf("the API server rejected the credential: %s", strings.TrimSpace(string(data)))
+	default:
+		return 0, fmt.Errorf("unexpected response from the API server: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+}
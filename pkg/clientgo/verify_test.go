@@ -0,0 +1,86 @@
+package clientgo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func newVerifyServer(t *testing.T, responses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"kind":"Status","message":"Unauthorized"}`))
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name        string
+		responses   map[string]string
+		bearerToken string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name: "SelfSubjectReview of the latest served version should report the user",
+			responses: map[string]string{
+				"/apis/authentication.k8s.io/v1beta1/selfsubjectreviews":  `{"status":{"userInfo":{"username":"foo@bar.com","uid":"oid","groups":["group1","system:authenticated"],"extra":{"oid":["oid"]}}}}`,
+				"/apis/authentication.k8s.io/v1alpha1/selfsubjectreviews": `{"status":{"userInfo":{"username":"alpha"}}}`,
+			},
+			bearerToken: "token",
+			expected:    "username: foo@bar.com\nuid: oid\ngroups: group1, system:authenticated\nextra oid: oid",
+		},
+		{
+			name: "SelfSubjectAccessReview should verify the credential without SelfSubjectReview",
+			responses: map[string]string{
+				"/apis/authorization.k8s.io/v1/selfsubjectaccessreviews": `{"status":{"allowed":true}}`,
+			},
+			bearerToken: "token",
+			expected:    "allowed to list namespaces: true",
+		},
+		{
+			name:        "API server serving neither review should return error",
+			bearerToken: "token",
+			expectedErr: "serves neither SelfSubjectReview nor SelfSubjectAccessReview",
+		},
+		{
+			name:        "rejected credential should return error",
+			bearerToken: "invalid",
+			expectedErr: "the API server rejected the credential",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newVerifyServer(t, tc.responses)
+			result, err := Verify(context.Background(), &rest.Config{Host: server.URL, BearerToken: tc.bearerToken})
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := result.String(); !strings.HasSuffix(got, tc.expected) {
+				t.Fatalf("expected result %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
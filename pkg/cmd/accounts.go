@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewAccountsCmd provides a cobra command for accounts sub command
+func NewAccountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "accounts",
+		Short: "list and switch the accounts whose tokens are cached side by side with --account-alias",
+		Long: `list and switch the accounts whose tokens are cached side by side, e.g. a work and a personal identity for the same server ID.
+get-token with --account-alias <alias> caches the tokens of the account in its own token cache.
+get-token without --account-alias uses the account set by accounts switch.`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return c.Help()
+		},
+	}
+	cmd.AddCommand(newAccountsListCmd())
+	cmd.AddCommand(newAccountsSwitchCmd())
+	return cmd
+}
+
+func newAccountsListCmd() *cobra.Command {
+	var (
+		tokenCacheDir = token.DefaultTokenCacheDir
+		output        string
+	)
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "list the accounts with the number of cached tokens and the identities they are issued to",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			accounts, err := token.ListAccounts(tokenCacheDir)
+			if err != nil {
+				return fmt.Errorf("unable to list the accounts in %s: %w", tokenCacheDir, err)
+			}
+			switch output {
+			case "":
+				return printAccounts(c.OutOrStdout(), accounts)
+			case outputJSON:
+				e := json.NewEncoder(c.OutOrStdout())
+				e.SetIndent("", "  ")
+				return e.Encode(accounts)
+			default:
+				return fmt.Errorf("'%s' is not a supported output format. Supported format is %s", output, outputJSON)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&tokenCacheDir, "token-cache-dir", tokenCacheDir, "directory to cache token")
+	cmd.Flags().StringVarP(&output, "output", "o", output, fmt.Sprintf("output format. Supported format: %s. Tables are printed by default", outputJSON))
+	return cmd
+}
+
+func newAccountsSwitchCmd() *cobra.Command {
+	tokenCacheDir := token.DefaultTokenCacheDir
+
+	cmd := &cobra.Command{
+		Use:   "switch <alias>",
+		Short: "use the token cache of the account when get-token is run without --account-alias",
+		Long: fmt.Sprintf(`use the token cache of the account when get-token is run without --account-alias.
+The account does not need to be logged in yet. %s switches back to the token cache directory itself.`, token.DefaultAccountAlias),
+		Example:      "  kubelogin accounts switch work",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := token.SwitchAccount(tokenCacheDir, args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.OutOrStdout(), "switched to account %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tokenCacheDir, "token-cache-dir", tokenCacheDir, "directory to cache token")
+	return cmd
+}
+
+func printAccounts(out io.Writer, accounts []token.AccountInfo) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tALIAS\tTOKENS\tIDENTITIES")
+	for _, a := range accounts {
+		current := ""
+		if a.Current {
+			current = "*"
+		}
+		identities := strings.Join(a.Identities, ",")
+		if identities == "" {
+			identities = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", current, a.Alias, a.Tokens, identities)
+	}
+	return w.Flush()
+}
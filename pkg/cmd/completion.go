@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// registerTokenFlagCompletions completes the values of the flags registered by token.Options.AddFlags in the
+// shell completion generated by the completion sub command. o must be the options the flags are bound to.
+func registerTokenFlagCompletions(cmd *cobra.Command, o *token.Options) {
+	_ = cmd.RegisterFlagCompletionFunc("login", completeLoginMethods)
+	_ = cmd.RegisterFlagCompletionFunc("environment", completeValues(token.GetEnvironmentNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("legacy-audience", completeValues(token.LegacyAudienceOn, token.LegacyAudienceOff, token.LegacyAudienceAuto))
+	_ = cmd.RegisterFlagCompletionFunc("token-type", completeValues(token.TokenTypeAccess, token.TokenTypeID))
+	_ = cmd.RegisterFlagCompletionFunc("server-id", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		// flags are parsed before completing, so --token-cache-dir on the command line is honored
+		serverIDs, err := token.GetCachedServerIDs(o.TokenCacheDir)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return serverIDs, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func completeLoginMethods(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	for _, m := range token.GetLoginMethods() {
+		if m.Deprecated != "" {
+			// shells supporting descriptions show it next to the login method
+			completions = append(completions, m.Name+"\tdeprecated: "+m.Deprecated)
+			continue
+		}
+		completions = append(completions, m.Name)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
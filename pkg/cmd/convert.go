@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/Azure/kubelogin/pkg/converter"
 	"github.com/spf13/cobra"
 	"k8s.io/client-go/tools/clientcmd"
@@ -22,8 +24,17 @@ func NewConvertCmd() *cobra.Command {
 				return err
 			}
 
+			if o.Output != "" {
+				return converter.WriteExecSnippet(o, os.Stdout)
+			}
+
+			kubeconfig, _ := o.Flags.GetString("kubeconfig")
+			if kubeconfig == converter.StdinStdout {
+				return converter.ConvertStream(o, os.Stdin, os.Stdout)
+			}
+
 			pathOptions := clientcmd.NewDefaultPathOptions()
-			pathOptions.LoadingRules.ExplicitPath, _ = o.Flags.GetString("kubeconfig")
+			pathOptions.LoadingRules.ExplicitPath = kubeconfig
 
 			if err := converter.Convert(o, pathOptions); err != nil {
 				return err
@@ -33,6 +44,7 @@ func NewConvertCmd() *cobra.Command {
 	}
 
 	o.AddFlags(cmd.Flags())
+	registerTokenFlagCompletions(cmd, &o.TokenOptions)
 
 	return cmd
 }
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewExplainCmd provides a cobra command for explain sub command
+func NewExplainCmd() *cobra.Command {
+	o := token.NewOptions()
+
+	cmd := &cobra.Command{
+		Use:   "explain",
+		Short: "explain what get-token would do, without network calls",
+		Long: `explain what get-token would do with the same flags, step by step: the token cache file checked,
+whether the cached token is valid, whether it would be refreshed, and which login would run against which endpoint.
+It does not make network calls nor write files, for debugging unexpected login prompts.`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			o.UpdateFromEnvWithFlags(c.Flags())
+			if err := o.Validate(); err != nil {
+				return token.NewConfigError(err)
+			}
+
+			steps, err := token.Explain(&o)
+			if err != nil {
+				return err
+			}
+			for i, step := range steps {
+				fmt.Fprintf(c.OutOrStdout(), "%d. %s\n", i+1, step)
+			}
+			return nil
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+	registerTokenFlagCompletions(cmd, &o)
+	return cmd
+}
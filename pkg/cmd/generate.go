@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/Azure/kubelogin/pkg/converter"
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewGenerateCmd provides a cobra command for generate-kubeconfig sub command
+func NewGenerateCmd() *cobra.Command {
+	var (
+		o            = converter.New()
+		clustersFile string
+		kubeconfig   = converter.StdinStdout
+	)
+
+	cmd := &cobra.Command{
+		Use:   "generate-kubeconfig",
+		Short: "generate kubeconfig with exec auth module for a list of clusters",
+		Long: `generate kubeconfig with a cluster, a context, and a user running kubelogin get-token with the given login flags
+for each of the clusters in the cluster list, without az aks get-credentials.
+The API server and the CA of the clusters listed by ARM resource ID are looked up in Azure Resource Manager,
+authenticating with the same login flags for the ARM audience.`,
+		Example: `  # clusters.yaml
+  clusters:
+  - id: /subscriptions/<subscription>/resourceGroups/<group>/providers/Microsoft.ContainerService/managedClusters/<name>
+  - name: onprem
+    server: https://onprem.example.com:6443
+    certificateAuthorityData: <base64 encoded CA>
+
+  kubelogin generate-kubeconfig -f clusters.yaml -l workloadidentity --server-id aks --kubeconfig kubeconfig`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			o.Flags = c.Flags()
+			o.UpdateFromEnv()
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if clustersFile == "" {
+				return fmt.Errorf("--file is required")
+			}
+			list, err := converter.LoadClusterList(clustersFile, os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			if kubeconfig == converter.StdinStdout {
+				return converter.GenerateKubeconfig(c.Context(), o, list, os.Stdout)
+			}
+			var buf bytes.Buffer
+			if err := converter.GenerateKubeconfig(c.Context(), o, list, &buf); err != nil {
+				return err
+			}
+			if err := os.WriteFile(kubeconfig, buf.Bytes(), 0600); err != nil {
+				return fmt.Errorf("unable to write kubeconfig: %w", err)
+			}
+			return nil
+		},
+	}
+
+	o.TokenOptions = token.NewOptions()
+	o.TokenOptions.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&clustersFile, "file", "f", clustersFile, "file of the cluster list in YAML or JSON, or - to read it from standard input")
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", kubeconfig, "kubeconfig file to write, or - to write to standard output")
+	registerTokenFlagCompletions(cmd, &o.TokenOptions)
+
+	return cmd
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+const outputJSON = "json"
+
+// NewListLoginMethodsCmd provides a cobra command for list-login-methods sub command
+func NewListLoginMethodsCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:          "list-login-methods",
+		Short:        "list the login methods supported by this build and the login plugins on PATH, and their capabilities",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			methods := append(token.GetLoginMethods(), token.GetLoginPlugins()...)
+			switch output {
+			case "":
+				w := tabwriter.NewWriter(c.OutOrStdout(), 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tINTERACTIVE\tCACHE\tREFRESH\tID TOKEN\tB2C\tDEPRECATED\tPLUGIN")
+				for _, m := range methods {
+					fmt.Fprintf(w, "%s\t%t\t%t\t%t\t%t\t%t\t%s\t%s\n", m.Name, m.Interactive, m.Cache, m.Refresh, m.IDToken, m.B2C, m.Deprecated, m.Plugin)
+				}
+				return w.Flush()
+			case outputJSON:
+				e := json.NewEncoder(c.OutOrStdout())
+				e.SetIndent("", "  ")
+				return e.Encode(methods)
+			default:
+				return fmt.Errorf("'%s' is not a supported output format. Supported format is %s", output, outputJSON)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", output, fmt.Sprintf("output format. Supported format: %s. A table is printed by default", outputJSON))
+	return cmd
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// loggingFlags are the flags of klog kubelogin accepts
+var loggingFlags = []string{"v", "logtostderr"}
+
+var (
+	klogFlags     *flag.FlagSet
+	klogFlagsOnce sync.Once
+)
+
+// getKlogFlags returns the flag set klog is initialized with, which is initialized once
+// since klog.InitFlags resets the verbosity and the outputs of klog
+func getKlogFlags() *flag.FlagSet {
+	klogFlagsOnce.Do(func() {
+		klogFlags = flag.NewFlagSet("klog", flag.ContinueOnError)
+		klog.InitFlags(klogFlags)
+		// kubectl shows the standard error of exec plugins, so log lines are not written to files by default
+		_ = klogFlags.Set("logtostderr", "true")
+	})
+	return klogFlags
+}
+
+// AddLoggingFlags adds -v and --logtostderr of klog to fs.
+// The flags of klog are registered in a flag set of their own instead of flag.CommandLine,
+// so that they do not collide with the flags of a program embedding kubelogin, nor panic when it registered klog itself.
+// A flag already in fs, e.g. -v of the embedding program, is kept and not added.
+func AddLoggingFlags(fs *pflag.FlagSet) {
+	klogFlags := getKlogFlags()
+	for _, name := range loggingFlags {
+		if fs.Lookup(name) != nil || (len(name) == 1 && fs.ShorthandLookup(name) != nil) {
+			continue
+		}
+		f := pflag.PFlagFromGoFlag(klogFlags.Lookup(name))
+		f.DefValue = f.Value.String()
+		fs.AddFlag(f)
+	}
+}
+
+// logBuffer is an io.Writer keeping the last max bytes written to it, trimmed to whole lines
+type logBuffer struct {
+	mu   sync.Mutex
+	max  int
+	data []byte
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+		if i := bytes.IndexByte(b.data, '\n'); i >= 0 {
+			b.data = b.data[i+1:]
+		}
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the log lines in the buffer
+func (b *logBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.data...)
+}
+
+// captureLogs writes the output of klog to a logBuffer keeping its last maxBytes as well,
+// and returns the buffer with a function restoring the outputs of klog.
+// Log lines are still written to the standard error when --logtostderr is set.
+func captureLogs(maxBytes int) (*logBuffer, func()) {
+	klogFlags := getKlogFlags()
+	toStderr := klogFlags.Lookup("logtostderr").Value.String()
+	b := &logBuffer{max: maxBytes}
+
+	// klog writes a line to the outputs of its severity and the lower ones, so the buffer is the output of INFO only
+	klog.SetOutputBySeverity("INFO", b)
+	for _, severity := range []string{"WARNING", "ERROR", "FATAL"} {
+		klog.SetOutputBySeverity(severity, io.Discard)
+	}
+	_ = klogFlags.Set("alsologtostderr", toStderr)
+	_ = klogFlags.Set("logtostderr", "false")
+
+	return b, func() {
+		klog.Flush()
+		_ = klogFlags.Set("logtostderr", toStderr)
+		_ = klogFlags.Set("alsologtostderr", "false")
+	}
+}
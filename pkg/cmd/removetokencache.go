@@ -1,29 +1,29 @@
 package cmd
 
 import (
-	"os"
-
 	"github.com/Azure/kubelogin/pkg/token"
 	"github.com/spf13/cobra"
-	"k8s.io/klog"
 )
 
 // NewRemoveTokenCacheCmd provides a cobra command for removing token cache sub command
 func NewRemoveTokenCacheCmd() *cobra.Command {
-	var tokenCacheDir string
+	var (
+		tokenCacheDir string
+		all           bool
+		dryRun        bool
+	)
 
 	cmd := &cobra.Command{
 		Use:          "remove-tokens",
 		Short:        "Remove all cached tokens from filesystem",
 		SilenceUsage: true,
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := os.RemoveAll(tokenCacheDir); err != nil {
-				klog.V(5).Infof("unable to delete tokens cache in '%s': %s", tokenCacheDir, err)
-			}
-			return nil
+			return token.RemoveTokenCaches(token.GetTokenCacheDirs(tokenCacheDir, all), dryRun, c.OutOrStdout())
 		},
 	}
 
 	cmd.Flags().StringVar(&tokenCacheDir, "token-cache-dir", token.DefaultTokenCacheDir, "directory to cache token")
+	cmd.Flags().BoolVar(&all, "all", all, "also remove the token cache directories set in AAD_TOKEN_CACHE_DIR and AZURE_TOKEN_CACHE_DIR, and the default one")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", dryRun, "only print the files which would be removed")
 	return cmd
 }
@@ -17,9 +17,20 @@ func NewRootCmd(version string) *cobra.Command {
 		},
 	}
 
+	AddLoggingFlags(cmd.PersistentFlags())
+
 	cmd.AddCommand(NewConvertCmd())
+	cmd.AddCommand(NewGenerateCmd())
 	cmd.AddCommand(NewTokenCmd())
 	cmd.AddCommand(NewRemoveTokenCacheCmd())
+	cmd.AddCommand(NewSupportBundleCmd(version))
+	cmd.AddCommand(NewStatusCmd())
+	cmd.AddCommand(NewExplainCmd())
+	cmd.AddCommand(NewListLoginMethodsCmd())
+	cmd.AddCommand(NewVerifyCmd())
+	cmd.AddCommand(NewVerifyExecCredentialCmd())
+	cmd.AddCommand(NewTokenCacheCmd())
+	cmd.AddCommand(NewAccountsCmd())
 
 	return cmd
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewStatusCmd provides a cobra command for status sub command
+func NewStatusCmd() *cobra.Command {
+	o := token.NewOptions()
+	var quiet bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "report whether a valid cached credential exists",
+		Long: `report whether a valid cached credential exists and its remaining lifetime, without network calls.
+It exits with 0 when the cached credential is valid, and 1 otherwise.`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			o.UpdateFromEnvWithFlags(c.Flags())
+			if err := o.Validate(); err != nil {
+				return token.NewConfigError(err)
+			}
+
+			status, err := token.GetCredentialStatus(&o)
+			if err != nil {
+				return err
+			}
+			if !status.Valid {
+				c.SilenceErrors = quiet
+				return errors.New(status.String())
+			}
+			if !quiet {
+				fmt.Fprintln(c.OutOrStdout(), status)
+			}
+			return nil
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+	registerTokenFlagCompletions(cmd, &o)
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", quiet, "only report the status with the exit code")
+	return cmd
+}
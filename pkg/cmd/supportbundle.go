@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// supportBundleLogBytes is the size of the recent klog output included in the support bundle
+const supportBundleLogBytes = 1 << 20
+
+// NewSupportBundleCmd provides a cobra command for support-bundle sub command
+func NewSupportBundleCmd(version string) *cobra.Command {
+	o := token.NewOptions()
+	var output string
+
+	cmd := &cobra.Command{
+		Use:          "support-bundle",
+		Short:        "collect redacted options, environment, and token cache metadata into a tar.gz for bug reports",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			logs, restore := captureLogs(supportBundleLogBytes)
+			defer restore()
+
+			o.UpdateFromEnvWithFlags(c.Flags())
+
+			if output == "" {
+				output = fmt.Sprintf("kubelogin-support-bundle-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+			}
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("unable to create support bundle: %w", err)
+			}
+			defer f.Close()
+
+			if err := token.WriteSupportBundle(&o, version, logs, f); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "support bundle is written to %s\n", output)
+			return nil
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+	registerTokenFlagCompletions(cmd, &o)
+	cmd.Flags().StringVarP(&output, "output", "o", output, "path of the support bundle. Defaults to kubelogin-support-bundle-<timestamp>.tar.gz in current directory")
+	return cmd
+}
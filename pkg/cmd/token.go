@@ -1,28 +1,47 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/Azure/kubelogin/pkg/token"
 	"github.com/spf13/cobra"
 )
 
+// ErrorOutputAnnotation is the annotation of the commands whose errors are written to stderr as a token.ErrorOutput
+const ErrorOutputAnnotation = "kubelogin/error-output"
+
 // NewTokenCmd provides a cobra command for convert sub command
 func NewTokenCmd() *cobra.Command {
 	o := token.NewOptions()
+	var helpLogin string
 
 	cmd := &cobra.Command{
 		Use:          "get-token",
 		Short:        "get AAD token",
+		Long:         getTokenLongDescription(),
 		SilenceUsage: true,
+		// errors are written to stderr as a JSON object by main
+		SilenceErrors: true,
+		Annotations:   map[string]string{ErrorOutputAnnotation: "json"},
 		RunE: func(c *cobra.Command, args []string) error {
-			o.UpdateFromEnv()
+			if helpLogin != "" {
+				example, err := token.GetLoginMethodExample(helpLogin)
+				if err != nil {
+					return token.NewConfigError(err)
+				}
+				fmt.Fprintln(c.OutOrStdout(), example)
+				return nil
+			}
+
+			o.UpdateFromEnvWithFlags(c.Flags())
 
 			if err := o.Validate(); err != nil {
-				return err
+				return token.NewConfigError(err)
 			}
 
 			plugin, err := token.New(&o)
 			if err != nil {
-				return err
+				return token.NewConfigError(err)
 			}
 			if err := plugin.Do(); err != nil {
 				return err
@@ -31,6 +50,32 @@ func NewTokenCmd() *cobra.Command {
 		},
 	}
 
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return token.NewConfigError(err)
+	})
 	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&helpLogin, "help-login", helpLogin, "show an example configuring the login method, e.g. spn, and exit")
+	registerTokenFlagCompletions(cmd, &o)
+	_ = cmd.RegisterFlagCompletionFunc("help-login", completeLoginMethods)
 	return cmd
 }
+
+func getTokenLongDescription() string {
+	return fmt.Sprintf(`get AAD token
+
+Exit codes:
+  %2d  general error
+  %2d  interactive login required
+  %2d  network error
+  %2d  configuration error
+  %2d  consent required
+  %2d  token denied by --policy
+
+Errors are written to stderr as {"code":<exit code>,"error":"<message>"}`,
+		token.ExitCodeGeneralError,
+		token.ExitCodeInteractiveLoginRequired,
+		token.ExitCodeNetworkError,
+		token.ExitCodeConfigError,
+		token.ExitCodeConsentRequired,
+		token.ExitCodePolicyDenied)
+}
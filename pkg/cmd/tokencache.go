@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewTokenCacheCmd provides a cobra command for token-cache sub command
+func NewTokenCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "token-cache",
+		Short:        "inspect the token cache",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return c.Help()
+		},
+	}
+	cmd.AddCommand(newTokenCacheStatsCmd())
+	return cmd
+}
+
+func newTokenCacheStatsCmd() *cobra.Command {
+	var (
+		tokenCacheDir = token.DefaultTokenCacheDir
+		output        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "report the cached tokens per audience and a histogram of their remaining lifetimes",
+		Long: `report the number of cached tokens per audience, how long ago the user authenticated for the oldest of them,
+their remaining lifetimes, and when they were last used, without network calls.
+The time of authentication and the last use are recorded in the cache metadata by get-token.`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			stats, err := token.GetTokenCacheStats(tokenCacheDir)
+			if err != nil {
+				return fmt.Errorf("unable to read token cache %s: %w", tokenCacheDir, err)
+			}
+			switch output {
+			case "":
+				return printTokenCacheStats(c.OutOrStdout(), stats)
+			case outputJSON:
+				e := json.NewEncoder(c.OutOrStdout())
+				e.SetIndent("", "  ")
+				// keep the labels of the histogram, e.g. "< 1h", readable
+				e.SetEscapeHTML(false)
+				return e.Encode(stats)
+			default:
+				return fmt.Errorf("'%s' is not a supported output format. Supported format is %s", output, outputJSON)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&tokenCacheDir, "token-cache-dir", tokenCacheDir, "directory to cache token")
+	cmd.Flags().StringVarP(&output, "output", "o", output, fmt.Sprintf("output format. Supported format: %s. Tables are printed by default", outputJSON))
+	return cmd
+}
+
+func printTokenCacheStats(out io.Writer, stats token.TokenCacheStats) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AUDIENCE\tTOKENS\tEXPIRED\tREFRESHABLE\tAUTHENTICATED\tMIN REMAINING\tMAX REMAINING\tLAST USED")
+	for _, a := range stats.Audiences {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", a.Audience, a.Tokens, a.Expired, a.Refreshable,
+			formatAgo(stats.Now, a.OldestAuthenticatedAt),
+			formatRemaining(a.EarliestExpiresOn.Sub(stats.Now)),
+			formatRemaining(a.LatestExpiresOn.Sub(stats.Now)),
+			formatAgo(stats.Now, a.LastUsedAt))
+	}
+	fmt.Fprintln(w)
+
+	max := 0
+	for _, b := range stats.Lifetimes {
+		if b.Tokens > max {
+			max = b.Tokens
+		}
+	}
+	fmt.Fprintln(w, "REMAINING LIFETIME\tTOKENS")
+	for _, b := range stats.Lifetimes {
+		if bar := histogramBar(b.Tokens, max); bar != "" {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", b.Label, b.Tokens, bar)
+		} else {
+			fmt.Fprintf(w, "%s\t%d\n", b.Label, b.Tokens)
+		}
+	}
+	return w.Flush()
+}
+
+// histogramBarWidth is the width of the bar of the largest bucket
+const histogramBarWidth = 40
+
+func histogramBar(n, max int) string {
+	if n == 0 || max == 0 {
+		return ""
+	}
+	width := n * histogramBarWidth / max
+	if width == 0 {
+		width = 1
+	}
+	return strings.Repeat("#", width)
+}
+
+func formatAgo(now time.Time, t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	return formatStatsDuration(now.Sub(*t)) + " ago"
+}
+
+func formatRemaining(d time.Duration) string {
+	if d <= 0 {
+		return "expired"
+	}
+	return formatStatsDuration(d)
+}
+
+// formatStatsDuration formats durations of a day or longer in days and hours, e.g. 14d3h instead of 339h0m3s
+func formatStatsDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day {
+		return fmt.Sprintf("%dd%dh", d/day, (d%day)/time.Hour)
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/clientgo"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const defaultVerifyTimeout = 5 * time.Minute
+
+// NewVerifyCmd provides a cobra command for verify sub command
+func NewVerifyCmd() *cobra.Command {
+	kubeconfig, kubeContext := "", ""
+	configFlags := &genericclioptions.ConfigFlags{KubeConfig: &kubeconfig, Context: &kubeContext}
+	timeout := defaultVerifyTimeout
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify the credential of a kubeconfig context against the API server",
+		Long: `verify the credential of a kubeconfig context against the API server, running its exec plugin as kubectl does,
+and report the username and groups the API server authenticated it as with SelfSubjectReview.
+When the API server does not serve SelfSubjectReview, a SelfSubjectAccessReview verifies the credential is accepted.`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := configFlags.ToRESTConfig()
+			if err != nil {
+				return fmt.Errorf("unable to load kubeconfig: %w", err)
+			}
+			ctx, cancel := context.WithTimeout(c.Context(), timeout)
+			defer cancel()
+
+			result, err := clientgo.Verify(ctx, config)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.OutOrStdout(), "server: %s\n%s\n", config.Host, result)
+			return nil
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().DurationVar(&timeout, "timeout", timeout, "timeout of verifying the credential, including the login of the exec plugin")
+	return cmd
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/cobra"
+)
+
+// NewVerifyExecCredentialCmd provides a cobra command for verify-exec-credential sub command
+func NewVerifyExecCredentialCmd() *cobra.Command {
+	var (
+		file          = "-"
+		publicKey     string
+		signatureFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify-exec-credential",
+		Short: "verify the signature of an ExecCredential written by get-token with --sign-key",
+		Long: `verify the detached signature written to --signature-file by get-token with --sign-key against the ExecCredential,
+e.g. when credentials are passed between processes, so that a credential which was not written by get-token, or was modified, is rejected.
+It exits with 1 when the signature does not match.`,
+		Example: `  kubelogin get-token --server-id <server-id> --sign-key key.pem --signature-file cred.jws > cred.json
+  kubelogin verify-exec-credential -f cred.json --public-key key.pub --signature-file cred.jws`,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if publicKey == "" || signatureFile == "" {
+				return errors.New("--public-key and --signature-file are required")
+			}
+			keyData, err := os.ReadFile(publicKey)
+			if err != nil {
+				return fmt.Errorf("unable to read the public key: %w", err)
+			}
+			key, err := token.ParsePublicKey(keyData)
+			if err != nil {
+				return fmt.Errorf("unable to parse the public key in %s: %w", publicKey, err)
+			}
+			signature, err := os.ReadFile(signatureFile)
+			if err != nil {
+				return fmt.Errorf("unable to read the signature: %w", err)
+			}
+			var payload []byte
+			if file == "-" {
+				payload, err = io.ReadAll(c.InOrStdin())
+			} else {
+				payload, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return fmt.Errorf("unable to read the ExecCredential: %w", err)
+			}
+
+			if err := token.VerifyExecCredential(payload, string(signature), key); err != nil {
+				return err
+			}
+			kid, err := token.GetKeyID(key)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.OutOrStdout(), "signature is valid, signed by key %s\n", kid)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", file, "file of the ExecCredential written by get-token. - reads standard input")
+	cmd.Flags().StringVar(&publicKey, "public-key", publicKey, "file of the PEM public key, certificate, or private key of --sign-key")
+	cmd.Flags().StringVar(&signatureFile, "signature-file", signatureFile, "file of the signature written by get-token with --signature-file")
+	return cmd
+}
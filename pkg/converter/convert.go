@@ -1,7 +1,9 @@
 package converter
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/Azure/kubelogin/pkg/token"
@@ -17,37 +19,93 @@ const (
 	cfgEnvironment    = "environment"
 	cfgConfigMode     = "config-mode"
 
-	argClientID           = "--client-id"
-	argServerID           = "--server-id"
-	argTenantID           = "--tenant-id"
-	argEnvironment        = "--environment"
-	argClientSecret       = "--client-secret"
-	argClientCert         = "--client-certificate"
-	argClientCertPassword = "--client-certificate-password"
-	argIsLegacy           = "--legacy"
-	argUsername           = "--username"
-	argPassword           = "--password"
-	argLoginMethod        = "--login"
-	argIdentityResourceID = "--identity-resource-id"
-	argAuthorityHost      = "--authority-host"
-	argFederatedTokenFile = "--federated-token-file"
-	argTokenCacheDir      = "--token-cache-dir"
-
-	flagClientID           = "client-id"
-	flagServerID           = "server-id"
-	flagTenantID           = "tenant-id"
-	flagEnvironment        = "environment"
-	flagClientSecret       = "client-secret"
-	flagClientCert         = "client-certificate"
-	flagClientCertPassword = "client-certificate-password"
-	flagIsLegacy           = "legacy"
-	flagUsername           = "username"
-	flagPassword           = "password"
-	flagLoginMethod        = "login"
-	flagIdentityResourceID = "identity-resource-id"
-	flagAuthorityHost      = "authority-host"
-	flagFederatedTokenFile = "federated-token-file"
-	flagTokenCacheDir      = "token-cache-dir"
+	argClientID               = "--client-id"
+	argServerID               = "--server-id"
+	argTenantID               = "--tenant-id"
+	argEnvironment            = "--environment"
+	argClientSecret           = "--client-secret"
+	argClientCert             = "--client-certificate"
+	argClientCertPassword     = "--client-certificate-password"
+	argSendCertChain          = "--send-certificate-chain"
+	argMTLSPoP                = "--mtls-pop"
+	argIsLegacy               = "--legacy"
+	argLegacyAudience         = "--legacy-audience"
+	argUsername               = "--username"
+	argPassword               = "--password"
+	argLoginMethod            = "--login"
+	argIdentityResourceID     = "--identity-resource-id"
+	argAuthorityHost          = "--authority-host"
+	argFederatedTokenFile     = "--federated-token-file"
+	argTokenCacheDir          = "--token-cache-dir"
+	argOpenBrowser            = "--open-browser"
+	argNMIEndpoint            = "--nmi-endpoint"
+	argTokenPrefix            = "--token-prefix"
+	argTokenType              = "--token-type"
+	argTimeout                = "--timeout"
+	argReuseRefreshToken      = "--reuse-refresh-token-across-audiences"
+	argTrustJWTExp            = "--trust-jwt-exp"
+	argMaxCacheAge            = "--max-cache-age"
+	argTokenCacheReadOnly     = "--token-cache-read-only"
+	argDeviceCodePollInterval = "--device-code-poll-interval"
+	argDeviceCodeTimeout      = "--device-code-timeout"
+	argSudoCacheBehavior      = "--sudo-cache-behavior"
+	argTLSCADir               = "--tls-ca-dir"
+	argAzureRegion            = "--azure-region"
+	argShowClaims             = "--show-claims"
+	argRulesFile              = "--rules-file"
+	argCacheAzureCLIToken     = "--cache-azurecli-token"
+	argAzureCLIUseAzidentity  = "--azurecli-use-azidentity"
+	argPolicy                 = "--policy"
+	argExpiryJitter           = "--expiry-jitter"
+	argB2CPolicy              = "--b2c-policy"
+	argFailFast               = "--fail-fast"
+	argSignKey                = "--sign-key"
+	argSignatureFile          = "--signature-file"
+	argAccountAlias           = "--account-alias"
+
+	flagClientID               = "client-id"
+	flagServerID               = "server-id"
+	flagTenantID               = "tenant-id"
+	flagEnvironment            = "environment"
+	flagClientSecret           = "client-secret"
+	flagClientCert             = "client-certificate"
+	flagClientCertPassword     = "client-certificate-password"
+	flagSendCertChain          = "send-certificate-chain"
+	flagMTLSPoP                = "mtls-pop"
+	flagIsLegacy               = "legacy"
+	flagLegacyAudience         = "legacy-audience"
+	flagUsername               = "username"
+	flagPassword               = "password"
+	flagLoginMethod            = "login"
+	flagIdentityResourceID     = "identity-resource-id"
+	flagAuthorityHost          = "authority-host"
+	flagFederatedTokenFile     = "federated-token-file"
+	flagTokenCacheDir          = "token-cache-dir"
+	flagOpenBrowser            = "open-browser"
+	flagNMIEndpoint            = "nmi-endpoint"
+	flagTokenPrefix            = "token-prefix"
+	flagTokenType              = "token-type"
+	flagTimeout                = "timeout"
+	flagReuseRefreshToken      = "reuse-refresh-token-across-audiences"
+	flagTrustJWTExp            = "trust-jwt-exp"
+	flagMaxCacheAge            = "max-cache-age"
+	flagTokenCacheReadOnly     = "token-cache-read-only"
+	flagDeviceCodePollInterval = "device-code-poll-interval"
+	flagDeviceCodeTimeout      = "device-code-timeout"
+	flagSudoCacheBehavior      = "sudo-cache-behavior"
+	flagTLSCADir               = "tls-ca-dir"
+	flagAzureRegion            = "azure-region"
+	flagShowClaims             = "show-claims"
+	flagRulesFile              = "rules-file"
+	flagCacheAzureCLIToken     = "cache-azurecli-token"
+	flagAzureCLIUseAzidentity  = "azurecli-use-azidentity"
+	flagPolicy                 = "policy"
+	flagExpiryJitter           = "expiry-jitter"
+	flagB2CPolicy              = "b2c-policy"
+	flagFailFast               = "fail-fast"
+	flagSignKey                = "sign-key"
+	flagSignatureFile          = "signature-file"
+	flagAccountAlias           = "account-alias"
 
 	execName        = "kubelogin"
 	getTokenCommand = "get-token"
@@ -143,190 +201,374 @@ func isExecUsingkubelogin(authInfoPtr *api.AuthInfo) (ok bool) {
 	return strings.Contains(lowerc, "kubelogin")
 }
 
+// Convert converts the users using legacy azure auth or kubelogin in the kubeconfig files of pathOptions,
+// preserving the comments and key order of the files
 func Convert(o Options, pathOptions *clientcmd.PathOptions) error {
-	config, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	for _, file := range pathOptions.GetLoadingPrecedence() {
+		if err := convertFile(o, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertFile(o Options, file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("unable to load kubeconfig: %s", err)
+		return fmt.Errorf("unable to read kubeconfig: %w", err)
+	}
+	converted, ok, err := convertKubeconfig(o, data)
+	if err != nil || !ok {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.WriteFile(file, converted, mode); err != nil {
+		return fmt.Errorf("unable to write kubeconfig: %w", err)
+	}
+	return nil
+}
+
+// getExecConfig returns the exec config running kubelogin get-token for the options,
+// with values not set by flags taken from the existing auth info
+func getExecConfig(o Options, authInfo *api.AuthInfo) (*api.ExecConfig, error) {
+	argServerIDVal, argClientIDVal, argEnvironmentVal, argTenantIDVal, argTokenCacheDirVal, isLegacyConfigMode := getArgValues(o, authInfo)
+	exec := &api.ExecConfig{
+		Command: execName,
+		Args: []string{
+			getTokenCommand,
+		},
+		APIVersion: execAPIVersion,
+	}
+
+	exec.Args = append(exec.Args, argLoginMethod, o.TokenOptions.LoginMethod)
+
+	// all login methods require --server-id specified
+	if argServerIDVal == "" {
+		return nil, fmt.Errorf("%s is required", argServerID)
+	}
+	exec.Args = append(exec.Args, argServerID, argServerIDVal)
+
+	if argTokenCacheDirVal != "" {
+		exec.Args = append(exec.Args, argTokenCacheDir, argTokenCacheDirVal)
+	}
+
+	if o.isSet(flagTokenPrefix) {
+		exec.Args = append(exec.Args, argTokenPrefix, o.TokenOptions.TokenPrefix)
+	}
+
+	if o.isSet(flagTimeout) {
+		exec.Args = append(exec.Args, argTimeout, o.TokenOptions.Timeout.String())
+	}
+
+	if o.isSet(flagTrustJWTExp) && o.TokenOptions.TrustJWTExp {
+		exec.Args = append(exec.Args, argTrustJWTExp)
+	}
+
+	if o.isSet(flagMaxCacheAge) {
+		exec.Args = append(exec.Args, argMaxCacheAge, o.TokenOptions.MaxCacheAge.String())
+	}
+
+	if o.isSet(flagTokenCacheReadOnly) && o.TokenOptions.TokenCacheReadOnly {
+		exec.Args = append(exec.Args, argTokenCacheReadOnly)
+	}
+
+	if o.isSet(flagSudoCacheBehavior) {
+		exec.Args = append(exec.Args, argSudoCacheBehavior, o.TokenOptions.SudoCacheBehavior)
+	}
+
+	if o.isSet(flagTLSCADir) {
+		exec.Args = append(exec.Args, argTLSCADir, o.TokenOptions.TLSCADir)
+	}
+
+	if o.isSet(flagAzureRegion) {
+		exec.Args = append(exec.Args, argAzureRegion, o.TokenOptions.AzureRegion)
+	}
+
+	if o.isSet(flagShowClaims) && o.TokenOptions.ShowClaims {
+		exec.Args = append(exec.Args, argShowClaims)
+	}
+
+	if o.isSet(flagRulesFile) {
+		exec.Args = append(exec.Args, argRulesFile, o.TokenOptions.RulesFile)
+		// the rules are matched against the API server, which kubectl only passes with provideClusterInfo
+		exec.ProvideClusterInfo = true
+	}
+
+	if o.isSet(flagCacheAzureCLIToken) && o.TokenOptions.CacheAzureCLIToken {
+		exec.Args = append(exec.Args, argCacheAzureCLIToken)
+	}
+
+	if o.isSet(flagAzureCLIUseAzidentity) && o.TokenOptions.AzureCLIUseAzidentity {
+		exec.Args = append(exec.Args, argAzureCLIUseAzidentity)
+	}
+
+	if o.isSet(flagPolicy) {
+		exec.Args = append(exec.Args, argPolicy, o.TokenOptions.Policy)
+	}
+
+	if o.isSet(flagExpiryJitter) {
+		exec.Args = append(exec.Args, argExpiryJitter, o.TokenOptions.ExpiryJitter.String())
 	}
 
-	for _, authInfo := range config.AuthInfos {
+	if o.isSet(flagFailFast) && o.TokenOptions.FailFast {
+		exec.Args = append(exec.Args, argFailFast)
+	}
+
+	if o.isSet(flagSignKey) {
+		exec.Args = append(exec.Args, argSignKey, o.TokenOptions.SignKey)
+	}
+
+	if o.isSet(flagSignatureFile) {
+		exec.Args = append(exec.Args, argSignatureFile, o.TokenOptions.SignatureFile)
+	}
 
-		//  is it legacy aad auth or is it exec using kubelogin?
-		if !isExecUsingkubelogin(authInfo) && !isLegacyAzureAuth(authInfo) {
-			continue
+	if o.isSet(flagAccountAlias) {
+		exec.Args = append(exec.Args, argAccountAlias, o.TokenOptions.AccountAlias)
+	}
+
+	switch o.TokenOptions.LoginMethod {
+	case token.AzureCLILogin:
+
+		// when convert to azurecli login, tenantID from the input kubeconfig will be disregarded and
+		// will have to come from explicit flag `--tenant-id`.
+		// this is because azure cli logged in using MSI does not allow specifying tenant ID
+		// see https://github.com/Azure/kubelogin/issues/123#issuecomment-1209652342
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
 		}
-		argServerIDVal, argClientIDVal, argEnvironmentVal, argTenantIDVal, argTokenCacheDirVal, isLegacyConfigMode := getArgValues(o, authInfo)
-		exec := &api.ExecConfig{
-			Command: execName,
-			Args: []string{
-				getTokenCommand,
-			},
-			APIVersion: execAPIVersion,
+
+	case token.DeviceCodeLogin:
+
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
 		}
 
-		exec.Args = append(exec.Args, argLoginMethod, o.TokenOptions.LoginMethod)
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-		// all login methods require --server-id specified
-		if argServerIDVal == "" {
-			return fmt.Errorf("%s is required", argServerID)
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
 		}
-		exec.Args = append(exec.Args, argServerID, argServerIDVal)
 
-		if argTokenCacheDirVal != "" {
-			exec.Args = append(exec.Args, argTokenCacheDir, argTokenCacheDirVal)
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+
+		if argEnvironmentVal != "" {
+			// environment is optional
+			exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
 		}
 
-		switch o.TokenOptions.LoginMethod {
-		case token.AzureCLILogin:
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
 
-			// when convert to azurecli login, tenantID from the input kubeconfig will be disregarded and
-			// will have to come from explicit flag `--tenant-id`.
-			// this is because azure cli logged in using MSI does not allow specifying tenant ID
-			// see https://github.com/Azure/kubelogin/issues/123#issuecomment-1209652342
-			if o.isSet(flagTenantID) {
-				exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
-			}
+		if o.isSet(flagLegacyAudience) {
+			exec.Args = append(exec.Args, argLegacyAudience, o.TokenOptions.LegacyAudience)
+		}
 
-		case token.DeviceCodeLogin:
+		if o.isSet(flagOpenBrowser) && o.TokenOptions.OpenBrowser {
+			exec.Args = append(exec.Args, argOpenBrowser)
+		}
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+		if o.isSet(flagDeviceCodePollInterval) {
+			exec.Args = append(exec.Args, argDeviceCodePollInterval, o.TokenOptions.DeviceCodePollInterval.String())
+		}
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		if o.isSet(flagDeviceCodeTimeout) {
+			exec.Args = append(exec.Args, argDeviceCodeTimeout, o.TokenOptions.DeviceCodeTimeout.String())
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+		if o.isSet(flagTokenType) {
+			exec.Args = append(exec.Args, argTokenType, o.TokenOptions.TokenType)
+		}
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		if o.isSet(flagReuseRefreshToken) && o.TokenOptions.ReuseRefreshToken {
+			exec.Args = append(exec.Args, argReuseRefreshToken)
+		}
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		if o.isSet(flagB2CPolicy) {
+			exec.Args = append(exec.Args, argB2CPolicy, o.TokenOptions.B2CPolicy)
+			if o.isSet(flagAuthorityHost) {
+				exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
 			}
+		}
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+	case token.InteractiveLogin:
 
-		case token.InteractiveLogin:
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		if argEnvironmentVal != "" {
+			// environment is optional
+			exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		}
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		if o.isSet(flagB2CPolicy) {
+			exec.Args = append(exec.Args, argB2CPolicy, o.TokenOptions.B2CPolicy)
+			if o.isSet(flagAuthorityHost) {
+				exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
 			}
+		}
 
-		case token.ServicePrincipalLogin:
+	case token.ServicePrincipalLogin:
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		if argEnvironmentVal != "" {
+			// environment is optional
+			exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		}
 
-			if o.isSet(flagClientSecret) {
-				exec.Args = append(exec.Args, argClientSecret, o.TokenOptions.ClientSecret)
-			}
+		if o.isSet(flagClientSecret) {
+			exec.Args = append(exec.Args, argClientSecret, o.TokenOptions.ClientSecret)
+		}
 
-			if o.isSet(flagClientCert) {
-				exec.Args = append(exec.Args, argClientCert, o.TokenOptions.ClientCert)
-			}
+		if o.isSet(flagClientCert) {
+			exec.Args = append(exec.Args, argClientCert, o.TokenOptions.ClientCert)
+		}
 
-			if o.isSet(flagClientCertPassword) {
-				exec.Args = append(exec.Args, argClientCertPassword, o.TokenOptions.ClientCertPassword)
-			}
+		if o.isSet(flagClientCertPassword) {
+			exec.Args = append(exec.Args, argClientCertPassword, o.TokenOptions.ClientCertPassword)
+		}
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+		if o.isSet(flagSendCertChain) && o.TokenOptions.SendCertificateChain {
+			exec.Args = append(exec.Args, argSendCertChain)
+		}
 
-		case token.MSILogin:
+		if o.isSet(flagMTLSPoP) && o.TokenOptions.MTLSPoP {
+			exec.Args = append(exec.Args, argMTLSPoP)
+		}
 
-			if o.isSet(flagClientID) {
-				exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
-			} else if o.isSet(flagIdentityResourceID) {
-				exec.Args = append(exec.Args, argIdentityResourceID, o.TokenOptions.IdentityResourceID)
-			}
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
 
-		case token.ROPCLogin:
+		if o.isSet(flagLegacyAudience) {
+			exec.Args = append(exec.Args, argLegacyAudience, o.TokenOptions.LegacyAudience)
+		}
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+	case token.MSILogin:
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		} else if o.isSet(flagIdentityResourceID) {
+			exec.Args = append(exec.Args, argIdentityResourceID, o.TokenOptions.IdentityResourceID)
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+	case token.NMILogin:
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		}
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		if o.isSet(flagNMIEndpoint) {
+			exec.Args = append(exec.Args, argNMIEndpoint, o.TokenOptions.NMIEndpoint)
+		}
 
-			if o.isSet(flagUsername) {
-				exec.Args = append(exec.Args, argUsername, o.TokenOptions.Username)
-			}
+	case token.ROPCLogin:
 
-			if o.isSet(flagPassword) {
-				exec.Args = append(exec.Args, argPassword, o.TokenOptions.Password)
-			}
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-		case token.WorkloadIdentityLogin:
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			if o.isSet(flagClientID) {
-				exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
-			}
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-			if o.isSet(flagTenantID) {
-				exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
-			}
+		if argEnvironmentVal != "" {
+			// environment is optional
+			exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		}
 
-			if o.isSet(flagAuthorityHost) {
-				exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
-			}
+		if o.isSet(flagUsername) {
+			exec.Args = append(exec.Args, argUsername, o.TokenOptions.Username)
+		}
 
-			if o.isSet(flagFederatedTokenFile) {
-				exec.Args = append(exec.Args, argFederatedTokenFile, o.TokenOptions.FederatedTokenFile)
-			}
+		if o.isSet(flagPassword) {
+			exec.Args = append(exec.Args, argPassword, o.TokenOptions.Password)
+		}
+
+		if o.isSet(flagTokenType) {
+			exec.Args = append(exec.Args, argTokenType, o.TokenOptions.TokenType)
+		}
+
+		if o.isSet(flagReuseRefreshToken) && o.TokenOptions.ReuseRefreshToken {
+			exec.Args = append(exec.Args, argReuseRefreshToken)
+		}
+
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
+
+		if o.isSet(flagLegacyAudience) {
+			exec.Args = append(exec.Args, argLegacyAudience, o.TokenOptions.LegacyAudience)
 		}
 
-		authInfo.Exec = exec
-		authInfo.AuthProvider = nil
+	case token.WorkloadIdentityLogin:
+
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		}
+
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		}
+
+		if o.isSet(flagAuthorityHost) {
+			exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
+		}
+
+		if o.isSet(flagFederatedTokenFile) {
+			exec.Args = append(exec.Args, argFederatedTokenFile, o.TokenOptions.FederatedTokenFile)
+		}
+
+	case token.CloudShellLogin:
+
+		// the token of the Cloud Shell user is returned, which takes no options
+
+	default:
+
+		// login plugins receive the client ID, tenant ID, and environment in the login request
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		}
+
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		}
+
+		if argEnvironmentVal != "" {
+			exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
+		}
 	}
-	err = clientcmd.ModifyConfig(pathOptions, config, true)
-	return err
+	return exec, nil
 }
 
 // get the item in Exec.Args[] right after someArg
@@ -60,6 +60,294 @@ func TestConvert(t *testing.T) {
 				argLoginMethod, token.MSILogin,
 			},
 		},
+		{
+			name: "using legacy azure auth to convert to azurecli with token-prefix and timeout",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagTokenPrefix: "Pomerium-",
+				flagTimeout:     "1m",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argTokenPrefix, "Pomerium-",
+				argTimeout, "1m0s",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with tls-ca-dir",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagTLSCADir:    "/etc/kubelogin/ca.d",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argTLSCADir, "/etc/kubelogin/ca.d",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with rules-file",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagRulesFile:   "/etc/kubelogin/rules.yaml",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argRulesFile, "/etc/kubelogin/rules.yaml",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with policy",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagPolicy:      "claims.tid == tenantID",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argPolicy, "claims.tid == tenantID",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with expiry-jitter",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:  token.AzureCLILogin,
+				flagExpiryJitter: "5m",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argExpiryJitter, "5m0s",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with fail-fast",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagFailFast:    "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argFailFast,
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with sign-key and signature-file",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:   token.AzureCLILogin,
+				flagSignKey:       "/etc/kubelogin/key.pem",
+				flagSignatureFile: "/run/kubelogin/cred.jws",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argSignKey, "/etc/kubelogin/key.pem",
+				argSignatureFile, "/run/kubelogin/cred.jws",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with account-alias",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:  token.AzureCLILogin,
+				flagAccountAlias: "work",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argAccountAlias, "work",
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with show-claims",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagShowClaims:  "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argShowClaims,
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with cache-azurecli-token",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:        token.AzureCLILogin,
+				flagCacheAzureCLIToken: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argCacheAzureCLIToken,
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to azurecli with azurecli-use-azidentity",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:           token.AzureCLILogin,
+				flagAzureCLIUseAzidentity: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argAzureCLIUseAzidentity,
+				argLoginMethod, token.AzureCLILogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to spn with azure-region",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.ServicePrincipalLogin,
+				flagAzureRegion: "westus2",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argLoginMethod, token.ServicePrincipalLogin,
+				argServerID, serverID,
+				argAzureRegion, "westus2",
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argIsLegacy,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to cloudshell",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.CloudShellLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argLoginMethod, token.CloudShellLogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to nmi with nmi-endpoint",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.NMILogin,
+				flagClientID:    "pod-identity-client-id",
+				flagNMIEndpoint: "http://127.0.0.1:2579",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, "pod-identity-client-id",
+				argNMIEndpoint, "http://127.0.0.1:2579",
+				argLoginMethod, token.NMILogin,
+			},
+		},
 		{
 			name: "using legacy azure auth to convert to msi with client-id override",
 			authProviderConfig: map[string]string{
@@ -124,6 +412,29 @@ func TestConvert(t *testing.T) {
 				argLoginMethod, token.WorkloadIdentityLogin,
 			},
 		},
+		{
+			name: "using legacy azure auth to convert to a login plugin",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "0",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: "file",
+				flagClientID:    spClientID,
+				flagTenantID:    tenantID,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, spClientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argLoginMethod, "file",
+			},
+		},
 		{
 			name: "using legacy azure auth to convert to spn without setting environment",
 			authProviderConfig: map[string]string{
@@ -218,6 +529,32 @@ func TestConvert(t *testing.T) {
 				argLoginMethod, token.ServicePrincipalLogin,
 			},
 		},
+		{
+			name: "using legacy azure auth to convert to spn with clientCert and certificate chain",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:   token.ServicePrincipalLogin,
+				flagClientID:      spClientID,
+				flagClientCert:    clientCert,
+				flagSendCertChain: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, spClientID,
+				argClientCert, clientCert,
+				argSendCertChain,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argLoginMethod, token.ServicePrincipalLogin,
+			},
+		},
 		{
 			name: "using legacy azure auth to convert to ropc",
 			authProviderConfig: map[string]string{
@@ -353,6 +690,125 @@ func TestConvert(t *testing.T) {
 				argLoginMethod, loginMethod,
 			},
 		},
+		{
+			name: "using legacy azure auth to convert to devicecode with --legacy-audience",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:    loginMethod,
+				flagLegacyAudience: token.LegacyAudienceAuto,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argEnvironment, envName,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLegacyAudience, token.LegacyAudienceAuto,
+				argLoginMethod, loginMethod,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to devicecode with --token-type id",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: loginMethod,
+				flagTokenType:   token.TokenTypeID,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argEnvironment, envName,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argTokenType, token.TokenTypeID,
+				argLoginMethod, loginMethod,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to devicecode with --open-browser",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: loginMethod,
+				flagOpenBrowser: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argEnvironment, envName,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argOpenBrowser,
+				argLoginMethod, loginMethod,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to devicecode with --device-code-poll-interval and --device-code-timeout",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:            loginMethod,
+				flagDeviceCodePollInterval: "10s",
+				flagDeviceCodeTimeout:      "1h",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argEnvironment, envName,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argDeviceCodePollInterval, "10s",
+				argDeviceCodeTimeout, "1h0m0s",
+				argLoginMethod, loginMethod,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to devicecode with --b2c-policy and --authority-host",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:   loginMethod,
+				flagB2CPolicy:     "B2C_1A_signin",
+				flagAuthorityHost: "https://login.contoso.com/",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argEnvironment, envName,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argB2CPolicy, "B2C_1A_signin",
+				argAuthorityHost, "https://login.contoso.com/",
+				argLoginMethod, loginMethod,
+			},
+		},
 		{
 			name: "using legacy azure auth with configMode: \"1\" to convert to devicecode with --legacy",
 			authProviderConfig: map[string]string{
@@ -1067,6 +1523,9 @@ func TestConvert(t *testing.T) {
 				data.authProviderConfig,
 				data.execArgItems,
 			)
+			if err := clientcmd.WriteToFile(*config, kubeconfigFile); err != nil {
+				t.Fatalf("unable to write kubeconfig: %s", err)
+			}
 			fs := &pflag.FlagSet{}
 			o := Options{
 				Flags: fs,
@@ -1092,7 +1551,11 @@ func TestConvert(t *testing.T) {
 				t.Fatalf("Unexpected error from Convert: %v", err)
 			}
 
-			validate(t, config.AuthInfos[clusterName], data.authProviderConfig, data.expectedArgs)
+			converted, err := clientcmd.LoadFromFile(kubeconfigFile)
+			if err != nil {
+				t.Fatalf("unable to load converted kubeconfig: %s", err)
+			}
+			validate(t, converted.AuthInfos[clusterName], data.authProviderConfig, data.expectedArgs)
 		})
 	}
 }
@@ -1172,6 +1635,10 @@ func validate(
 	if exec.Args[0] != getTokenCommand {
 		t.Fatalf("expected %s as first argument. actual: %s", getTokenCommand, exec.Args[0])
 	}
+	expectedProvideClusterInfo := contains(expectedArgs, argRulesFile)
+	if exec.ProvideClusterInfo != expectedProvideClusterInfo {
+		t.Fatalf("expected provideClusterInfo: %t, actual: %t", expectedProvideClusterInfo, exec.ProvideClusterInfo)
+	}
 	if len(exec.Args) != len(expectedArgs) {
 		t.Fatalf("expected exec args: %v, actual: %v", expectedArgs, exec.Args)
 	}
@@ -0,0 +1,107 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// ClusterList is the list of the clusters generate-kubeconfig writes kubeconfig for
+type ClusterList struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+// Cluster is either an AKS cluster of an ARM resource ID, or an API server with its CA
+type Cluster struct {
+	// Name is the name of the cluster, context, and user entries. It defaults to the name of the AKS cluster resource.
+	Name string `json:"name,omitempty"`
+	// ID is the ARM resource ID of an AKS cluster, whose API server and CA are looked up in Azure Resource Manager
+	ID string `json:"id,omitempty"`
+	// Server is the address of the API server, when ID is not set
+	Server string `json:"server,omitempty"`
+	// CertificateAuthorityData is the base64 encoded CA of the API server, as in kubeconfig
+	CertificateAuthorityData []byte `json:"certificateAuthorityData,omitempty"`
+	// Namespace is the default namespace of the context
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// lookupAKSCluster looks up the API server and the CA of an AKS cluster, replaced in tests
+var lookupAKSCluster = token.GetAKSCluster
+
+// LoadClusterList reads the list of clusters in YAML or JSON from file, or from standard input when file is StdinStdout
+func LoadClusterList(file string, stdin io.Reader) (ClusterList, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if file == StdinStdout {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return ClusterList{}, fmt.Errorf("unable to read cluster list: %w", err)
+	}
+	var list ClusterList
+	if err := yaml.UnmarshalStrict(data, &list); err != nil {
+		return ClusterList{}, fmt.Errorf("unable to parse cluster list %s: %w", file, err)
+	}
+	return list, nil
+}
+
+// GenerateKubeconfig writes a kubeconfig with a cluster, a context, and a user running kubelogin get-token
+// with the login options for each of the clusters. The current context is the one of the first cluster.
+func GenerateKubeconfig(ctx context.Context, o Options, list ClusterList, w io.Writer) error {
+	if len(list.Clusters) == 0 {
+		return errors.New("the cluster list has no cluster")
+	}
+	exec, err := getExecConfig(o, &api.AuthInfo{})
+	if err != nil {
+		return err
+	}
+
+	config := api.NewConfig()
+	for i, c := range list.Clusters {
+		switch {
+		case c.ID != "" && c.Server != "":
+			return fmt.Errorf("cluster %d cannot have both id and server", i)
+		case c.ID != "":
+			aks, err := lookupAKSCluster(ctx, &o.TokenOptions, c.ID)
+			if err != nil {
+				return fmt.Errorf("unable to look up cluster %s: %w", c.ID, err)
+			}
+			if c.Name == "" {
+				c.Name = aks.Name
+			}
+			c.Server, c.CertificateAuthorityData = aks.Server, aks.CertificateAuthorityData
+		case c.Server == "":
+			return fmt.Errorf("cluster %d requires either id or server", i)
+		case c.Name == "":
+			return fmt.Errorf("cluster %s requires a name", c.Server)
+		}
+		if _, ok := config.Clusters[c.Name]; ok {
+			return fmt.Errorf("cluster name %s is used more than once", c.Name)
+		}
+
+		config.Clusters[c.Name] = &api.Cluster{Server: c.Server, CertificateAuthorityData: c.CertificateAuthorityData}
+		config.AuthInfos[c.Name] = &api.AuthInfo{Exec: exec.DeepCopy()}
+		config.Contexts[c.Name] = &api.Context{Cluster: c.Name, AuthInfo: c.Name, Namespace: c.Namespace}
+		if i == 0 {
+			config.CurrentContext = c.Name
+		}
+	}
+
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return fmt.Errorf("unable to marshal kubeconfig: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
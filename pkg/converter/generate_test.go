@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const aksClusterID = "/subscriptions/sub/resourceGroups/group/providers/Microsoft.ContainerService/managedClusters/aks1"
+
+func TestGenerateKubeconfig(t *testing.T) {
+	lookupAKSCluster = func(ctx context.Context, o *token.Options, resourceID string) (token.AKSCluster, error) {
+		if resourceID != aksClusterID {
+			return token.AKSCluster{}, errors.New("not found")
+		}
+		return token.AKSCluster{Name: "aks1", Server: "https://aks1.hcp.eastus.azmk8s.io:443", CertificateAuthorityData: []byte("ca1")}, nil
+	}
+	t.Cleanup(func() { lookupAKSCluster = token.GetAKSCluster })
+
+	testData := []struct {
+		name          string
+		list          string
+		expectedError string
+	}{
+		{
+			name: "clusters by ARM ID and by server should be generated",
+			list: `clusters:
+- id: ` + aksClusterID + `
+- name: onprem
+  server: https://onprem.example.com:6443
+  certificateAuthorityData: Y2Ey
+  namespace: dev
+`,
+		},
+		{
+			name:          "empty list should fail",
+			list:          "clusters: []\n",
+			expectedError: "the cluster list has no cluster",
+		},
+		{
+			name:          "cluster without id or server should fail",
+			list:          "clusters:\n- name: a\n",
+			expectedError: "cluster 0 requires either id or server",
+		},
+		{
+			name:          "cluster without name should fail",
+			list:          "clusters:\n- server: https://a\n",
+			expectedError: "cluster https://a requires a name",
+		},
+		{
+			name:          "duplicate names should fail",
+			list:          "clusters:\n- id: " + aksClusterID + "\n- name: aks1\n  server: https://a\n",
+			expectedError: "cluster name aks1 is used more than once",
+		},
+		{
+			name:          "failure of the lookup should be returned",
+			list:          "clusters:\n- id: /subscriptions/missing\n",
+			expectedError: "unable to look up cluster /subscriptions/missing: not found",
+		},
+		{
+			name:          "unknown fields should fail",
+			list:          "clusters:\n- name: a\n  sever: https://a\n",
+			expectedError: `unknown field "sever"`,
+		},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "clusters.yaml")
+			if err := os.WriteFile(file, []byte(data.list), 0600); err != nil {
+				t.Fatalf("unable to write file: %s", err)
+			}
+			fs := &pflag.FlagSet{}
+			o := Options{Flags: fs}
+			o.AddFlags(fs)
+			_ = o.setFlag(flagLoginMethod, token.WorkloadIdentityLogin)
+			_ = o.setFlag(flagServerID, "serverID")
+
+			buf := &bytes.Buffer{}
+			list, err := LoadClusterList(file, nil)
+			if err == nil {
+				err = GenerateKubeconfig(context.Background(), o, list, buf)
+			}
+			if data.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), data.expectedError) {
+					t.Fatalf("expected error: %s, actual: %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			config, err := clientcmd.Load(buf.Bytes())
+			if err != nil {
+				t.Fatalf("unable to load the generated kubeconfig: %s", err)
+			}
+			if config.CurrentContext != "aks1" || len(config.Contexts) != 2 {
+				t.Fatalf("unexpected contexts: %s, %v", config.CurrentContext, config.Contexts)
+			}
+			if c := config.Clusters["aks1"]; c.Server != "https://aks1.hcp.eastus.azmk8s.io:443" || string(c.CertificateAuthorityData) != "ca1" {
+				t.Fatalf("unexpected cluster aks1: %+v", c)
+			}
+			if c := config.Clusters["onprem"]; c.Server != "https://onprem.example.com:6443" || string(c.CertificateAuthorityData) != "ca2" {
+				t.Fatalf("unexpected cluster onprem: %+v", c)
+			}
+			if ctx := config.Contexts["onprem"]; ctx.Cluster != "onprem" || ctx.AuthInfo != "onprem" || ctx.Namespace != "dev" {
+				t.Fatalf("unexpected context onprem: %+v", ctx)
+			}
+			expectedArgs := "get-token --login workloadidentity --server-id serverID"
+			for name, user := range config.AuthInfos {
+				if user.Exec == nil || user.Exec.Command != execName || strings.Join(user.Exec.Args, " ") != expectedArgs {
+					t.Fatalf("unexpected exec config of user %s: %+v", name, user.Exec)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// StdinStdout is the kubeconfig path reading the kubeconfig from standard input and writing it to standard output
+	StdinStdout = "-"
+
+	yamlIndent = 2
+)
+
+// ConvertStream converts the kubeconfig read from r and writes it to w, for pipelines such as
+// az aks get-credentials -f - | kubelogin convert-kubeconfig --kubeconfig - > kubeconfig
+func ConvertStream(o Options, r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to read kubeconfig: %w", err)
+	}
+	converted, _, err := convertKubeconfig(o, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(converted)
+	return err
+}
+
+// convertKubeconfig converts the users of the kubeconfig in data using legacy azure auth or kubelogin to the exec config of the options.
+// The kubeconfig is edited as YAML nodes, so that the comments, key order, and values of the other entries are preserved.
+// data is returned as is, and the bool is false, when there is no user to convert.
+func convertKubeconfig(o Options, data []byte) ([]byte, bool, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to load kubeconfig: %s", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, false, fmt.Errorf("unable to parse kubeconfig: %w", err)
+	}
+	if len(root.Content) == 0 {
+		return data, false, nil
+	}
+
+	converted := false
+	users := mappingValue(root.Content[0], "users")
+	if users == nil || users.Kind != yaml.SequenceNode {
+		return data, false, nil
+	}
+	for _, user := range users.Content {
+		name := mappingValue(user, "name")
+		if name == nil {
+			continue
+		}
+		authInfo := config.AuthInfos[name.Value]
+		//  is it legacy aad auth or is it exec using kubelogin?
+		if !isExecUsingkubelogin(authInfo) && !isLegacyAzureAuth(authInfo) {
+			continue
+		}
+		exec, err := getExecConfig(o, authInfo)
+		if err != nil {
+			return nil, false, err
+		}
+		execNode, err := newExecNode(exec)
+		if err != nil {
+			return nil, false, err
+		}
+		setExecNode(mappingValue(user, "user"), execNode)
+		converted = true
+	}
+	if !converted {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(yamlIndent)
+	if err := e.Encode(&root); err != nil {
+		return nil, false, fmt.Errorf("unable to marshal kubeconfig: %w", err)
+	}
+	if err := e.Close(); err != nil {
+		return nil, false, fmt.Errorf("unable to marshal kubeconfig: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// newExecNode returns the YAML node of exec in the kubeconfig format
+func newExecNode(exec *api.ExecConfig) (*yaml.Node, error) {
+	authInfo := clientcmdapiv1.AuthInfo{}
+	if err := clientcmdapiv1.Convert_api_AuthInfo_To_v1_AuthInfo(&api.AuthInfo{Exec: exec}, &authInfo, nil); err != nil {
+		return nil, fmt.Errorf("unable to convert exec config: %w", err)
+	}
+	data, err := sigsyaml.Marshal(authInfo.Exec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal exec config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse exec config: %w", err)
+	}
+	return doc.Content[0], nil
+}
+
+// setExecNode replaces the exec config and the auth provider of the user mapping with execNode,
+// at the position of the former one
+func setExecNode(user, execNode *yaml.Node) {
+	if user == nil {
+		return
+	}
+	if user.Kind != yaml.MappingNode {
+		// e.g. user: null
+		*user = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	content := make([]*yaml.Node, 0, len(user.Content)+2)
+	set := false
+	for i := 0; i+1 < len(user.Content); i += 2 {
+		key, value := user.Content[i], user.Content[i+1]
+		switch key.Value {
+		case "exec", "auth-provider":
+			if set {
+				continue
+			}
+			key, value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "exec", HeadComment: key.HeadComment}, execNode
+			set = true
+		}
+		content = append(content, key, value)
+	}
+	if !set {
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "exec"}, execNode)
+	}
+	user.Content = content
+}
+
+// mappingValue returns the value of key in the mapping node, or nil when it is not found
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
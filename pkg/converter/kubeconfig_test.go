@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeconfig = `# managed by az aks get-credentials
+apiVersion: v1
+kind: Config
+current-context: aks
+clusters:
+- name: aks
+  cluster:
+    server: https://aks.hcp.eastus.azmk8s.io:443
+contexts:
+- name: aks
+  context:
+    cluster: aks
+    user: clusterUser_aks
+preferences: {}
+users:
+# the user converted to kubelogin
+- name: clusterUser_aks
+  user:
+    auth-provider:
+      name: azure
+      config:
+        apiserver-id: serverID
+        client-id: clientID
+        config-mode: "1"
+        environment: AzurePublicCloud
+        tenant-id: tenantID
+- name: admin
+  user:
+    token: admin-token # not converted
+`
+
+func newTestOptions(t *testing.T, flags map[string]string) Options {
+	fs := &pflag.FlagSet{}
+	o := New()
+	o.Flags = fs
+	o.AddFlags(fs)
+	for k, v := range flags {
+		if err := o.setFlag(k, v); err != nil {
+			t.Fatalf("unable to set flag %s: %s", k, err)
+		}
+	}
+	return o
+}
+
+func TestConvertStream(t *testing.T) {
+	o := newTestOptions(t, map[string]string{flagLoginMethod: token.AzureCLILogin})
+
+	var out bytes.Buffer
+	if err := ConvertStream(o, strings.NewReader(testKubeconfig), &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `# managed by az aks get-credentials
+apiVersion: v1
+kind: Config
+current-context: aks
+clusters:
+  - name: aks
+    cluster:
+      server: https://aks.hcp.eastus.azmk8s.io:443
+contexts:
+  - name: aks
+    context:
+      cluster: aks
+      user: clusterUser_aks
+preferences: {}
+users:
+  # the user converted to kubelogin
+  - name: clusterUser_aks
+    user:
+      exec:
+        apiVersion: client.authentication.k8s.io/v1beta1
+        args:
+          - get-token
+          - --login
+          - azurecli
+          - --server-id
+          - serverID
+        command: kubelogin
+        env: null
+        provideClusterInfo: false
+  - name: admin
+    user:
+      token: admin-token # not converted
+`
+	if out.String() != expected {
+		t.Fatalf("expected kubeconfig:\n%s\nactual:\n%s", expected, out.String())
+	}
+}
+
+func TestConvertStreamWithoutUsersToConvert(t *testing.T) {
+	o := newTestOptions(t, map[string]string{flagLoginMethod: token.AzureCLILogin})
+	input := "apiVersion: v1\nkind: Config\nusers:\n- name: admin\n  user:\n    token: admin-token\n"
+
+	var out bytes.Buffer
+	if err := ConvertStream(o, strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != input {
+		t.Fatalf("expected kubeconfig to be unchanged, actual:\n%s", out.String())
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(file, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	o := newTestOptions(t, map[string]string{flagLoginMethod: token.AzureCLILogin})
+	pathOptions := clientcmd.PathOptions{
+		ExplicitFileFlag: "kubeconfig",
+		LoadingRules:     &clientcmd.ClientConfigLoadingRules{ExplicitPath: file},
+	}
+	if err := Convert(o, &pathOptions); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	config, err := clientcmd.LoadFromFile(file)
+	if err != nil {
+		t.Fatalf("unable to load converted kubeconfig: %s", err)
+	}
+	if config.AuthInfos["clusterUser_aks"].Exec == nil || config.AuthInfos["clusterUser_aks"].AuthProvider != nil {
+		t.Fatal("expected user to be converted to exec plugin")
+	}
+	if config.AuthInfos["admin"].Token != "admin-token" {
+		t.Fatal("expected other users to be kept")
+	}
+}
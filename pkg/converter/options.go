@@ -1,6 +1,8 @@
 package converter
 
 import (
+	"fmt"
+
 	"github.com/Azure/kubelogin/pkg/token"
 	"github.com/spf13/pflag"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -10,6 +12,7 @@ type Options struct {
 	Flags        *pflag.FlagSet
 	configFlags  genericclioptions.RESTClientGetter
 	TokenOptions token.Options
+	Output       string
 }
 
 func stringptr(str string) *string { return &str }
@@ -27,14 +30,21 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 		cf.AddFlags(fs)
 	}
 	o.TokenOptions.AddFlags(fs)
+	fs.StringVarP(&o.Output, "output", "o", o.Output,
+		fmt.Sprintf("instead of modifying kubeconfig, print only the user entry with the exec config for the given flags. Supported values: %s (YAML), %s", OutputExecSnippet, OutputExecSnippetJSON))
 }
 
 func (o *Options) Validate() error {
+	switch o.Output {
+	case "", OutputExecSnippet, OutputExecSnippetJSON:
+	default:
+		return fmt.Errorf("'%s' is not a supported output. Supported output is one of %s, %s", o.Output, OutputExecSnippet, OutputExecSnippetJSON)
+	}
 	return o.TokenOptions.Validate()
 }
 
 func (o *Options) UpdateFromEnv() {
-	o.TokenOptions.UpdateFromEnv()
+	o.TokenOptions.UpdateFromEnvWithFlags(o.Flags)
 }
 
 func (o *Options) isSet(name string) bool {
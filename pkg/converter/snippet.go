@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputExecSnippet     = "exec-snippet"
+	OutputExecSnippetJSON = "exec-snippet-json"
+)
+
+// WriteExecSnippet writes the user entry with the exec config for the options to w, without reading or modifying kubeconfig.
+// All values are taken from flags, so the output is deterministic for the same flags.
+func WriteExecSnippet(o Options, w io.Writer) error {
+	exec, err := getExecConfig(o, &api.AuthInfo{})
+	if err != nil {
+		return err
+	}
+
+	authInfo := clientcmdapiv1.AuthInfo{}
+	if err := clientcmdapiv1.Convert_api_AuthInfo_To_v1_AuthInfo(&api.AuthInfo{Exec: exec}, &authInfo, nil); err != nil {
+		return fmt.Errorf("unable to convert user entry: %w", err)
+	}
+
+	var data []byte
+	switch o.Output {
+	case OutputExecSnippetJSON:
+		data, err = json.MarshalIndent(authInfo, "", "  ")
+		data = append(data, '\n')
+	default:
+		data, err = yaml.Marshal(authInfo)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to marshal user entry: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,99 @@
+package converter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/kubelogin/pkg/token"
+	"github.com/spf13/pflag"
+)
+
+func TestWriteExecSnippet(t *testing.T) {
+	testData := []struct {
+		name           string
+		overrideFlags  map[string]string
+		expectedOutput string
+		expectedError  string
+	}{
+		{
+			name: "yaml output",
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagServerID:    "serverID",
+				"output":        OutputExecSnippet,
+			},
+			expectedOutput: `exec:
+  apiVersion: client.authentication.k8s.io/v1beta1
+  args:
+  - get-token
+  - --login
+  - azurecli
+  - --server-id
+  - serverID
+  command: kubelogin
+  env: null
+  provideClusterInfo: false
+`,
+		},
+		{
+			name: "json output",
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.MSILogin,
+				flagServerID:    "serverID",
+				"output":        OutputExecSnippetJSON,
+			},
+			expectedOutput: `{
+  "exec": {
+    "command": "kubelogin",
+    "args": [
+      "get-token",
+      "--login",
+      "msi",
+      "--server-id",
+      "serverID"
+    ],
+    "env": null,
+    "apiVersion": "client.authentication.k8s.io/v1beta1",
+    "provideClusterInfo": false
+  }
+}
+`,
+		},
+		{
+			name: "missing server id",
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				"output":        OutputExecSnippet,
+			},
+			expectedError: "--server-id is required",
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			fs := &pflag.FlagSet{}
+			o := Options{Flags: fs}
+			o.AddFlags(fs)
+			for k, v := range data.overrideFlags {
+				if err := o.setFlag(k, v); err != nil {
+					t.Fatalf("unable to add flag: %s, err: %s", k, err)
+				}
+			}
+
+			buf := &bytes.Buffer{}
+			err := WriteExecSnippet(o, buf)
+			if data.expectedError != "" {
+				if err == nil || err.Error() != data.expectedError {
+					t.Fatalf("expected error: %s, actual: %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if buf.String() != data.expectedOutput {
+				t.Fatalf("expected output:\n%s\nactual:\n%s", data.expectedOutput, buf.String())
+			}
+		})
+	}
+}
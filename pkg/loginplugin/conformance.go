@@ -0,0 +1,66 @@
+package loginplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// CheckConformance runs the plugin executable at path the same as kubelogin does, and checks that
+//   - it returns a token which has not expired for req, with nothing but the response on standard output
+//   - it fails with the reason in the response for a request of an unsupported protocol version
+//
+// It returns the response to req, so that the token can be checked further.
+func CheckConformance(ctx context.Context, path string, req LoginRequest) (*LoginResponse, error) {
+	req.APIVersion, req.Kind = APIVersion, KindLoginRequest
+	stdout, err := runPlugin(ctx, path, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ParseLoginResponse(stdout)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, fmt.Errorf("the plugin exited successfully without a token: %w", err)
+	}
+	if !resp.ExpiresOn.After(time.Now()) {
+		return nil, fmt.Errorf("the plugin returned a token which expired on %s", resp.ExpiresOn)
+	}
+
+	unsupported := req
+	unsupported.APIVersion = "kubelogin.azure.com/v0"
+	stdout, err = runPlugin(ctx, path, unsupported)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("expected the plugin to exit with non-zero for an unsupported request, got %v", err)
+	}
+	errResp, err := ParseLoginResponse(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("expected the plugin to return the reason for an unsupported request: %w", err)
+	}
+	if errResp.Error == "" || errResp.AccessToken != "" {
+		return nil, fmt.Errorf("expected the plugin to return an error and no token for an unsupported request, got %+v", errResp)
+	}
+	return resp, nil
+}
+
+func runPlugin(ctx context.Context, path string, req LoginRequest) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package loginplugin
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestSampleConformance builds the sample plugin and checks it against the protocol
+func TestSampleConformance(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not on PATH")
+	}
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, BinaryPrefix+"file")
+	if runtime.GOOS == "windows" {
+		plugin += ".exe"
+	}
+	build := exec.Command(goBin, "build", "-o", plugin, "./sample/kubelogin-login-file")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("unable to build the sample plugin: %s: %s", err, output)
+	}
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("token\n"), 0600); err != nil {
+		t.Fatalf("unable to write the token: %s", err)
+	}
+	t.Setenv("KUBELOGIN_LOGIN_FILE_TOKEN", tokenFile)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	resp, err := CheckConformance(ctx, plugin, LoginRequest{LoginMethod: "file", ServerID: "serverID", TimeoutSeconds: 60})
+	if err != nil {
+		t.Fatalf("expected the sample plugin to conform: %s", err)
+	}
+	if resp.AccessToken != "token" {
+		t.Fatalf("unexpected token: %s", resp.AccessToken)
+	}
+
+	t.Setenv("KUBELOGIN_LOGIN_FILE_TTL", "-1h")
+	if _, err := CheckConformance(ctx, plugin, LoginRequest{LoginMethod: "file", ServerID: "serverID"}); err == nil {
+		t.Fatal("expected an expired token to fail")
+	}
+}
@@ -0,0 +1,97 @@
+// Package loginplugin defines the protocol between kubelogin and out-of-tree login methods.
+//
+// A login plugin is an executable named kubelogin-login-<name> on PATH, used by get-token with --login <name>
+// when <name> is not a built-in login method. kubelogin writes a LoginRequest as JSON to standard input of the plugin,
+// and reads a LoginResponse as JSON from its standard output. Standard error of the plugin is passed through to the user,
+// so that the plugin may prompt, e.g. for the PIN of a smartcard, when the request is interactive.
+// The plugin exits with zero when it returns a token, and non-zero with the reason in LoginResponse.Error otherwise.
+//
+// Plugins written in Go may use Serve to implement the protocol, and CheckConformance to test it.
+package loginplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// APIVersion is the version of the protocol, set in the requests and expected in the responses
+	APIVersion = "kubelogin.azure.com/v1"
+	// KindLoginRequest is the kind of LoginRequest
+	KindLoginRequest = "LoginRequest"
+	// KindLoginResponse is the kind of LoginResponse
+	KindLoginResponse = "LoginResponse"
+	// BinaryPrefix is the prefix of the executable name of a login plugin, followed by the login method name
+	BinaryPrefix = "kubelogin-login-"
+)
+
+// LoginRequest is the options of get-token passed to the plugin
+type LoginRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// LoginMethod is the name of the login method, i.e. the plugin name without BinaryPrefix
+	LoginMethod string `json:"loginMethod"`
+	// ServerID is the audience of the token, i.e. --server-id
+	ServerID string `json:"serverID"`
+	ClientID string `json:"clientID,omitempty"`
+	TenantID string `json:"tenantID,omitempty"`
+	// Environment is the Azure environment name, e.g. AzurePublicCloud, and AuthorityHost its Azure AD endpoint
+	Environment   string `json:"environment,omitempty"`
+	AuthorityHost string `json:"authorityHost,omitempty"`
+	// Interactive is true when the plugin may prompt the user on standard error and the terminal
+	Interactive bool `json:"interactive"`
+	// TimeoutSeconds is how long the plugin has to return the token before it is killed, or zero without a timeout
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// LoginResponse is the token returned by the plugin, or the reason it could not return one
+type LoginResponse struct {
+	APIVersion  string     `json:"apiVersion"`
+	Kind        string     `json:"kind"`
+	AccessToken string     `json:"accessToken,omitempty"`
+	ExpiresOn   *time.Time `json:"expiresOn,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// NewLoginResponse returns a LoginResponse of the token
+func NewLoginResponse(accessToken string, expiresOn time.Time) *LoginResponse {
+	return &LoginResponse{
+		APIVersion:  APIVersion,
+		Kind:        KindLoginResponse,
+		AccessToken: accessToken,
+		ExpiresOn:   &expiresOn,
+	}
+}
+
+// ParseLoginResponse parses the standard output of a plugin, which must be a single LoginResponse
+func ParseLoginResponse(data []byte) (*LoginResponse, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	var resp LoginResponse
+	if err := d.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("unable to parse the login response: %w", err)
+	}
+	if d.More() {
+		return nil, errors.New("unexpected output after the login response")
+	}
+	if resp.APIVersion != APIVersion || resp.Kind != KindLoginResponse {
+		return nil, fmt.Errorf("unsupported login response %s %s, expected %s %s", resp.APIVersion, resp.Kind, APIVersion, KindLoginResponse)
+	}
+	return &resp, nil
+}
+
+// Validate returns the error of the response, or whether the token is missing
+func (r *LoginResponse) Validate() error {
+	if r.Error != "" {
+		return errors.New(r.Error)
+	}
+	if r.AccessToken == "" {
+		return errors.New("the login response has no accessToken")
+	}
+	if r.ExpiresOn == nil || r.ExpiresOn.IsZero() {
+		return errors.New("the login response has no expiresOn")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// kubelogin-login-file is a sample login plugin returning the token written to a file by another process,
+// e.g. an internal broker. Install it on PATH and run kubelogin get-token --login file.
+//
+// The file is set in KUBELOGIN_LOGIN_FILE_TOKEN, and the token is valid for KUBELOGIN_LOGIN_FILE_TTL, 1h by default,
+// after the file was last written.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/loginplugin"
+)
+
+const (
+	tokenFileEnv = "KUBELOGIN_LOGIN_FILE_TOKEN"
+	ttlEnv       = "KUBELOGIN_LOGIN_FILE_TTL"
+	defaultTTL   = time.Hour
+)
+
+func main() {
+	loginplugin.Serve(login)
+}
+
+func login(_ context.Context, req *loginplugin.LoginRequest) (*loginplugin.LoginResponse, error) {
+	file := os.Getenv(tokenFileEnv)
+	if file == "" {
+		return nil, fmt.Errorf("%s is not set", tokenFileEnv)
+	}
+	ttl := defaultTTL
+	if v := os.Getenv(ttlEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ttlEnv, err)
+		}
+		ttl = d
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the token of %s: %w", req.ServerID, err)
+	}
+	expiresOn := info.ModTime().Add(ttl)
+	if !expiresOn.After(time.Now()) {
+		return nil, fmt.Errorf("the token in %s expired on %s", file, expiresOn.Format(time.RFC3339))
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the token of %s: %w", req.ServerID, err)
+	}
+	return loginplugin.NewLoginResponse(strings.TrimSpace(string(data)), expiresOn), nil
+}
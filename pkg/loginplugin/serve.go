@@ -0,0 +1,63 @@
+package loginplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// LoginFunc returns the token of the request
+type LoginFunc func(ctx context.Context, req *LoginRequest) (*LoginResponse, error)
+
+// Serve implements the plugin side of the protocol with login, reading the request from standard input
+// and writing the response to standard output. It exits with 1 when login fails, with the reason in the response,
+// which kubelogin shows to the user.
+func Serve(login LoginFunc) {
+	if err := ServeIO(context.Background(), os.Stdin, os.Stdout, login); err != nil {
+		os.Exit(1)
+	}
+}
+
+// ServeIO implements the plugin side of the protocol with login, reading the request from r and writing the response to w.
+// The context passed to login is done after the timeout of the request.
+// When the request is not supported or login fails, the error is written in the response and returned.
+func ServeIO(ctx context.Context, r io.Reader, w io.Writer, login LoginFunc) error {
+	resp, err := serve(ctx, r, login)
+	if err != nil {
+		resp = &LoginResponse{Error: err.Error()}
+	}
+	resp.APIVersion, resp.Kind = APIVersion, KindLoginResponse
+	if encodeErr := json.NewEncoder(w).Encode(resp); encodeErr != nil && err == nil {
+		err = fmt.Errorf("unable to write the login response: %w", encodeErr)
+	}
+	return err
+}
+
+func serve(ctx context.Context, r io.Reader, login LoginFunc) (*LoginResponse, error) {
+	var req LoginRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return nil, fmt.Errorf("unable to parse the login request: %w", err)
+	}
+	if req.APIVersion != APIVersion || req.Kind != KindLoginRequest {
+		return nil, fmt.Errorf("unsupported login request %s %s, expected %s %s", req.APIVersion, req.Kind, APIVersion, KindLoginRequest)
+	}
+	if req.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	resp, err := login(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("%s login returned no response", req.LoginMethod)
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package loginplugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeIO(t *testing.T) {
+	expiresOn := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	login := func(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
+		if req.ServerID != "serverID" {
+			return nil, errors.New("unknown server ID")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("expected the timeout of the request")
+		}
+		return NewLoginResponse("token", expiresOn), nil
+	}
+
+	testData := []struct {
+		name          string
+		request       string
+		expectedError string
+	}{
+		{
+			name:    "token should be returned",
+			request: `{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginRequest","serverID":"serverID","timeoutSeconds":60}`,
+		},
+		{
+			name:          "unsupported version should fail",
+			request:       `{"apiVersion":"kubelogin.azure.com/v0","kind":"LoginRequest","serverID":"serverID"}`,
+			expectedError: "unsupported login request",
+		},
+		{
+			name:          "failed login should return the reason",
+			request:       `{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginRequest","serverID":"other","timeoutSeconds":60}`,
+			expectedError: "unknown server ID",
+		},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := ServeIO(context.Background(), strings.NewReader(data.request), &out, login)
+			resp, parseErr := ParseLoginResponse(out.Bytes())
+			if parseErr != nil {
+				t.Fatalf("expected a login response, got %q: %s", out.String(), parseErr)
+			}
+			if data.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), data.expectedError) || resp.Error != err.Error() {
+					t.Fatalf("expected error %q in the response, got %v, %+v", data.expectedError, err, resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if resp.Validate() != nil || resp.AccessToken != "token" || !resp.ExpiresOn.Equal(expiresOn) {
+				t.Fatalf("unexpected response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestParseLoginResponse(t *testing.T) {
+	if _, err := ParseLoginResponse([]byte(`{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginResponse"} {}`)); err == nil || !strings.Contains(err.Error(), "unexpected output") {
+		t.Fatalf("expected output after the response to fail, got %v", err)
+	}
+	if _, err := ParseLoginResponse([]byte(`{"apiVersion":"v1","kind":"ExecCredential"}`)); err == nil || !strings.Contains(err.Error(), "unsupported login response") {
+		t.Fatalf("expected another kind to fail, got %v", err)
+	}
+	resp, err := ParseLoginResponse([]byte(`{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginResponse","accessToken":"token"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := resp.Validate(); err == nil || !strings.Contains(err.Error(), "no expiresOn") {
+		t.Fatalf("expected a response without expiresOn to be invalid, got %v", err)
+	}
+}
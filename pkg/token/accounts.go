@@ -0,0 +1,159 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	// DefaultAccountAlias is the alias of the tokens cached in the token cache directory itself
+	DefaultAccountAlias = "default"
+	// accountsDirName is the directory of the token cache directory holding the token caches of the aliases
+	accountsDirName = "accounts"
+	// currentAccountFileName is the file in the accounts directory holding the alias set by accounts switch
+	currentAccountFileName = "current"
+)
+
+var accountAliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// AccountInfo describes the token cache of an account alias
+type AccountInfo struct {
+	Alias   string `json:"alias"`
+	Current bool   `json:"current"`
+	Tokens  int    `json:"tokens"`
+	// Identities are the distinct upn, or oid, of the cached tokens which are JWTs
+	Identities []string `json:"identities"`
+}
+
+// ValidateAccountAlias returns an error when alias cannot be used as the name of a token cache
+func ValidateAccountAlias(alias string) error {
+	if !accountAliasPattern.MatchString(alias) {
+		return fmt.Errorf("'%s' is not a valid account alias. It may only contain lowercase letters, digits, '-', and '_'", alias)
+	}
+	return nil
+}
+
+// getAccountCacheDir returns the token cache directory of the account alias
+func getAccountCacheDir(tokenCacheDir, alias string) string {
+	if alias == "" || alias == DefaultAccountAlias {
+		return tokenCacheDir
+	}
+	return filepath.Join(tokenCacheDir, accountsDirName, alias)
+}
+
+// GetCurrentAccountAlias returns the alias set by accounts switch, or DefaultAccountAlias
+func GetCurrentAccountAlias(tokenCacheDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(tokenCacheDir, accountsDirName, currentAccountFileName))
+	if os.IsNotExist(err) {
+		return DefaultAccountAlias, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read the current account alias: %w", err)
+	}
+	alias := strings.TrimSpace(string(data))
+	if err := ValidateAccountAlias(alias); err != nil {
+		return "", err
+	}
+	return alias, nil
+}
+
+// SwitchAccount has get-token use the token cache of alias when --account-alias is not set
+func SwitchAccount(tokenCacheDir, alias string) error {
+	if err := ValidateAccountAlias(alias); err != nil {
+		return err
+	}
+	dir := filepath.Join(tokenCacheDir, accountsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create %s: %w", dir, err)
+	}
+	// written to a temporary file first so that get-token never reads a partially written alias
+	tmp, err := os.CreateTemp(dir, currentAccountFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(alias + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, currentAccountFileName))
+}
+
+// ListAccounts returns the default alias and the aliases with a token cache in the token cache directory
+func ListAccounts(tokenCacheDir string) ([]AccountInfo, error) {
+	current, err := GetCurrentAccountAlias(tokenCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	aliases := []string{DefaultAccountAlias}
+	entries, err := os.ReadDir(filepath.Join(tokenCacheDir, accountsDirName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && ValidateAccountAlias(e.Name()) == nil && e.Name() != DefaultAccountAlias {
+			aliases = append(aliases, e.Name())
+		}
+	}
+	if current != DefaultAccountAlias && !containsString(aliases, current) {
+		// switched to before the first login
+		aliases = append(aliases, current)
+	}
+	sort.Strings(aliases[1:])
+
+	accounts := make([]AccountInfo, 0, len(aliases))
+	for _, alias := range aliases {
+		a := AccountInfo{Alias: alias, Current: alias == current, Identities: []string{}}
+		files, err := os.ReadDir(getAccountCacheDir(tokenCacheDir, alias))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || filepath.Ext(f.Name()) != ".json" || strings.HasSuffix(f.Name(), ".metadata.json") {
+				continue
+			}
+			token, err := adal.LoadToken(filepath.Join(getAccountCacheDir(tokenCacheDir, alias), f.Name()))
+			if err != nil || token.IsZero() {
+				continue
+			}
+			a.Tokens++
+			if identity := getTokenIdentity(token.AccessToken); identity != "" && !containsString(a.Identities, identity) {
+				a.Identities = append(a.Identities, identity)
+			}
+		}
+		sort.Strings(a.Identities)
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+// getTokenIdentity returns the upn, or oid, of the token, or an empty string when it is not a JWT
+func getTokenIdentity(token string) string {
+	var claims tokenClaims
+	if err := parseJWTClaims("token", token, &claims); err != nil {
+		return ""
+	}
+	var email string
+	if len(claims.Emails) > 0 {
+		email = claims.Emails[0]
+	}
+	return firstNonEmpty(claims.UPN, claims.PreferredUsername, email, claims.ObjectID)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestSwitchAccount(t *testing.T) {
+	dir := t.TempDir()
+	alias, err := GetCurrentAccountAlias(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if alias != DefaultAccountAlias {
+		t.Fatalf("expected the default account before switching, got %s", alias)
+	}
+
+	if err := SwitchAccount(dir, "work"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if alias, _ := GetCurrentAccountAlias(dir); alias != "work" {
+		t.Fatalf("expected the current account to be work, got %s", alias)
+	}
+
+	if err := SwitchAccount(dir, "../work"); !ErrorContains(err, "is not a valid account alias") {
+		t.Fatalf("expected invalid account alias to return error, got %v", err)
+	}
+	if alias, _ := GetCurrentAccountAlias(dir); alias != "work" {
+		t.Fatalf("expected the current account to be unchanged, got %s", alias)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, accountsDirName, currentAccountFileName), []byte("../etc\n"), 0600); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if _, err := GetCurrentAccountAlias(dir); !ErrorContains(err, "is not a valid account alias") {
+		t.Fatalf("expected invalid current account to return error, got %v", err)
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	dir := t.TempDir()
+	saveToken := func(alias, file string, claims map[string]interface{}) {
+		token := adal.Token{AccessToken: newUnsignedJWT(t, claims), Resource: "serverID", ExpiresOn: "1700000000"}
+		if err := adal.SaveToken(filepath.Join(getAccountCacheDir(dir, alias), file), 0600, token); err != nil {
+			t.Fatalf("unable to save token: %s", err)
+		}
+	}
+	saveToken(DefaultAccountAlias, "a.json", map[string]interface{}{"upn": "me@contoso.com"})
+	saveToken("work", "a.json", map[string]interface{}{"upn": "me@work.com"})
+	saveToken("work", "b.json", map[string]interface{}{"preferred_username": "admin@work.com"})
+	saveToken("work", "c.json", map[string]interface{}{"upn": "me@work.com"})
+	if err := writeCacheMetadata(filepath.Join(getAccountCacheDir(dir, "work"), "a.metadata.json"), cacheMetadata{}); err != nil {
+		t.Fatalf("unable to write cache metadata: %s", err)
+	}
+	if err := SwitchAccount(dir, "personal"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	accounts, err := ListAccounts(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []AccountInfo{
+		{Alias: DefaultAccountAlias, Tokens: 1, Identities: []string{"me@contoso.com"}},
+		{Alias: "personal", Current: true, Identities: []string{}},
+		{Alias: "work", Tokens: 3, Identities: []string{"admin@work.com", "me@work.com"}},
+	}
+	if !reflect.DeepEqual(accounts, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, accounts)
+	}
+}
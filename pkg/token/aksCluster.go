@@ -0,0 +1,122 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// aksAPIVersion is the API version of listClusterUserCredential of the Azure Kubernetes Service resource provider
+const aksAPIVersion = "2023-05-01"
+
+// aksClusterIDPattern matches the ARM resource ID of an AKS cluster
+var aksClusterIDPattern = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.ContainerService/managedClusters/([^/]+)$`)
+
+// AKSCluster is the API server and the CA of an AKS cluster
+type AKSCluster struct {
+	// Name is the name of the cluster resource
+	Name                     string
+	Server                   string
+	CertificateAuthorityData []byte
+}
+
+// GetAKSCluster looks up the API server and the CA of the AKS cluster of the ARM resource ID
+// with listClusterUserCredential of Azure Resource Manager, authenticating with the login method of o for the ARM audience.
+// The ARM token is cached in the token cache the same way get-token --server-id arm does.
+func GetAKSCluster(ctx context.Context, o *Options, resourceID string) (AKSCluster, error) {
+	m := aksClusterIDPattern.FindStringSubmatch(resourceID)
+	if m == nil {
+		return AKSCluster{}, fmt.Errorf("%q is not the resource ID of an AKS cluster, e.g. /subscriptions/<subscription>/resourceGroups/<group>/providers/Microsoft.ContainerService/managedClusters/<name>", resourceID)
+	}
+	e, err := lookupCloudEnvironment(o.Environment)
+	if err != nil {
+		return AKSCluster{}, err
+	}
+	env, err := e.azureEnvironment()
+	if err != nil {
+		return AKSCluster{}, err
+	}
+
+	armOptions := *o
+	armOptions.ServerID = armAppID
+	// the options of the ExecCredential are the ones of the kubeconfig, not of the ARM token
+	armOptions.TokenPrefix = ""
+	armOptions.SignKey = ""
+	armOptions.SignatureFile = ""
+	armOptions.ShowClaims = false
+	armOptions.tokenCacheFile = getCacheFileName(&armOptions)
+	provider, err := NewTokenProvider(&armOptions)
+	if err != nil {
+		return AKSCluster{}, err
+	}
+	token, err := provider.Token()
+	if err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to get token for Azure Resource Manager: %w", err)
+	}
+
+	cluster, err := getAKSCluster(ctx, armOptions.getHTTPSettings().newHTTPClient(), env.ResourceManagerEndpoint, token.AccessToken, resourceID)
+	if err != nil {
+		return AKSCluster{}, redactError(err)
+	}
+	cluster.Name = m[1]
+	return cluster, nil
+}
+
+// getAKSCluster calls listClusterUserCredential of the cluster at the ARM endpoint,
+// and returns the API server and the CA of the current context of the returned kubeconfig
+func getAKSCluster(ctx context.Context, client *http.Client, endpoint, accessToken, resourceID string) (AKSCluster, error) {
+	url := strings.TrimSuffix(endpoint, "/") + resourceID + "/listClusterUserCredential?api-version=" + aksAPIVersion
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to create Azure Resource Manager request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to send Azure Resource Manager request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to read Azure Resource Manager response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return AKSCluster{}, fmt.Errorf("listClusterUserCredential of %s failed with status code %d: %s", resourceID, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var credentials struct {
+		Kubeconfigs []struct {
+			Value []byte `json:"value"`
+		} `json:"kubeconfigs"`
+	}
+	if err := json.Unmarshal(body, &credentials); err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to unmarshal listClusterUserCredential response: %w", err)
+	}
+	if len(credentials.Kubeconfigs) == 0 {
+		return AKSCluster{}, fmt.Errorf("listClusterUserCredential of %s returned no kubeconfig", resourceID)
+	}
+	config, err := clientcmd.Load(credentials.Kubeconfigs[0].Value)
+	if err != nil {
+		return AKSCluster{}, fmt.Errorf("failed to load the kubeconfig of %s: %w", resourceID, err)
+	}
+	name := ""
+	if c, ok := config.Contexts[config.CurrentContext]; ok {
+		name = c.Cluster
+	} else if len(config.Clusters) == 1 {
+		for n := range config.Clusters {
+			name = n
+		}
+	}
+	cluster, ok := config.Clusters[name]
+	if !ok {
+		return AKSCluster{}, fmt.Errorf("the kubeconfig of %s does not have the cluster of the current context", resourceID)
+	}
+	return AKSCluster{Server: cluster.Server, CertificateAuthorityData: cluster.CertificateAuthorityData}, nil
+}
@@ -0,0 +1,64 @@
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAKSClusterID = "/subscriptions/sub/resourceGroups/group/providers/Microsoft.ContainerService/managedClusters/aks1"
+
+func TestGetAKSCluster(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: aks1
+  cluster:
+    server: https://aks1.hcp.eastus.azmk8s.io:443
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString([]byte("ca")) + `
+contexts:
+- name: aks1
+  context:
+    cluster: aks1
+    user: clusterUser_group_aks1
+current-context: aks1
+users:
+- name: clusterUser_group_aks1
+  user: {}
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer armToken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case testAKSClusterID + "/listClusterUserCredential":
+			fmt.Fprintf(w, `{"kubeconfigs":[{"name":"clusterUser","value":"%s"}]}`, base64.StdEncoding.EncodeToString([]byte(kubeconfig)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"ResourceNotFound"}`)
+		}
+	}))
+	defer server.Close()
+
+	cluster, err := getAKSCluster(context.Background(), server.Client(), server.URL+"/", "armToken", testAKSClusterID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cluster.Server != "https://aks1.hcp.eastus.azmk8s.io:443" || string(cluster.CertificateAuthorityData) != "ca" {
+		t.Fatalf("unexpected cluster: %+v", cluster)
+	}
+
+	_, err = getAKSCluster(context.Background(), server.Client(), server.URL, "armToken", testAKSClusterID+"2")
+	if !ErrorContains(err, `failed with status code 404: {"code":"ResourceNotFound"}`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o := NewOptions()
+	if _, err := GetAKSCluster(context.Background(), &o, "/subscriptions/sub/resourceGroups/group"); !ErrorContains(err, "is not the resource ID of an AKS cluster") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
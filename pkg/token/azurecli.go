@@ -1,65 +1,183 @@
 package token
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"k8s.io/client-go/util/homedir"
 )
 
+const (
+	defaultAzureCLITimeout = 30 * time.Second
+
+	// azureCLIConfigDirEnv overrides the configuration directory of Azure CLI, ~/.azure by default
+	azureCLIConfigDirEnv = "AZURE_CONFIG_DIR"
+	// azureCLIProfileFileName is the profile of Azure CLI holding the logged in accounts and the current subscription
+	azureCLIProfileFileName = "azureProfile.json"
+)
+
+var azureCLIResourcePattern = regexp.MustCompile("^[0-9a-zA-Z-.:/]+$")
+
 type AzureCLIToken struct {
 	resourceID string
 	tenantID   string
+	timeout    time.Duration
+	// useAzidentity gets the token with the AzureCLICredential of azidentity instead of running az directly
+	useAzidentity bool
+	// extraCAs are the CAs of --tls-ca-dir in PEM, added to the CA bundle of Azure CLI
+	extraCAs []byte
+	log      *logSink
 }
 
 // newAzureCLIToken returns a TokenProvider that will fetch a token for the user currently logged into the Azure CLI.
-// Required arguments include an oAuthConfiguration object and the resourceID (which is used as the scope)
-func newAzureCLIToken(resourceID string, tenantID string) (TokenProvider, error) {
+// Required arguments include the resourceID (which is used as the scope).
+// az is killed when it does not complete within timeout, which defaults to defaultAzureCLITimeout.
+// With useAzidentity, the token is got with the AzureCLICredential of azidentity, which does not use extraCAs.
+func newAzureCLIToken(resourceID string, tenantID string, timeout time.Duration, useAzidentity bool, extraCAs []byte, log *logSink) (TokenProvider, error) {
 	if resourceID == "" {
 		return nil, errors.New("resourceID cannot be empty")
 	}
+	if timeout <= 0 {
+		timeout = defaultAzureCLITimeout
+	}
 
 	return &AzureCLIToken{
-		resourceID: resourceID,
-		tenantID:   tenantID,
+		resourceID:    resourceID,
+		tenantID:      tenantID,
+		timeout:       timeout,
+		useAzidentity: useAzidentity,
+		extraCAs:      extraCAs,
+		log:           log,
 	}, nil
 }
 
-// Token fetches an azcore.AccessToken from the Azure CLI SDK and converts it to an adal.Token for use with kubelogin.
+// Token runs az account get-access-token and converts its output to an adal.Token for use with kubelogin.
 func (p *AzureCLIToken) Token() (adal.Token, error) {
 	emptyToken := adal.Token{}
 
-	// Request a new Azure CLI token provider
-	cred, err := azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{
-		TenantID: p.tenantID,
-	})
+	if !azureCLIResourcePattern.MatchString(p.resourceID) {
+		return emptyToken, fmt.Errorf("unexpected resource %q. Only alphanumeric characters and \".\", \":\", \"-\", and \"/\" are allowed", p.resourceID)
+	}
+	if p.useAzidentity {
+		return p.tokenFromAzidentity()
+	}
+	args := []string{"account", "get-access-token", "--output", "json", "--resource", p.resourceID}
+	if p.tenantID != "" {
+		args = append(args, "--tenant", p.tenantID)
+	}
+
+	az, err := findAzureCLI()
 	if err != nil {
-		return emptyToken, fmt.Errorf("unable to create credential. Received: %v", err)
+		return emptyToken, err
 	}
 
-	// Use the token provider to get a new token
-	cliAccessToken, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{p.resourceID}})
+	env, cleanup, err := azureCLICABundleEnv(p.log, p.extraCAs)
 	if err != nil {
-		return emptyToken, fmt.Errorf("expected an empty error but received: %v", err)
+		return emptyToken, err
 	}
-	if cliAccessToken.Token == "" {
+	defer cleanup()
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	output, err := runCommandWithEnv(ctx, env, az, args...)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to get token from Azure CLI: %w", err)
+	}
+
+	var cliToken struct {
+		AccessToken string `json:"accessToken"`
+		// expires_on is a POSIX timestamp, only available since Azure CLI 2.54
+		ExpiresOnTimestamp json.Number `json:"expires_on"`
+		// expiresOn is a local datetime
+		ExpiresOn string `json:"expiresOn"`
+	}
+	if err := json.Unmarshal(output, &cliToken); err != nil {
+		return emptyToken, fmt.Errorf("failed to parse Azure CLI output: %w", err)
+	}
+	if cliToken.AccessToken == "" {
 		return emptyToken, errors.New("did not receive a token")
 	}
 
-	// azurecore.AccessTokens have ExpiresOn as Time.Time. We need to convert it to JSON.Number
-	// by fetching the time in seconds since the Unix epoch via Unix() and then converting to a
-	// JSON.Number via formatting as a string using a base-10 int64 conversion.
-	expiresOn := json.Number(strconv.FormatInt(cliAccessToken.ExpiresOn.Unix(), 10))
+	expiresOn := cliToken.ExpiresOnTimestamp
+	if expiresOn == "" {
+		t, err := parseAzureCLIExpiresOn(cliToken.ExpiresOn)
+		if err != nil {
+			return emptyToken, err
+		}
+		expiresOn = json.Number(strconv.FormatInt(t.Unix(), 10))
+	}
 
-	// Re-wrap the azurecore.AccessToken into an adal.Token
 	return adal.Token{
-		AccessToken: cliAccessToken.Token,
+		AccessToken: cliToken.AccessToken,
 		ExpiresOn:   expiresOn,
 		Resource:    p.resourceID,
 	}, nil
 }
+
+// tokenFromAzidentity gets the token of the current account of Azure CLI with the AzureCLICredential of azidentity
+func (p *AzureCLIToken) tokenFromAzidentity() (adal.Token, error) {
+	cred, err := azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: p.tenantID})
+	if err != nil {
+		return adal.Token{}, fmt.Errorf("failed to create Azure CLI credential: %w", err)
+	}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{p.resourceID}})
+	if err != nil {
+		return adal.Token{}, fmt.Errorf("failed to get token from Azure CLI: %w", err)
+	}
+
+	return adal.Token{
+		AccessToken: token.Token,
+		ExpiresOn:   json.Number(strconv.FormatInt(token.ExpiresOn.Unix(), 10)),
+		Resource:    p.resourceID,
+	}, nil
+}
+
+// parseAzureCLIExpiresOn parses either an Azure CLI or a Cloud Shell date
+func parseAzureCLIExpiresOn(s string) (time.Time, error) {
+	// Cloud Shell
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	// Azure CLI, e.g. 2017-08-31 19:48:57.998857 in local timezone
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse expiresOn %q from Azure CLI output: %w", s, err)
+	}
+	return t, nil
+}
+
+// getAzureCLIProfileFile returns the profile of Azure CLI, which is written by az login, az logout, and az account set
+func getAzureCLIProfileFile() string {
+	dir := os.Getenv(azureCLIConfigDirEnv)
+	if dir == "" {
+		dir = filepath.Join(homedir.HomeDir(), ".azure")
+	}
+	return filepath.Join(dir, azureCLIProfileFileName)
+}
+
+// isAzureCLITokenStale is true when the Azure CLI profile changed after the token of azurecli login was cached,
+// e.g. the user logged in with another account, so that the cached token may not be the one az would return
+func isAzureCLITokenStale(tokenCacheFile string) bool {
+	cached, err := os.Stat(tokenCacheFile)
+	if err != nil {
+		return false
+	}
+	profile, err := os.Stat(getAzureCLIProfileFile())
+	if err != nil {
+		// az logout of the last account removes the profile
+		return errors.Is(err, os.ErrNotExist)
+	}
+	return profile.ModTime().After(cached.ModTime())
+}
@@ -0,0 +1,45 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// azureCLIPathEnv overrides the discovery of Azure CLI with the path of the az executable
+const azureCLIPathEnv = "AZURE_CLI_PATH"
+
+// azureCLIInstallPaths returns the well-known install locations of Azure CLI which may not be in PATH,
+// e.g. when kubectl is run by an IDE or a service with a minimal environment.
+// It is a variable so that tests can replace it.
+var azureCLIInstallPaths = defaultAzureCLIInstallPaths
+
+// findAzureCLI returns the path of the az executable from AZURE_CLI_PATH environment variable,
+// PATH, or the well-known install locations in that order
+func findAzureCLI() (string, error) {
+	if path := os.Getenv(azureCLIPathEnv); path != "" {
+		if !isExecutableFile(path) {
+			return "", fmt.Errorf("Azure CLI is not found at %s specified in %s environment variable", path, azureCLIPathEnv)
+		}
+		return path, nil
+	}
+	if path, err := exec.LookPath("az"); err == nil {
+		return path, nil
+	}
+	paths := azureCLIInstallPaths()
+	for _, path := range paths {
+		if isExecutableFile(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("Azure CLI is not found in PATH or %s. Install Azure CLI or set %s environment variable to the path of az", strings.Join(paths, ", "), azureCLIPathEnv)
+}
+
+func isExecutableFile(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	return isExecutableMode(fi.Mode())
+}
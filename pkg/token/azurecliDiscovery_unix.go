@@ -0,0 +1,31 @@
+//go:build !windows
+
+package token
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+func defaultAzureCLIInstallPaths() []string {
+	paths := []string{
+		// deb, rpm, and Homebrew on Intel macOS
+		"/usr/bin/az",
+		"/usr/local/bin/az",
+		// Homebrew on Apple silicon
+		"/opt/homebrew/bin/az",
+		// Homebrew on Linux
+		"/home/linuxbrew/.linuxbrew/bin/az",
+	}
+	if home := homedir.HomeDir(); home != "" {
+		// install script
+		paths = append(paths, filepath.Join(home, "bin", "az"))
+	}
+	return paths
+}
+
+func isExecutableMode(mode fs.FileMode) bool {
+	return mode&0111 != 0
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindAzureCLI(t *testing.T) {
+	writeFakeAzureCLI := func(t *testing.T, dir string) string {
+		path := filepath.Join(dir, "az")
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0700); err != nil {
+			t.Fatalf("unable to write fake az: %s", err)
+		}
+		return path
+	}
+
+	t.Run("AZURE_CLI_PATH takes precedence over PATH", func(t *testing.T) {
+		override := writeFakeAzureCLI(t, t.TempDir())
+		t.Setenv("PATH", filepath.Dir(writeFakeAzureCLI(t, t.TempDir())))
+		t.Setenv(azureCLIPathEnv, override)
+
+		path, err := findAzureCLI()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if path != override {
+			t.Fatalf("expected %s, got %s", override, path)
+		}
+	})
+
+	t.Run("AZURE_CLI_PATH which is not executable should return error", func(t *testing.T) {
+		t.Setenv(azureCLIPathEnv, t.TempDir())
+
+		if _, err := findAzureCLI(); !ErrorContains(err, "Azure CLI is not found at") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("well-known install locations are used when az is not in PATH", func(t *testing.T) {
+		installed := writeFakeAzureCLI(t, t.TempDir())
+		t.Setenv("PATH", t.TempDir())
+		t.Setenv(azureCLIPathEnv, "")
+		defer func(f func() []string) { azureCLIInstallPaths = f }(azureCLIInstallPaths)
+		azureCLIInstallPaths = func() []string { return []string{"/nonexistent/az", installed} }
+
+		path, err := findAzureCLI()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if path != installed {
+			t.Fatalf("expected %s, got %s", installed, path)
+		}
+	})
+
+	t.Run("error should explain how to specify az", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		t.Setenv(azureCLIPathEnv, "")
+		defer func(f func() []string) { azureCLIInstallPaths = f }(azureCLIInstallPaths)
+		azureCLIInstallPaths = func() []string { return []string{"/nonexistent/az"} }
+
+		if _, err := findAzureCLI(); !ErrorContains(err, "set AZURE_CLI_PATH environment variable") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package token
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func defaultAzureCLIInstallPaths() []string {
+	var paths []string
+	// MSI installs the 64-bit Azure CLI in Program Files and the 32-bit one in Program Files (x86)
+	for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)"} {
+		if dir := os.Getenv(env); dir != "" {
+			paths = append(paths, filepath.Join(dir, "Microsoft SDKs", "Azure", "CLI2", "wbin", "az.cmd"))
+		}
+	}
+	return paths
+}
+
+func isExecutableMode(fs.FileMode) bool {
+	// Windows does not have the executable bit
+	return true
+}
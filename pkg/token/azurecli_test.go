@@ -6,7 +6,7 @@ import (
 )
 
 func TestNewAzureCLITokenEmpty(t *testing.T) {
-	_, err := newAzureCLIToken("", "")
+	_, err := newAzureCLIToken("", "", 0, false, nil, nil)
 
 	if !ErrorContains(err, "resourceID cannot be empty") {
 		t.Errorf("unexpected error: %v", err)
@@ -17,7 +17,7 @@ func TestNewAzureCLIToken(t *testing.T) {
 	azcli := AzureCLIToken{}
 	_, err := azcli.Token()
 
-	if !ErrorContains(err, "expected an empty error but received:") {
+	if !ErrorContains(err, "unexpected resource") {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
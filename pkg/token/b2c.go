@@ -0,0 +1,157 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	// b2cTokenEndpointPath is the path of the token endpoint of a B2C policy, relative to the authority
+	b2cTokenEndpointPath = "oauth2/v2.0/token"
+	// b2cScopes are requested with the scope of the server ID, for the ID token and the refresh token
+	b2cScopes = "openid offline_access"
+	// b2cDeviceCodeGrantType is the grant type of RFC 8628, which the v2 endpoints require instead of device_code of adal
+	b2cDeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// b2cPolicyPattern matches the names of user flows, e.g. B2C_1_signin, and custom policies, e.g. B2C_1A_signin
+var b2cPolicyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// getB2CAuthority returns the authority of the B2C policy of the options, i.e. https://<host>/<tenant>/<policy>/.
+// The host defaults to <name>.b2clogin.com of the tenant <name>.onmicrosoft.com when --authority-host is not set.
+func getB2CAuthority(o *Options) (*url.URL, error) {
+	host := o.AuthorityHost
+	if host == "" {
+		name := strings.TrimSuffix(strings.ToLower(o.TenantID), ".onmicrosoft.com")
+		if name == strings.ToLower(o.TenantID) {
+			return nil, fmt.Errorf("--authority-host, e.g. https://<tenant>.b2clogin.com/, is required with --b2c-policy unless the tenant ID is <tenant>.onmicrosoft.com")
+		}
+		host = "https://" + name + ".b2clogin.com/"
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("B2C authority host must be an https URL, got %q", host)
+	}
+	return u.Parse("/" + url.PathEscape(o.TenantID) + "/" + url.PathEscape(o.B2CPolicy) + "/")
+}
+
+// getB2COAuthConfig returns the v2 endpoints of the B2C policy of the options
+func getB2COAuthConfig(o *Options) (*adal.OAuthConfig, error) {
+	authority, err := getB2CAuthority(o)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := func(path string) url.URL {
+		u, _ := authority.Parse(path)
+		return *u
+	}
+	return &adal.OAuthConfig{
+		AuthorityEndpoint:  *authority,
+		AuthorizeEndpoint:  endpoint("oauth2/v2.0/authorize"),
+		TokenEndpoint:      endpoint(b2cTokenEndpointPath),
+		DeviceCodeEndpoint: endpoint("oauth2/v2.0/devicecode"),
+	}, nil
+}
+
+// getOAuthConfigForOptions returns the endpoints of the B2C policy when --b2c-policy is set, or the ones of the environment
+func getOAuthConfigForOptions(o *Options) (*adal.OAuthConfig, error) {
+	if o.B2CPolicy != "" {
+		return getB2COAuthConfig(o)
+	}
+	return getOAuthConfig(o.Environment, o.TenantID, o.IsLegacy)
+}
+
+// isB2COAuthConfig returns true when the endpoints are the ones of a B2C policy returned by getB2COAuthConfig
+func isB2COAuthConfig(oAuthConfig adal.OAuthConfig) bool {
+	return strings.HasSuffix(oAuthConfig.TokenEndpoint.Path, "/"+b2cTokenEndpointPath)
+}
+
+// b2cSender implements adal.Sender and adapts the v1 requests and responses of adal to the v2 endpoints of B2C.
+// The resource of the requests is sent as the scope, and the device code with the grant type of RFC 8628.
+// The expiry and the resource, which are not returned by B2C, are added to the token responses,
+// and the device authorization response is converted to the format of v1.
+type b2cSender struct {
+	sender adal.Sender
+}
+
+func (s *b2cSender) Do(req *http.Request) (*http.Response, error) {
+	resource := ""
+	if req.Body != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		v, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse B2C request: %w", err)
+		}
+		if resource = v.Get("resource"); resource != "" {
+			v.Del("resource")
+			v.Set("scope", resource+" "+b2cScopes)
+		}
+		if v.Get("grant_type") == adal.OAuthGrantTypeDeviceCode {
+			v.Set("grant_type", b2cDeviceCodeGrantType)
+			v.Set("device_code", v.Get("code"))
+			v.Del("code")
+		}
+		encoded := v.Encode()
+		req.Body = io.NopCloser(strings.NewReader(encoded))
+		req.ContentLength = int64(len(encoded))
+	}
+
+	resp, err := s.sender.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK || resource == "" {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return resp, nil
+	}
+	switch {
+	case response["access_token"] != nil:
+		if _, ok := response["resource"]; !ok {
+			response["resource"] = resource
+		}
+		if _, ok := response["expires_on"]; !ok {
+			if expiresIn, err := json.Number(fmt.Sprint(response["expires_in"])).Int64(); err == nil {
+				response["expires_on"] = strconv.FormatInt(time.Now().Add(time.Duration(expiresIn)*time.Second).Unix(), 10)
+			}
+		}
+	case response["device_code"] != nil:
+		// adal expects verification_url, and expires_in and interval as strings
+		if _, ok := response["verification_url"]; !ok {
+			response["verification_url"] = response["verification_uri"]
+		}
+		for _, key := range []string{"expires_in", "interval"} {
+			if n, ok := response[key].(float64); ok {
+				response[key] = strconv.FormatInt(int64(n), 10)
+			}
+		}
+	default:
+		return resp, nil
+	}
+	if body, err = json.Marshal(response); err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
@@ -0,0 +1,206 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// b2cInteractiveToken acquires a token of a B2C policy with the authorization code flow and PKCE,
+// since the interactive browser credential of azidentity does not support the policy segment of B2C authorities
+type b2cInteractiveToken struct {
+	clientID    string
+	resourceID  string
+	timeout     time.Duration
+	httpClient  *http.Client
+	oAuthConfig adal.OAuthConfig
+	// openURL opens the authorization URL in a browser, which redirects to the local listener
+	openURL func(string) error
+}
+
+// redirectReadHeaderTimeout bounds how long the local listener waits for the headers of the redirect,
+// so that a client connecting without sending a request does not hold the listener until the login times out
+const redirectReadHeaderTimeout = 10 * time.Second
+
+type b2cAuthorizationResult struct {
+	code string
+	err  error
+}
+
+// b2cTokenResponse is the response of the v2 token endpoint
+type b2cTokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	RefreshToken     string      `json:"refresh_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func newB2CInteractiveTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourceID string, timeout time.Duration, httpClient *http.Client) (TokenProvider, error) {
+	if clientID == "" {
+		return nil, errors.New("clientID cannot be empty")
+	}
+	if resourceID == "" {
+		return nil, errors.New("resourceID cannot be empty")
+	}
+
+	return &b2cInteractiveToken{
+		clientID:    clientID,
+		resourceID:  resourceID,
+		timeout:     timeout,
+		httpClient:  httpClient,
+		oAuthConfig: oAuthConfig,
+		openURL:     openSignInURL,
+	}, nil
+}
+
+func (p *b2cInteractiveToken) Token() (adal.Token, error) {
+	emptyToken := adal.Token{}
+
+	verifier, err := newRandomString(32)
+	if err != nil {
+		return emptyToken, err
+	}
+	state, err := newRandomString(16)
+	if err != nil {
+		return emptyToken, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return emptyToken, fmt.Errorf("unable to listen for the redirect: %w", err)
+	}
+	redirectURI := fmt.Sprintf("http://localhost:%d/", listener.Addr().(*net.TCPAddr).Port)
+
+	results := make(chan b2cAuthorizationResult, 1)
+	server := &http.Server{ReadHeaderTimeout: redirectReadHeaderTimeout, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var result b2cAuthorizationResult
+		switch {
+		case q.Get("state") != state:
+			http.Error(w, "state does not match", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			result.err = fmt.Errorf("authorization failed: %s: %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("code") == "":
+			result.err = errors.New("authorization failed: no code in the redirect")
+		default:
+			result.code = q.Get("code")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "Authentication complete. You can close this window.")
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	authorizeURL := p.oAuthConfig.AuthorizeEndpoint
+	authorizeURL.RawQuery = url.Values{
+		"client_id":             {p.clientID},
+		"response_type":         {"code"},
+		"response_mode":         {"query"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {p.resourceID + " " + b2cScopes},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	if err := p.openURL(authorizeURL.String()); err != nil {
+		return emptyToken, err
+	}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	var result b2cAuthorizationResult
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		return emptyToken, fmt.Errorf("timed out waiting for the redirect to %s: %w", redirectURI, ctx.Err())
+	}
+	if result.err != nil {
+		return emptyToken, result.err
+	}
+
+	return p.redeemCode(result.code, redirectURI, verifier)
+}
+
+// redeemCode exchanges the authorization code for the tokens at the token endpoint of the policy
+func (p *b2cInteractiveToken) redeemCode(code, redirectURI, verifier string) (adal.Token, error) {
+	emptyToken := adal.Token{}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {p.clientID},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+		"scope":         {p.resourceID + " " + b2cScopes},
+	}
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.oAuthConfig.TokenEndpoint.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return emptyToken, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := p.httpClient
+	if client == nil {
+		client = defaultHTTPSettings.newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to redeem the authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to read the token response: %w", err)
+	}
+
+	var response b2cTokenResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return emptyToken, fmt.Errorf("failed to parse the token response of status %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || response.AccessToken == "" {
+		return emptyToken, fmt.Errorf("failed to redeem the authorization code, status %d: %s: %s", resp.StatusCode, response.Error, response.ErrorDescription)
+	}
+	expiresIn, err := response.ExpiresIn.Int64()
+	if err != nil {
+		return emptyToken, fmt.Errorf("invalid expires_in %q in the token response", response.ExpiresIn)
+	}
+
+	return adal.Token{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresIn:    response.ExpiresIn,
+		ExpiresOn:    json.Number(strconv.FormatInt(time.Now().Add(time.Duration(expiresIn)*time.Second).Unix(), 10)),
+		Resource:     p.resourceID,
+	}, nil
+}
+
+// newRandomString returns n random bytes encoded in base64url, for the PKCE verifier and the state
+func newRandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,245 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestGetB2CAuthority(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tenantID      string
+		authorityHost string
+		expected      string
+		expectedErr   string
+	}{
+		{
+			name:     "host should default to b2clogin.com of the tenant",
+			tenantID: "Contoso.onmicrosoft.com",
+			expected: "https://contoso.b2clogin.com/Contoso.onmicrosoft.com/B2C_1A_signin/",
+		},
+		{
+			name:          "custom domain should be used",
+			tenantID:      "00000000-0000-0000-0000-000000000001",
+			authorityHost: "https://login.contoso.com/",
+			expected:      "https://login.contoso.com/00000000-0000-0000-0000-000000000001/B2C_1A_signin/",
+		},
+		{
+			name:        "authority host should be required with a tenant ID",
+			tenantID:    "00000000-0000-0000-0000-000000000001",
+			expectedErr: "--authority-host, e.g. https://<tenant>.b2clogin.com/, is required",
+		},
+		{
+			name:          "authority host should be https",
+			tenantID:      "contoso.onmicrosoft.com",
+			authorityHost: "http://contoso.b2clogin.com/",
+			expectedErr:   "B2C authority host must be an https URL",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{TenantID: tc.tenantID, AuthorityHost: tc.authorityHost, B2CPolicy: "B2C_1A_signin"}
+			authority, err := getB2CAuthority(o)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if authority.String() != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, authority)
+			}
+		})
+	}
+}
+
+func TestGetOAuthConfigForOptions(t *testing.T) {
+	o := &Options{TenantID: "contoso.onmicrosoft.com", B2CPolicy: "B2C_1_signin"}
+	cfg, err := getOAuthConfigForOptions(o)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !isB2COAuthConfig(*cfg) {
+		t.Fatalf("expected the endpoints of the B2C policy, got %+v", cfg)
+	}
+	for endpoint, expected := range map[*url.URL]string{
+		&cfg.AuthorizeEndpoint:  "https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signin/oauth2/v2.0/authorize",
+		&cfg.TokenEndpoint:      "https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signin/oauth2/v2.0/token",
+		&cfg.DeviceCodeEndpoint: "https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signin/oauth2/v2.0/devicecode",
+	} {
+		if endpoint.String() != expected {
+			t.Fatalf("expected %s, got %s", expected, endpoint)
+		}
+	}
+
+	o = &Options{Environment: "AzurePublicCloud", TenantID: "tenantID"}
+	cfg, err = getOAuthConfigForOptions(o)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if isB2COAuthConfig(*cfg) {
+		t.Fatalf("expected the endpoints of the environment, got %+v", cfg)
+	}
+}
+
+// newB2CServer serves the v2 device authorization and token endpoints of a B2C policy,
+// which fail the requests of the v1 format of adal
+func newB2CServer(t *testing.T) (*httptest.Server, adal.OAuthConfig) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unable to parse form: %s", err)
+		}
+		if r.Form.Get("resource") != "" || r.Form.Get("scope") != "resourceID "+b2cScopes {
+			t.Errorf("expected the scope instead of the resource, got %v", r.Form)
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/B2C_1_signin/oauth2/v2.0/devicecode"):
+			fmt.Fprint(w, `{"device_code":"code","user_code":"user","verification_uri":"https://contoso.b2clogin.com/device","expires_in":900,"interval":0,"message":"enter the code"}`)
+		case strings.HasSuffix(r.URL.Path, "/B2C_1_signin/oauth2/v2.0/token"):
+			switch r.Form.Get("grant_type") {
+			case b2cDeviceCodeGrantType:
+				if r.Form.Get("device_code") != "code" || r.Form.Get("code") != "" {
+					t.Errorf("unexpected device code grant: %v", r.Form)
+				}
+			case "refresh_token":
+				if r.Form.Get("refresh_token") != "refreshToken" {
+					t.Errorf("unexpected refresh grant: %v", r.Form)
+				}
+			default:
+				t.Errorf("unexpected grant: %v", r.Form)
+			}
+			fmt.Fprint(w, `{"access_token":"accessToken","id_token":"idToken","refresh_token":"refreshToken","token_type":"Bearer","expires_in":3600}`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	cfg, err := getB2COAuthConfig(&Options{TenantID: "contoso.onmicrosoft.com", AuthorityHost: "https://" + u.Host + "/", B2CPolicy: "B2C_1_signin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, endpoint := range []*url.URL{&cfg.AuthorityEndpoint, &cfg.AuthorizeEndpoint, &cfg.TokenEndpoint, &cfg.DeviceCodeEndpoint} {
+		endpoint.Scheme = "http"
+	}
+	return server, *cfg
+}
+
+func TestB2CDeviceCodeToken(t *testing.T) {
+	setFastDeviceCodePolling(t)
+	_, cfg := newB2CServer(t)
+	provider, err := newDeviceCodeTokenProvider(cfg, "clientID", "resourceID", "contoso.onmicrosoft.com", false, TokenTypeAccess, 0, 0, 0, http.DefaultClient, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "accessToken" || token.RefreshToken != "refreshToken" || token.Resource != "resourceID" || token.IsExpired() {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+}
+
+func TestB2CRefreshToken(t *testing.T) {
+	_, cfg := newB2CServer(t)
+	provider, err := newManualToken(cfg, "clientID", "resourceID", "contoso.onmicrosoft.com", TokenTypeAccess, 0, &adal.Token{RefreshToken: "refreshToken", Resource: "resourceID"}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "accessToken" || token.Resource != "resourceID" || token.IsExpired() {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+}
+
+func TestB2CInteractiveToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unable to parse form: %s", err)
+		}
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != "authCode" || r.Form.Get("code_verifier") == "" {
+			t.Errorf("unexpected authorization code grant: %v", r.Form)
+		}
+		fmt.Fprint(w, `{"access_token":"accessToken","refresh_token":"refreshToken","token_type":"Bearer","expires_in":3600}`)
+	}))
+	t.Cleanup(server.Close)
+	tokenEndpoint, _ := url.Parse(server.URL + "/contoso.onmicrosoft.com/B2C_1_signin/oauth2/v2.0/token")
+	authorizeEndpoint, _ := url.Parse("https://contoso.b2clogin.com/contoso.onmicrosoft.com/B2C_1_signin/oauth2/v2.0/authorize")
+
+	testCases := []struct {
+		name        string
+		redirect    func(authorize url.Values) string
+		expectedErr string
+	}{
+		{
+			name: "code should be redeemed",
+			redirect: func(authorize url.Values) string {
+				return "?code=authCode&state=" + authorize.Get("state")
+			},
+		},
+		{
+			name: "error of the policy should be returned",
+			redirect: func(authorize url.Values) string {
+				return "?error=access_denied&error_description=cancelled&state=" + authorize.Get("state")
+			},
+			expectedErr: "authorization failed: access_denied: cancelled",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider, err := newB2CInteractiveTokenProvider(adal.OAuthConfig{AuthorizeEndpoint: *authorizeEndpoint, TokenEndpoint: *tokenEndpoint}, "clientID", "resourceID", 0, server.Client())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			p := provider.(*b2cInteractiveToken)
+			// the browser is redirected to the local listener by the policy
+			p.openURL = func(s string) error {
+				u, err := url.Parse(s)
+				if err != nil {
+					return err
+				}
+				authorize := u.Query()
+				if authorize.Get("code_challenge_method") != "S256" || authorize.Get("scope") != "resourceID "+b2cScopes {
+					t.Errorf("unexpected authorization request: %v", authorize)
+				}
+				go func() {
+					resp, err := http.Get(authorize.Get("redirect_uri") + tc.redirect(authorize))
+					if err == nil {
+						resp.Body.Close()
+					}
+				}()
+				return nil
+			}
+
+			token, err := p.Token()
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != "accessToken" || token.RefreshToken != "refreshToken" || token.Resource != "resourceID" || token.IsExpired() {
+				t.Fatalf("unexpected token: %+v", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// benchTimeThresholdsEnv enables the time thresholds of TestHotPathRegressions,
+// which depend on the machine and are therefore not checked by default
+const benchTimeThresholdsEnv = "KUBELOGIN_BENCH_TIME_THRESHOLDS"
+
+// hotPathBenchmark is a path run by every get-token invocation served from the token cache
+type hotPathBenchmark struct {
+	name string
+	op   func() error
+}
+
+// newBenchmarkToken returns a token of the size of Azure AD tokens, whose access token is an unsigned JWT expiring in an hour
+func newBenchmarkToken() adal.Token {
+	expiresOn := time.Now().Add(time.Hour).Unix()
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud":    "6dae42f8-4368-4678-94ff-3960e28e3630",
+		"iss":    "https://sts.windows.net/72f988bf-86f1-41af-91ab-2d7cd011db47/",
+		"oid":    "00000000-0000-0000-0000-000000000000",
+		"upn":    "user@example.com",
+		"exp":    expiresOn,
+		"nbf":    expiresOn - 3600,
+		"groups": make([]string, 50),
+	})
+	return adal.Token{
+		AccessToken:  "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl",
+		RefreshToken: "refresh-token",
+		ExpiresOn:    json.Number(fmt.Sprintf("%d", expiresOn)),
+		Resource:     "6dae42f8-4368-4678-94ff-3960e28e3630",
+		Type:         "Bearer",
+	}
+}
+
+// getHotPathBenchmarks returns the hot paths of get-token, i.e. reading and writing the token cache,
+// marshaling ExecCredential, and parsing JWTs, which cache tokens in a temporary directory
+func getHotPathBenchmarks(tb testing.TB) []hotPathBenchmark {
+	dir := tb.TempDir()
+	token := newBenchmarkToken()
+	cache := &defaultTokenCache{}
+	readFile := filepath.Join(dir, "read.json")
+	if err := cache.Write(readFile, token); err != nil {
+		tb.Fatalf("unable to write token cache: %s", err)
+	}
+	writeFile := filepath.Join(dir, "write.json")
+	w := &execCredentialWriter{}
+	return []hotPathBenchmark{
+		{
+			name: "cache-read",
+			op: func() error {
+				_, err := cache.Read(readFile)
+				return err
+			},
+		},
+		{
+			name: "cache-write",
+			op:   func() error { return cache.Write(writeFile, token) },
+		},
+		{
+			name: "exec-credential-marshal",
+			op:   func() error { return w.Write(token, io.Discard) },
+		},
+		{
+			name: "jwt-parse",
+			op: func() error {
+				_, err := parseJWTExpiryClaims("access token", token.AccessToken)
+				return err
+			},
+		},
+	}
+}
+
+func runHotPathBenchmark(b *testing.B, bm hotPathBenchmark) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := bm.op(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHotPaths(b *testing.B) {
+	for _, bm := range getHotPathBenchmarks(b) {
+		bm := bm
+		b.Run(bm.name, func(b *testing.B) {
+			runHotPathBenchmark(b, bm)
+		})
+	}
+}
+
+// hotPathThresholds are the regression thresholds of the hot paths.
+// The allocations are deterministic and catch e.g. a token being re-encoded or a file being read twice.
+// The times are loose enough for slow CI machines and disks, and catch regressions of orders of magnitude,
+// but are only checked with KUBELOGIN_BENCH_TIME_THRESHOLDS set.
+var hotPathThresholds = map[string]struct {
+	maxTimePerOp   time.Duration
+	maxAllocsPerOp float64
+}{
+	"cache-read":              {maxTimePerOp: 5 * time.Millisecond, maxAllocsPerOp: 40},
+	"cache-write":             {maxTimePerOp: 50 * time.Millisecond, maxAllocsPerOp: 40},
+	"exec-credential-marshal": {maxTimePerOp: time.Millisecond, maxAllocsPerOp: 15},
+	"jwt-parse":               {maxTimePerOp: time.Millisecond, maxAllocsPerOp: 15},
+}
+
+func TestHotPathRegressions(t *testing.T) {
+	checkTime := os.Getenv(benchTimeThresholdsEnv) != ""
+	benchmarks := getHotPathBenchmarks(t)
+	if len(benchmarks) != len(hotPathThresholds) {
+		t.Fatalf("expected a threshold for each of the benchmarks, got %d benchmarks", len(benchmarks))
+	}
+	for _, bm := range benchmarks {
+		threshold, ok := hotPathThresholds[bm.name]
+		if !ok {
+			t.Fatalf("no threshold for benchmark %s", bm.name)
+		}
+
+		var err error
+		allocs := testing.AllocsPerRun(100, func() {
+			if opErr := bm.op(); opErr != nil {
+				err = opErr
+			}
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %s", bm.name, err)
+		}
+		if allocs > threshold.maxAllocsPerOp {
+			t.Errorf("%s allocated %.0f times per operation, more than %.0f", bm.name, allocs, threshold.maxAllocsPerOp)
+		}
+
+		if !checkTime {
+			continue
+		}
+		r := testing.Benchmark(func(b *testing.B) { runHotPathBenchmark(b, bm) })
+		if r.N == 0 {
+			t.Fatalf("benchmark %s failed", bm.name)
+		}
+		t.Logf("%s: %s", bm.name, r.String())
+		if time.Duration(r.NsPerOp()) > threshold.maxTimePerOp {
+			t.Errorf("%s took %s per operation, more than %s", bm.name, time.Duration(r.NsPerOp()), threshold.maxTimePerOp)
+		}
+	}
+}
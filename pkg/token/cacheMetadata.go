@@ -0,0 +1,110 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheMetadata is persisted next to the token cache file and stores what kubelogin
+// learned about the token cache entry, e.g. which audience variant the tenant accepts
+type cacheMetadata struct {
+	// LegacyAudience records whether the token was acquired with 'spn:' prefix in audience claim
+	// when --legacy-audience=auto is used
+	LegacyAudience *bool `json:"legacyAudience,omitempty"`
+	// AuthenticatedAt records when the user last authenticated with the login method instead of a refresh token,
+	// which --max-cache-age is compared with
+	AuthenticatedAt *time.Time `json:"authenticatedAt,omitempty"`
+	// LastUsedAt records when the cached token was last returned, with a resolution of lastUsedResolution
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// lastUsedResolution is how often LastUsedAt is updated at most, so that the metadata is not written on every call
+const lastUsedResolution = time.Minute
+
+func getCacheMetadataFileName(o *Options) string {
+	// format: ${token cache file name without _legacy}.metadata.json
+	// legacy and non-legacy token cache files share the same metadata, which records the audience variant to use
+	nonLegacy := *o
+	nonLegacy.IsLegacy = false
+	return getCacheMetadataFileNameOfToken(getCacheFileName(&nonLegacy))
+}
+
+// getCacheMetadataFileNameOfToken returns the cache metadata file of the token cache file,
+// which is shared by the legacy and non-legacy variants of the token
+func getCacheMetadataFileNameOfToken(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), ".json")
+	// the suffixes of the token cache file name follow _legacy, see getCacheFileNameForServerID
+	var suffixes string
+	for _, suffix := range []string{"_azurecli", "_id"} {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			suffixes = suffix + suffixes
+		}
+	}
+	name = strings.TrimSuffix(name, "_legacy") + suffixes
+	return filepath.Join(filepath.Dir(file), name+".metadata.json")
+}
+
+// readCacheMetadata returns empty metadata when the file does not exist
+func readCacheMetadata(file string) (cacheMetadata, error) {
+	var m cacheMetadata
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to unmarshal cache metadata %s: %w", file, err)
+	}
+	return m, nil
+}
+
+func writeCacheMetadata(file string, m cacheMetadata) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache metadata: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for cache metadata: %w", err)
+	}
+	// write to a temp file and rename so that concurrent readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for cache metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write cache metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache metadata: %w", err)
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// updateCacheMetadata applies update to the cache metadata in file, keeping the fields it does not change
+func updateCacheMetadata(file string, update func(*cacheMetadata)) error {
+	m, err := readCacheMetadata(file)
+	if err != nil {
+		m = cacheMetadata{}
+	}
+	update(&m)
+	return writeCacheMetadata(file, m)
+}
+
+// isMaxCacheAgeExceeded returns true when the user authenticated longer than maxAge before now,
+// or when it is unknown when the user authenticated
+func isMaxCacheAgeExceeded(file string, maxAge time.Duration, now time.Time) bool {
+	m, err := readCacheMetadata(file)
+	if err != nil || m.AuthenticatedAt == nil {
+		return true
+	}
+	return now.Sub(*m.AuthenticatedAt) > maxAge
+}
@@ -0,0 +1,58 @@
+package token
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCacheMetadataFileName(t *testing.T) {
+	testData := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{
+			name:     "access token",
+			options:  Options{LoginMethod: DeviceCodeLogin},
+			expected: "AzurePublicCloud-serverID-clientID-tenantID.metadata.json",
+		},
+		{
+			name:     "legacy token shares the metadata of the non-legacy one",
+			options:  Options{LoginMethod: DeviceCodeLogin, IsLegacy: true},
+			expected: "AzurePublicCloud-serverID-clientID-tenantID.metadata.json",
+		},
+		{
+			name:     "b2c policy",
+			options:  Options{LoginMethod: InteractiveLogin, B2CPolicy: "B2C_1_signin", IsLegacy: true},
+			expected: "AzurePublicCloud-serverID-clientID-tenantID_b2c_1_signin.metadata.json",
+		},
+		{
+			name:     "id token",
+			options:  Options{LoginMethod: DeviceCodeLogin, TokenType: TokenTypeID, IsLegacy: true},
+			expected: "AzurePublicCloud-serverID-clientID-tenantID_id.metadata.json",
+		},
+		{
+			name:     "azurecli",
+			options:  Options{LoginMethod: AzureCLILogin, TokenType: TokenTypeID},
+			expected: "AzurePublicCloud-serverID-clientID-tenantID_id_azurecli.metadata.json",
+		},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			o := data.options
+			o.Environment = defaultEnvironmentName
+			o.ServerID = "serverID"
+			o.ClientID = "clientID"
+			o.TenantID = "tenantID"
+			o.TokenCacheDir = "/cache"
+			expected := filepath.Join("/cache", data.expected)
+			if file := getCacheMetadataFileName(&o); file != expected {
+				t.Fatalf("expected %s, actual: %s", expected, file)
+			}
+			// the cache stats find the metadata from the token cache file
+			if file := getCacheMetadataFileNameOfToken(getCacheFileName(&o)); file != expected {
+				t.Fatalf("expected %s of the token cache file, actual: %s", expected, file)
+			}
+		})
+	}
+}
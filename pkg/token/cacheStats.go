@@ -0,0 +1,154 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// lifetimeBuckets are the upper bounds of the remaining lifetimes in the histogram of token-cache stats.
+// Expired tokens and the tokens living longer than the last bound are counted in their own buckets.
+var lifetimeBuckets = []time.Duration{15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// TokenCacheStats summarizes the tokens cached in a token cache directory
+type TokenCacheStats struct {
+	Dir string `json:"dir"`
+	// Now is the time the remaining lifetimes and ages are relative to
+	Now       time.Time       `json:"now"`
+	Audiences []AudienceStats `json:"audiences"`
+	// Lifetimes is the histogram of the remaining lifetimes of all tokens
+	Lifetimes []LifetimeBucket `json:"lifetimes"`
+}
+
+// AudienceStats summarizes the cached tokens of an audience, i.e. of a server ID, across client IDs, tenants, and environments
+type AudienceStats struct {
+	Audience    string `json:"audience"`
+	Tokens      int    `json:"tokens"`
+	Expired     int    `json:"expired"`
+	Refreshable int    `json:"refreshable"`
+	// OldestAuthenticatedAt is when the user authenticated for the oldest token, which --max-cache-age is compared with.
+	// It is nil when no time of authentication is recorded in the cache metadata.
+	OldestAuthenticatedAt *time.Time `json:"oldestAuthenticatedAt,omitempty"`
+	EarliestExpiresOn     time.Time  `json:"earliestExpiresOn"`
+	LatestExpiresOn       time.Time  `json:"latestExpiresOn"`
+	// LastUsedAt is when any of the tokens was last returned. It is nil when no use is recorded in the cache metadata.
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// LifetimeBucket is a bucket of the histogram of the remaining lifetimes
+type LifetimeBucket struct {
+	// Label is "expired", "< <bound>", or ">= <last bound>"
+	Label  string `json:"label"`
+	Tokens int    `json:"tokens"`
+}
+
+// GetTokenCacheStats reads the tokens and the cache metadata in the token cache directory without network calls.
+// Files which are not tokens, or cannot be read, are skipped.
+func GetTokenCacheStats(dir string) (TokenCacheStats, error) {
+	return getTokenCacheStats(dir, realClock{})
+}
+
+func getTokenCacheStats(dir string, c clock) (TokenCacheStats, error) {
+	stats := TokenCacheStats{Dir: dir, Now: c.Now().UTC(), Audiences: []AudienceStats{}}
+	counts := make([]int, len(lifetimeBuckets)+2)
+
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return stats, err
+	}
+	audiences := map[string]*AudienceStats{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" || strings.HasSuffix(f.Name(), ".metadata.json") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		token, err := adal.LoadToken(path)
+		if err != nil || token.IsZero() {
+			logf(5, "skipping %s which is not a token: %v", path, err)
+			continue
+		}
+
+		a, ok := audiences[token.Resource]
+		if !ok {
+			a = &AudienceStats{Audience: token.Resource, EarliestExpiresOn: token.Expires().UTC(), LatestExpiresOn: token.Expires().UTC()}
+			audiences[token.Resource] = a
+		}
+		a.Tokens++
+		remaining := timeUntilExpiry(c, *token)
+		if remaining <= 0 {
+			a.Expired++
+		}
+		if token.RefreshToken != "" {
+			a.Refreshable++
+		}
+		if token.Expires().Before(a.EarliestExpiresOn) {
+			a.EarliestExpiresOn = token.Expires().UTC()
+		}
+		if token.Expires().After(a.LatestExpiresOn) {
+			a.LatestExpiresOn = token.Expires().UTC()
+		}
+		counts[getLifetimeBucket(remaining)]++
+
+		m, err := readCacheMetadata(getCacheMetadataFileNameOfToken(path))
+		if err != nil {
+			logf(5, "%s", err)
+			continue
+		}
+		if m.AuthenticatedAt != nil && (a.OldestAuthenticatedAt == nil || m.AuthenticatedAt.Before(*a.OldestAuthenticatedAt)) {
+			a.OldestAuthenticatedAt = m.AuthenticatedAt
+		}
+		if m.LastUsedAt != nil && (a.LastUsedAt == nil || m.LastUsedAt.After(*a.LastUsedAt)) {
+			a.LastUsedAt = m.LastUsedAt
+		}
+	}
+
+	for _, a := range audiences {
+		stats.Audiences = append(stats.Audiences, *a)
+	}
+	sort.Slice(stats.Audiences, func(i, j int) bool { return stats.Audiences[i].Audience < stats.Audiences[j].Audience })
+	for i, n := range counts {
+		stats.Lifetimes = append(stats.Lifetimes, LifetimeBucket{Label: getLifetimeBucketLabel(i), Tokens: n})
+	}
+	return stats, nil
+}
+
+// getLifetimeBucket returns the index of the bucket of the remaining lifetime, where 0 is the bucket of expired tokens
+func getLifetimeBucket(remaining time.Duration) int {
+	if remaining <= 0 {
+		return 0
+	}
+	for i, bound := range lifetimeBuckets {
+		if remaining < bound {
+			return i + 1
+		}
+	}
+	return len(lifetimeBuckets) + 1
+}
+
+func getLifetimeBucketLabel(i int) string {
+	switch {
+	case i == 0:
+		return "expired"
+	case i <= len(lifetimeBuckets):
+		return "< " + formatBucketBound(lifetimeBuckets[i-1])
+	default:
+		return ">= " + formatBucketBound(lifetimeBuckets[len(lifetimeBuckets)-1])
+	}
+}
+
+// formatBucketBound formats the bound without the zero units of time.Duration.String, e.g. 1h instead of 1h0m0s
+func formatBucketBound(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
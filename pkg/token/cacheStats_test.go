@@ -0,0 +1,123 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestGetTokenCacheStats(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	expiresIn := func(d time.Duration) json.Number {
+		return json.Number(fmt.Sprintf("%d", now.Add(d).Unix()))
+	}
+	saveToken := func(name string, token adal.Token) {
+		if err := adal.SaveToken(filepath.Join(dir, name), 0600, token); err != nil {
+			t.Fatalf("unable to save token: %s", err)
+		}
+	}
+	saveToken("AzurePublicCloud-aks-client1-tenant.json", adal.Token{AccessToken: "a", Resource: "aks", ExpiresOn: expiresIn(30 * time.Minute), RefreshToken: "r"})
+	saveToken("AzurePublicCloud-aks-client1-tenant_legacy.json", adal.Token{AccessToken: "a", Resource: "aks", ExpiresOn: expiresIn(10 * time.Minute)})
+	saveToken("AzurePublicCloud-aks-client2-tenant.json", adal.Token{AccessToken: "a", Resource: "aks", ExpiresOn: expiresIn(-time.Hour)})
+	saveToken("AzurePublicCloud-arm-client1-tenant.json", adal.Token{AccessToken: "a", Resource: "arm", ExpiresOn: expiresIn(48 * time.Hour)})
+
+	authenticatedAt, lastUsedAt := now.Add(-72*time.Hour), now.Add(-time.Minute)
+	if err := writeCacheMetadata(filepath.Join(dir, "AzurePublicCloud-aks-client1-tenant.metadata.json"), cacheMetadata{AuthenticatedAt: &authenticatedAt, LastUsedAt: &lastUsedAt}); err != nil {
+		t.Fatalf("unable to write cache metadata: %s", err)
+	}
+	// neither the metadata cache nor files which are not tokens are counted
+	if err := os.MkdirAll(filepath.Join(dir, metadataCacheDirName), 0700); err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0600); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	stats, err := getTokenCacheStats(dir, &fakeClock{now: now})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []AudienceStats{
+		{
+			Audience:              "aks",
+			Tokens:                3,
+			Expired:               1,
+			Refreshable:           1,
+			OldestAuthenticatedAt: &authenticatedAt,
+			EarliestExpiresOn:     now.Add(-time.Hour),
+			LatestExpiresOn:       now.Add(30 * time.Minute),
+			LastUsedAt:            &lastUsedAt,
+		},
+		{
+			Audience:          "arm",
+			Tokens:            1,
+			EarliestExpiresOn: now.Add(48 * time.Hour),
+			LatestExpiresOn:   now.Add(48 * time.Hour),
+		},
+	}
+	if !reflect.DeepEqual(stats.Audiences, expected) {
+		t.Fatalf("expected audiences %+v, got %+v", expected, stats.Audiences)
+	}
+	expectedLifetimes := []LifetimeBucket{
+		{Label: "expired", Tokens: 1},
+		{Label: "< 15m", Tokens: 1},
+		{Label: "< 1h", Tokens: 1},
+		{Label: "< 6h"},
+		{Label: "< 24h"},
+		{Label: ">= 24h", Tokens: 1},
+	}
+	if !reflect.DeepEqual(stats.Lifetimes, expectedLifetimes) {
+		t.Fatalf("expected lifetimes %+v, got %+v", expectedLifetimes, stats.Lifetimes)
+	}
+
+	stats, err = getTokenCacheStats(filepath.Join(dir, "missing"), &fakeClock{now: now})
+	if err != nil || len(stats.Audiences) != 0 {
+		t.Fatalf("expected no audiences in a missing directory, got %+v, %v", stats, err)
+	}
+}
+
+func TestRecordTokenUsage(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := &fakeClock{now: now}
+	o := &Options{ServerID: "apiServer", TokenCacheDir: t.TempDir()}
+	p := &execCredentialPlugin{o: o, clock: c}
+	lastUsedAt := func() time.Time {
+		m, err := readCacheMetadata(getCacheMetadataFileName(o))
+		if err != nil || m.LastUsedAt == nil {
+			t.Fatalf("expected the last use to be recorded, got %+v, %v", m, err)
+		}
+		return *m.LastUsedAt
+	}
+
+	if err := p.recordTokenUsage(&tokenState{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := lastUsedAt(); !got.Equal(now) {
+		t.Fatalf("expected the last use at %s, got %s", now, got)
+	}
+
+	c.now = now.Add(lastUsedResolution / 2)
+	_ = p.recordTokenUsage(&tokenState{})
+	if got := lastUsedAt(); !got.Equal(now) {
+		t.Fatalf("expected the last use not to be written again within %s, got %s", lastUsedResolution, got)
+	}
+
+	c.now = now.Add(lastUsedResolution)
+	_ = p.recordTokenUsage(&tokenState{})
+	if got := lastUsedAt(); !got.Equal(c.now) {
+		t.Fatalf("expected the last use at %s, got %s", c.now, got)
+	}
+
+	readOnly := &Options{ServerID: "apiServer", TokenCacheDir: t.TempDir(), TokenCacheReadOnly: true}
+	_ = (&execCredentialPlugin{o: readOnly, clock: c}).recordTokenUsage(&tokenState{})
+	if _, err := os.Stat(getCacheMetadataFileName(readOnly)); !os.IsNotExist(err) {
+		t.Fatalf("expected a read-only token cache not to be written, got %v", err)
+	}
+}
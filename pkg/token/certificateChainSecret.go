@@ -0,0 +1,104 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // x5t is defined as SHA-1 thumbprint
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// certificateChainSecret implements adal.ServicePrincipalSecret for certificate authentication
+// that sends the whole certificate chain in the x5c header of the client assertion.
+// This is required by Subject Name + Issuer (SNI) authentication.
+type certificateChainSecret struct {
+	tokenEndpoint string
+	clientID      string
+	chain         []*x509.Certificate
+	privateKey    *rsa.PrivateKey
+}
+
+func newCertificateChainSecret(oAuthConfig adal.OAuthConfig, clientID string, chain []*x509.Certificate, privateKey *rsa.PrivateKey) (*certificateChainSecret, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain cannot be empty")
+	}
+	if privateKey == nil {
+		return nil, errors.New("privateKey cannot be nil")
+	}
+	return &certificateChainSecret{
+		tokenEndpoint: oAuthConfig.TokenEndpoint.String(),
+		clientID:      clientID,
+		chain:         chain,
+		privateKey:    privateKey,
+	}, nil
+}
+
+// SetAuthenticationValues is a method of the interface adal.ServicePrincipalSecret.
+func (s *certificateChainSecret) SetAuthenticationValues(_ *adal.ServicePrincipalToken, v *url.Values) error {
+	assertion, err := s.signJWT()
+	if err != nil {
+		return err
+	}
+	v.Set("client_assertion", assertion)
+	v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s certificateChainSecret) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("marshalling certificateChainSecret is not supported")
+}
+
+func (s *certificateChainSecret) signJWT() (string, error) {
+	// the leaf certificate is always the first one in the chain
+	thumbprint := sha1.Sum(s.chain[0].Raw) //nolint:gosec
+	x5c := make([]string, 0, len(s.chain))
+	for _, cert := range s.chain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	// The jti (JWT ID) claim provides a unique identifier for the JWT.
+	jti := make([]byte, 20)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.URLEncoding.EncodeToString(thumbprint[:]),
+		"x5c": x5c,
+	})
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": s.tokenEndpoint,
+		"iss": s.clientID,
+		"sub": s.clientID,
+		"jti": base64.URLEncoding.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
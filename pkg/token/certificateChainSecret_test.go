@@ -0,0 +1,93 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestCertificateChainSecret(t *testing.T) {
+	leafKey, leaf := createTestCertificate(t, "leaf")
+	_, intermediate := createTestCertificate(t, "intermediate")
+
+	oAuthConfig, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", "tenantID")
+	if err != nil {
+		t.Fatalf("unable to create oAuthConfig: %s", err)
+	}
+
+	t.Run("empty chain should return error", func(t *testing.T) {
+		_, err := newCertificateChainSecret(*oAuthConfig, "clientID", nil, leafKey)
+		if !ErrorContains(err, "certificate chain cannot be empty") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("client assertion should carry the whole chain in x5c header", func(t *testing.T) {
+		secret, err := newCertificateChainSecret(*oAuthConfig, "clientID", []*x509.Certificate{leaf, intermediate}, leafKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		v := url.Values{}
+		if err := secret.SetAuthenticationValues(nil, &v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		parts := strings.Split(v.Get("client_assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("expected 3 parts in client assertion, got %d", len(parts))
+		}
+		headerData, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		var header struct {
+			X5C []string `json:"x5c"`
+		}
+		if err := json.Unmarshal(headerData, &header); err != nil {
+			t.Fatalf("unable to unmarshal header: %s", err)
+		}
+		if len(header.X5C) != 2 {
+			t.Fatalf("expected 2 certificates in x5c, got %d", len(header.X5C))
+		}
+		if header.X5C[0] != base64.StdEncoding.EncodeToString(leaf.Raw) {
+			t.Fatal("expected leaf certificate to be the first one in x5c")
+		}
+
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&leafKey.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+			t.Fatalf("client assertion signature cannot be verified: %s", err)
+		}
+	})
+}
+
+func createTestCertificate(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate private key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unable to parse certificate: %s", err)
+	}
+	return key, cert
+}
@@ -0,0 +1,84 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenClaims are the claims of an Azure AD token deciding the identity and the groups seen by the API server
+type tokenClaims struct {
+	ObjectID          string      `json:"oid"`
+	UPN               string      `json:"upn"`
+	PreferredUsername string      `json:"preferred_username"`
+	AppID             string      `json:"appid"`
+	AuthorizedParty   string      `json:"azp"`
+	IDType            string      `json:"idtyp"`
+	TenantID          string      `json:"tid"`
+	Audience          interface{} `json:"aud"`
+	Groups            []string    `json:"groups"`
+	WIDs              []string    `json:"wids"`
+	// ClaimNames has groups when the user is member of too many groups to be included in the token
+	ClaimNames map[string]interface{} `json:"_claim_names"`
+	// Subject, Emails, and the policy in TrustFrameworkPolicy or AuthContextClassRef are the claims of B2C tokens,
+	// which have neither oid nor upn unless they are configured in the policy
+	Subject              string   `json:"sub"`
+	Emails               []string `json:"emails"`
+	TrustFrameworkPolicy string   `json:"tfp"`
+	AuthContextClassRef  string   `json:"acr"`
+}
+
+// summarizeClaims returns a one line summary of the RBAC relevant claims of the token.
+// Group object IDs are counted rather than listed, and the token itself is never included.
+func summarizeClaims(token string) (string, error) {
+	var claims tokenClaims
+	if err := parseJWTClaims("token", token, &claims); err != nil {
+		return "", err
+	}
+
+	policy := firstNonEmpty(claims.TrustFrameworkPolicy, claims.AuthContextClassRef)
+	objectID := claims.ObjectID
+	if objectID == "" && policy != "" {
+		// the subject of a B2C token is the object ID of the user
+		objectID = claims.Subject
+	}
+	fields := []string{"oid=" + objectID}
+	var email string
+	if len(claims.Emails) > 0 {
+		email = claims.Emails[0]
+	}
+	if upn := firstNonEmpty(claims.UPN, claims.PreferredUsername, email); upn != "" {
+		fields = append(fields, "upn="+upn)
+	}
+	if appID := firstNonEmpty(claims.AppID, claims.AuthorizedParty); appID != "" {
+		fields = append(fields, "appid="+appID)
+	}
+	if claims.IDType != "" {
+		fields = append(fields, "idtyp="+claims.IDType)
+	}
+	if _, ok := claims.ClaimNames["groups"]; ok {
+		// the API server only sees the groups in the token
+		fields = append(fields, "groups=overage")
+	} else {
+		fields = append(fields, fmt.Sprintf("groups=%d", len(claims.Groups)))
+	}
+	fields = append(fields, fmt.Sprintf("wids=[%s]", strings.Join(claims.WIDs, ",")))
+	if claims.TenantID != "" {
+		fields = append(fields, "tid="+claims.TenantID)
+	}
+	if claims.Audience != nil {
+		fields = append(fields, fmt.Sprintf("aud=%v", claims.Audience))
+	}
+	if policy != "" {
+		fields = append(fields, "policy="+policy)
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+	"k8s.io/klog"
+)
+
+// newUnsignedJWT returns a JWT with claims, whose signature is not verified by summarizeClaims
+func newUnsignedJWT(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %s", err)
+	}
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestSummarizeClaims(t *testing.T) {
+	testCases := []struct {
+		name        string
+		claims      map[string]interface{}
+		token       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name: "user",
+			claims: map[string]interface{}{
+				"oid":    "00000000-0000-0000-0000-000000000001",
+				"upn":    "foo@bar.com",
+				"idtyp":  "user",
+				"tid":    "tenantID",
+				"aud":    "6dae42f8-4368-4678-94ff-3960e28e3630",
+				"groups": []string{"group1", "group2"},
+				"wids":   []string{"62e90394-69f5-4237-9190-012177145e10"},
+			},
+			expected: "oid=00000000-0000-0000-0000-000000000001 upn=foo@bar.com idtyp=user groups=2 wids=[62e90394-69f5-4237-9190-012177145e10] tid=tenantID aud=6dae42f8-4368-4678-94ff-3960e28e3630",
+		},
+		{
+			name: "service principal",
+			claims: map[string]interface{}{
+				"oid":   "00000000-0000-0000-0000-000000000002",
+				"azp":   "clientID",
+				"idtyp": "app",
+			},
+			expected: "oid=00000000-0000-0000-0000-000000000002 appid=clientID idtyp=app groups=0 wids=[]",
+		},
+		{
+			name: "groups overage",
+			claims: map[string]interface{}{
+				"oid":          "00000000-0000-0000-0000-000000000003",
+				"_claim_names": map[string]string{"groups": "src1"},
+			},
+			expected: "oid=00000000-0000-0000-0000-000000000003 groups=overage wids=[]",
+		},
+		{
+			name: "B2C user",
+			claims: map[string]interface{}{
+				"sub":    "00000000-0000-0000-0000-000000000004",
+				"emails": []string{"foo@bar.com"},
+				"tfp":    "B2C_1A_signin",
+				"aud":    "clientID",
+			},
+			expected: "oid=00000000-0000-0000-0000-000000000004 upn=foo@bar.com groups=0 wids=[] aud=clientID policy=B2C_1A_signin",
+		},
+		{
+			name:        "not a JWT",
+			token:       "opaque",
+			expectedErr: "token is not a valid JWT",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := tc.token
+			if token == "" {
+				token = newUnsignedJWT(t, tc.claims)
+			}
+			summary, err := summarizeClaims(token)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if summary != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, summary)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginLogsClaims(t *testing.T) {
+	logs := captureLogs(t)
+	ctrl, tokenCache, _, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	accessToken := newUnsignedJWT(t, map[string]interface{}{"oid": "objectID", "upn": "foo@bar.com", "groups": []string{"group1"}})
+	cached := adal.Token{
+		AccessToken: accessToken,
+		Resource:    "apiServer",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+	tokenCache.EXPECT().Read(gomock.Any()).Return(cached, nil)
+	pluginWriter.EXPECT().Write(gomock.Any(), gomock.Any()).Return(nil)
+
+	o := &Options{
+		LoginMethod:   DeviceCodeLogin,
+		ClientID:      "clientID",
+		TenantID:      "tenantID",
+		ServerID:      "apiServer",
+		Environment:   defaultEnvironmentName,
+		TokenCacheDir: t.TempDir(),
+	}
+	o.tokenCacheFile = getCacheFileName(o)
+	plugin := execCredentialPlugin{o: o, tokenCache: tokenCache, execCredentialWriter: pluginWriter}
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	klog.Flush()
+	if !strings.Contains(logs.String(), "token claims: oid=objectID upn=foo@bar.com groups=1 wids=[]") {
+		t.Fatalf("expected the claims in logs, got %q", logs.String())
+	}
+	if strings.Contains(logs.String(), accessToken) {
+		t.Fatalf("token leaked in logs")
+	}
+}
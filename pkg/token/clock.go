@@ -0,0 +1,60 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// clockSkewWarningThreshold is how far the machine clock may deviate from the iat claim of a new token before a warning.
+// Azure AD backdates iat by up to 5 minutes to tolerate skew, which stays below the threshold.
+const clockSkewWarningThreshold = 10 * time.Minute
+
+// clock tells the current time, which decides whether tokens expire, whether the token cache is too old,
+// and the time of cache metadata, so that this logic is deterministic in tests
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// willExpireIn is adal.Token.WillExpireIn at the time of c.
+// Both times are absolute instants, so the result does not change with the time zone or DST of the machine.
+func willExpireIn(c clock, token adal.Token, d time.Duration) bool {
+	return !token.Expires().After(c.Now().Add(d))
+}
+
+// timeUntilExpiry is the remaining lifetime of token at the time of c
+func timeUntilExpiry(c clock, token adal.Token) time.Duration {
+	return token.Expires().Sub(c.Now())
+}
+
+type jwtIssuedAtClaims struct {
+	IssuedAt int64 `json:"iat"`
+}
+
+// warnClockSkew warns when the machine clock deviates from the iat claim of a token just issued by more than
+// clockSkewWarningThreshold, since tokens would then be considered expired too early or too late
+func warnClockSkew(c clock, token adal.Token) {
+	if skew, ok := getClockSkew(c, token); ok && skew > clockSkewWarningThreshold {
+		fmt.Fprintf(os.Stderr, "warning: the machine clock deviates from the issue time of the token by %s. Synchronize the clock so that tokens expire as expected\n", skew.Round(time.Second))
+	}
+}
+
+// getClockSkew returns how far the time of c deviates from the iat claim of token, in either direction.
+// It returns false when the token is not a JWT, or has no iat claim.
+func getClockSkew(c clock, token adal.Token) (time.Duration, bool) {
+	var claims jwtIssuedAtClaims
+	if err := parseJWTClaims("token", token.AccessToken, &claims); err != nil || claims.IssuedAt == 0 {
+		return 0, false
+	}
+	skew := c.Now().Sub(time.Unix(claims.IssuedAt, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew, true
+}
@@ -0,0 +1,116 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestWillExpireIn(t *testing.T) {
+	now := time.Date(2023, 3, 26, 1, 30, 0, 0, time.UTC)
+	token := adal.Token{ExpiresOn: json.Number(fmt.Sprintf("%d", now.Add(30*time.Minute).Unix()))}
+	c := &fakeClock{now: now}
+
+	if willExpireIn(c, token, expirationDelta) {
+		t.Fatalf("expected the token not to expire within %s", expirationDelta)
+	}
+	if got := timeUntilExpiry(c, token); got != 30*time.Minute {
+		t.Fatalf("expected the token to expire in 30m, got %s", got)
+	}
+
+	// the clock of a time zone switching to DST at the same instant does not change the result
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err == nil {
+		c.now = now.In(berlin)
+		if willExpireIn(c, token, expirationDelta) || timeUntilExpiry(c, token) != 30*time.Minute {
+			t.Fatalf("expected the expiry not to depend on the time zone")
+		}
+	}
+
+	c.now = now.Add(30*time.Minute - expirationDelta)
+	if !willExpireIn(c, token, expirationDelta) {
+		t.Fatalf("expected the token to expire within %s", expirationDelta)
+	}
+}
+
+func TestGetClockSkew(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := &fakeClock{now: now}
+	testCases := []struct {
+		name     string
+		token    string
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:     "clock behind the issue time",
+			token:    newUnsignedJWT(t, map[string]interface{}{"iat": now.Add(time.Hour).Unix()}),
+			expected: time.Hour,
+			ok:       true,
+		},
+		{
+			name:     "clock ahead of the backdated issue time",
+			token:    newUnsignedJWT(t, map[string]interface{}{"iat": now.Add(-5 * time.Minute).Unix()}),
+			expected: 5 * time.Minute,
+			ok:       true,
+		},
+		{
+			name:  "token without iat claim",
+			token: newUnsignedJWT(t, map[string]interface{}{"aud": "audience"}),
+		},
+		{
+			name:  "token which is not a JWT",
+			token: "opaque",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			skew, ok := getClockSkew(c, adal.Token{AccessToken: tc.token})
+			if ok != tc.ok || skew != tc.expected {
+				t.Fatalf("expected skew %s (%t), got %s (%t)", tc.expected, tc.ok, skew, ok)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginClock(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	// the token is only valid for the clock of the plugin
+	cachedToken := adal.Token{
+		AccessToken: "cachedToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", now.Add(time.Hour).Unix())),
+	}
+	tokenCache.EXPECT().Read(cacheFile).Return(cachedToken, nil)
+
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    MSILogin,
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		clock:                &fakeClock{now: now},
+	}
+	token, err := plugin.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != cachedToken.AccessToken {
+		t.Fatalf("expected the cached token, got %s", token.AccessToken)
+	}
+}
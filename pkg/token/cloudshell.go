@@ -0,0 +1,90 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	// msiEndpointEnv is set by Azure Cloud Shell to the token endpoint of the signed in user
+	msiEndpointEnv    = "MSI_ENDPOINT"
+	cloudShellTimeout = 30 * time.Second
+)
+
+type cloudShellToken struct {
+	resourceID string
+	endpoint   string
+	timeout    time.Duration
+	client     *http.Client
+}
+
+// newCloudShellToken returns a TokenProvider which gets the token of the user signed in to Azure Cloud Shell
+// from the endpoint in MSI_ENDPOINT environment variable.
+func newCloudShellToken(resourceID, endpoint string, timeout time.Duration, httpClient *http.Client) (TokenProvider, error) {
+	if resourceID == "" {
+		return nil, errors.New("resourceID cannot be empty")
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("%s environment variable is not set. %s login only works in Azure Cloud Shell", msiEndpointEnv, CloudShellLogin)
+	}
+
+	if timeout <= 0 {
+		timeout = cloudShellTimeout
+	}
+
+	return &cloudShellToken{
+		resourceID: resourceID,
+		endpoint:   endpoint,
+		timeout:    timeout,
+		client:     httpClient,
+	}, nil
+}
+
+func (p *cloudShellToken) Token() (adal.Token, error) {
+	emptyToken := adal.Token{}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	v := url.Values{}
+	v.Set("resource", p.resourceID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to create Cloud Shell token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Metadata", "true")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to send Cloud Shell token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to read Cloud Shell token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return emptyToken, fmt.Errorf("Cloud Shell token request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token adal.Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return emptyToken, fmt.Errorf("failed to unmarshal Cloud Shell token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return emptyToken, errors.New("did not receive a token")
+	}
+	if token.Resource == "" {
+		token.Resource = p.resourceID
+	}
+	return token, nil
+}
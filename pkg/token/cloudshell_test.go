@@ -0,0 +1,64 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewCloudShellTokenEmpty(t *testing.T) {
+	_, err := newCloudShellToken("", "http://localhost:50342/oauth2/token", 0, http.DefaultClient)
+	if !ErrorContains(err, "resourceID cannot be empty") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = newCloudShellToken("serverID", "", 0, http.DefaultClient)
+	if !ErrorContains(err, "MSI_ENDPOINT environment variable is not set") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCloudShellToken(t *testing.T) {
+	const serverID = "serverID"
+
+	t.Run("token should be requested from MSI_ENDPOINT", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Header.Get("Metadata") != "true" {
+				t.Errorf("unexpected request: %s %v", r.Method, r.Header)
+			}
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("resource") != serverID {
+				t.Errorf("unexpected form: %v, err: %v", r.PostForm, err)
+			}
+			_, _ = w.Write([]byte(`{"access_token":"token","expires_on":"1700000000","resource":"serverID","token_type":"Bearer"}`))
+		}))
+		defer server.Close()
+
+		provider, err := newCloudShellToken(serverID, server.URL, 0, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		token, err := provider.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token.AccessToken != "token" || token.Resource != serverID || token.ExpiresOn != "1700000000" {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+	})
+
+	t.Run("error response should return error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid resource", http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		provider, err := newCloudShellToken(serverID, server.URL, 0, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, err = provider.Token()
+		if !ErrorContains(err, "Cloud Shell token request failed with status code 400: invalid resource") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
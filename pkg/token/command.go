@@ -0,0 +1,70 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runCommand runs the command and returns its standard output.
+// When ctx is done before the command exits, the whole process group of the command is killed,
+// so that children such as the python process of Azure CLI do not outlive kubelogin.
+// Standard error of the command is surfaced in the returned error.
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return runCommandWithEnv(ctx, nil, name, args...)
+}
+
+// runCommandWithEnv runs the command like runCommand, with env added to the environment of kubelogin
+func runCommandWithEnv(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	return runCommandWithInput(ctx, env, nil, nil, name, args...)
+}
+
+// runCommandWithInput runs the command like runCommandWithEnv, writing stdin to its standard input.
+// When stderrPassthrough is not nil, standard error of the command is passed through to it as well, e.g. to prompt the user.
+// Standard output is also returned when the command exits with non-zero, e.g. to read the reason of the failure.
+func runCommandWithInput(ctx context.Context, env []string, stdin []byte, stderrPassthrough io.Writer, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stderrPassthrough != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, stderrPassthrough)
+	}
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return stdout.Bytes(), fmt.Errorf("%s: %w: %s", name, err, msg)
+			}
+			return stdout.Bytes(), fmt.Errorf("%s: %w", name, err)
+		}
+		return stdout.Bytes(), nil
+	case <-ctx.Done():
+		if err := killProcessGroup(cmd); err != nil && !errors.Is(err, errProcessDone) {
+			return nil, fmt.Errorf("%s: %w, and failed to kill the process: %s", name, ctx.Err(), err)
+		}
+		<-done
+		return nil, fmt.Errorf("%s: %w", name, ctx.Err())
+	}
+}
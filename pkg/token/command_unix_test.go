@@ -0,0 +1,138 @@
+//go:build !windows
+
+package token
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	t.Run("standard output should be returned", func(t *testing.T) {
+		output, err := runCommand(context.Background(), "sh", "-c", "echo hello")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(output) != "hello\n" {
+			t.Fatalf("unexpected output: %q", output)
+		}
+	})
+
+	t.Run("standard error should be surfaced in error", func(t *testing.T) {
+		_, err := runCommand(context.Background(), "sh", "-c", "echo 'Please run az login' >&2; exit 1")
+		if !ErrorContains(err, "Please run az login") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("process group should be killed on timeout", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		// the child keeps running after the shell if only the shell is killed
+		_, err := runCommand(ctx, "sh", "-c", "(sleep 1; touch "+marker+") & wait")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got: %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("runCommand should return on timeout")
+		}
+		time.Sleep(1500 * time.Millisecond)
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Fatal("child process should have been killed")
+		}
+	})
+}
+
+func TestAzureCLITokenFromFakeCLI(t *testing.T) {
+	testData := []struct {
+		name              string
+		script            string
+		expectedExpiresOn string
+		expectedError     string
+	}{
+		{
+			name:              "expires_on timestamp",
+			script:            `echo '{"accessToken":"token","expiresOn":"2023-01-01 00:00:00.000000","expires_on":1700000000}'`,
+			expectedExpiresOn: "1700000000",
+		},
+		{
+			name:              "cloud shell expiresOn",
+			script:            `echo '{"accessToken":"token","expiresOn":"2023-11-14T22:13:20Z"}'`,
+			expectedExpiresOn: "1700000000",
+		},
+		{
+			name:          "az failure",
+			script:        `echo "ERROR: Please run 'az login' to setup account." >&2; exit 1`,
+			expectedError: "Please run 'az login' to setup account.",
+		},
+		{
+			name:          "az timeout",
+			script:        `sleep 5`,
+			expectedError: "context deadline exceeded",
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "az"), []byte("#!/bin/sh\n"+data.script+"\n"), 0700); err != nil {
+				t.Fatalf("unable to write fake az: %s", err)
+			}
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			provider, err := newAzureCLIToken("serverID", "", 500*time.Millisecond, false, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			token, err := provider.Token()
+			if data.expectedError != "" {
+				if !ErrorContains(err, data.expectedError) {
+					t.Fatalf("expected error: %s, actual: %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != "token" || token.Resource != "serverID" || string(token.ExpiresOn) != data.expectedExpiresOn {
+				t.Fatalf("unexpected token: %+v", token)
+			}
+		})
+	}
+}
+
+func TestAzureCLITokenFromAzidentity(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := `echo "$@" > ` + args + `; echo '{"accessToken":"token","expiresOn":"2023-11-14T22:13:20Z"}'`
+	if err := os.WriteFile(filepath.Join(dir, "az"), []byte("#!/bin/sh\n"+script+"\n"), 0700); err != nil {
+		t.Fatalf("unable to write fake az: %s", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	provider, err := newAzureCLIToken("serverID", "tenantID", 500*time.Millisecond, true, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "token" || token.Resource != "serverID" || string(token.ExpiresOn) != "1700000000" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+	b, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatalf("fake az should have been run: %s", err)
+	}
+	if expected := "account get-access-token -o json --resource serverID --tenant tenantID\n"; string(b) != expected {
+		t.Fatalf("expected arguments %q, actual %q", expected, b)
+	}
+}
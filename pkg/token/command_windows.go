@@ -0,0 +1,21 @@
+//go:build windows
+
+package token
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+var errProcessDone = os.ErrProcessDone
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	// taskkill /T terminates the process tree, e.g. python spawned by az.cmd
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package token
+
+import (
+	"context"
+	"time"
+)
+
+// newTimeoutContext returns a context which is cancelled after timeout.
+// When timeout is not positive, the context has no deadline.
+func newTimeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
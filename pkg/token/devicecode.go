@@ -1,22 +1,41 @@
 package token
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/browser"
+)
+
+var (
+	// defaultDeviceCodePollInterval is used when the device authorization response has no interval
+	defaultDeviceCodePollInterval = 5 * time.Second
+	// deviceCodeSlowDownIncrement is added to the polling interval on slow_down error, see RFC 8628 section 3.5
+	deviceCodeSlowDownIncrement = 5 * time.Second
 )
 
 type deviceCodeTokenProvider struct {
-	clientID    string
-	resourceID  string
-	tenantID    string
-	oAuthConfig adal.OAuthConfig
+	clientID     string
+	resourceID   string
+	tenantID     string
+	openBrowser  bool
+	tokenType    string
+	timeout      time.Duration
+	pollInterval time.Duration
+	waitTimeout  time.Duration
+	oAuthConfig  adal.OAuthConfig
+	httpClient   *http.Client
+	log          *logSink
 }
 
-func newDeviceCodeTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID string) (TokenProvider, error) {
+func newDeviceCodeTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID string, openBrowser bool, tokenType string, timeout, pollInterval, waitTimeout time.Duration, httpClient *http.Client, log *logSink) (TokenProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("clientID cannot be empty")
 	}
@@ -28,30 +47,116 @@ func newDeviceCodeTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resource
 	}
 
 	return &deviceCodeTokenProvider{
-		clientID:    clientID,
-		resourceID:  resourceID,
-		tenantID:    tenantID,
-		oAuthConfig: oAuthConfig,
+		clientID:     clientID,
+		resourceID:   resourceID,
+		tenantID:     tenantID,
+		openBrowser:  openBrowser,
+		tokenType:    tokenType,
+		timeout:      timeout,
+		pollInterval: pollInterval,
+		waitTimeout:  waitTimeout,
+		oAuthConfig:  oAuthConfig,
+		httpClient:   httpClient,
+		log:          log,
 	}, nil
 }
 
 func (p *deviceCodeTokenProvider) Token() (adal.Token, error) {
 	emptyToken := adal.Token{}
-	client := &autorest.Client{}
-	deviceCode, err := adal.InitiateDeviceAuth(client, p.oAuthConfig, p.clientID, p.resourceID)
-	if err != nil {
-		return emptyToken, fmt.Errorf("initialing the device code authentication: %s", err)
+	var client adal.Sender = &autorest.Client{Sender: p.httpClient}
+	idTokenSender := newIDTokenSender(p.httpClient)
+	if p.tokenType == TokenTypeID {
+		client = idTokenSender
 	}
-
-	_, err = fmt.Fprintln(os.Stderr, *deviceCode.Message)
-	if err != nil {
-		return emptyToken, fmt.Errorf("prompting the device code message: %s", err)
+	if isB2COAuthConfig(p.oAuthConfig) {
+		client = &b2cSender{sender: client}
 	}
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	var deadline time.Time
+	if p.waitTimeout > 0 {
+		deadline = time.Now().Add(p.waitTimeout)
+	}
+
+	var token *adal.Token
+	for attempt := 0; ; attempt++ {
+		deviceCode, err := adal.InitiateDeviceAuthWithContext(ctx, client, p.oAuthConfig, p.clientID, p.resourceID)
+		if err != nil {
+			return emptyToken, fmt.Errorf("initialing the device code authentication: %w", err)
+		}
 
-	token, err := adal.WaitForUserCompletion(client, deviceCode)
-	if err != nil {
-		return emptyToken, fmt.Errorf("waiting for device code authentication to complete: %s", err)
+		_, err = fmt.Fprintln(os.Stderr, *deviceCode.Message)
+		if err != nil {
+			return emptyToken, fmt.Errorf("prompting the device code message: %s", err)
+		}
+
+		if p.openBrowser && attempt == 0 && deviceCode.VerificationURL != nil {
+			// the message is already printed, so failing to open the browser is not fatal
+			if err := browser.Open(*deviceCode.VerificationURL); err != nil {
+				p.log.logf(5, "unable to open browser for device code login: %s", err)
+			}
+		}
+
+		token, err = waitForDeviceCodeCompletion(ctx, client, deviceCode, p.pollInterval, deadline, p.log)
+		if isDeviceCodeExpired(err) && !deadline.IsZero() && time.Now().Before(deadline) {
+			// the device code expires before --device-code-timeout, e.g. while waiting for approvals, so prompt a new one
+			p.log.logf(5, "device code expired, requesting a new one")
+			continue
+		}
+		if err != nil {
+			return emptyToken, fmt.Errorf("waiting for device code authentication to complete: %w", err)
+		}
+		break
 	}
 
+	if p.tokenType == TokenTypeID {
+		return withIDToken(*token, idTokenSender.idToken)
+	}
 	return *token, nil
 }
+
+// waitForDeviceCodeCompletion polls the token endpoint until the user completes the device code login.
+// Unlike adal.WaitForUserCompletionWithContext, it keeps polling on slow_down error with the interval increased,
+// polls no more often than pollInterval, and gives up at deadline unless it is zero.
+func waitForDeviceCodeCompletion(ctx context.Context, sender adal.Sender, code *adal.DeviceCode, pollInterval time.Duration, deadline time.Time, log *logSink) (*adal.Token, error) {
+	interval := defaultDeviceCodePollInterval
+	if code.Interval != nil && *code.Interval > 0 {
+		interval = time.Duration(*code.Interval) * time.Second
+	}
+	// the interval of the authorization server is the minimum, so a custom interval can only poll less often
+	if pollInterval > interval {
+		interval = pollInterval
+	}
+
+	for {
+		token, err := adal.CheckForUserCompletionWithContext(ctx, sender, code)
+		switch {
+		case err == nil:
+			return token, nil
+		case errors.Is(err, adal.ErrDeviceSlowDown):
+			interval += deviceCodeSlowDownIncrement
+			log.logf(5, "authorization server asked to slow down, polling every %s", interval)
+		case errors.Is(err, adal.ErrDeviceAuthorizationPending):
+		default:
+			return nil, err
+		}
+
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			return nil, errors.New("the device code login was not completed within the device code timeout")
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isDeviceCodeExpired returns true when the user did not complete the login before the device code expired
+func isDeviceCodeExpired(err error) bool {
+	if err == nil {
+		return false
+	}
+	// RFC 8628 names the error expired_token, which adal does not recognize
+	return errors.Is(err, adal.ErrDeviceCodeExpired) || strings.Contains(err.Error(), "expired_token") || strings.Contains(err.Error(), "AADSTS70020")
+}
@@ -1,9 +1,13 @@
 package token
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 )
@@ -31,11 +35,11 @@ func TestNewDeviceCodeTokenProviderEmpty(t *testing.T) {
 
 			switch {
 			case strings.Contains(name, "clientID"):
-				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "", "", "")
+				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "", "", "", false, TokenTypeAccess, 0, 0, 0, http.DefaultClient, nil)
 			case strings.Contains(name, "resourceID"):
-				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "test", "", "")
+				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "test", "", "", false, TokenTypeAccess, 0, 0, 0, http.DefaultClient, nil)
 			case strings.Contains(name, "tenantID"):
-				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "test", "test", "")
+				_, err = newDeviceCodeTokenProvider(adal.OAuthConfig{}, "test", "test", "", false, TokenTypeAccess, 0, 0, 0, http.DefaultClient, nil)
 			default:
 				fmt.Println(false)
 			}
@@ -48,10 +52,124 @@ func TestNewDeviceCodeTokenProviderEmpty(t *testing.T) {
 }
 
 func TestNewDeviceCodeToken(t *testing.T) {
-	deviceCode := deviceCodeTokenProvider{}
+	deviceCode := deviceCodeTokenProvider{httpClient: http.DefaultClient}
 	_, err := deviceCode.Token()
 
 	if !ErrorContains(err, "initialing the device code authentication:") {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+// newDeviceCodeServer serves the device authorization endpoint and the token endpoint returning errors in order
+func newDeviceCodeServer(t *testing.T, tokenErrors ...string) (*httptest.Server, *int) {
+	deviceCodes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devicecode"):
+			deviceCodes++
+			fmt.Fprintf(w, `{"device_code":"code%d","user_code":"user","verification_url":"https://microsoft.com/devicelogin","expires_in":"900","interval":"0","message":"enter the code"}`, deviceCodes)
+		case strings.HasSuffix(r.URL.Path, "/token"):
+			if len(tokenErrors) > 0 {
+				fmt.Fprintf(w, `{"error":"%s","error_description":"%s"}`, tokenErrors[0], tokenErrors[0])
+				tokenErrors = tokenErrors[1:]
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"accessToken","token_type":"Bearer","expires_in":"3600","resource":"resourceID"}`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &deviceCodes
+}
+
+func setFastDeviceCodePolling(t *testing.T) {
+	pollInterval, slowDownIncrement := defaultDeviceCodePollInterval, deviceCodeSlowDownIncrement
+	defaultDeviceCodePollInterval, deviceCodeSlowDownIncrement = time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		defaultDeviceCodePollInterval, deviceCodeSlowDownIncrement = pollInterval, slowDownIncrement
+	})
+}
+
+func TestDeviceCodeTokenPolling(t *testing.T) {
+	testCases := []struct {
+		name                string
+		tokenErrors         []string
+		waitTimeout         time.Duration
+		expectedErr         string
+		expectedDeviceCodes int
+	}{
+		{
+			name:                "slow_down keeps polling",
+			tokenErrors:         []string{"slow_down", "slow_down", "slow_down", "authorization_pending"},
+			expectedDeviceCodes: 1,
+		},
+		{
+			name:                "new device code is prompted when it expires within the timeout",
+			tokenErrors:         []string{"authorization_pending", "code_expired", "expired_token"},
+			waitTimeout:         time.Hour,
+			expectedDeviceCodes: 3,
+		},
+		{
+			name:                "login fails when the device code expires without timeout",
+			tokenErrors:         []string{"expired_token"},
+			expectedErr:         "expired_token",
+			expectedDeviceCodes: 1,
+		},
+		{
+			name:                "access denied fails the login",
+			tokenErrors:         []string{"access_denied"},
+			expectedErr:         "Access Denied",
+			expectedDeviceCodes: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setFastDeviceCodePolling(t)
+			server, deviceCodes := newDeviceCodeServer(t, tc.tokenErrors...)
+			oAuthConfig, err := adal.NewOAuthConfig(server.URL, "tenantID")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			provider, err := newDeviceCodeTokenProvider(*oAuthConfig, "clientID", "resourceID", "tenantID", false, TokenTypeAccess, 0, 0, tc.waitTimeout, http.DefaultClient, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			token, err := provider.Token()
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if token.AccessToken != "accessToken" {
+					t.Fatalf("unexpected token: %+v", token)
+				}
+			}
+			if *deviceCodes != tc.expectedDeviceCodes {
+				t.Fatalf("expected %d device codes, got %d", tc.expectedDeviceCodes, *deviceCodes)
+			}
+		})
+	}
+}
+
+func TestWaitForDeviceCodeCompletionInterval(t *testing.T) {
+	setFastDeviceCodePolling(t)
+	server, _ := newDeviceCodeServer(t, "authorization_pending")
+	oAuthConfig, err := adal.NewOAuthConfig(server.URL, "tenantID")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	deviceCode := "code"
+	code := &adal.DeviceCode{DeviceCode: &deviceCode, OAuthConfig: *oAuthConfig}
+
+	// the deadline is reached before polling again with the custom interval
+	_, err = waitForDeviceCodeCompletion(context.Background(), http.DefaultClient, code, time.Hour, time.Now().Add(time.Minute), nil)
+	if !ErrorContains(err, "not completed within the device code timeout") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package token
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// envOption maps a flag to the environment variables the option may be specified in.
+// When more than one of the environment variables is set, the last one wins.
+type envOption struct {
+	flag    string
+	envVars func(o *Options) []string
+}
+
+func envVars(names ...string) func(*Options) []string {
+	return func(*Options) []string { return names }
+}
+
+// envOptions lists the options in the order they are resolved.
+// use-azurerm-env-vars and login are resolved first since they decide which environment variables other options are read from.
+var envOptions = []envOption{
+	{flag: "use-azurerm-env-vars", envVars: envVars(kubeloginUseAzureRMEnvVars, azureUseAzureRMEnvVars)},
+	{flag: "login", envVars: envVars(loginMethod, azureLoginMethod)},
+	{flag: "client-id", envVars: func(o *Options) []string {
+		if o.UseAzureRMTerraformEnv {
+			if o.LoginMethod == WorkloadIdentityLogin {
+				// workload identity webhook always injects AZURE_CLIENT_ID
+				return []string{terraformClientID, azureClientID}
+			}
+			return []string{terraformClientID}
+		}
+		return []string{kubeloginClientID, azureClientID}
+	}},
+	{flag: "client-secret", envVars: func(o *Options) []string {
+		if o.UseAzureRMTerraformEnv {
+			return []string{terraformClientSecret}
+		}
+		return []string{kubeloginClientSecret, azureClientSecret}
+	}},
+	{flag: "client-certificate", envVars: func(o *Options) []string {
+		if o.UseAzureRMTerraformEnv {
+			return []string{terraformClientCertificatePath}
+		}
+		return []string{kubeloginClientCertificatePath, azureClientCertificatePath}
+	}},
+	{flag: "client-certificate-password", envVars: func(o *Options) []string {
+		if o.UseAzureRMTerraformEnv {
+			return []string{terraformClientCertificatePassword}
+		}
+		return []string{kubeloginClientCertificatePassword, azureClientCertificatePassword}
+	}},
+	{flag: "tenant-id", envVars: func(o *Options) []string {
+		if o.UseAzureRMTerraformEnv {
+			return []string{terraformTenantID}
+		}
+		return []string{kubeloginTenantID, azureTenantID}
+	}},
+	{flag: "username", envVars: envVars(kubeloginROPCUsername, azureUsername)},
+	{flag: "password", envVars: envVars(kubeloginROPCPassword, azurePassword)},
+	{flag: "server-id", envVars: envVars(kubeloginServerID, azureServerID)},
+	{flag: "environment", envVars: envVars(kubeloginEnvironment, azureEnvironment)},
+	{flag: "token-cache-dir", envVars: envVars(kubeloginTokenCacheDir, azureTokenCacheDir)},
+	{flag: "federated-token-file", envVars: envVars(kubeloginFederatedTokenFile, azureFederatedTokenFile)},
+	{flag: "authority-host", envVars: envVars(kubeloginAuthorityHost, azureAuthorityHost)},
+	{flag: "identity-resource-id", envVars: envVars(kubeloginIdentityResourceID, azureIdentityResourceID)},
+	{flag: "legacy", envVars: envVars(kubeloginLegacy, azureLegacy)},
+	{flag: "legacy-audience", envVars: envVars(kubeloginLegacyAudience, azureLegacyAudience)},
+	{flag: "send-certificate-chain", envVars: envVars(kubeloginSendCertificateChain, azureSendCertificateChain)},
+	{flag: "mtls-pop", envVars: envVars(kubeloginMTLSPoP, azureMTLSPoP)},
+	{flag: "open-browser", envVars: envVars(kubeloginOpenBrowser, azureOpenBrowser)},
+	{flag: "device-code-poll-interval", envVars: envVars(kubeloginDeviceCodePollInterval, azureDeviceCodePollInterval)},
+	{flag: "device-code-timeout", envVars: envVars(kubeloginDeviceCodeTimeout, azureDeviceCodeTimeout)},
+	{flag: "nmi-endpoint", envVars: envVars(kubeloginNMIEndpoint, azureNMIEndpoint)},
+	{flag: "token-prefix", envVars: envVars(kubeloginTokenPrefix, azureTokenPrefix)},
+	{flag: "token-type", envVars: envVars(kubeloginTokenType, azureTokenType)},
+	{flag: "timeout", envVars: envVars(kubeloginTimeout, azureTimeout)},
+	{flag: "metadata-cache-ttl", envVars: envVars(kubeloginMetadataCacheTTL, azureMetadataCacheTTL)},
+	{flag: "reuse-refresh-token-across-audiences", envVars: envVars(kubeloginReuseRefreshToken, azureReuseRefreshToken)},
+	{flag: "trust-jwt-exp", envVars: envVars(kubeloginTrustJWTExp, azureTrustJWTExp)},
+	{flag: "max-cache-age", envVars: envVars(kubeloginMaxCacheAge, azureMaxCacheAge)},
+	{flag: "token-cache-read-only", envVars: envVars(kubeloginTokenCacheReadOnly, azureTokenCacheReadOnly)},
+	{flag: "sudo-cache-behavior", envVars: envVars(kubeloginSudoCacheBehavior, azureSudoCacheBehavior)},
+	{flag: "tls-ca-dir", envVars: envVars(kubeloginTLSCADir, azureTLSCADir)},
+	{flag: "azure-region", envVars: envVars(kubeloginAzureRegion, azureRegionalAuthorityName)},
+	{flag: "show-claims", envVars: envVars(kubeloginShowClaims, azureShowClaims)},
+	{flag: "rules-file", envVars: envVars(kubeloginRulesFile, azureRulesFile)},
+	{flag: "cache-azurecli-token", envVars: envVars(kubeloginCacheAzureCLIToken, azureCacheAzureCLIToken)},
+	{flag: "azurecli-use-azidentity", envVars: envVars(kubeloginAzureCLIUseAzidentity, azureAzureCLIUseAzidentity)},
+	{flag: "policy", envVars: envVars(kubeloginPolicy, azurePolicy)},
+	{flag: "record", envVars: envVars(kubeloginRecord, azureRecord)},
+	{flag: "replay", envVars: envVars(kubeloginReplay, azureReplay)},
+	{flag: "expiry-jitter", envVars: envVars(kubeloginExpiryJitter, azureExpiryJitter)},
+	{flag: "b2c-policy", envVars: envVars(kubeloginB2CPolicy, azureB2CPolicy)},
+	{flag: "fail-fast", envVars: envVars(kubeloginFailFast, azureFailFast)},
+	{flag: "sign-key", envVars: envVars(kubeloginSignKey, azureSignKey)},
+	{flag: "signature-file", envVars: envVars(kubeloginSignatureFile, azureSignatureFile)},
+	{flag: "account-alias", envVars: envVars(kubeloginAccountAlias, azureAccountAlias)},
+}
+
+// resolveFromEnv sets the options from environment variables with the precedence:
+// flags explicitly set in fs > environment variables > current values of the options.
+// fs must contain the flags registered by AddFlags for o.
+func resolveFromEnv(o *Options, fs *pflag.FlagSet) {
+	for _, opt := range envOptions {
+		f := fs.Lookup(opt.flag)
+		if f == nil || f.Changed {
+			continue
+		}
+		for _, name := range opt.envVars(o) {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := f.Value.Set(v); err != nil {
+				logf(5, "ignoring invalid value of %s environment variable for --%s: %s", name, opt.flag, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestResolveFromEnv(t *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		envVarMap map[string]string
+		expected  func(o Options) bool
+	}{
+		{
+			name:      "env var should override default value",
+			envVarMap: map[string]string{kubeloginServerID: "envServerID"},
+			expected:  func(o Options) bool { return o.ServerID == "envServerID" },
+		},
+		{
+			name:      "flag should take precedence over env var",
+			args:      []string{"--server-id", "flagServerID"},
+			envVarMap: map[string]string{kubeloginServerID: "envServerID", azureServerID: "envServerID"},
+			expected:  func(o Options) bool { return o.ServerID == "flagServerID" },
+		},
+		{
+			name:      "AZURE_ env var should take precedence over AAD_ env var",
+			envVarMap: map[string]string{kubeloginEnvironment: "AzureChinaCloud", azureEnvironment: "AzureUSGovernmentCloud"},
+			expected:  func(o Options) bool { return o.Environment == "AzureUSGovernmentCloud" },
+		},
+		{
+			name:      "flag should take precedence over login method env var",
+			args:      []string{"--login", ROPCLogin},
+			envVarMap: map[string]string{loginMethod: MSILogin},
+			expected:  func(o Options) bool { return o.LoginMethod == ROPCLogin },
+		},
+		{
+			name:      "bool env var should be parsed",
+			envVarMap: map[string]string{kubeloginLegacy: "true", azureOpenBrowser: "1"},
+			expected:  func(o Options) bool { return o.IsLegacy && o.OpenBrowser },
+		},
+		{
+			name:      "invalid bool env var should be ignored",
+			envVarMap: map[string]string{kubeloginSendCertificateChain: "maybe"},
+			expected:  func(o Options) bool { return !o.SendCertificateChain },
+		},
+		{
+			name:      "terraform env vars should be used when enabled by env var",
+			envVarMap: map[string]string{kubeloginUseAzureRMEnvVars: "true", terraformTenantID: "armTenantID", azureTenantID: "azureTenantID"},
+			expected:  func(o Options) bool { return o.UseAzureRMTerraformEnv && o.TenantID == "armTenantID" },
+		},
+		{
+			name:      "AZURE_ env var of record and replay should be used",
+			envVarMap: map[string]string{azureRecord: "record.json", azureReplay: "replay.json"},
+			expected:  func(o Options) bool { return o.Record == "record.json" && o.Replay == "replay.json" },
+		},
+		{
+			name:      "AZURE_ env var of expiry jitter should be used",
+			envVarMap: map[string]string{azureExpiryJitter: "5m"},
+			expected:  func(o Options) bool { return o.ExpiryJitter == 5*time.Minute },
+		},
+		{
+			name:      "AZURE_ env var of b2c policy should be used",
+			envVarMap: map[string]string{azureB2CPolicy: "B2C_1A_signin"},
+			expected:  func(o Options) bool { return o.B2CPolicy == "B2C_1A_signin" },
+		},
+		{
+			name:      "AZURE_ env var of fail fast should be used",
+			envVarMap: map[string]string{azureFailFast: "true"},
+			expected:  func(o Options) bool { return o.FailFast },
+		},
+		{
+			name:      "AZURE_ env var of sign key and signature file should be used",
+			envVarMap: map[string]string{azureSignKey: "key.pem", azureSignatureFile: "cred.jws"},
+			expected:  func(o Options) bool { return o.SignKey == "key.pem" && o.SignatureFile == "cred.jws" },
+		},
+		{
+			name:      "AZURE_ env var of account alias should be used",
+			envVarMap: map[string]string{azureAccountAlias: "work"},
+			expected:  func(o Options) bool { return o.AccountAlias == "work" },
+		},
+		{
+			name: "AZURE_CLIENT_ID should be used in workload identity login with terraform env vars",
+			args: []string{"--use-azurerm-env-vars"},
+			envVarMap: map[string]string{
+				loginMethod:       WorkloadIdentityLogin,
+				terraformClientID: "armClientID",
+				azureClientID:     "azureClientID",
+			},
+			expected: func(o Options) bool { return o.ClientID == "azureClientID" },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.envVarMap {
+				t.Setenv(k, v)
+			}
+			o := NewOptions()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			o.AddFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			o.UpdateFromEnvWithFlags(fs)
+			if !tc.expected(o) {
+				t.Fatalf("unexpected options: %+v", o)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package token
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+const (
+	azureStackCloudName = "AzureStackCloud"
+
+	// aksAADServerAppID is the application ID of the Azure Kubernetes Service AAD Server, the audience of AKS managed AAD clusters
+	aksAADServerAppID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+	// armAppID is the application ID of Azure Resource Manager, e.g. the audience of AKS Trusted Access
+	armAppID = "797f4846-ba00-4fd7-ba43-dac1f8f63013"
+)
+
+// serverIDShortcuts are the --server-id shortcuts of the well-known applications in the public, China, and US Government clouds
+var serverIDShortcuts = map[string]string{
+	"aks": aksAADServerAppID,
+	"arm": armAppID,
+}
+
+// cloudEnvironment describes an Azure environment and what the login methods can use in it
+type cloudEnvironment struct {
+	// name is the canonical name of the environment, which is used in token cache file names
+	name string
+	// aliases are the other names the environment may be specified with, case insensitively
+	aliases []string
+	// environment holds the endpoints of the environment. It is empty for Azure Stack,
+	// whose endpoints are read from the file in AZURE_ENVIRONMENT_FILEPATH environment variable
+	environment azure.Environment
+	// mtlsAuthorityHost is the host of the mutual TLS token endpoint, empty when mtls_pop token is not supported
+	mtlsAuthorityHost string
+	// regionalAuthorityHost is the host of the regional token endpoints prefixed with the region, e.g. westus2.login.microsoft.com,
+	// empty when regional token endpoints are not available
+	regionalAuthorityHost string
+	// imds is true when managed identities are served by the Instance Metadata Service, used in msi and nmi login
+	imds bool
+	// serverIDShortcuts maps the --server-id shortcuts, e.g. aks, to the application IDs in the environment
+	serverIDShortcuts map[string]string
+}
+
+var cloudEnvironments = []cloudEnvironment{
+	{
+		name:                  "AzurePublicCloud",
+		aliases:               []string{"AzureCloud", "public"},
+		environment:           azure.PublicCloud,
+		mtlsAuthorityHost:     "mtlsauth.microsoft.com",
+		regionalAuthorityHost: "login.microsoft.com",
+		imds:                  true,
+		serverIDShortcuts:     serverIDShortcuts,
+	},
+	{
+		name:                  "AzureChinaCloud",
+		aliases:               []string{"AzureChina", "china", "mooncake"},
+		environment:           azure.ChinaCloud,
+		regionalAuthorityHost: "login.chinacloudapi.cn",
+		imds:                  true,
+		serverIDShortcuts:     serverIDShortcuts,
+	},
+	{
+		name:                  "AzureUSGovernmentCloud",
+		aliases:               []string{"AzureUSGovernment", "usgov", "usgovernment", "fairfax"},
+		environment:           azure.USGovernmentCloud,
+		regionalAuthorityHost: "login.microsoftonline.us",
+		imds:                  true,
+		serverIDShortcuts:     serverIDShortcuts,
+	},
+	{
+		name:              "AzureGermanCloud",
+		aliases:           []string{"AzureGermany", "german", "germany", "blackforest"},
+		environment:       azure.GermanCloud,
+		imds:              true,
+		serverIDShortcuts: map[string]string{"arm": armAppID},
+	},
+	{
+		name:    azureStackCloudName,
+		aliases: []string{"AzureStack", "stack"},
+	},
+}
+
+// lookupCloudEnvironment returns the environment whose name or alias matches name case insensitively.
+// The default environment is returned when name is empty.
+func lookupCloudEnvironment(name string) (cloudEnvironment, error) {
+	if name == "" {
+		name = defaultEnvironmentName
+	}
+	for _, e := range cloudEnvironments {
+		if strings.EqualFold(e.name, name) {
+			return e, nil
+		}
+		for _, alias := range e.aliases {
+			if strings.EqualFold(alias, name) {
+				return e, nil
+			}
+		}
+	}
+	return cloudEnvironment{}, fmt.Errorf("'%s' is not a supported environment. Supported environment is one of %s", name, getSupportedEnvironments())
+}
+
+// getSupportedEnvironments returns the canonical names of the environments
+func getSupportedEnvironments() string {
+	names := make([]string, 0, len(cloudEnvironments))
+	for _, e := range cloudEnvironments {
+		names = append(names, e.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// GetEnvironmentNames returns the canonical names and aliases of the environments, in the order they are documented
+func GetEnvironmentNames() []string {
+	var names []string
+	for _, e := range cloudEnvironments {
+		names = append(names, e.name)
+		names = append(names, e.aliases...)
+	}
+	return names
+}
+
+// resolveEnvironmentName returns the canonical name of the environment name or alias,
+// or name itself when it is empty or not a known environment
+func resolveEnvironmentName(name string) string {
+	if name == "" {
+		return name
+	}
+	e, err := lookupCloudEnvironment(name)
+	if err != nil {
+		return name
+	}
+	return e.name
+}
+
+// azureEnvironment returns the endpoints of the environment
+func (e cloudEnvironment) azureEnvironment() (azure.Environment, error) {
+	if e.name == azureStackCloudName {
+		return azure.EnvironmentFromName(e.name)
+	}
+	return e.environment, nil
+}
+
+// lookupCloudEnvironmentByAuthority returns the environment whose authority is served by host
+func lookupCloudEnvironmentByAuthority(host string) (cloudEnvironment, bool) {
+	for _, e := range cloudEnvironments {
+		u, err := url.Parse(e.environment.ActiveDirectoryEndpoint)
+		if err == nil && u.Hostname() != "" && strings.EqualFold(u.Hostname(), host) {
+			return e, true
+		}
+	}
+	return cloudEnvironment{}, false
+}
+
+// resolveServerIDShortcut returns the application ID of the --server-id shortcut in the environment, e.g. aks,
+// or serverID itself when it is not a shortcut. The shortcuts in overrides, formatted as <name>=<application ID>[,...],
+// take precedence over the ones of the environment.
+func resolveServerIDShortcut(serverID, environment, overrides string) string {
+	if serverID == "" {
+		return serverID
+	}
+	for _, override := range strings.Split(overrides, ",") {
+		name, appID, ok := strings.Cut(strings.TrimSpace(override), "=")
+		if !ok {
+			if override != "" {
+				logf(5, "ignoring server ID shortcut %q without application ID, expected <name>=<application ID>", override)
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(name), serverID) {
+			return strings.TrimSpace(appID)
+		}
+	}
+	e, err := lookupCloudEnvironment(environment)
+	if err != nil {
+		return serverID
+	}
+	if appID, ok := e.serverIDShortcuts[strings.ToLower(serverID)]; ok {
+		logf(5, "using application ID %s of server ID shortcut %s in %s", appID, serverID, e.name)
+		return appID
+	}
+	return serverID
+}
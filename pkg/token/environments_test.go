@@ -0,0 +1,174 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestLookupCloudEnvironment(t *testing.T) {
+	testCases := []struct {
+		name         string
+		expectedName string
+		expectedErr  string
+	}{
+		{name: "", expectedName: "AzurePublicCloud"},
+		{name: "AzurePublicCloud", expectedName: "AzurePublicCloud"},
+		{name: "azurepubliccloud", expectedName: "AzurePublicCloud"},
+		{name: "AzureCloud", expectedName: "AzurePublicCloud"},
+		{name: "AzureChinaCloud", expectedName: "AzureChinaCloud"},
+		{name: "china", expectedName: "AzureChinaCloud"},
+		{name: "Mooncake", expectedName: "AzureChinaCloud"},
+		{name: "AzureUSGovernmentCloud", expectedName: "AzureUSGovernmentCloud"},
+		{name: "AzureUSGovernment", expectedName: "AzureUSGovernmentCloud"},
+		{name: "usgov", expectedName: "AzureUSGovernmentCloud"},
+		{name: "AzureGermanCloud", expectedName: "AzureGermanCloud"},
+		{name: "german", expectedName: "AzureGermanCloud"},
+		{name: "AzureStackCloud", expectedName: "AzureStackCloud"},
+		{name: "mars", expectedErr: "'mars' is not a supported environment"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := lookupCloudEnvironment(tc.name)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				if resolveEnvironmentName(tc.name) != tc.name {
+					t.Fatalf("expected unknown environment name %s to be kept", tc.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if e.name != tc.expectedName {
+				t.Fatalf("expected environment %s, got %s", tc.expectedName, e.name)
+			}
+		})
+	}
+}
+
+func TestResolveServerIDShortcut(t *testing.T) {
+	testCases := []struct {
+		name        string
+		serverID    string
+		environment string
+		overrides   string
+		expected    string
+	}{
+		{name: "aks in public cloud", serverID: "aks", environment: "AzurePublicCloud", expected: aksAADServerAppID},
+		{name: "shortcut is case insensitive", serverID: "AKS", environment: "AzureChinaCloud", expected: aksAADServerAppID},
+		{name: "arm in US Government cloud", serverID: "arm", environment: "AzureUSGovernmentCloud", expected: armAppID},
+		{name: "aks is not available in German cloud", serverID: "aks", environment: "AzureGermanCloud", expected: "aks"},
+		{name: "no shortcuts in Azure Stack", serverID: "arm", environment: azureStackCloudName, expected: "arm"},
+		{name: "application ID is kept", serverID: "serverID", environment: "AzurePublicCloud", expected: "serverID"},
+		{name: "empty server ID is kept", serverID: "", environment: "AzurePublicCloud", overrides: "=appID", expected: ""},
+		{name: "override takes precedence", serverID: "aks", environment: "AzurePublicCloud", overrides: "aks=customAppID", expected: "customAppID"},
+		{name: "override adds a shortcut", serverID: "myapp", environment: azureStackCloudName, overrides: "invalid, myapp = myAppID", expected: "myAppID"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := resolveServerIDShortcut(tc.serverID, tc.environment, tc.overrides); actual != tc.expected {
+				t.Fatalf("expected server ID %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCloudEnvironmentEndpoints(t *testing.T) {
+	testCases := []struct {
+		environment       string
+		authorityHost     string
+		mtlsTokenEndpoint string
+		imds              bool
+	}{
+		{
+			environment:       "AzurePublicCloud",
+			authorityHost:     "login.microsoftonline.com",
+			mtlsTokenEndpoint: "https://mtlsauth.microsoft.com/tenantID/oauth2/v2.0/token",
+			imds:              true,
+		},
+		{
+			environment:   "AzureChinaCloud",
+			authorityHost: "login.chinacloudapi.cn",
+			imds:          true,
+		},
+		{
+			environment:   "AzureUSGovernmentCloud",
+			authorityHost: "login.microsoftonline.us",
+			imds:          true,
+		},
+		{
+			environment:   "AzureGermanCloud",
+			authorityHost: "login.microsoftonline.de",
+			imds:          true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.environment, func(t *testing.T) {
+			e, err := lookupCloudEnvironment(tc.environment)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if e.imds != tc.imds {
+				t.Fatalf("expected IMDS availability %t, got %t", tc.imds, e.imds)
+			}
+
+			// the table has to agree with go-autorest
+			env, err := azure.EnvironmentFromName(tc.environment)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if e.environment.ActiveDirectoryEndpoint != env.ActiveDirectoryEndpoint {
+				t.Fatalf("expected active directory endpoint %s, got %s", env.ActiveDirectoryEndpoint, e.environment.ActiveDirectoryEndpoint)
+			}
+
+			for _, isLegacy := range []bool{false, true} {
+				oAuthConfig, err := getOAuthConfig(tc.environment, "tenantID", isLegacy)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if oAuthConfig.TokenEndpoint.Hostname() != tc.authorityHost {
+					t.Fatalf("expected authority host %s, got %s", tc.authorityHost, oAuthConfig.TokenEndpoint.Hostname())
+				}
+
+				endpoint, err := getMTLSPoPTokenEndpoint(*oAuthConfig, "tenantID")
+				if tc.mtlsTokenEndpoint == "" {
+					if err == nil {
+						t.Fatalf("expected mtls_pop token not to be supported, got endpoint %s", endpoint)
+					}
+				} else if endpoint != tc.mtlsTokenEndpoint {
+					t.Fatalf("expected mtls_pop token endpoint %s, got %s, err: %v", tc.mtlsTokenEndpoint, endpoint, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTokenProviderInAzureStack(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "azurestack.json")
+	if err := os.WriteFile(envFile, []byte(`{"name":"AzureStackCloud","activeDirectoryEndpoint":"https://adfs.local.azurestack.external/"}`), 0600); err != nil {
+		t.Fatalf("unable to write environment file: %s", err)
+	}
+	t.Setenv(azure.EnvironmentFilepathName, envFile)
+
+	o := &Options{
+		LoginMethod: MSILogin,
+		ServerID:    "serverID",
+		Environment: "stack",
+	}
+	if _, err := newTokenProvider(o); !ErrorContains(err, "msi login is not supported in AzureStackCloud") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o.LoginMethod = AzureCLILogin
+	if _, err := newTokenProvider(o); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
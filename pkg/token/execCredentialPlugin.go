@@ -3,12 +3,13 @@ package token
 //go:generate sh -c "mockgen -destination mock_$GOPACKAGE/execCredentialPlugin.go github.com/Azure/kubelogin/pkg/token ExecCredentialPlugin"
 
 import (
+	"crypto"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
-	"k8s.io/klog"
 )
 
 const (
@@ -24,127 +25,342 @@ type execCredentialPlugin struct {
 	tokenCache           TokenCache
 	execCredentialWriter ExecCredentialWriter
 	provider             TokenProvider
+	providerFactory      func(*Options) (TokenProvider, error)
 	disableTokenCache    bool
-	refresher            func(adal.OAuthConfig, string, string, string, *adal.Token) (TokenProvider, error)
+	cacheLocker          cacheLocker
+	// sudoUser is set when the files written to the token cache directory are given to the user running sudo
+	sudoUser  *sudoUser
+	refresher func(adal.OAuthConfig, string, string, string, string, time.Duration, *adal.Token) (TokenProvider, error)
+	// stages of getting the token, defaultTokenStages when nil
+	stages []tokenStage
+	// clock decides the expiry of tokens, realClock when nil
+	clock clock
+	// signer signs the ExecCredential written to standard output when it is set
+	signer crypto.Signer
 }
 
-func New(o *Options) (ExecCredentialPlugin, error) {
+func New(o *Options, opts ...Option) (ExecCredentialPlugin, error) {
+	plugin, err := newExecCredentialPlugin(o, applyOptions(opts))
+	if err != nil {
+		return nil, redactError(err)
+	}
+	return plugin, nil
+}
+
+// NewTokenProvider returns a TokenProvider which reads, refreshes and persists the token in the token cache
+// the same way get-token does, without writing ExecCredential to standard output.
+// The options only applied to the ExecCredential, e.g. TokenPrefix and signing, are rejected.
+func NewTokenProvider(o *Options, opts ...Option) (TokenProvider, error) {
+	po := applyOptions(opts)
+	if err := validateTokenProviderOptions(o, po); err != nil {
+		return nil, err
+	}
+	plugin, err := newExecCredentialPlugin(o, po)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	return plugin, nil
+}
+
+// validateTokenProviderOptions returns an error when an option only applied to the ExecCredential written for kubectl is set,
+// since a TokenProvider returns the token to the program instead
+func validateTokenProviderOptions(o *Options, po pluginOptions) error {
+	var option string
+	switch {
+	case o.TokenPrefix != "":
+		option = "--token-prefix"
+	case o.SignKey != "" || po.signer != nil:
+		option = "signing"
+	case o.SignatureFile != "":
+		option = "--signature-file"
+	case o.ShowClaims:
+		option = "--show-claims"
+	default:
+		return nil
+	}
+	return NewConfigError(fmt.Errorf("%s is not supported by a token provider, as it only applies to the ExecCredential written for kubectl", option))
+}
+
+func newExecCredentialPlugin(o *Options, po pluginOptions) (_ *execCredentialPlugin, err error) {
+	o.log = &logSink{logger: po.logger}
+	// the Key Vault secret source trusts the CAs, and its requests are recorded, as well
+	settings, err := newHTTPSettings(o)
+	if err != nil {
+		return nil, err
+	}
+	o.http = settings
+	if err := o.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			o.secrets.zero()
+		}
+	}()
+	// secrets have no recognizable format, so they are redacted by the digests of their values
+	registerSecrets(o.secrets.clientSecret, o.secrets.clientCertPassword, o.secrets.password)
+	settings.cassette.saveRecording()
+
+	policy, err := newTokenPolicy(o.Policy)
+	if err != nil {
+		return nil, NewConfigError(err)
+	}
 
 	logginOptionsObject := marshalOptionsForLogging(o)
 
-	klog.V(10).Info(logginOptionsObject)
+	o.log.logf(10, "%v", logginOptionsObject)
 	provider, err := newTokenProvider(o)
 	if err != nil {
 		return nil, err
 	}
-	disableTokenCache := false
-	if o.LoginMethod == ServicePrincipalLogin || o.LoginMethod == MSILogin || o.LoginMethod == WorkloadIdentityLogin || o.LoginMethod == AzureCLILogin {
-		disableTokenCache = true
+	method, _ := getLoginMethodOfOptions(o)
+	if method.Deprecated != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s login is deprecated: %s\n", method.Name, method.Deprecated)
+	}
+	var tokenCache TokenCache = &defaultTokenCache{}
+	locker := newFileCacheLocker(defaultCacheLockTimeout, defaultCacheLockStaleAfter, o.log)
+	if o.TokenCacheReadOnly {
+		// the lock file would be written to the token cache directory as well
+		tokenCache = newReadOnlyTokenCache(tokenCache)
+		locker = nil
+	}
+	var owner *sudoUser
+	if o.SudoCacheBehavior == SudoCacheBehaviorChown && !o.TokenCacheReadOnly {
+		if u, ok := getSudoUserOfCacheDir(o.TokenCacheDir); ok {
+			fmt.Fprintf(os.Stderr, "warning: running as root with sudo, files written to %s are given to the invoking user\n", o.TokenCacheDir)
+			owner = &u
+		}
+	}
+	signer := po.signer
+	if o.SignKey != "" {
+		if signer, err = loadSigningKey(o.SignKey); err != nil {
+			return nil, NewConfigError(err)
+		}
+	}
+	// the signer of WithExecCredentialSigner is only known once the options of New are applied, after Validate
+	if signer != nil && o.SignatureFile == "" {
+		return nil, NewConfigError(fmt.Errorf("--signature-file is required to sign the ExecCredential"))
+	}
+	// refresh tokens are redeemed with the HTTP client of the options as well
+	refresher := func(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID, tokenType string, timeout time.Duration, token *adal.Token) (TokenProvider, error) {
+		return newManualToken(oAuthConfig, clientID, resourceID, tenantID, tokenType, timeout, token, settings.newHTTPClient())
 	}
+
 	return &execCredentialPlugin{
 		o:                    o,
-		tokenCache:           &defaultTokenCache{},
+		tokenCache:           tokenCache,
 		execCredentialWriter: &execCredentialWriter{},
 		provider:             provider,
-		refresher:            newManualToken,
-		disableTokenCache:    disableTokenCache,
+		providerFactory:      newTokenProvider,
+		refresher:            refresher,
+		disableTokenCache:    !method.Cache,
+		cacheLocker:          locker,
+		sudoUser:             owner,
+		stages:               getTokenStages(o, policy),
+		clock:                realClock{},
+		signer:               signer,
 	}, nil
 }
 
+// getTokenStages returns the default stages with the stages of the options inserted, or nil when there are none
+func getTokenStages(o *Options, policy *tokenPolicy) []tokenStage {
+	var stages []tokenStage
+	if policy != nil {
+		// checked before the token is persisted, so that a denied token is never cached
+		stages = insertTokenStage(defaultTokenStages(), stageAcquire, policyStage(policy))
+	}
+	// the responses of --replay do not need connectivity
+	if o.FailFast && o.Replay == "" {
+		if stages == nil {
+			stages = defaultTokenStages()
+		}
+		stages = insertTokenStage(stages, stageValidate, probeStage())
+	}
+	return stages
+}
+
 func marshalOptionsForLogging(o *Options) KlogsLoggingPurposeOptions {
 	logginOptionsObject := KlogsLoggingPurposeOptions{
 		LoginMethod:            o.LoginMethod,
 		ClientID:               o.ClientID,
 		ClientCert:             o.ClientCert,
+		SendCertificateChain:   o.SendCertificateChain,
+		MTLSPoP:                o.MTLSPoP,
 		Username:               o.Username,
 		ServerID:               o.ServerID,
 		TenantID:               o.TenantID,
 		Environment:            o.Environment,
 		IsLegacy:               o.IsLegacy,
+		LegacyAudience:         o.LegacyAudience,
 		TokenCacheDir:          o.TokenCacheDir,
 		tokenCacheFile:         o.tokenCacheFile,
 		IdentityResourceID:     o.IdentityResourceID,
 		FederatedTokenFile:     o.FederatedTokenFile,
 		AuthorityHost:          o.AuthorityHost,
 		UseAzureRMTerraformEnv: o.UseAzureRMTerraformEnv,
+		OpenBrowser:            o.OpenBrowser,
+		NMIEndpoint:            o.NMIEndpoint,
+		TokenPrefix:            o.TokenPrefix,
+		TokenType:              o.TokenType,
+		Timeout:                o.Timeout,
+		MetadataCacheTTL:       o.MetadataCacheTTL,
+		ReuseRefreshToken:      o.ReuseRefreshToken,
+		TrustJWTExp:            o.TrustJWTExp,
+		MaxCacheAge:            o.MaxCacheAge,
+		TokenCacheReadOnly:     o.TokenCacheReadOnly,
+		DeviceCodePollInterval: o.DeviceCodePollInterval,
+		DeviceCodeTimeout:      o.DeviceCodeTimeout,
+		SudoCacheBehavior:      o.SudoCacheBehavior,
+		TLSCADir:               o.TLSCADir,
+		AzureRegion:            o.AzureRegion,
+		ShowClaims:             o.ShowClaims,
+		RulesFile:              o.RulesFile,
+		CacheAzureCLIToken:     o.CacheAzureCLIToken,
+		AzureCLIUseAzidentity:  o.AzureCLIUseAzidentity,
+		Policy:                 o.Policy,
+		MaxIdleConnsPerHost:    o.MaxIdleConnsPerHost,
+		Record:                 o.Record,
+		Replay:                 o.Replay,
+		ExpiryJitter:           o.ExpiryJitter,
+		B2CPolicy:              o.B2CPolicy,
+		FailFast:               o.FailFast,
+		SignKey:                o.SignKey,
+		SignatureFile:          o.SignatureFile,
+		AccountAlias:           o.AccountAlias,
 	}
 	return logginOptionsObject
 }
 
 func (p *execCredentialPlugin) Do() error {
-	var (
-		token adal.Token
-		err   error
-	)
-	if !p.disableTokenCache {
-		// get token from cache
-		token, err = p.tokenCache.Read(p.o.tokenCacheFile)
-		if err != nil {
-			return fmt.Errorf("unable to read from token cache: %s, err: %s", p.o.tokenCacheFile, err)
-		}
+	_, err := p.run(true)
+	return err
+}
+
+// showClaims prints the summary of the claims of the token handed to kubectl to standard error with --show-claims,
+// and logs it at verbosity 5 otherwise, so that the identity and groups seen by the API server can be verified
+func (p *execCredentialPlugin) showClaims(token adal.Token) {
+	summary, err := summarizeClaims(token.AccessToken)
+	if err != nil {
+		p.o.log.logf(5, "unable to summarize token claims: %s", err)
+		return
+	}
+	if p.o.ShowClaims {
+		fmt.Fprintf(os.Stderr, "token claims: %s\n", redact(summary))
+		return
 	}
+	p.o.log.logf(5, "token claims: %s", summary)
+}
+
+// Token returns the access token from the token cache when it is still valid,
+// refreshes it when it has expired, or acquires a new one from the underlying provider.
+// Tokens and secrets are redacted from the returned error.
+func (p *execCredentialPlugin) Token() (adal.Token, error) {
+	return p.run(false)
+}
 
-	// verify resource
-	targetAudience := p.o.ServerID
-	if p.o.IsLegacy {
-		targetAudience = fmt.Sprintf("spn:%s", p.o.ServerID)
+func (p *execCredentialPlugin) getClock() clock {
+	if p.clock == nil {
+		return realClock{}
 	}
-	if token.Resource == targetAudience && !token.IsZero() {
-		// if not expired, return
-		if !token.WillExpireIn(expirationDelta) {
-			klog.V(10).Info("access token is still valid. will return")
-			return p.execCredentialWriter.Write(token, os.Stdout)
-		}
+	return p.clock
+}
 
-		// if expired, try refresh when refresh token exists
-		if token.RefreshToken != "" {
-			tokenRefreshed := false
-			klog.V(10).Info("getting refresher")
-			oAuthConfig, err := getOAuthConfig(p.o.Environment, p.o.TenantID, p.o.IsLegacy)
-			if err != nil {
-				return fmt.Errorf("unable to get oAuthConfig: %s", err)
-			}
-			refresher, err := p.refresher(*oAuthConfig, p.o.ClientID, p.o.ServerID, p.o.TenantID, &token)
-			if err != nil {
-				return fmt.Errorf("failed to get refresher: %s", err)
-			}
-			klog.V(5).Info("refresh token")
-			token, err := refresher.Token()
-			// if refresh fails, we will login using token provider
-			if err != nil {
-				klog.V(5).Infof("refresh failed, will continue to login: %s", err)
-			} else {
-				tokenRefreshed = true
-			}
-
-			if tokenRefreshed {
-				klog.V(10).Info("token refreshed")
-
-				// if refresh succeeds, save tooken, and return
-				if err := p.tokenCache.Write(p.o.tokenCacheFile, token); err != nil {
-					return fmt.Errorf("failed to write to store: %s", err)
-				}
-
-				return p.execCredentialWriter.Write(token, os.Stdout)
-			}
-		} else {
-			klog.V(5).Info("there is no refresh token")
-		}
+// run runs the token pipeline, writing the ExecCredential to standard output when emit is set
+func (p *execCredentialPlugin) run(emit bool) (adal.Token, error) {
+	s := &tokenState{emit: emit}
+	err := p.runTokenStages(s)
+	if p.sudoUser != nil {
+		chownTokenCacheDir(p.o.TokenCacheDir, *p.sudoUser, p.o.log)
+	}
+	if err != nil {
+		return adal.Token{}, redactError(err)
+	}
+	return s.token, nil
+}
+
+// withJWTExpiry takes the expiry of token from the exp claim of the JWT when --trust-jwt-exp is set.
+// The expiry returned by the token endpoint is kept when the token is not a JWT with exp claim.
+func (p *execCredentialPlugin) withJWTExpiry(token adal.Token) adal.Token {
+	return withTrustedJWTExpiry(p.o, token)
+}
+
+// withTrustedJWTExpiry returns token with the expiry of the exp claim when --trust-jwt-exp is set in o,
+// see execCredentialPlugin.withJWTExpiry
+func withTrustedJWTExpiry(o *Options, token adal.Token) adal.Token {
+	if !o.TrustJWTExp || token.AccessToken == "" {
+		return token
 	}
+	t, err := withJWTExpiry(token)
+	if err != nil {
+		o.log.logf(5, "unable to use exp claim as token expiry: %s", err)
+		return token
+	}
+	return t
+}
 
-	klog.V(5).Info("acquire new token")
-	// run the underlying provider
-	token, err = p.provider.Token()
+// tokenFromOtherAudiences acquires the token with a refresh token cached for another server ID
+// of the same client ID and tenant ID, so that the user is not prompted again for each server ID.
+// It returns the cache metadata file of the other server ID with the token, and false when none of the refresh tokens works.
+func (p *execCredentialPlugin) tokenFromOtherAudiences() (adal.Token, string, bool, error) {
+	if method, _ := getLoginMethod(p.o.LoginMethod); !method.Refresh {
+		return adal.Token{}, "", false, nil
+	}
+	files, err := filepath.Glob(getCacheFileNameForServerID(p.o, "*"))
 	if err != nil {
-		return fmt.Errorf("failed to get token: %s", err)
+		p.o.log.logf(5, "unable to list token cache files of other audiences: %s", err)
+		return adal.Token{}, "", false, nil
+	}
+	oAuthConfig, err := getOAuthConfigForOptions(p.o)
+	if err != nil {
+		return adal.Token{}, "", false, fmt.Errorf("unable to get oAuthConfig: %s", err)
 	}
 
-	if !p.disableTokenCache {
-		// save token
-		if err := p.tokenCache.Write(p.o.tokenCacheFile, token); err != nil {
-			return fmt.Errorf("unable to write to token cache: %s, err: %s", p.o.tokenCacheFile, err)
+	for _, file := range files {
+		if file == p.o.tokenCacheFile {
+			continue
+		}
+		other := *p.o
+		other.ServerID = getServerIDFromCacheFileName(p.o, file)
+		otherMetadataFile := getCacheMetadataFileName(&other)
+		if p.o.MaxCacheAge > 0 && isMaxCacheAgeExceeded(otherMetadataFile, p.o.MaxCacheAge, p.getClock().Now()) {
+			p.o.log.logf(5, "last authentication of %s is older than %s, skipping", file, p.o.MaxCacheAge)
+			continue
+		}
+		cached, err := p.tokenCache.Read(file)
+		if err != nil || cached.RefreshToken == "" {
+			continue
+		}
+		refresher, err := p.refresher(*oAuthConfig, p.o.ClientID, p.o.ServerID, p.o.TenantID, p.o.TokenType, p.o.Timeout, &cached)
+		if err != nil {
+			return adal.Token{}, "", false, fmt.Errorf("failed to get refresher: %s", err)
+		}
+		p.o.log.logf(5, "acquire token with refresh token of %s", file)
+		token, err := refresher.Token()
+		if err != nil {
+			p.o.log.logf(5, "unable to acquire token with refresh token of %s: %s", file, err)
+			continue
 		}
+		return p.withJWTExpiry(token), otherMetadataFile, true, nil
 	}
+	return adal.Token{}, "", false, nil
+}
 
-	return p.execCredentialWriter.Write(token, os.Stdout)
+// tokenWithLegacyAudience switches to 'spn:' prefix in audience claim and acquires the token again
+func (p *execCredentialPlugin) tokenWithLegacyAudience() (adal.Token, error) {
+	p.o.IsLegacy = true
+	p.o.tokenCacheFile = getCacheFileName(p.o)
+	provider, err := p.providerFactory(p.o)
+	if err != nil {
+		return adal.Token{}, err
+	}
+	p.provider = provider
+	return p.provider.Token()
+}
+
+// getTargetAudience returns the resource the cached token is expected to be issued for
+func getTargetAudience(o *Options) string {
+	if o.IsLegacy {
+		return fmt.Sprintf("spn:%s", o.ServerID)
+	}
+	return o.ServerID
 }
@@ -1,10 +1,14 @@
 package token
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -116,6 +120,7 @@ func TestExecCredentialPlugin(t *testing.T) {
 			}
 
 			data.setupExpectations(tc)
+			data.options.TokenCacheDir = t.TempDir()
 
 			plugin := execCredentialPlugin{
 				o:                    data.options,
@@ -135,6 +140,590 @@ func TestExecCredentialPlugin(t *testing.T) {
 	}
 }
 
+func TestExecCredentialPluginNonInteractive(t *testing.T) {
+	const (
+		cacheFile = "cacheFile"
+	)
+	testData := []struct {
+		name            string
+		loginMethod     string
+		execInfoEnvTest string
+		expectProvider  bool
+		expectedError   string
+	}{
+		{
+			name:            "devicecode login with v1 and spec.interactive false should not prompt",
+			loginMethod:     DeviceCodeLogin,
+			execInfoEnvTest: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			expectedError:   "devicecode login requires user interaction but the exec plugin is not run interactively",
+		},
+		{
+			name:            "devicecode login with v1 and spec.interactive true should prompt",
+			loginMethod:     DeviceCodeLogin,
+			execInfoEnvTest: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true}}`,
+			expectProvider:  true,
+		},
+		{
+			name:            "devicecode login with v1beta1 should prompt regardless of spec.interactive",
+			loginMethod:     DeviceCodeLogin,
+			execInfoEnvTest: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{"interactive":false}}`,
+			expectProvider:  true,
+		},
+		{
+			name:            "ropc login with v1 and spec.interactive false should invoke token provider",
+			loginMethod:     ROPCLogin,
+			execInfoEnvTest: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			expectProvider:  true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, data.execInfoEnvTest)
+			ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+			defer ctrl.Finish()
+
+			tokenCache.EXPECT().Read(cacheFile).Return(adal.Token{}, nil)
+			if data.expectProvider {
+				tokenProvider.EXPECT().Token().Return(adal.Token{}, nil)
+				tokenCache.EXPECT().Write(cacheFile, adal.Token{}).Return(nil)
+				pluginWriter.EXPECT().Write(adal.Token{}, os.Stdout)
+			}
+
+			plugin := execCredentialPlugin{
+				o: &Options{
+					TokenCacheDir:  t.TempDir(),
+					LoginMethod:    data.loginMethod,
+					tokenCacheFile: cacheFile,
+				},
+				tokenCache:           tokenCache,
+				provider:             tokenProvider,
+				execCredentialWriter: pluginWriter,
+			}
+
+			err := plugin.Do()
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if errMessage != data.expectedError {
+				t.Fatalf("expectedError: %s, actual: %s", data.expectedError, errMessage)
+			}
+			if err != nil && GetExitCode(err) != ExitCodeInteractiveLoginRequired {
+				t.Fatalf("expected exit code: %d, actual: %d", ExitCodeInteractiveLoginRequired, GetExitCode(err))
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginLegacyAudienceAuto(t *testing.T) {
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+	legacyTokenProvider := mock_token.NewMockTokenProvider(ctrl)
+
+	o := &Options{
+		ServerID:       "apiServer",
+		TokenCacheDir:  t.TempDir(),
+		LegacyAudience: LegacyAudienceAuto,
+	}
+	o.tokenCacheFile = getCacheFileName(o)
+	legacyToken := adal.Token{Resource: "spn:apiServer"}
+
+	tokenCache.EXPECT().Read(o.tokenCacheFile).Return(adal.Token{}, nil)
+	tokenProvider.EXPECT().Token().Return(adal.Token{}, errors.New("AADSTS500011: resource principal not found"))
+	legacyTokenProvider.EXPECT().Token().Return(legacyToken, nil)
+	tokenCache.EXPECT().Write(getCacheFileName(&Options{ServerID: "apiServer", TokenCacheDir: o.TokenCacheDir, IsLegacy: true}), legacyToken).Return(nil)
+	pluginWriter.EXPECT().Write(legacyToken, os.Stdout)
+
+	plugin := execCredentialPlugin{
+		o:                    o,
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		providerFactory: func(o *Options) (TokenProvider, error) {
+			if !o.IsLegacy {
+				t.Fatal("expected provider to be created with legacy audience")
+			}
+			return legacyTokenProvider, nil
+		},
+	}
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m, err := readCacheMetadata(getCacheMetadataFileName(o))
+	if err != nil {
+		t.Fatalf("unable to read cache metadata: %s", err)
+	}
+	if m.LegacyAudience == nil || !*m.LegacyAudience {
+		t.Fatalf("expected legacy audience to be recorded in cache metadata, got %+v", m)
+	}
+
+	// next run should skip probing
+	next := &Options{
+		ServerID:       "apiServer",
+		TokenCacheDir:  o.TokenCacheDir,
+		LegacyAudience: LegacyAudienceAuto,
+	}
+	next.UpdateFromEnv()
+	if !next.IsLegacy {
+		t.Fatal("expected legacy audience to be read from cache metadata")
+	}
+}
+
+func TestExecCredentialPluginLegacyAudienceAutoOtherError(t *testing.T) {
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	o := &Options{
+		ServerID:       "apiServer",
+		TokenCacheDir:  t.TempDir(),
+		LegacyAudience: LegacyAudienceAuto,
+	}
+	o.tokenCacheFile = getCacheFileName(o)
+
+	tokenCache.EXPECT().Read(o.tokenCacheFile).Return(adal.Token{}, nil)
+	tokenProvider.EXPECT().Token().Return(adal.Token{}, errors.New("AADSTS7000215: Invalid client secret provided"))
+
+	plugin := execCredentialPlugin{
+		o:                    o,
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		providerFactory: func(o *Options) (TokenProvider, error) {
+			t.Fatal("expected the token not to be acquired again with legacy audience")
+			return nil, nil
+		},
+	}
+	if err := plugin.Do(); !ErrorContains(err, "AADSTS7000215") {
+		t.Fatalf("expected the original error to be returned, got %v", err)
+	}
+	if o.IsLegacy {
+		t.Fatal("expected legacy audience not to be used")
+	}
+}
+
+func TestExecCredentialPluginTokenPrefix(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	validToken := adal.Token{
+		AccessToken: "accessToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+	prefixedToken := validToken
+	prefixedToken.AccessToken = "Pomerium-accessToken"
+	tokenCache.EXPECT().Read(cacheFile).Return(validToken, nil)
+	pluginWriter.EXPECT().Write(prefixedToken, os.Stdout).Return(nil)
+
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    ROPCLogin,
+			TokenPrefix:    "Pomerium-",
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+	}
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestExecCredentialPluginReuseRefreshTokenAcrossAudiences(t *testing.T) {
+	testData := []struct {
+		name          string
+		reuse         bool
+		refreshErr    error
+		expectedLogin bool
+	}{
+		{
+			name:  "refresh token of another audience is used",
+			reuse: true,
+		},
+		{
+			name:          "login when refresh token of another audience does not work",
+			reuse:         true,
+			refreshErr:    errors.New("invalid_grant"),
+			expectedLogin: true,
+		},
+		{
+			name:          "login when reusing refresh token is not enabled",
+			expectedLogin: true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+			defer ctrl.Finish()
+			refreshProvider := mock_token.NewMockTokenProvider(ctrl)
+
+			o := &Options{
+				LoginMethod:       DeviceCodeLogin,
+				ClientID:          "clientID",
+				TenantID:          "tenantID",
+				ServerID:          "apiServer",
+				Environment:       defaultEnvironmentName,
+				TokenCacheDir:     t.TempDir(),
+				ReuseRefreshToken: data.reuse,
+			}
+			o.tokenCacheFile = getCacheFileName(o)
+			otherCacheFile := getCacheFileNameForServerID(o, "otherServer")
+			if err := os.WriteFile(otherCacheFile, []byte("{}"), 0600); err != nil {
+				t.Fatalf("unable to write token cache file: %s", err)
+			}
+
+			otherToken := adal.Token{Resource: "otherServer", RefreshToken: "refreshToken"}
+			newToken := adal.Token{
+				AccessToken: "accessToken",
+				Resource:    "apiServer",
+				ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+			}
+			tokenCache.EXPECT().Read(o.tokenCacheFile).Return(adal.Token{}, nil)
+			if data.reuse {
+				tokenCache.EXPECT().Read(otherCacheFile).Return(otherToken, nil)
+				refreshProvider.EXPECT().Token().Return(newToken, data.refreshErr)
+			}
+			if data.expectedLogin {
+				tokenProvider.EXPECT().Token().Return(newToken, nil)
+			}
+			tokenCache.EXPECT().Write(o.tokenCacheFile, newToken).Return(nil)
+			pluginWriter.EXPECT().Write(newToken, os.Stdout).Return(nil)
+
+			plugin := execCredentialPlugin{
+				o:                    o,
+				tokenCache:           tokenCache,
+				provider:             tokenProvider,
+				execCredentialWriter: pluginWriter,
+				refresher: func(_ adal.OAuthConfig, _, resourceID, _, _ string, _ time.Duration, token *adal.Token) (TokenProvider, error) {
+					if resourceID != "apiServer" || token.RefreshToken != "refreshToken" {
+						t.Fatalf("unexpected refresher for resource %s with token %+v", resourceID, token)
+					}
+					return refreshProvider, nil
+				},
+			}
+			if err := plugin.Do(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginTrustJWTExp(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	exp := time.Now().Add(time.Hour).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud":"apiServer","exp":%d}`, exp)))
+	// the expiry returned by the token endpoint is wrong
+	cachedToken := adal.Token{
+		AccessToken: "header." + payload + ".signature",
+		Resource:    "apiServer",
+		ExpiresIn:   "3600",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())),
+	}
+	expectedToken := cachedToken
+	expectedToken.ExpiresIn = ""
+	expectedToken.ExpiresOn = json.Number(fmt.Sprintf("%d", exp-int64(expirationDelta.Seconds())))
+	tokenCache.EXPECT().Read(cacheFile).Return(cachedToken, nil)
+	pluginWriter.EXPECT().Write(expectedToken, os.Stdout).Return(nil)
+
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    DeviceCodeLogin,
+			ServerID:       "apiServer",
+			TrustJWTExp:    true,
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+	}
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestExecCredentialPluginMaxCacheAge(t *testing.T) {
+	testData := []struct {
+		name            string
+		authenticatedAt *time.Time
+		expectedLogin   bool
+	}{
+		{
+			name:            "cached token is used when the last authentication is within the limit",
+			authenticatedAt: func() *time.Time { t := time.Now().Add(-time.Hour); return &t }(),
+		},
+		{
+			name:            "login when the last authentication is older than the limit",
+			authenticatedAt: func() *time.Time { t := time.Now().Add(-48 * time.Hour); return &t }(),
+			expectedLogin:   true,
+		},
+		{
+			name:          "login when the last authentication is unknown",
+			expectedLogin: true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+			defer ctrl.Finish()
+
+			o := &Options{
+				LoginMethod:   DeviceCodeLogin,
+				ServerID:      "apiServer",
+				TokenCacheDir: t.TempDir(),
+				MaxCacheAge:   24 * time.Hour,
+			}
+			o.tokenCacheFile = getCacheFileName(o)
+			if err := writeCacheMetadata(getCacheMetadataFileName(o), cacheMetadata{AuthenticatedAt: data.authenticatedAt}); err != nil {
+				t.Fatalf("unable to write cache metadata: %s", err)
+			}
+
+			validToken := adal.Token{
+				AccessToken:  "accessToken",
+				RefreshToken: "refreshToken",
+				Resource:     "apiServer",
+				ExpiresOn:    json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+			}
+			tokenCache.EXPECT().Read(o.tokenCacheFile).Return(validToken, nil)
+			if data.expectedLogin {
+				tokenProvider.EXPECT().Token().Return(validToken, nil)
+				tokenCache.EXPECT().Write(o.tokenCacheFile, validToken).Return(nil)
+			}
+			pluginWriter.EXPECT().Write(validToken, os.Stdout).Return(nil)
+
+			plugin := execCredentialPlugin{
+				o:                    o,
+				tokenCache:           tokenCache,
+				provider:             tokenProvider,
+				execCredentialWriter: pluginWriter,
+			}
+			if err := plugin.Do(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if isMaxCacheAgeExceeded(getCacheMetadataFileName(o), o.MaxCacheAge, time.Now()) {
+				t.Fatal("expected the last authentication to be within the limit")
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginAzureCLITokenCache(t *testing.T) {
+	testData := []struct {
+		name           string
+		profileChanged bool
+		expectedLogin  bool
+	}{
+		{
+			name: "cached token is used when the Azure CLI profile did not change",
+		},
+		{
+			name:           "run Azure CLI when the Azure CLI profile changed after the token was cached",
+			profileChanged: true,
+			expectedLogin:  true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+			defer ctrl.Finish()
+
+			o := &Options{
+				LoginMethod:        AzureCLILogin,
+				ServerID:           "apiServer",
+				TokenCacheDir:      t.TempDir(),
+				CacheAzureCLIToken: true,
+			}
+			o.tokenCacheFile = getCacheFileName(o)
+			configDir := t.TempDir()
+			t.Setenv(azureCLIConfigDirEnv, configDir)
+			profileFile := filepath.Join(configDir, azureCLIProfileFileName)
+			for _, file := range []string{o.tokenCacheFile, profileFile} {
+				if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cachedAt := time.Now().Add(-time.Minute)
+			profileChangedAt := cachedAt.Add(-time.Hour)
+			if data.profileChanged {
+				profileChangedAt = cachedAt.Add(time.Second)
+			}
+			if err := os.Chtimes(o.tokenCacheFile, cachedAt, cachedAt); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(profileFile, profileChangedAt, profileChangedAt); err != nil {
+				t.Fatal(err)
+			}
+
+			validToken := adal.Token{
+				AccessToken: "accessToken",
+				Resource:    "apiServer",
+				ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+			}
+			tokenCache.EXPECT().Read(o.tokenCacheFile).Return(validToken, nil)
+			if data.expectedLogin {
+				tokenProvider.EXPECT().Token().Return(validToken, nil)
+				tokenCache.EXPECT().Write(o.tokenCacheFile, validToken).Return(nil)
+			}
+			pluginWriter.EXPECT().Write(validToken, os.Stdout).Return(nil)
+
+			method, _ := getLoginMethodOfOptions(o)
+			plugin := execCredentialPlugin{
+				o:                    o,
+				tokenCache:           tokenCache,
+				provider:             tokenProvider,
+				execCredentialWriter: pluginWriter,
+				disableTokenCache:    !method.Cache,
+			}
+			if err := plugin.Do(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginTokenCacheReadOnly(t *testing.T) {
+	ctrl, _, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+	refreshProvider := mock_token.NewMockTokenProvider(ctrl)
+
+	o := &Options{
+		LoginMethod:        DeviceCodeLogin,
+		ServerID:           "apiServer",
+		Environment:        defaultEnvironmentName,
+		TokenCacheDir:      t.TempDir(),
+		LegacyAudience:     LegacyAudienceAuto,
+		TokenCacheReadOnly: true,
+	}
+	o.tokenCacheFile = getCacheFileName(o)
+	expiredToken := adal.Token{
+		AccessToken:  "expiredToken",
+		RefreshToken: "refreshToken",
+		Resource:     "apiServer",
+		ExpiresOn:    json.Number(fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())),
+	}
+	if err := adal.SaveToken(o.tokenCacheFile, 0600, expiredToken); err != nil {
+		t.Fatalf("unable to write token cache: %s", err)
+	}
+	cached, err := os.ReadFile(o.tokenCacheFile)
+	if err != nil {
+		t.Fatalf("unable to read token cache: %s", err)
+	}
+
+	refreshedToken := adal.Token{
+		AccessToken: "refreshedToken",
+		Resource:    "apiServer",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+	// the refreshed token is kept in memory, so that it is refreshed once only
+	refreshProvider.EXPECT().Token().Return(refreshedToken, nil).Times(1)
+	pluginWriter.EXPECT().Write(refreshedToken, os.Stdout).Return(nil).Times(2)
+
+	plugin := execCredentialPlugin{
+		o:                    o,
+		tokenCache:           newReadOnlyTokenCache(&defaultTokenCache{}),
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		refresher: func(adal.OAuthConfig, string, string, string, string, time.Duration, *adal.Token) (TokenProvider, error) {
+			return refreshProvider, nil
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := plugin.Do(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	actual, err := os.ReadFile(o.tokenCacheFile)
+	if err != nil {
+		t.Fatalf("unable to read token cache: %s", err)
+	}
+	if string(actual) != string(cached) {
+		t.Fatalf("expected token cache not to be written, got %s", actual)
+	}
+	entries, err := os.ReadDir(o.TokenCacheDir)
+	if err != nil {
+		t.Fatalf("unable to read token cache directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected no file to be written to the token cache directory, got %d entries", len(entries))
+	}
+
+	// authority metadata fetched by interactive and workloadidentity logins is kept in memory only
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	for _, loginMethod := range []string{InteractiveLogin, WorkloadIdentityLogin} {
+		t.Run(loginMethod, func(t *testing.T) {
+			hits = 0
+			o := &Options{
+				LoginMethod:        loginMethod,
+				ServerID:           "apiServer",
+				ClientID:           "clientID",
+				TenantID:           "tenantID",
+				Environment:        defaultEnvironmentName,
+				FederatedTokenFile: "/var/run/secrets/token",
+				TokenCacheDir:      t.TempDir(),
+				MetadataCacheTTL:   time.Hour,
+				TokenCacheReadOnly: true,
+			}
+			provider, err := newTokenProvider(o)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var client *http.Client
+			switch p := provider.(type) {
+			case *InteractiveToken:
+				client = p.httpClient
+			case *memoryCachedToken:
+				client = p.provider.(*workloadIdentityToken).httpClient
+			}
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(server.URL + "/common/discovery/instance")
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				resp.Body.Close()
+			}
+			if hits != 1 {
+				t.Fatalf("expected authority metadata to be cached in memory, got %d requests", hits)
+			}
+			entries, err := os.ReadDir(o.TokenCacheDir)
+			if err != nil {
+				t.Fatalf("unable to read token cache directory: %s", err)
+			}
+			if len(entries) != 0 {
+				t.Fatalf("expected no file to be written to the token cache directory, got %s", entries[0].Name())
+			}
+		})
+	}
+}
+
+func TestGetServerIDFromCacheFileName(t *testing.T) {
+	o := &Options{
+		Environment:   defaultEnvironmentName,
+		ClientID:      "clientID",
+		TenantID:      "tenantID",
+		TokenCacheDir: "/cache",
+		IsLegacy:      true,
+	}
+	if serverID := getServerIDFromCacheFileName(o, getCacheFileNameForServerID(o, "6dae42f8-4368-4678-94ff-3960e28e3630")); serverID != "6dae42f8-4368-4678-94ff-3960e28e3630" {
+		t.Fatalf("unexpected server ID: %s", serverID)
+	}
+}
+
 func setupMocks(t *testing.T) (*gomock.Controller, *mock_token.MockTokenCache, *mock_token.MockTokenProvider, *mock_token.MockExecCredentialWriter) {
 	ctrl := gomock.NewController(t)
 	tokenCache := mock_token.NewMockTokenCache(ctrl)
@@ -69,13 +69,12 @@ func (*execCredentialWriter) Write(token adal.Token, writer io.Writer) error {
 }
 
 func getAPIVersionFromExecInfoEnv() (string, error) {
-	env := os.Getenv(execInfoEnv)
-	if env == "" {
-		return apiV1beta1, nil
+	execCredential, err := getExecCredentialFromExecInfoEnv()
+	if err != nil {
+		return "", err
 	}
-	var execCredential clientauthentication.ExecCredential
-	if err := json.Unmarshal([]byte(env), &execCredential); err != nil {
-		return "", fmt.Errorf("cannot unmarshal %q to ExecCredential: %w", env, err)
+	if execCredential == nil {
+		return apiV1beta1, nil
 	}
 	switch execCredential.TypeMeta.APIVersion {
 	case "":
@@ -86,3 +85,29 @@ func getAPIVersionFromExecInfoEnv() (string, error) {
 		return "", fmt.Errorf("api version: %s is not supported", execCredential.TypeMeta.APIVersion)
 	}
 }
+
+// isInteractiveFromExecInfoEnv returns whether the exec plugin is allowed to prompt the user.
+// Only client.authentication.k8s.io/v1 guarantees spec.interactive is populated by client-go,
+// so prompting is always allowed for other api versions or when kubelogin is not run by client-go.
+func isInteractiveFromExecInfoEnv() (bool, error) {
+	execCredential, err := getExecCredentialFromExecInfoEnv()
+	if err != nil {
+		return false, err
+	}
+	if execCredential == nil || execCredential.TypeMeta.APIVersion != apiV1 {
+		return true, nil
+	}
+	return execCredential.Spec.Interactive, nil
+}
+
+func getExecCredentialFromExecInfoEnv() (*clientauthentication.ExecCredential, error) {
+	env := os.Getenv(execInfoEnv)
+	if env == "" {
+		return nil, nil
+	}
+	var execCredential clientauthentication.ExecCredential
+	if err := json.Unmarshal([]byte(env), &execCredential); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %q to ExecCredential: %w", env, err)
+	}
+	return &execCredential, nil
+}
@@ -59,3 +59,51 @@ func TestExecCredentialWriterAPIVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestIsInteractiveFromExecInfoEnv(t *testing.T) {
+	testData := []struct {
+		name                string
+		execInfoEnvTest     string
+		expectedInteractive bool
+		expectedError       bool
+	}{
+		{
+			name:                "KUBERNETES_EXEC_INFO is empty",
+			execInfoEnvTest:     "",
+			expectedInteractive: true,
+		},
+		{
+			name:                "KUBERNETES_EXEC_INFO is v1beta1 and spec.interactive is false",
+			execInfoEnvTest:     `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{"interactive":false}}`,
+			expectedInteractive: true,
+		},
+		{
+			name:                "KUBERNETES_EXEC_INFO is v1 and spec.interactive is true",
+			execInfoEnvTest:     `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true}}`,
+			expectedInteractive: true,
+		},
+		{
+			name:                "KUBERNETES_EXEC_INFO is v1 and spec.interactive is false",
+			execInfoEnvTest:     `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			expectedInteractive: false,
+		},
+		{
+			name:            "KUBERNETES_EXEC_INFO is malformed",
+			execInfoEnvTest: `{`,
+			expectedError:   true,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, data.execInfoEnvTest)
+			interactive, err := isInteractiveFromExecInfoEnv()
+			if (err != nil) != data.expectedError {
+				t.Fatalf("expected error: %t, actual: %v", data.expectedError, err)
+			}
+			if interactive != data.expectedInteractive {
+				t.Fatalf("expected interactive: %t, actual: %t", data.expectedInteractive, interactive)
+			}
+		})
+	}
+}
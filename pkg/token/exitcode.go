@@ -0,0 +1,111 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// exit codes returned by get-token so that automation can branch on the failure type
+const (
+	ExitCodeGeneralError             = 1
+	ExitCodeInteractiveLoginRequired = 10
+	ExitCodeNetworkError             = 11
+	ExitCodeConfigError              = 12
+	ExitCodeConsentRequired          = 13
+	ExitCodePolicyDenied             = 14
+)
+
+var (
+	// AAD error codes and OAuth error values indicating the user has to sign in interactively
+	interactiveLoginRequiredMarkers = []string{
+		"interaction_required",
+		"login_required",
+		"AADSTS50076",
+		"AADSTS50079",
+		"AADSTS50158",
+		"AADSTS70043",
+		"AADSTS700082",
+	}
+	// AAD error codes and OAuth error values indicating the user or admin has to grant consent
+	consentRequiredMarkers = []string{
+		"consent_required",
+		"AADSTS65001",
+	}
+)
+
+// resourceNotFoundMarker is the AAD error code returned when no service principal exists for the requested resource,
+// e.g. when the server ID needs the 'spn:' prefix
+const resourceNotFoundMarker = "AADSTS500011"
+
+// isResourceNotFound returns true when the token was not issued because the resource principal was not found
+func isResourceNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), resourceNotFoundMarker)
+}
+
+// ExitCodeError is an error carrying the exit code the process should exit with
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// NewConfigError wraps err so that it is reported with ExitCodeConfigError
+func NewConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitCodeError{Code: ExitCodeConfigError, Err: err}
+}
+
+// GetExitCode returns the exit code matching the failure type of err
+func GetExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCodeErr *ExitCodeError
+	if errors.As(err, &exitCodeErr) {
+		return exitCodeErr.Code
+	}
+	msg := err.Error()
+	if containsAny(msg, consentRequiredMarkers) {
+		return ExitCodeConsentRequired
+	}
+	if containsAny(msg, interactiveLoginRequiredMarkers) {
+		return ExitCodeInteractiveLoginRequired
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ExitCodeNetworkError
+	}
+	return ExitCodeGeneralError
+}
+
+// ErrorOutput is the JSON object get-token writes to stderr on failure, whose code is the exit code of the process
+type ErrorOutput struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+// WriteErrorOutput writes err to w as an ErrorOutput classified by GetExitCode
+func WriteErrorOutput(w io.Writer, err error) error {
+	return json.NewEncoder(w).Encode(ErrorOutput{Code: GetExitCode(err), Error: err.Error()})
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
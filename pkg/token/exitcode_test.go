@@ -0,0 +1,81 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestGetExitCode(t *testing.T) {
+	testData := []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{
+			name:         "nil error",
+			err:          nil,
+			expectedCode: 0,
+		},
+		{
+			name:         "unclassified error",
+			err:          errors.New("fail"),
+			expectedCode: ExitCodeGeneralError,
+		},
+		{
+			name:         "config error",
+			err:          NewConfigError(errors.New("'foo' is not a supported login method")),
+			expectedCode: ExitCodeConfigError,
+		},
+		{
+			name:         "wrapped config error",
+			err:          fmt.Errorf("outer: %w", NewConfigError(errors.New("inner"))),
+			expectedCode: ExitCodeConfigError,
+		},
+		{
+			name:         "interaction required",
+			err:          errors.New("failed to get token: AADSTS50076: Due to a configuration change made by your administrator, you must use multi-factor authentication"),
+			expectedCode: ExitCodeInteractiveLoginRequired,
+		},
+		{
+			name:         "consent required",
+			err:          errors.New("failed to get token: AADSTS65001: The user or administrator has not consented to use the application"),
+			expectedCode: ExitCodeConsentRequired,
+		},
+		{
+			name:         "network error",
+			err:          fmt.Errorf("failed to get token: %w", &net.DNSError{Err: "no such host", Name: "login.microsoftonline.com"}),
+			expectedCode: ExitCodeNetworkError,
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			if code := GetExitCode(data.err); code != data.expectedCode {
+				t.Fatalf("expected exit code: %d, actual: %d", data.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestWriteErrorOutput(t *testing.T) {
+	var buf bytes.Buffer
+	err := fmt.Errorf("failed to get token: %w", &net.DNSError{Err: "no such host", Name: "login.microsoftonline.com"})
+	if err := WriteErrorOutput(&buf, err); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var output ErrorOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("expected a JSON object, got %q: %s", buf.String(), err)
+	}
+	if output.Code != GetExitCode(err) || output.Code != ExitCodeNetworkError {
+		t.Fatalf("expected code %d, got %d", ExitCodeNetworkError, output.Code)
+	}
+	if output.Error != err.Error() {
+		t.Fatalf("expected error %q, got %q", err.Error(), output.Error)
+	}
+}
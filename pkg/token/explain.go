@@ -0,0 +1,143 @@
+package token
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Explain describes, step by step, what get-token would do with the options: the token cache file checked,
+// the state of the cached token, whether it would be refreshed, and which login would run against which endpoint.
+// It does not make network calls nor write files. o must have been resolved by UpdateFromEnv.
+func Explain(o *Options) ([]string, error) {
+	return explain(o, realClock{})
+}
+
+func explain(o *Options, c clock) ([]string, error) {
+	method, _ := getLoginMethodOfOptions(o)
+	oAuthConfig, err := getOAuthConfigForOptions(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oAuthConfig. isLegacy: %t, err: %s", o.IsLegacy, err)
+	}
+
+	var steps []string
+	step := func(format string, args ...interface{}) {
+		steps = append(steps, fmt.Sprintf(format, args...))
+	}
+
+	step("login method is %s, audience is %s", method.Name, getTargetAudience(o))
+	if method.Deprecated != "" {
+		step("%s login is deprecated: %s", method.Name, method.Deprecated)
+	}
+
+	if !method.Cache {
+		step("%s login does not cache tokens, so the token cache is not checked", method.Name)
+	} else {
+		step("check token cache file %s", o.tokenCacheFile)
+		cached, err := (&defaultTokenCache{}).Read(o.tokenCacheFile)
+		if err != nil {
+			step("get-token would fail: unable to read from token cache: %s", err)
+			return steps, nil
+		}
+		if o.TrustJWTExp && cached.AccessToken != "" {
+			if t, err := withJWTExpiry(cached); err == nil {
+				cached = t
+			}
+		}
+
+		switch {
+		case cached.IsZero():
+			step("token cache miss: there is no cached token")
+		case cached.Resource != getTargetAudience(o):
+			step("token cache miss: the cached token is issued for %s", cached.Resource)
+		case o.MaxCacheAge > 0 && isMaxCacheAgeExceeded(getCacheMetadataFileName(o), o.MaxCacheAge, c.Now()):
+			step("token cache miss: the last authentication is older than %s", o.MaxCacheAge)
+		case o.LoginMethod == AzureCLILogin && isAzureCLITokenStale(o.tokenCacheFile):
+			step("token cache miss: the Azure CLI profile changed after the token was cached")
+		case !willExpireIn(c, cached, expirationDelta):
+			step("token cache hit: the cached token expires in %s", timeUntilExpiry(c, cached).Round(time.Second))
+			step("return the cached token without network calls")
+			return steps, nil
+		default:
+			step("the cached token expired or expires within %s, at %s", expirationDelta, cached.Expires().Format(time.RFC3339))
+			switch {
+			case !method.Refresh:
+				step("%s login does not refresh tokens", method.Name)
+			case cached.RefreshToken == "":
+				step("there is no refresh token")
+			default:
+				step("refresh the token with the cached refresh token at %s", oAuthConfig.TokenEndpoint.String())
+				step("when the refresh succeeds, write the token to the token cache and return it, otherwise continue to login")
+			}
+		}
+
+		if o.ReuseRefreshToken && method.Refresh {
+			files, _ := filepath.Glob(getCacheFileNameForServerID(o, "*"))
+			for _, file := range files {
+				if file == o.tokenCacheFile {
+					continue
+				}
+				if other, err := (&defaultTokenCache{}).Read(file); err == nil && other.RefreshToken != "" {
+					step("try the refresh token cached for server ID %s", getServerIDFromCacheFileName(o, file))
+				}
+			}
+		}
+	}
+
+	if method.Interactive {
+		interactive, err := isInteractiveFromExecInfoEnv()
+		if err != nil {
+			step("get-token would fail: %s", err)
+			return steps, nil
+		}
+		if !interactive {
+			step("get-token would fail with exit code %d: %s login requires user interaction but the exec plugin is not run interactively",
+				ExitCodeInteractiveLoginRequired, method.Name)
+			return steps, nil
+		}
+	}
+
+	step("acquire a new token with %s login %s", method.Name, describeLoginEndpoint(o, oAuthConfig.AuthorityEndpoint.String()))
+	hosts, err := getAuthorityHosts(o)
+	if err != nil {
+		step("get-token would fail: %s", err)
+		return steps, nil
+	}
+	if hosts != nil {
+		step("send the token request to the regional token endpoint %s, failing over to %s when it is degraded", hosts.regional, hosts.global)
+	}
+	if o.LegacyAudience == LegacyAudienceAuto && !o.IsLegacy {
+		step("when the login fails, retry with 'spn:' prefix in audience claim")
+	}
+	if method.Cache {
+		if o.TokenCacheReadOnly {
+			step("keep the token in memory without writing to the read-only token cache directory")
+		} else {
+			step("write the token to token cache file %s", o.tokenCacheFile)
+		}
+	}
+	return steps, nil
+}
+
+// describeLoginEndpoint returns where the provider of the login method gets the token from
+func describeLoginEndpoint(o *Options, authority string) string {
+	switch o.LoginMethod {
+	case MSILogin:
+		return fmt.Sprintf("from the Instance Metadata Service at %s", defaultNMIEndpoint)
+	case NMILogin:
+		if o.NMIEndpoint != "" {
+			return fmt.Sprintf("from the NMI endpoint %s", o.NMIEndpoint)
+		}
+		return fmt.Sprintf("from the Instance Metadata Service intercepted by NMI at %s", defaultNMIEndpoint)
+	case AzureCLILogin:
+		return "by running az account get-access-token"
+	case CloudShellLogin:
+		return fmt.Sprintf("from the endpoint %s in %s environment variable", o.cloudShellEndpoint, msiEndpointEnv)
+	case WorkloadIdentityLogin:
+		if o.AuthorityHost != "" {
+			return fmt.Sprintf("from the authority %s%s with the federated token %s", o.AuthorityHost, o.TenantID, o.FederatedTokenFile)
+		}
+		return fmt.Sprintf("from the authority %s with the federated token %s", authority, o.FederatedTokenFile)
+	}
+	return fmt.Sprintf("from the authority %s", authority)
+}
@@ -0,0 +1,113 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestExplain(t *testing.T) {
+	const serverID = "serverID"
+	expiresOn := func(d time.Duration) json.Number {
+		return json.Number(fmt.Sprintf("%d", time.Now().Add(d).Unix()))
+	}
+	testData := []struct {
+		name          string
+		loginMethod   string
+		cachedToken   *adal.Token
+		execInfo      string
+		expectedSteps []string
+		notExpected   string
+	}{
+		{
+			name:        "no cached token",
+			loginMethod: DeviceCodeLogin,
+			expectedSteps: []string{
+				"token cache miss: there is no cached token",
+				"acquire a new token with devicecode login from the authority https://login.microsoftonline.com/tenantID",
+				"write the token to token cache file",
+			},
+		},
+		{
+			name:        "valid cached token",
+			loginMethod: DeviceCodeLogin,
+			cachedToken: &adal.Token{AccessToken: "a", RefreshToken: "r", Resource: serverID, ExpiresOn: expiresOn(time.Hour)},
+			expectedSteps: []string{
+				"token cache hit: the cached token expires in",
+				"return the cached token without network calls",
+			},
+			notExpected: "acquire a new token",
+		},
+		{
+			name:        "expired cached token with refresh token",
+			loginMethod: ROPCLogin,
+			cachedToken: &adal.Token{AccessToken: "a", RefreshToken: "r", Resource: serverID, ExpiresOn: expiresOn(-time.Hour)},
+			expectedSteps: []string{
+				"refresh the token with the cached refresh token at https://login.microsoftonline.com/tenantID/oauth2/token",
+				"acquire a new token with ropc login",
+			},
+		},
+		{
+			name:        "cached token for other audience",
+			loginMethod: DeviceCodeLogin,
+			cachedToken: &adal.Token{AccessToken: "a", Resource: "spn:" + serverID, ExpiresOn: expiresOn(time.Hour)},
+			expectedSteps: []string{
+				"token cache miss: the cached token is issued for spn:serverID",
+			},
+		},
+		{
+			name:        "interactive login not run interactively",
+			loginMethod: DeviceCodeLogin,
+			execInfo:    `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":false}}`,
+			expectedSteps: []string{
+				fmt.Sprintf("get-token would fail with exit code %d", ExitCodeInteractiveLoginRequired),
+			},
+			notExpected: "acquire a new token",
+		},
+		{
+			name:        "login without token cache",
+			loginMethod: MSILogin,
+			expectedSteps: []string{
+				"msi login does not cache tokens",
+				"acquire a new token with msi login from the Instance Metadata Service",
+			},
+			notExpected: "write the token",
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, data.execInfo)
+			o := &Options{
+				LoginMethod:    data.loginMethod,
+				ServerID:       serverID,
+				TenantID:       "tenantID",
+				Environment:    defaultEnvironmentName,
+				tokenCacheFile: filepath.Join(t.TempDir(), "cache.json"),
+			}
+			if data.cachedToken != nil {
+				if err := adal.SaveToken(o.tokenCacheFile, 0600, *data.cachedToken); err != nil {
+					t.Fatalf("unable to save token: %s", err)
+				}
+			}
+			steps, err := Explain(o)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			explanation := strings.Join(steps, "\n")
+			for _, expected := range data.expectedSteps {
+				if !strings.Contains(explanation, expected) {
+					t.Fatalf("expected step %q, got:\n%s", expected, explanation)
+				}
+			}
+			if data.notExpected != "" && strings.Contains(explanation, data.notExpected) {
+				t.Fatalf("unexpected step %q in:\n%s", data.notExpected, explanation)
+			}
+		})
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
@@ -18,9 +19,13 @@ type workloadIdentityToken struct {
 	federatedTokenFile string
 	authorityHost      string
 	serverID           string
+	timeout            time.Duration
+	httpClient         *http.Client
+	// secretClient sends the requests of the Key Vault source of the federated token
+	secretClient *http.Client
 }
 
-func newWorkloadIdentityToken(clientID, federatedTokenFile, authorityHost, serverID, tenantID string) (TokenProvider, error) {
+func newWorkloadIdentityToken(clientID, federatedTokenFile, authorityHost, serverID, tenantID string, timeout time.Duration, httpClient, secretClient *http.Client) (TokenProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("clientID cannot be empty")
 	}
@@ -43,26 +48,37 @@ func newWorkloadIdentityToken(clientID, federatedTokenFile, authorityHost, serve
 		federatedTokenFile: federatedTokenFile,
 		authorityHost:      authorityHost,
 		serverID:           serverID,
+		timeout:            timeout,
+		httpClient:         httpClient,
+		secretClient:       secretClient,
 	}, nil
 }
 
 func (p *workloadIdentityToken) Token() (adal.Token, error) {
 	emptyToken := adal.Token{}
 
-	signedAssertion, err := readJWTFromFS(p.federatedTokenFile)
+	// the federated token is rotated, so it is read from its source on every request
+	source, err := parseSecretSource(p.federatedTokenFile, secretSchemeFile, p.secretClient)
 	if err != nil {
 		return emptyToken, fmt.Errorf("failed to read signed assertion from token file: %s", err)
 	}
-	cred, err := confidential.NewCredFromAssertion(signedAssertion)
+	signedAssertion, err := source.Secret(context.Background())
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to read signed assertion from token file: %s", err)
+	}
+	defer zeroBytes(signedAssertion)
+	// MSAL takes the assertion as a string, which is only referenced by the client of this request
+	cred, err := confidential.NewCredFromAssertion(string(signedAssertion))
 	if err != nil {
 		return emptyToken, fmt.Errorf("failed to create confidential creds: %s", err)
 	}
 
 	// create the confidential client to request an AAD token
-	confidentialClientApp, err := confidential.New(
-		p.clientID,
-		cred,
-		confidential.WithAuthority(fmt.Sprintf("%s%s/oauth2/token", p.authorityHost, p.tenantID)))
+	options := []confidential.Option{confidential.WithAuthority(fmt.Sprintf("%s%s/oauth2/token", p.authorityHost, p.tenantID))}
+	if p.httpClient != nil {
+		options = append(options, confidential.WithHTTPClient(p.httpClient))
+	}
+	confidentialClientApp, err := confidential.New(p.clientID, cred, options...)
 	if err != nil {
 		return emptyToken, fmt.Errorf("failed to create confidential client app. %s", err)
 	}
@@ -73,9 +89,11 @@ func (p *workloadIdentityToken) Token() (adal.Token, error) {
 		resource += "/.default"
 	}
 
-	result, err := confidentialClientApp.AcquireTokenByCredential(context.Background(), []string{resource})
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	result, err := confidentialClientApp.AcquireTokenByCredential(ctx, []string{resource})
 	if err != nil {
-		return emptyToken, fmt.Errorf("failed to acquire token. %s", err)
+		return emptyToken, fmt.Errorf("failed to acquire token. %w", err)
 	}
 
 	return adal.Token{
@@ -84,12 +102,3 @@ func (p *workloadIdentityToken) Token() (adal.Token, error) {
 		Resource:    p.serverID,
 	}, nil
 }
-
-// readJWTFromFS reads the jwt from file system
-func readJWTFromFS(tokenFilePath string) (string, error) {
-	token, err := os.ReadFile(tokenFilePath)
-	if err != nil {
-		return "", err
-	}
-	return string(token), nil
-}
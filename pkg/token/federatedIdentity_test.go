@@ -35,15 +35,15 @@ func TestNewWorkloadIdentityTokenProvderEmpty(t *testing.T) {
 
 			switch {
 			case strings.Contains(name, "clientID"):
-				_, err = newWorkloadIdentityToken("", "", "", "", "")
+				_, err = newWorkloadIdentityToken("", "", "", "", "", 0, nil, nil)
 			case strings.Contains(name, "federatedTokenFile"):
-				_, err = newWorkloadIdentityToken("test", "", "", "", "test")
+				_, err = newWorkloadIdentityToken("test", "", "", "", "test", 0, nil, nil)
 			case strings.Contains(name, "authorityHost"):
-				_, err = newWorkloadIdentityToken("test", "test", "", "", "test")
+				_, err = newWorkloadIdentityToken("test", "test", "", "", "test", 0, nil, nil)
 			case strings.Contains(name, "serverID"):
-				_, err = newWorkloadIdentityToken("test", "test", "test", "", "test")
+				_, err = newWorkloadIdentityToken("test", "test", "test", "", "test", 0, nil, nil)
 			case strings.Contains(name, "tenantID"):
-				_, err = newWorkloadIdentityToken("test", "test", "test", "test", "")
+				_, err = newWorkloadIdentityToken("test", "test", "test", "test", "", 0, nil, nil)
 			default:
 				fmt.Println(false)
 			}
@@ -0,0 +1,202 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// cassetteFile is the format of the files of --record and --replay
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// httpCassette holds the interactions of the cassette file.
+// Recorded interactions are kept as is in memory, and scrubbed by redact whenever the file is written,
+// so that secrets registered after the request, e.g. the one read from Key Vault, are scrubbed as well.
+type httpCassette struct {
+	file   string
+	replay bool
+	log    *logSink
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	// used marks the replayed interactions, so that repeated requests get the following responses in order
+	used []bool
+}
+
+// newHTTPCassette returns the cassette recording the HTTP traffic of token providers to the file of --record,
+// or replaying it from the file of --replay without network calls. It returns nil without either.
+func newHTTPCassette(o *Options) (*httpCassette, error) {
+	switch {
+	case o.Record != "" && o.Replay != "":
+		return nil, fmt.Errorf("--record and --replay cannot be used together")
+	case o.Replay != "":
+		data, err := os.ReadFile(o.Replay)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cassette: %w", err)
+		}
+		var f cassetteFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("unable to parse cassette %s: %w", o.Replay, err)
+		}
+		return &httpCassette{file: o.Replay, replay: true, log: o.log, interactions: f.Interactions, used: make([]bool, len(f.Interactions))}, nil
+	case o.Record != "":
+		c := &httpCassette{file: o.Record, log: o.log}
+		if err := c.save(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, nil
+}
+
+// saveRecording writes the recorded interactions again, once the secrets of the options are registered for redact
+func (c *httpCassette) saveRecording() {
+	if c == nil || c.replay {
+		return
+	}
+	if err := c.save(); err != nil {
+		c.log.logf(5, "%s", err)
+	}
+}
+
+func (c *httpCassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := cassetteFile{Interactions: []cassetteInteraction{}}
+	for _, i := range c.interactions {
+		f.Interactions = append(f.Interactions, scrubInteraction(i))
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal cassette: %w", err)
+	}
+	if err := os.WriteFile(c.file, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write cassette: %w", err)
+	}
+	return nil
+}
+
+// scrubInteraction redacts tokens and secrets in the interaction.
+// Request headers, e.g. Authorization, are never recorded, nor are cookies and Content-Length of the response.
+func scrubInteraction(i cassetteInteraction) cassetteInteraction {
+	header := http.Header{}
+	for k, values := range i.Response.Header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Set-Cookie", "Content-Length":
+			continue
+		}
+		for _, v := range values {
+			header.Add(k, redact(v))
+		}
+	}
+	i.Request.URL = redact(i.Request.URL)
+	i.Request.Body = redact(i.Request.Body)
+	i.Response.Header = header
+	i.Response.Body = redact(i.Response.Body)
+	return i
+}
+
+// wrap returns base recording or replaying its requests with --record or --replay, i.e. when c is not nil
+func (c *httpCassette) wrap(base http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return base
+	}
+	return &cassetteTransport{cassette: c, base: base}
+}
+
+type cassetteTransport struct {
+	cassette *httpCassette
+	base     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read request body: %w", err)
+		}
+		body = data
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.cassette.replay {
+		return t.cassette.replayResponse(req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	t.cassette.mu.Lock()
+	t.cassette.interactions = append(t.cassette.interactions, cassetteInteraction{
+		Request:  cassetteRequest{Method: req.Method, URL: req.URL.String(), Body: string(body)},
+		Response: cassetteResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone(), Body: string(data)},
+	})
+	t.cassette.mu.Unlock()
+	if err := t.cassette.save(); err != nil {
+		t.cassette.log.logf(5, "%s", err)
+	}
+	return resp, nil
+}
+
+// replayResponse returns the response of the first interaction not replayed yet with the method and the URL of req.
+// The URL is compared after redact, the same as it is recorded.
+func (c *httpCassette) replayResponse(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	url := redact(req.URL.String())
+	for i, interaction := range c.interactions {
+		if c.used[i] || interaction.Request.Method != req.Method || interaction.Request.URL != url {
+			continue
+		}
+		c.used[i] = true
+		c.log.logf(5, "replaying %s %s from cassette %s", req.Method, url, c.file)
+		r := interaction.Response
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+			StatusCode:    r.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        r.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(r.Body)),
+			ContentLength: int64(len(r.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s in cassette %s", req.Method, url, c.file)
+}
@@ -0,0 +1,126 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestHTTPCassetteRecordAndReplay(t *testing.T) {
+	accessToken := newUnsignedJWT(t, map[string]interface{}{"aud": "serverID", "oid": "oid"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie"})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"` + accessToken + `","expires_on":"1700000000","resource":"serverID"}`))
+	}))
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	settings, err := newHTTPSettings(&Options{Record: file})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	provider, err := newNMIToken("clientID", "serverID", server.URL, "pod", "ns", 0, settings.newHTTPClient())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != accessToken {
+		t.Fatalf("expected the recorded response to be returned as is, got %s", token.AccessToken)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read cassette: %s", err)
+	}
+	for _, secret := range []string{accessToken, "Set-Cookie", "cookie"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("expected %s to be scrubbed from the cassette, got %s", secret, data)
+		}
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the cassette to be readable only by the owner, got %v, %v", info, err)
+	}
+
+	settings, err = newHTTPSettings(&Options{Replay: file})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	provider, err = newNMIToken("clientID", "serverID", server.URL, "pod", "ns", 0, settings.newHTTPClient())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token, err = provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != redactedValue || token.ExpiresOn != "1700000000" || token.Resource != "serverID" {
+		t.Fatalf("unexpected replayed token: %+v", token)
+	}
+	if _, err := provider.Token(); !ErrorContains(err, "no recorded response for GET") {
+		t.Fatalf("expected the interaction to be replayed once, got %v", err)
+	}
+}
+
+func TestHTTPCassetteReplayADFS(t *testing.T) {
+	// ADFS returns expires_in without expires_on, and no refresh token
+	cassette := `{
+  "interactions": [
+    {
+      "request": {"method": "POST", "url": "https://adfs.contoso.com/adfs/oauth2/token?api-version=1.0"},
+      "response": {
+        "statusCode": 200,
+        "header": {"Content-Type": ["application/json;charset=UTF-8"]},
+        "body": "{\"access_token\":\"<REDACTED>\",\"token_type\":\"bearer\",\"expires_in\":3600,\"resource\":\"serverID\"}"
+      }
+    }
+  ]
+}`
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(file, []byte(cassette), 0600); err != nil {
+		t.Fatalf("unable to write cassette: %s", err)
+	}
+	settings, err := newHTTPSettings(&Options{Replay: file})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	oAuthConfig, err := adal.NewOAuthConfig("https://adfs.contoso.com/", "adfs")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	provider, err := newServicePrincipalToken(*oAuthConfig, "clientID", []byte("clientSecret"), "", nil, "serverID", "adfs", false, false, time.Minute, settings.newHTTPClient(), settings.newTLSConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != redactedValue || token.Resource != "serverID" || token.ExpiresIn != "3600" {
+		t.Fatalf("unexpected replayed token: %+v", token)
+	}
+}
+
+func TestNewHTTPCassette(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := newHTTPCassette(&Options{Record: filepath.Join(dir, "a.json"), Replay: filepath.Join(dir, "b.json")}); !ErrorContains(err, "cannot be used together") {
+		t.Fatalf("expected --record and --replay to conflict, got %v", err)
+	}
+	if _, err := newHTTPCassette(&Options{Replay: filepath.Join(dir, "missing.json")}); !ErrorContains(err, "unable to read cassette") {
+		t.Fatalf("expected a missing cassette to fail, got %v", err)
+	}
+	if c, err := newHTTPCassette(&Options{}); err != nil || c != nil {
+		t.Fatalf("expected no cassette without --record and --replay, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// idTokenSender implements adal.Sender and records the id_token returned by the token endpoint,
+// since adal.Token only keeps the access token
+type idTokenSender struct {
+	sender  adal.Sender
+	idToken string
+}
+
+func newIDTokenSender(sender adal.Sender) *idTokenSender {
+	return &idTokenSender{sender: sender}
+}
+
+func (s *idTokenSender) Do(req *http.Request) (*http.Response, error) {
+	resp, err := s.sender.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	// responses other than token responses, e.g. device code, are not json with id_token
+	if err := json.Unmarshal(body, &tokenResponse); err == nil && tokenResponse.IDToken != "" {
+		s.idToken = tokenResponse.IDToken
+	}
+	return resp, nil
+}
+
+// jwtExpiryClaims are the claims of a JWT deciding when it is valid
+type jwtExpiryClaims struct {
+	Expiry    json.Number `json:"exp"`
+	NotBefore json.Number `json:"nbf"`
+}
+
+// parseJWTClaims decodes the claims of the JWT into claims without verifying its signature.
+// name is the name of the JWT in the error messages.
+func parseJWTClaims(name, jwt string, claims interface{}) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%s is not a valid JWT", name)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("failed to parse %s claims: %w", name, err)
+	}
+	return nil
+}
+
+// parseJWTExpiryClaims decodes the exp and nbf claims of the JWT without verifying its signature.
+// name is the name of the JWT in the error messages.
+func parseJWTExpiryClaims(name, jwt string) (jwtExpiryClaims, error) {
+	var claims jwtExpiryClaims
+	if err := parseJWTClaims(name, jwt, &claims); err != nil {
+		return claims, err
+	}
+	if claims.Expiry == "" {
+		return claims, fmt.Errorf("%s does not have exp claim", name)
+	}
+	return claims, nil
+}
+
+// withJWTExpiry returns token with the expiry taken from the exp claim of the access token,
+// for tokens whose expiry returned by the token endpoint is wrong or missing
+func withJWTExpiry(token adal.Token) (adal.Token, error) {
+	claims, err := parseJWTExpiryClaims("access token", token.AccessToken)
+	if err != nil {
+		return token, err
+	}
+	token.ExpiresOn = claims.Expiry
+	token.ExpiresIn = ""
+	return token, nil
+}
+
+// withIDToken returns token with the access token replaced by idToken,
+// and the expiry taken from the claims of idToken
+func withIDToken(token adal.Token, idToken string) (adal.Token, error) {
+	if idToken == "" {
+		return adal.Token{}, errors.New("id_token is not returned in token response")
+	}
+	claims, err := parseJWTExpiryClaims("id_token", idToken)
+	if err != nil {
+		return adal.Token{}, err
+	}
+
+	token.AccessToken = idToken
+	token.ExpiresOn = claims.Expiry
+	token.NotBefore = claims.NotBefore
+	token.ExpiresIn = ""
+	return token, nil
+}
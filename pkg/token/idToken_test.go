@@ -0,0 +1,110 @@
+package token
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestIDTokenSender(t *testing.T) {
+	const idToken = "header.payload.signature"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"access_token":"accessToken","id_token":"%s"}`, idToken)
+	}))
+	defer server.Close()
+
+	sender := newIDTokenSender(http.DefaultClient)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	resp, err := sender.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	if sender.idToken != idToken {
+		t.Fatalf("expected id token: %s, actual: %s", idToken, sender.idToken)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != fmt.Sprintf(`{"access_token":"accessToken","id_token":"%s"}`, idToken) {
+		t.Fatalf("response body should be kept for adal, actual: %s", body)
+	}
+}
+
+func TestWithIDToken(t *testing.T) {
+	accessToken := adal.Token{
+		AccessToken:  "accessToken",
+		RefreshToken: "refreshToken",
+		Resource:     "resource",
+		ExpiresIn:    "3600",
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"clientID","exp":1700000000,"nbf":1699990000}`))
+
+	testData := []struct {
+		name          string
+		idToken       string
+		expectedError string
+	}{
+		{
+			name:          "empty id token",
+			expectedError: "id_token is not returned in token response",
+		},
+		{
+			name:          "malformed id token",
+			idToken:       "notajwt",
+			expectedError: "id_token is not a valid JWT",
+		},
+		{
+			name:          "id token without exp claim",
+			idToken:       "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"clientID"}`)) + ".signature",
+			expectedError: "id_token does not have exp claim",
+		},
+		{
+			name:    "valid id token",
+			idToken: "header." + payload + ".signature",
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			token, err := withIDToken(accessToken, data.idToken)
+			if data.expectedError != "" {
+				if !ErrorContains(err, data.expectedError) {
+					t.Fatalf("expected error: %s, actual: %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != data.idToken {
+				t.Fatalf("expected access token to be replaced by id token, actual: %s", token.AccessToken)
+			}
+			if token.ExpiresOn != "1700000000" || token.NotBefore != "1699990000" {
+				t.Fatalf("unexpected expiry: expiresOn %s, notBefore %s", token.ExpiresOn, token.NotBefore)
+			}
+			if token.RefreshToken != accessToken.RefreshToken || token.Resource != accessToken.Resource {
+				t.Fatal("expected refresh token and resource to be kept")
+			}
+		})
+	}
+}
+
+func TestWithJWTExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"resource","exp":1700000000}`))
+
+	token, err := withJWTExpiry(adal.Token{AccessToken: "header." + payload + ".signature", ExpiresIn: "3600", ExpiresOn: "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.ExpiresOn != "1700000000" || token.ExpiresIn != "" {
+		t.Fatalf("unexpected expiry: expiresOn %s, expiresIn %s", token.ExpiresOn, token.ExpiresIn)
+	}
+
+	if _, err := withJWTExpiry(adal.Token{AccessToken: "opaque"}); !ErrorContains(err, "access token is not a valid JWT") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -1,29 +1,34 @@
 package token
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/browser"
 )
 
 type InteractiveToken struct {
 	clientID    string
 	resourceID  string
 	tenantID    string
+	timeout     time.Duration
+	httpClient  *http.Client
 	oAuthConfig adal.OAuthConfig
 }
 
 // newInteractiveTokenProvider returns a TokenProvider that will fetch a token for the user currently logged into the Interactive.
 // Required arguments include an oAuthConfiguration object and the resourceID (which is used as the scope)
-func newInteractiveTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID string) (TokenProvider, error) {
+func newInteractiveTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID string, timeout time.Duration, httpClient *http.Client) (TokenProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("clientID cannot be empty")
 	}
@@ -38,6 +43,8 @@ func newInteractiveTokenProvider(oAuthConfig adal.OAuthConfig, clientID, resourc
 		clientID:    clientID,
 		resourceID:  resourceID,
 		tenantID:    tenantID,
+		timeout:     timeout,
+		httpClient:  httpClient,
 		oAuthConfig: oAuthConfig,
 	}, nil
 }
@@ -51,6 +58,9 @@ func (p *InteractiveToken) Token() (adal.Token, error) {
 	clientOpts := azcore.ClientOptions{Cloud: cloud.Configuration{
 		ActiveDirectoryAuthorityHost: authorityFromConfig.String(),
 	}}
+	if p.httpClient != nil {
+		clientOpts.Transport = p.httpClient
+	}
 	cred, err := azidentity.NewInteractiveBrowserCredential(&azidentity.InteractiveBrowserCredentialOptions{
 		ClientOptions: clientOpts,
 		TenantID:      p.tenantID,
@@ -61,7 +71,9 @@ func (p *InteractiveToken) Token() (adal.Token, error) {
 	}
 
 	// Use the token provider to get a new token
-	interactiveToken, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{p.resourceID + "/.default"}})
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	interactiveToken, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{p.resourceID + "/.default"}})
 	if err != nil {
 		return emptyToken, fmt.Errorf("expected an empty error but received: %w", err)
 	}
@@ -81,3 +93,13 @@ func (p *InteractiveToken) Token() (adal.Token, error) {
 		Resource:    p.resourceID,
 	}, nil
 }
+
+// openSignInURL opens the sign-in page with pkg/browser, which opens it in the browser of Windows from WSL.
+// When no browser can be opened, e.g. in an SSH session or a container, the URL is printed for the user to open instead,
+// and the login keeps waiting for the redirect to the local web server.
+func openSignInURL(signInURL string) error {
+	if err := browser.Open(signInURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to open a browser: %s\nTo sign in, open the following URL in a browser which can reach localhost of this machine, e.g. through SSH port forwarding:\n%s\n", err, signInURL)
+	}
+	return nil
+}
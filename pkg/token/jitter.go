@@ -0,0 +1,35 @@
+package token
+
+import (
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// maxExpiryJitter keeps the jitter below half of the default lifetime of Azure AD access tokens,
+// so that a token just refreshed is not considered expiring right away
+const maxExpiryJitter = 30 * time.Minute
+
+// getExpiryJitter returns how long before its expiry the token is refreshed and reported to expire to kubectl, within --expiry-jitter.
+// The offset is derived from the host name, the token cache file, and the expiry of the token rather than chosen at random,
+// so that all get-token processes on a host agree on it and refresh the token once, while hosts given tokens
+// at the same moment, e.g. after a mass credential rollout, spread their refreshes over the jitter.
+func (p *execCredentialPlugin) getExpiryJitter(token adal.Token) time.Duration {
+	return getExpiryJitter(p.o, token)
+}
+
+// getExpiryJitter returns the jitter of token for the options, see execCredentialPlugin.getExpiryJitter
+func getExpiryJitter(o *Options, token adal.Token) time.Duration {
+	if o.ExpiryJitter <= 0 || token.IsZero() {
+		return 0
+	}
+	hostname, _ := os.Hostname()
+	h := fnv.New64a()
+	for _, s := range []string{hostname, o.tokenCacheFile, token.Expires().UTC().Format(time.RFC3339)} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	return time.Duration(h.Sum64() % uint64(o.ExpiryJitter))
+}
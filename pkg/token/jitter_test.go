@@ -0,0 +1,140 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+)
+
+func TestGetExpiryJitter(t *testing.T) {
+	token := adal.Token{AccessToken: "token", Resource: "apiServer", ExpiresOn: json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))}
+	newPlugin := func(cacheFile string, jitter time.Duration) *execCredentialPlugin {
+		return &execCredentialPlugin{o: &Options{tokenCacheFile: cacheFile, ExpiryJitter: jitter}}
+	}
+
+	if jitter := newPlugin("cacheFile", 0).getExpiryJitter(token); jitter != 0 {
+		t.Fatalf("expected no jitter by default, got %s", jitter)
+	}
+	p := newPlugin("cacheFile", 5*time.Minute)
+	if p.getExpiryJitter(adal.Token{}) != 0 {
+		t.Fatalf("expected no jitter of an empty token")
+	}
+	jitter := p.getExpiryJitter(token)
+	if jitter < 0 || jitter >= 5*time.Minute {
+		t.Fatalf("expected the jitter within 5m, got %s", jitter)
+	}
+	if again := p.getExpiryJitter(token); again != jitter {
+		t.Fatalf("expected the same jitter for the same token, got %s and %s", jitter, again)
+	}
+
+	offsets := map[time.Duration]bool{}
+	for i := 0; i < 10; i++ {
+		offsets[newPlugin(fmt.Sprintf("cacheFile%d", i), 5*time.Minute).getExpiryJitter(token)] = true
+	}
+	if len(offsets) < 2 {
+		t.Fatalf("expected the jitter to differ across token cache files, got %v", offsets)
+	}
+}
+
+func TestExecCredentialPluginExpiryJitter(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	expiresOn := time.Date(2023, 6, 1, 13, 0, 0, 0, time.UTC)
+	cachedToken := adal.Token{AccessToken: "token", Resource: "apiServer", ExpiresOn: json.Number(fmt.Sprintf("%d", expiresOn.Unix()))}
+	c := &fakeClock{}
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    DeviceCodeLogin,
+			ServerID:       "apiServer",
+			ExpiryJitter:   maxExpiryJitter,
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		clock:                c,
+	}
+	jitter := plugin.getExpiryJitter(cachedToken)
+	refreshAt := expiresOn.Add(-expirationDelta - jitter)
+
+	c.now = refreshAt.Add(-time.Second)
+	s := &tokenState{token: cachedToken}
+	if err := plugin.validateCachedToken(s); err != nil || !s.done {
+		t.Fatalf("expected the token to be valid before %s, got %v", refreshAt, err)
+	}
+	c.now = refreshAt
+	s = &tokenState{token: cachedToken}
+	if err := plugin.validateCachedToken(s); err != nil || s.done {
+		t.Fatalf("expected the token to be refreshed at %s, got %v", refreshAt, err)
+	}
+
+	c.now = refreshAt.Add(-time.Minute)
+	expectedToken := cachedToken
+	expectedToken.ExpiresOn = json.Number(fmt.Sprintf("%d", expiresOn.Add(-jitter).Unix()))
+	tokenCache.EXPECT().Read(cacheFile).Return(cachedToken, nil)
+	pluginWriter.EXPECT().Write(expectedToken, os.Stdout).Return(nil)
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestExecCredentialPluginExpiryJitterWithJWTExp(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	exp := time.Date(2023, 6, 1, 13, 0, 0, 0, time.UTC)
+	// the expiry returned by the token endpoint is later than the exp claim
+	cachedToken := adal.Token{
+		AccessToken: newUnsignedJWT(t, map[string]interface{}{"exp": exp.Unix()}),
+		Resource:    "apiServer",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", exp.Add(time.Hour).Unix())),
+	}
+	c := &fakeClock{}
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    DeviceCodeLogin,
+			ServerID:       "apiServer",
+			TrustJWTExp:    true,
+			ExpiryJitter:   maxExpiryJitter,
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		clock:                c,
+	}
+	jitter := plugin.getExpiryJitter(plugin.withJWTExpiry(cachedToken))
+	if jitter == 0 {
+		t.Fatal("expected a jitter")
+	}
+	refreshAt := exp.Add(-expirationDelta - jitter)
+
+	// the token is returned from cache until refreshAt, which is the expiry reported to kubectl
+	c.now = refreshAt.Add(-time.Second)
+	tokenCache.EXPECT().Read(cacheFile).Return(cachedToken, nil)
+	pluginWriter.EXPECT().Write(gomock.Any(), os.Stdout).DoAndReturn(func(token adal.Token, _ io.Writer) error {
+		if expiresOn := token.Expires(); expiresOn.Unix() != refreshAt.Unix() {
+			t.Errorf("expected the token to expire at %s, got %s", refreshAt, expiresOn)
+		}
+		return nil
+	})
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.now = refreshAt
+	s := &tokenState{token: plugin.withJWTExpiry(cachedToken)}
+	if err := plugin.validateCachedToken(s); err != nil || s.done {
+		t.Fatalf("expected the token to be refreshed at %s, got %v", refreshAt, err)
+	}
+}
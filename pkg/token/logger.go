@@ -0,0 +1,66 @@
+package token
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog"
+)
+
+// Option customizes the ExecCredentialPlugin and TokenProvider returned by New and NewTokenProvider
+type Option func(*pluginOptions)
+
+// pluginOptions are set by the options of New and NewTokenProvider, and only apply to the plugin they are passed to
+type pluginOptions struct {
+	logger *logr.Logger
+	signer crypto.Signer
+}
+
+// WithLogger logs with l instead of klog, e.g. when kubelogin is embedded in a program which logs with logr.
+// The verbosity levels of the log lines, i.e. the levels of -v, are the V levels of l.
+// The logger is used by the plugin the option is passed to, and the token providers, transports, and locks of the plugin.
+func WithLogger(l logr.Logger) Option {
+	return func(po *pluginOptions) {
+		// depth 2 attributes the log line to the caller of logf
+		l := l.WithCallDepth(2)
+		po.logger = &l
+	}
+}
+
+func applyOptions(opts []Option) pluginOptions {
+	var po pluginOptions
+	for _, opt := range opts {
+		opt(&po)
+	}
+	return po
+}
+
+// logSink writes the log lines of a plugin to the logger of WithLogger, or klog when it is nil or has no logger
+type logSink struct {
+	logger *logr.Logger
+}
+
+// logf logs the redacted message when the verbosity is at least level
+func (s *logSink) logf(level klog.Level, format string, args ...interface{}) {
+	s.output(level, format, args...)
+}
+
+// logf logs the redacted message with klog when the verbosity is at least level,
+// for the code which does not run in a plugin, e.g. the subcommands managing the token cache
+func logf(level klog.Level, format string, args ...interface{}) {
+	(*logSink)(nil).output(level, format, args...)
+}
+
+func (s *logSink) output(level klog.Level, format string, args ...interface{}) {
+	if s != nil && s.logger != nil {
+		if v := s.logger.V(int(level)); v.Enabled() {
+			v.Info(redact(fmt.Sprintf(format, args...)))
+		}
+		return
+	}
+	if klog.V(level) {
+		// depth 2 attributes the log line to the caller of logf
+		klog.InfoDepth(2, redact(fmt.Sprintf(format, args...)))
+	}
+}
@@ -0,0 +1,29 @@
+package token
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestWithLogger(t *testing.T) {
+	var lines []string
+	l := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 5})
+
+	log := &logSink{logger: applyOptions([]Option{WithLogger(l)}).logger}
+	log.logf(5, "token: %s", "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1c2VyIn0.")
+	log.logf(6, "too verbose")
+	// the logger only receives the log lines of the plugin it is passed to
+	logf(5, "another plugin")
+	(&logSink{}).logf(5, "another plugin")
+
+	if len(lines) != 1 {
+		t.Fatalf("expected only the line of level 5 to be logged, got %v", lines)
+	}
+	if !strings.Contains(lines[0], "token: "+redactedValue) {
+		t.Fatalf("expected the redacted token to be logged, got %s", lines[0])
+	}
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// loginMethodExamples shows how each login method is configured, printed by get-token --help-login
+var loginMethodExamples = map[string]string{
+	DeviceCodeLogin: `# sign in with a code entered in the browser on any device. The token is cached and refreshed.
+kubelogin convert-kubeconfig -l devicecode
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l devicecode \
+  --server-id <AAD server app ID> \
+  --client-id <AAD client app ID> \
+  --tenant-id <AAD tenant ID>`,
+
+	InteractiveLogin: `# sign in with the web browser opened on this machine. The token is cached.
+kubelogin convert-kubeconfig -l interactive
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l interactive \
+  --server-id <AAD server app ID> \
+  --client-id <AAD client app ID> \
+  --tenant-id <AAD tenant ID>`,
+
+	ServicePrincipalLogin: `# sign in as a service principal with a client secret
+export AAD_SERVICE_PRINCIPAL_CLIENT_ID=<spn client id>
+export AAD_SERVICE_PRINCIPAL_CLIENT_SECRET=<spn secret>
+kubelogin convert-kubeconfig -l spn
+
+# or with a client certificate
+export AAD_SERVICE_PRINCIPAL_CLIENT_ID=<spn client id>
+export AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE=/path/to/cert.pfx
+export AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE_PASSWORD=<pfx password>
+kubelogin convert-kubeconfig -l spn
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l spn \
+  --server-id <AAD server app ID> \
+  --tenant-id <AAD tenant ID>`,
+
+	ROPCLogin: `# sign in with the user name and password, without multi-factor authentication. The token is cached and refreshed.
+export AAD_USER_PRINCIPAL_NAME=foo@bar.com
+export AAD_USER_PRINCIPAL_PASSWORD=<password>
+kubelogin convert-kubeconfig -l ropc
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l ropc \
+  --server-id <AAD server app ID> \
+  --client-id <AAD client app ID> \
+  --tenant-id <AAD tenant ID>`,
+
+	MSILogin: `# sign in as the system assigned managed identity of the Azure VM
+kubelogin convert-kubeconfig -l msi
+
+# or as a user assigned managed identity
+kubelogin convert-kubeconfig -l msi --client-id <msi client id>
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l msi \
+  --server-id <AAD server app ID> \
+  --client-id <msi client id>`,
+
+	AzureCLILogin: `# use the account signed in to Azure CLI
+az login
+kubelogin convert-kubeconfig -l azurecli
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l azurecli \
+  --server-id <AAD server app ID>`,
+
+	WorkloadIdentityLogin: `# sign in with the federated token of Azure Workload Identity, e.g. in a pod with the
+# AZURE_CLIENT_ID, AZURE_TENANT_ID, AZURE_FEDERATED_TOKEN_FILE, and AZURE_AUTHORITY_HOST environment variables injected
+kubelogin convert-kubeconfig -l workloadidentity
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l workloadidentity \
+  --server-id <AAD server app ID>`,
+
+	CloudShellLogin: `# use the account signed in to Azure Cloud Shell
+kubelogin convert-kubeconfig -l cloudshell
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l cloudshell \
+  --server-id <AAD server app ID>`,
+
+	NMILogin: `# sign in as the identity assigned to the pod by aad-pod-identity (deprecated, use workloadidentity login instead)
+kubelogin convert-kubeconfig -l nmi --client-id <identity client id>
+
+# or with the NMI endpoint, reading pod name and namespace from POD_NAME and POD_NAMESPACE environment variables
+kubelogin convert-kubeconfig -l nmi --nmi-endpoint http://127.0.0.1:2579
+
+# get-token arguments written to the kubeconfig
+kubelogin get-token -l nmi \
+  --server-id <AAD server app ID> \
+  --client-id <identity client id>`,
+}
+
+// GetLoginMethodExample returns an example configuring the login method
+func GetLoginMethodExample(name string) (string, error) {
+	example, ok := loginMethodExamples[name]
+	if !ok {
+		return "", fmt.Errorf("'%s' is not a supported login method. Supported method is one of %s", name, GetSupportedLogins())
+	}
+	return strings.TrimSpace(example), nil
+}
@@ -0,0 +1,71 @@
+package token
+
+// LoginMethodCapabilities describes what a login method supports in this build
+type LoginMethodCapabilities struct {
+	Name string `json:"name"`
+	// Interactive is true when the login method prompts the user
+	Interactive bool `json:"interactive"`
+	// Cache is true when the token is cached on the filesystem
+	Cache bool `json:"cache"`
+	// Refresh is true when the cached token is renewed with a refresh token
+	Refresh bool `json:"refresh"`
+	// IDToken is true when the login method can return an ID token with --token-type id
+	IDToken bool `json:"idToken"`
+	// B2C is true when the login method can login with a user flow or custom policy of Azure AD B2C with --b2c-policy
+	B2C bool `json:"b2c"`
+	// Deprecated explains what to use instead when the login method is deprecated
+	Deprecated string `json:"deprecated,omitempty"`
+	// Plugin is the path of the executable of a login plugin, which is empty for built-in login methods
+	Plugin string `json:"plugin,omitempty"`
+}
+
+// loginMethods is the capability matrix of the supported login methods, in the order they are documented
+var loginMethods = []LoginMethodCapabilities{
+	{Name: DeviceCodeLogin, Interactive: true, Cache: true, Refresh: true, IDToken: true, B2C: true},
+	{Name: InteractiveLogin, Interactive: true, Cache: true, B2C: true},
+	{Name: ServicePrincipalLogin},
+	{Name: ROPCLogin, Cache: true, Refresh: true, IDToken: true},
+	{Name: MSILogin},
+	{Name: AzureCLILogin},
+	{Name: WorkloadIdentityLogin},
+	{Name: CloudShellLogin},
+	{Name: NMILogin, Deprecated: "aad-pod-identity is deprecated, use workloadidentity login instead"},
+}
+
+// GetLoginMethods returns the capabilities of the supported login methods
+func GetLoginMethods() []LoginMethodCapabilities {
+	methods := make([]LoginMethodCapabilities, len(loginMethods))
+	copy(methods, loginMethods)
+	return methods
+}
+
+// getLoginMethodNames returns the names of the login methods matching the capability filter
+func getLoginMethodNames(filter func(LoginMethodCapabilities) bool) []string {
+	var names []string
+	for _, m := range loginMethods {
+		if filter(m) {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// getLoginMethodOfOptions returns the capabilities of the login method of the options,
+// where azurecli login caches tokens with --cache-azurecli-token
+func getLoginMethodOfOptions(o *Options) (LoginMethodCapabilities, bool) {
+	m, ok := getLoginMethod(o.LoginMethod)
+	if m.Name == AzureCLILogin && o.CacheAzureCLIToken {
+		m.Cache = true
+	}
+	return m, ok
+}
+
+// getLoginMethod returns the capabilities of the login method and whether the login method is supported
+func getLoginMethod(name string) (LoginMethodCapabilities, bool) {
+	for _, m := range loginMethods {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return LoginMethodCapabilities{Name: name}, false
+}
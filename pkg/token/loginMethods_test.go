@@ -0,0 +1,51 @@
+package token
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetLoginMethod(t *testing.T) {
+	for _, name := range supportedLogin {
+		if _, ok := getLoginMethod(name); !ok {
+			t.Fatalf("expected login method %s to be found", name)
+		}
+	}
+
+	m, ok := getLoginMethod("unknown")
+	if ok {
+		t.Fatal("expected unknown login method not to be found")
+	}
+	if m.Cache || m.Refresh || m.Interactive || m.IDToken {
+		t.Fatalf("expected unknown login method to have no capability, got %+v", m)
+	}
+}
+
+func TestLoginMethodCapabilities(t *testing.T) {
+	for _, m := range GetLoginMethods() {
+		if m.Refresh && !m.Cache {
+			t.Errorf("login method %s refreshes the token but does not cache it", m.Name)
+		}
+	}
+
+	names := getLoginMethodNames(func(m LoginMethodCapabilities) bool { return m.IDToken })
+	if len(names) != 2 || names[0] != DeviceCodeLogin || names[1] != ROPCLogin {
+		t.Fatalf("unexpected login methods supporting ID token: %v", names)
+	}
+}
+
+func TestGetLoginMethodExample(t *testing.T) {
+	for _, m := range GetLoginMethods() {
+		example, err := GetLoginMethodExample(m.Name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !strings.Contains(example, "-l "+m.Name) {
+			t.Errorf("expected example of %s login to use the login method, got %s", m.Name, example)
+		}
+	}
+
+	if _, err := GetLoginMethodExample("unknown"); !ErrorContains(err, "'unknown' is not a supported login method") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
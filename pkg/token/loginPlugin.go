@@ -0,0 +1,127 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/loginplugin"
+)
+
+// loginPluginNamePattern restricts the name of login plugins, so that --login cannot refer to an arbitrary path
+var loginPluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// findLoginPlugin returns the path of the executable of the login plugin on PATH
+func findLoginPlugin(name string) (string, error) {
+	if !loginPluginNamePattern.MatchString(name) {
+		return "", fmt.Errorf("'%s' is not a valid login plugin name", name)
+	}
+	return exec.LookPath(loginplugin.BinaryPrefix + name)
+}
+
+// GetLoginPlugins returns the login plugins on PATH. Plugins of the same name as a built-in login method
+// or an earlier plugin on PATH are not used, and therefore not returned.
+func GetLoginPlugins() []LoginMethodCapabilities {
+	seen := map[string]bool{}
+	for _, m := range loginMethods {
+		seen[m.Name] = true
+	}
+	var plugins []LoginMethodCapabilities
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := strings.TrimPrefix(e.Name(), loginplugin.BinaryPrefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if name == e.Name() || seen[name] {
+				continue
+			}
+			path, err := findLoginPlugin(name)
+			if err != nil {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, LoginMethodCapabilities{Name: name, Plugin: path})
+		}
+	}
+	return plugins
+}
+
+type loginPluginToken struct {
+	path    string
+	request loginplugin.LoginRequest
+	timeout time.Duration
+}
+
+// newLoginPluginToken returns a provider running the login plugin executable at path.
+// The plugin is killed when it does not return the token within timeout.
+func newLoginPluginToken(path string, o *Options, authorityHost string) TokenProvider {
+	interactive, err := isInteractiveFromExecInfoEnv()
+	if err != nil {
+		o.log.logf(5, "unable to tell whether the exec plugin is run interactively: %s", err)
+	}
+	return &loginPluginToken{
+		path: path,
+		request: loginplugin.LoginRequest{
+			APIVersion:     loginplugin.APIVersion,
+			Kind:           loginplugin.KindLoginRequest,
+			LoginMethod:    o.LoginMethod,
+			ServerID:       o.ServerID,
+			ClientID:       o.ClientID,
+			TenantID:       o.TenantID,
+			Environment:    o.Environment,
+			AuthorityHost:  authorityHost,
+			Interactive:    interactive,
+			TimeoutSeconds: int64(o.Timeout / time.Second),
+		},
+		timeout: o.Timeout,
+	}
+}
+
+func (p *loginPluginToken) Token() (adal.Token, error) {
+	emptyToken := adal.Token{}
+	req, err := json.Marshal(p.request)
+	if err != nil {
+		return emptyToken, fmt.Errorf("unable to marshal the login request: %w", err)
+	}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	output, runErr := runCommandWithInput(ctx, nil, req, os.Stderr, p.path)
+	resp, err := loginplugin.ParseLoginResponse(output)
+	if runErr != nil {
+		// the reason in the response is more helpful than the exit status
+		if err == nil && resp.Error != "" {
+			return emptyToken, fmt.Errorf("%s login failed: %s", p.request.LoginMethod, resp.Error)
+		}
+		return emptyToken, fmt.Errorf("%s login failed: %w", p.request.LoginMethod, runErr)
+	}
+	if err != nil {
+		return emptyToken, fmt.Errorf("%s login failed: %w", p.request.LoginMethod, err)
+	}
+	if err := resp.Validate(); err != nil {
+		return emptyToken, fmt.Errorf("%s login failed: %w", p.request.LoginMethod, err)
+	}
+	if resp.ExpiresOn.Before(time.Now()) {
+		return emptyToken, fmt.Errorf("%s login failed: the plugin returned a token which expired on %s", p.request.LoginMethod, resp.ExpiresOn.Format(time.RFC3339))
+	}
+
+	return adal.Token{
+		AccessToken: resp.AccessToken,
+		ExpiresOn:   json.Number(strconv.FormatInt(resp.ExpiresOn.Unix(), 10)),
+		Resource:    p.request.ServerID,
+		Type:        "Bearer",
+	}, nil
+}
@@ -0,0 +1,115 @@
+//go:build !windows
+
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/loginplugin"
+)
+
+func writeLoginPlugin(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, loginplugin.BinaryPrefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatalf("unable to write the login plugin: %s", err)
+	}
+	return path
+}
+
+func TestGetLoginPlugins(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	path := writeLoginPlugin(t, dir1, "broker", "exit 0\n")
+	writeLoginPlugin(t, dir2, "broker", "exit 1\n")
+	writeLoginPlugin(t, dir2, ServicePrincipalLogin, "exit 1\n")
+	writeLoginPlugin(t, dir2, "Invalid.Name", "exit 1\n")
+	if err := os.WriteFile(filepath.Join(dir2, loginplugin.BinaryPrefix+"noexec"), nil, 0600); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	t.Setenv("PATH", dir1+string(os.PathListSeparator)+dir2)
+
+	plugins := GetLoginPlugins()
+	if len(plugins) != 1 || plugins[0].Name != "broker" || plugins[0].Plugin != path {
+		t.Fatalf("expected only the first broker plugin, got %+v", plugins)
+	}
+
+	o := NewOptions()
+	o.LoginMethod = "broker"
+	o.ServerID = "serverID"
+	if err := o.Validate(); err != nil {
+		t.Fatalf("expected the login plugin to be a supported login method, got %s", err)
+	}
+	o.LoginMethod = "missing"
+	if err := o.Validate(); !ErrorContains(err, "or a login plugin kubelogin-login-missing on PATH") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := findLoginPlugin("../broker"); !ErrorContains(err, "not a valid login plugin name") {
+		t.Fatalf("expected a path to be rejected, got %v", err)
+	}
+}
+
+func TestLoginPluginToken(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	testData := []struct {
+		name          string
+		script        string
+		expectedError string
+	}{
+		{
+			name: "token should be returned",
+			// the request is checked by the script
+			script: `req=$(cat)
+case "$req" in *'"loginMethod":"broker"'*'"serverID":"serverID"'*'"timeoutSeconds":60'*) ;; *) exit 2 ;; esac
+echo '{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginResponse","accessToken":"token","expiresOn":"` + expiresOn.Format(time.RFC3339) + `"}'
+`,
+		},
+		{
+			name: "reason of the failure should be returned",
+			script: `echo 'insert the smartcard' >&2
+echo '{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginResponse","error":"no smartcard found"}'
+exit 1
+`,
+			expectedError: "broker login failed: no smartcard found",
+		},
+		{
+			name:          "exit status should be returned without a response",
+			script:        "exit 3\n",
+			expectedError: "exit status 3",
+		},
+		{
+			name:          "invalid output should fail",
+			script:        "echo token\n",
+			expectedError: "unable to parse the login response",
+		},
+		{
+			name:          "expired token should fail",
+			script:        `echo '{"apiVersion":"kubelogin.azure.com/v1","kind":"LoginResponse","accessToken":"token","expiresOn":"2000-01-01T00:00:00Z"}'` + "\n",
+			expectedError: "expired on 2000-01-01T00:00:00Z",
+		},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			path := writeLoginPlugin(t, t.TempDir(), "broker", data.script)
+			o := NewOptions()
+			o.LoginMethod = "broker"
+			o.ServerID = "serverID"
+			o.Timeout = time.Minute
+			token, err := newLoginPluginToken(path, &o, "https://login.microsoftonline.com/").Token()
+			if data.expectedError != "" {
+				if !ErrorContains(err, data.expectedError) {
+					t.Fatalf("expected error %q, got %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != "token" || token.Resource != "serverID" || !token.Expires().Equal(expiresOn) {
+				t.Fatalf("unexpected token: %+v", token)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package token
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 )
@@ -11,11 +13,14 @@ type manualToken struct {
 	clientID    string
 	resourceID  string
 	tenantID    string
+	tokenType   string
+	timeout     time.Duration
 	oAuthConfig adal.OAuthConfig
 	token       adal.Token
+	httpClient  *http.Client
 }
 
-func newManualToken(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID string, token *adal.Token) (TokenProvider, error) {
+func newManualToken(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID, tokenType string, timeout time.Duration, token *adal.Token, httpClient *http.Client) (TokenProvider, error) {
 	if token == nil {
 		return nil, errors.New("token cannot be nil")
 	}
@@ -33,8 +38,11 @@ func newManualToken(oAuthConfig adal.OAuthConfig, clientID, resourceID, tenantID
 		clientID:    clientID,
 		resourceID:  resourceID,
 		tenantID:    tenantID,
+		tokenType:   tokenType,
+		timeout:     timeout,
 		oAuthConfig: oAuthConfig,
 		token:       *token,
+		httpClient:  httpClient,
 	}
 
 	return provider, nil
@@ -55,9 +63,24 @@ func (p *manualToken) Token() (adal.Token, error) {
 		return emptyToken, fmt.Errorf("failed to create service principal from manual token for token refresh: %s", err)
 	}
 
-	err = spt.Refresh()
+	var sender adal.Sender = p.httpClient
+	idTokenSender := newIDTokenSender(p.httpClient)
+	if p.tokenType == TokenTypeID {
+		sender = idTokenSender
+	}
+	if isB2COAuthConfig(p.oAuthConfig) {
+		sender = &b2cSender{sender: sender}
+	}
+	spt.SetSender(sender)
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	err = spt.RefreshWithContext(ctx)
 	if err != nil {
 		return emptyToken, err
 	}
+	if p.tokenType == TokenTypeID {
+		return withIDToken(spt.Token(), idTokenSender.idToken)
+	}
 	return spt.Token(), nil
 }
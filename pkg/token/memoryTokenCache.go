@@ -0,0 +1,64 @@
+package token
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// memoryTokenCache holds the tokens of managed identities for the lifetime of the process,
+// e.g. a controller using kubelogin as a library for many clusters
+var memoryTokenCache = &tokenMemoryCache{entries: map[string]*memoryCacheEntry{}, clock: realClock{}}
+
+type tokenMemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*memoryCacheEntry
+	clock   clock
+}
+
+type memoryCacheEntry struct {
+	// mu is held while the token is acquired, so that concurrent callers wait for it instead of requesting their own
+	mu    sync.Mutex
+	token adal.Token
+}
+
+func (c *tokenMemoryCache) entry(key string) *memoryCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &memoryCacheEntry{}
+		c.entries[key] = e
+	}
+	return e
+}
+
+// memoryCachedToken shares the tokens of provider in the process by the identity and the audience in key,
+// so that the token endpoint, e.g. IMDS throttling at high request rates, is called once per token lifetime
+type memoryCachedToken struct {
+	key      string
+	provider TokenProvider
+	log      *logSink
+}
+
+// withMemoryTokenCache returns provider caching its tokens in memory by the identity and the audience
+func withMemoryTokenCache(provider TokenProvider, log *logSink, keys ...string) TokenProvider {
+	return &memoryCachedToken{key: strings.Join(keys, "\x00"), provider: provider, log: log}
+}
+
+func (p *memoryCachedToken) Token() (adal.Token, error) {
+	e := memoryTokenCache.entry(p.key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.token.IsZero() && !willExpireIn(memoryTokenCache.clock, e.token, expirationDelta) {
+		p.log.logf(10, "using the token cached in memory")
+		return e.token, nil
+	}
+	token, err := p.provider.Token()
+	if err != nil {
+		return adal.Token{}, err
+	}
+	e.token = token
+	return token, nil
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+type countingTokenProvider struct {
+	calls     int32
+	expiresIn time.Duration
+}
+
+func (p *countingTokenProvider) Token() (adal.Token, error) {
+	n := atomic.AddInt32(&p.calls, 1)
+	// give concurrent callers the time to pile up
+	time.Sleep(10 * time.Millisecond)
+	return adal.Token{
+		AccessToken: fmt.Sprintf("token%d", n),
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(p.expiresIn).Unix())),
+	}, nil
+}
+
+func TestMemoryCachedToken(t *testing.T) {
+	t.Run("concurrent calls of the same identity and audience share a token", func(t *testing.T) {
+		provider := &countingTokenProvider{expiresIn: time.Hour}
+		cached := withMemoryTokenCache(provider, nil, t.Name(), "clientID", "audience")
+		other := withMemoryTokenCache(provider, nil, t.Name(), "clientID", "audience")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			p := cached
+			if i%2 == 1 {
+				p = other
+			}
+			wg.Add(1)
+			go func(p TokenProvider) {
+				defer wg.Done()
+				token, err := p.Token()
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				if token.AccessToken != "token1" {
+					t.Errorf("expected the shared token, got %s", token.AccessToken)
+				}
+			}(p)
+		}
+		wg.Wait()
+		if provider.calls != 1 {
+			t.Fatalf("expected the token to be acquired once, got %d", provider.calls)
+		}
+	})
+
+	t.Run("other audiences have their own tokens", func(t *testing.T) {
+		provider := &countingTokenProvider{expiresIn: time.Hour}
+		for _, audience := range []string{"audience1", "audience2"} {
+			if _, err := withMemoryTokenCache(provider, nil, t.Name(), "clientID", audience).Token(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if provider.calls != 2 {
+			t.Fatalf("expected a token per audience, got %d", provider.calls)
+		}
+	})
+
+	t.Run("expiring token is acquired again", func(t *testing.T) {
+		provider := &countingTokenProvider{expiresIn: expirationDelta / 2}
+		cached := withMemoryTokenCache(provider, nil, t.Name(), "clientID", "audience")
+		for i := 0; i < 2; i++ {
+			if _, err := cached.Token(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if provider.calls != 2 {
+			t.Fatalf("expected the expiring token to be acquired again, got %d", provider.calls)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package token
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetadataCacheTTL = 24 * time.Hour
+	metadataCacheDirName    = "authority-metadata"
+)
+
+// cachedMetadata is the on-disk format of a cached authority metadata document
+type cachedMetadata struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Body      []byte    `json:"body"`
+}
+
+// metadataCacheTransport is an http.RoundTripper caching instance discovery and OpenID configuration
+// documents on disk, so that MSAL does not fetch them from the authority on every token request
+type metadataCacheTransport struct {
+	dir  string
+	ttl  time.Duration
+	base http.RoundTripper
+	now  func() time.Time
+	// readOnly keeps fetched documents in memory instead of writing them to dir, for --token-cache-read-only
+	readOnly bool
+	log      *logSink
+	mu       sync.Mutex
+	memory   map[string]cachedMetadata
+}
+
+// newMetadataCacheClient returns an http.Client of the settings caching authority metadata documents in the metadata cache
+// directory under tokenCacheDir for ttl. When ttl is not positive, nil is returned so that the default client is used,
+// unless the CAs of --tls-ca-dir have to be trusted, the regional authority of --azure-region is used,
+// or the traffic is recorded or replayed with --record or --replay.
+// When readOnly is set, cached documents are read from the directory but fetched documents are only kept in memory.
+func newMetadataCacheClient(settings *httpSettings, tokenCacheDir string, ttl time.Duration, readOnly bool) *http.Client {
+	if ttl <= 0 {
+		if settings.rootCAs != nil || settings.regionalAuthority != nil || settings.cassette != nil {
+			return settings.newHTTPClient()
+		}
+		return nil
+	}
+	return &http.Client{
+		Transport: settings.cassette.wrap(&metadataCacheTransport{
+			dir:      filepath.Join(tokenCacheDir, metadataCacheDirName),
+			ttl:      ttl,
+			base:     settings.regionalAuthority.wrap(settings.log, settings.sharedTransport()),
+			now:      time.Now,
+			readOnly: readOnly,
+			log:      settings.log,
+		}),
+	}
+}
+
+// getMetadataCacheTTL returns ttl of --metadata-cache-ttl, or defaultTTL of the login method when it is not set
+func getMetadataCacheTTL(ttl, defaultTTL time.Duration) time.Duration {
+	if ttl == 0 {
+		return defaultTTL
+	}
+	return ttl
+}
+
+func isAuthorityMetadataRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	return strings.HasSuffix(req.URL.Path, "/discovery/instance") ||
+		strings.HasSuffix(req.URL.Path, "/.well-known/openid-configuration")
+}
+
+func (t *metadataCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isAuthorityMetadataRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	url := req.URL.String()
+	file := t.cacheFile(url)
+	if m, ok := t.read(file, url); ok {
+		t.log.logf(10, "using cached authority metadata of %s", url)
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(bytes.NewReader(m.Body)),
+			ContentLength: int64(len(m.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := t.write(file, cachedMetadata{URL: url, FetchedAt: t.now(), Body: body}); err != nil {
+		t.log.logf(5, "unable to cache authority metadata of %s: %s", url, err)
+	}
+	return resp, nil
+}
+
+func (t *metadataCacheTransport) cacheFile(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *metadataCacheTransport) read(file, url string) (cachedMetadata, bool) {
+	t.mu.Lock()
+	m, ok := t.memory[file]
+	t.mu.Unlock()
+	if ok && t.now().Sub(m.FetchedAt) <= t.ttl {
+		return m, true
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cachedMetadata{}, false
+	}
+	m = cachedMetadata{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.log.logf(5, "ignoring invalid authority metadata cache %s: %s", file, err)
+		return cachedMetadata{}, false
+	}
+	if m.URL != url || t.now().Sub(m.FetchedAt) > t.ttl {
+		return cachedMetadata{}, false
+	}
+	return m, true
+}
+
+func (t *metadataCacheTransport) write(file string, m cachedMetadata) error {
+	if t.readOnly {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.memory == nil {
+			t.memory = map[string]cachedMetadata{}
+		}
+		t.memory[file] = m
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(t.dir, filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", tmp.Name(), file, err)
+	}
+	return nil
+}
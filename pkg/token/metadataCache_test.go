@@ -0,0 +1,120 @@
+package token
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetadataCacheTransport(t *testing.T) {
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		if r.URL.Path == "/tenant/v2.0/.well-known/openid-configuration" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	client := newMetadataCacheClient(defaultHTTPSettings, t.TempDir(), time.Hour, false)
+	client.Transport.(*metadataCacheTransport).now = func() time.Time { return now }
+
+	get := func(path string) string {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	const discovery = "/common/discovery/instance"
+	if body := get(discovery); body != `{"path":"/common/discovery/instance"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if body := get(discovery); body != `{"path":"/common/discovery/instance"}` {
+		t.Fatalf("unexpected body from cache: %s", body)
+	}
+	if hits[discovery] != 1 {
+		t.Fatalf("expected instance discovery to be fetched once, got %d", hits[discovery])
+	}
+
+	now = now.Add(2 * time.Hour)
+	get(discovery)
+	if hits[discovery] != 2 {
+		t.Fatalf("expected expired instance discovery to be fetched again, got %d", hits[discovery])
+	}
+
+	const token = "/tenant/oauth2/v2.0/token"
+	get(token)
+	get(token)
+	if hits[token] != 2 {
+		t.Fatalf("expected requests other than authority metadata not to be cached, got %d", hits[token])
+	}
+
+	const openIDConfig = "/tenant/v2.0/.well-known/openid-configuration"
+	get(openIDConfig)
+	get(openIDConfig)
+	if hits[openIDConfig] != 2 {
+		t.Fatalf("expected failed responses not to be cached, got %d", hits[openIDConfig])
+	}
+}
+
+func TestNewMetadataCacheClientDisabled(t *testing.T) {
+	if client := newMetadataCacheClient(defaultHTTPSettings, t.TempDir(), 0, false); client != nil {
+		t.Fatal("expected nil client when ttl is 0")
+	}
+}
+
+func TestMetadataCacheTTLOfLoginMethods(t *testing.T) {
+	testData := []struct {
+		loginMethod string
+		ttl         time.Duration
+		cached      bool
+	}{
+		{loginMethod: InteractiveLogin, cached: true},
+		{loginMethod: InteractiveLogin, ttl: -1},
+		// workloadidentity runs in pods whose root filesystem may be read-only
+		{loginMethod: WorkloadIdentityLogin},
+		{loginMethod: WorkloadIdentityLogin, ttl: time.Hour, cached: true},
+	}
+	for _, data := range testData {
+		t.Run(fmt.Sprintf("%s with ttl %s", data.loginMethod, data.ttl), func(t *testing.T) {
+			o := &Options{
+				LoginMethod:        data.loginMethod,
+				ServerID:           "apiServer",
+				ClientID:           "clientID",
+				TenantID:           "tenantID",
+				Environment:        defaultEnvironmentName,
+				FederatedTokenFile: "/var/run/secrets/token",
+				TokenCacheDir:      t.TempDir(),
+				MetadataCacheTTL:   data.ttl,
+			}
+			provider, err := newTokenProvider(o)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var client *http.Client
+			switch p := provider.(type) {
+			case *InteractiveToken:
+				client = p.httpClient
+			case *memoryCachedToken:
+				client = p.provider.(*workloadIdentityToken).httpClient
+			}
+			cached := false
+			if client != nil {
+				_, cached = client.Transport.(*metadataCacheTransport)
+			}
+			if cached != data.cached {
+				t.Fatalf("expected authority metadata to be cached: %t, actual: %t", data.cached, cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package token
+
+import (
+	// the interactive browser credential of azidentity opens the sign-in page with browserOpenURL of this package
+	_ "github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+	_ "unsafe" // for go:linkname
+)
+
+// msalBrowserOpenURL is the function MSAL opens the sign-in page of the interactive browser credential of azidentity with.
+// Neither azidentity nor MSAL have an option for it, so it is linked to open the page with openSignInURL
+// instead of github.com/pkg/browser, which neither opens a browser from WSL nor prints the URL over SSH.
+//
+//go:linkname msalBrowserOpenURL github.com/AzureAD/microsoft-authentication-library-for-go/apps/public.browserOpenURL
+var msalBrowserOpenURL func(string) error
+
+func init() {
+	msalBrowserOpenURL = openSignInURL
+}
@@ -0,0 +1,62 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestInteractiveTokenOpensSignInURL(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/common/discovery/instance":
+			fmt.Fprintf(w, `{"tenant_discovery_endpoint":"%s/tenantID/v2.0/.well-known/openid-configuration","metadata":[]}`, server.URL)
+		case "/tenantID/v2.0/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"authorization_endpoint":"%[1]s/tenantID/oauth2/v2.0/authorize","token_endpoint":"%[1]s/tenantID/oauth2/v2.0/token","issuer":"%[1]s/tenantID/v2.0"}`, server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+	// every request of the credential, e.g. instance discovery on login.microsoftonline.com, is sent to the test server
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = serverURL.Scheme
+		r.URL.Host = serverURL.Host
+		return server.Client().Transport.RoundTrip(r)
+	})}
+	authority, _ := url.Parse(server.URL)
+
+	errOpened := errors.New("sign-in page opened")
+	var opened string
+	msalBrowserOpenURL = func(u string) error {
+		opened = u
+		return errOpened
+	}
+	t.Cleanup(func() { msalBrowserOpenURL = openSignInURL })
+
+	provider, err := newInteractiveTokenProvider(adal.OAuthConfig{AuthorityEndpoint: *authority}, "clientID", "resourceID", "tenantID", 10*time.Second, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// azidentity does not wrap the error of MSAL
+	if _, err := provider.Token(); !ErrorContains(err, errOpened.Error()) {
+		t.Fatalf("expected the sign-in page to be opened with msalBrowserOpenURL, got %v", err)
+	}
+	if u, err := url.Parse(opened); err != nil || u.Path != "/tenantID/oauth2/v2.0/authorize" {
+		t.Fatalf("expected the authorization endpoint to be opened, got %q", opened)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -3,6 +3,7 @@ package token
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 )
@@ -11,9 +12,10 @@ type managedIdentityToken struct {
 	clientID           string
 	identityResourceID string
 	resourceID         string
+	timeout            time.Duration
 }
 
-func newManagedIdentityToken(clientID, identityResourceID, resourceID string) (TokenProvider, error) {
+func newManagedIdentityToken(clientID, identityResourceID, resourceID string, timeout time.Duration) (TokenProvider, error) {
 	if resourceID == "" {
 		return nil, errors.New("resourceID cannot be empty")
 	}
@@ -22,6 +24,7 @@ func newManagedIdentityToken(clientID, identityResourceID, resourceID string) (T
 		clientID:           clientID,
 		identityResourceID: identityResourceID,
 		resourceID:         resourceID,
+		timeout:            timeout,
 	}
 
 	return provider, nil
@@ -77,7 +80,9 @@ func (p *managedIdentityToken) Token() (adal.Token, error) {
 		}
 	}
 
-	err = spt.Refresh()
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	err = spt.RefreshWithContext(ctx)
 	if err != nil {
 		return emptyToken, err
 	}
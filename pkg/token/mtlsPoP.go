@@ -0,0 +1,104 @@
+package token
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const mtlsPoPTokenType = "mtls_pop"
+
+// getMTLSPoPTokenEndpoint returns the mutual TLS token endpoint of the authority in oAuthConfig
+func getMTLSPoPTokenEndpoint(oAuthConfig adal.OAuthConfig, tenantID string) (string, error) {
+	cloud, ok := lookupCloudEnvironmentByAuthority(oAuthConfig.TokenEndpoint.Hostname())
+	if !ok || cloud.mtlsAuthorityHost == "" {
+		return "", fmt.Errorf("mtls_pop token is not supported by authority %s", oAuthConfig.TokenEndpoint.Hostname())
+	}
+	return fmt.Sprintf("https://%s/%s/oauth2/v2.0/token", cloud.mtlsAuthorityHost, tenantID), nil
+}
+
+// newMTLSClient returns an http.Client presenting the certificate chain in the TLS handshake, with a copy of tlsConfig
+func newMTLSClient(chain []*x509.Certificate, privateKey *rsa.PrivateKey, tlsConfig *tls.Config) *http.Client {
+	cert := tls.Certificate{PrivateKey: privateKey, Leaf: chain[0]}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}
+}
+
+// requestMTLSPoPToken requests a token bound to the client certificate presented by client.
+// The certificate authenticates the client in the TLS handshake, so no client assertion is sent.
+func requestMTLSPoPToken(ctx context.Context, client *http.Client, endpoint, clientID, resourceID string) (adal.Token, error) {
+	emptyToken := adal.Token{}
+
+	v := url.Values{}
+	v.Set("grant_type", "client_credentials")
+	v.Set("client_id", clientID)
+	v.Set("scope", strings.TrimSuffix(resourceID, "/")+"/.default")
+	v.Set("token_type", mtlsPoPTokenType)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to create mtls_pop token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to send mtls_pop token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to read mtls_pop token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return emptyToken, fmt.Errorf("mtls_pop token request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokenResp struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return emptyToken, fmt.Errorf("failed to unmarshal mtls_pop token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return emptyToken, fmt.Errorf("did not receive a token")
+	}
+	// a bearer token would not be bound to the certificate
+	if !strings.EqualFold(tokenResp.TokenType, mtlsPoPTokenType) {
+		return emptyToken, fmt.Errorf("expected token type %s, got %q", mtlsPoPTokenType, tokenResp.TokenType)
+	}
+	expiresIn, err := tokenResp.ExpiresIn.Int64()
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to parse expires_in %q of mtls_pop token response: %w", tokenResp.ExpiresIn, err)
+	}
+
+	now := time.Now()
+	return adal.Token{
+		AccessToken: tokenResp.AccessToken,
+		ExpiresIn:   tokenResp.ExpiresIn,
+		ExpiresOn:   json.Number(strconv.FormatInt(now.Add(time.Duration(expiresIn)*time.Second).Unix(), 10)),
+		NotBefore:   json.Number(strconv.FormatInt(now.Unix(), 10)),
+		Resource:    resourceID,
+		Type:        tokenResp.TokenType,
+	}, nil
+}
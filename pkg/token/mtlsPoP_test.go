@@ -0,0 +1,120 @@
+package token
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestGetMTLSPoPTokenEndpoint(t *testing.T) {
+	testCases := []struct {
+		name             string
+		activeDirectory  string
+		expectedEndpoint string
+		expectedErr      string
+	}{
+		{
+			name:             "public cloud",
+			activeDirectory:  "https://login.microsoftonline.com/",
+			expectedEndpoint: "https://mtlsauth.microsoft.com/tenantID/oauth2/v2.0/token",
+		},
+		{
+			name:            "unsupported cloud",
+			activeDirectory: "https://login.chinacloudapi.cn/",
+			expectedErr:     "mtls_pop token is not supported by authority login.chinacloudapi.cn",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oAuthConfig, err := adal.NewOAuthConfigWithAPIVersion(tc.activeDirectory, "tenantID", nil)
+			if err != nil {
+				t.Fatalf("unable to create oAuthConfig: %s", err)
+			}
+			endpoint, err := getMTLSPoPTokenEndpoint(*oAuthConfig, "tenantID")
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if endpoint != tc.expectedEndpoint {
+				t.Fatalf("expected endpoint %s, got %s", tc.expectedEndpoint, endpoint)
+			}
+		})
+	}
+}
+
+func TestRequestMTLSPoPToken(t *testing.T) {
+	key, cert := createTestCertificate(t, "client")
+
+	testCases := []struct {
+		name        string
+		tokenType   string
+		expectedErr string
+	}{
+		{
+			name:      "token bound to the client certificate",
+			tokenType: "mtls_pop",
+		},
+		{
+			name:        "bearer token should be rejected",
+			tokenType:   "Bearer",
+			expectedErr: `expected token type mtls_pop, got "Bearer"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.PeerCertificates) == 0 || !r.TLS.PeerCertificates[0].Equal(cert) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if err := r.ParseForm(); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if r.PostForm.Get("token_type") != "mtls_pop" || r.PostForm.Get("scope") != "resourceID/.default" ||
+					r.PostForm.Get("client_id") != "clientID" || r.PostForm.Get("client_assertion") != "" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				fmt.Fprintf(w, `{"access_token":"token","token_type":%q,"expires_in":3599}`, tc.tokenType)
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+			server.StartTLS()
+			defer server.Close()
+
+			rootCAs := x509.NewCertPool()
+			rootCAs.AddCert(server.Certificate())
+			client := newMTLSClient([]*x509.Certificate{cert}, key, &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12})
+
+			token, err := requestMTLSPoPToken(context.Background(), client, server.URL, "clientID", "resourceID")
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != "token" || token.Resource != "resourceID" || token.Type != "mtls_pop" {
+				t.Fatalf("unexpected token: %+v", token)
+			}
+			if token.IsExpired() {
+				t.Fatal("expected token not to be expired")
+			}
+		})
+	}
+}
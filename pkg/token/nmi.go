@@ -0,0 +1,125 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	// NMI of aad-pod-identity intercepts requests to IMDS endpoint
+	defaultNMIEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	imdsAPIVersion     = "2018-02-01"
+	// path of the NMI endpoint used when NMI is called explicitly instead of through IMDS interception
+	nmiHostTokenPath = "/host/token/"
+	nmiTimeout       = 30 * time.Second
+)
+
+type nmiToken struct {
+	clientID     string
+	resourceID   string
+	endpoint     string
+	podName      string
+	podNamespace string
+	timeout      time.Duration
+	client       *http.Client
+}
+
+// newNMIToken returns a TokenProvider which gets the token of the pod identity assigned by aad-pod-identity.
+// When the endpoint is not specified, the request goes to IMDS endpoint which NMI intercepts.
+// When the endpoint is specified, NMI host token endpoint is called with the pod name and namespace headers.
+func newNMIToken(clientID, resourceID, endpoint, podName, podNamespace string, timeout time.Duration, httpClient *http.Client) (TokenProvider, error) {
+	if resourceID == "" {
+		return nil, errors.New("resourceID cannot be empty")
+	}
+	if endpoint != "" && (podName == "" || podNamespace == "") {
+		return nil, errors.New("pod name and namespace cannot be empty when NMI endpoint is specified")
+	}
+
+	if timeout <= 0 {
+		timeout = nmiTimeout
+	}
+
+	return &nmiToken{
+		clientID:     clientID,
+		resourceID:   resourceID,
+		endpoint:     endpoint,
+		podName:      podName,
+		podNamespace: podNamespace,
+		timeout:      timeout,
+		client:       httpClient,
+	}, nil
+}
+
+func (p *nmiToken) Token() (adal.Token, error) {
+	emptyToken := adal.Token{}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	req, err := p.newRequest(ctx)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to create NMI token request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to send NMI token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return emptyToken, fmt.Errorf("failed to read NMI token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return emptyToken, fmt.Errorf("NMI token request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token adal.Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return emptyToken, fmt.Errorf("failed to unmarshal NMI token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return emptyToken, errors.New("did not receive a token")
+	}
+	if token.Resource == "" {
+		token.Resource = p.resourceID
+	}
+	return token, nil
+}
+
+func (p *nmiToken) newRequest(ctx context.Context) (*http.Request, error) {
+	v := url.Values{}
+	v.Set("resource", p.resourceID)
+
+	if p.endpoint == "" {
+		v.Set("api-version", imdsAPIVersion)
+		if p.clientID != "" {
+			v.Set("client_id", p.clientID)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, defaultNMIEndpoint+"?"+v.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata", "true")
+		return req, nil
+	}
+
+	if p.clientID != "" {
+		v.Set("clientid", p.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.endpoint, "/")+nmiHostTokenPath+"?"+v.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("podname", p.podName)
+	req.Header.Set("podns", p.podNamespace)
+	return req, nil
+}
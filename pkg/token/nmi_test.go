@@ -0,0 +1,72 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewNMITokenEmpty(t *testing.T) {
+	_, err := newNMIToken("", "", "", "", "", 0, http.DefaultClient)
+	if !ErrorContains(err, "resourceID cannot be empty") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = newNMIToken("", "serverID", "http://127.0.0.1:2579", "", "", 0, http.DefaultClient)
+	if !ErrorContains(err, "pod name and namespace cannot be empty") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNMIToken(t *testing.T) {
+	const (
+		clientID     = "clientID"
+		serverID     = "serverID"
+		podName      = "pod"
+		podNamespace = "ns"
+	)
+
+	t.Run("explicit NMI endpoint should receive pod headers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != nmiHostTokenPath {
+				t.Errorf("unexpected path: %s", r.URL.Path)
+			}
+			if r.Header.Get("podname") != podName || r.Header.Get("podns") != podNamespace {
+				t.Errorf("unexpected pod headers: %v", r.Header)
+			}
+			if r.URL.Query().Get("resource") != serverID || r.URL.Query().Get("clientid") != clientID {
+				t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"access_token":"token","expires_on":"1700000000","resource":"serverID"}`))
+		}))
+		defer server.Close()
+
+		provider, err := newNMIToken(clientID, serverID, server.URL, podName, podNamespace, 0, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		token, err := provider.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token.AccessToken != "token" || token.Resource != serverID || token.ExpiresOn != "1700000000" {
+			t.Fatalf("unexpected token: %+v", token)
+		}
+	})
+
+	t.Run("error response should return error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "no AzureAssignedIdentity found", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		provider, err := newNMIToken(clientID, serverID, server.URL, podName, podNamespace, 0, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, err = provider.Token()
+		if !ErrorContains(err, "NMI token request failed with status code 403: no AzureAssignedIdentity found") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
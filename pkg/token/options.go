@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/Azure/kubelogin/pkg/loginplugin"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/util/homedir"
 )
@@ -14,17 +16,49 @@ type KlogsLoggingPurposeOptions struct {
 	LoginMethod            string
 	ClientID               string
 	ClientCert             string
+	SendCertificateChain   bool
+	MTLSPoP                bool
 	Username               string
 	ServerID               string
 	TenantID               string
 	Environment            string
 	IsLegacy               bool
+	LegacyAudience         string
 	TokenCacheDir          string
 	tokenCacheFile         string
 	IdentityResourceID     string
 	FederatedTokenFile     string
 	AuthorityHost          string
 	UseAzureRMTerraformEnv bool
+	OpenBrowser            bool
+	NMIEndpoint            string
+	TokenPrefix            string
+	TokenType              string
+	Timeout                time.Duration
+	MetadataCacheTTL       time.Duration
+	ReuseRefreshToken      bool
+	TrustJWTExp            bool
+	MaxCacheAge            time.Duration
+	TokenCacheReadOnly     bool
+	DeviceCodePollInterval time.Duration
+	DeviceCodeTimeout      time.Duration
+	SudoCacheBehavior      string
+	TLSCADir               string
+	AzureRegion            string
+	ShowClaims             bool
+	RulesFile              string
+	CacheAzureCLIToken     bool
+	AzureCLIUseAzidentity  bool
+	Policy                 string
+	MaxIdleConnsPerHost    int
+	Record                 string
+	Replay                 string
+	ExpiryJitter           time.Duration
+	B2CPolicy              string
+	FailFast               bool
+	SignKey                string
+	SignatureFile          string
+	AccountAlias           string
 }
 
 type Options struct {
@@ -33,18 +67,62 @@ type Options struct {
 	ClientSecret           string
 	ClientCert             string
 	ClientCertPassword     string
+	SendCertificateChain   bool
+	MTLSPoP                bool
 	Username               string
 	Password               string
 	ServerID               string
 	TenantID               string
 	Environment            string
 	IsLegacy               bool
+	LegacyAudience         string
 	TokenCacheDir          string
 	tokenCacheFile         string
 	IdentityResourceID     string
 	FederatedTokenFile     string
 	AuthorityHost          string
 	UseAzureRMTerraformEnv bool
+	OpenBrowser            bool
+	NMIEndpoint            string
+	TokenPrefix            string
+	TokenType              string
+	Timeout                time.Duration
+	MetadataCacheTTL       time.Duration
+	ReuseRefreshToken      bool
+	TrustJWTExp            bool
+	MaxCacheAge            time.Duration
+	TokenCacheReadOnly     bool
+	DeviceCodePollInterval time.Duration
+	DeviceCodeTimeout      time.Duration
+	SudoCacheBehavior      string
+	TLSCADir               string
+	AzureRegion            string
+	ShowClaims             bool
+	RulesFile              string
+	CacheAzureCLIToken     bool
+	AzureCLIUseAzidentity  bool
+	Policy                 string
+	MaxIdleConnsPerHost    int
+	Record                 string
+	Replay                 string
+	ExpiryJitter           time.Duration
+	B2CPolicy              string
+	FailFast               bool
+	SignKey                string
+	SignatureFile          string
+	AccountAlias           string
+	podName                string
+	podNamespace           string
+	cloudShellEndpoint     string
+	// accountAlias is --account-alias, or the alias set by accounts switch, deciding the token cache of the account
+	accountAlias string
+	// rulesErr is the error applying --rules-file, returned by Validate
+	rulesErr error
+	// http and log are the HTTP client settings and the logger of the plugin, set up by New
+	http *httpSettings
+	log  *logSink
+	// secrets are the secrets of the secret-bearing options read from their sources by New
+	secrets *resolvedSecrets
 }
 
 const (
@@ -57,8 +135,17 @@ const (
 	MSILogin              = "msi"
 	AzureCLILogin         = "azurecli"
 	WorkloadIdentityLogin = "workloadidentity"
+	NMILogin              = "nmi"
+	CloudShellLogin       = "cloudshell"
 	manualTokenLogin      = "manual_token"
 
+	LegacyAudienceOn   = "on"
+	LegacyAudienceOff  = "off"
+	LegacyAudienceAuto = "auto"
+
+	TokenTypeAccess = "access"
+	TokenTypeID     = "id"
+
 	// env vars
 	loginMethod                        = "AAD_LOGIN_METHOD"
 	kubeloginROPCUsername              = "AAD_USER_PRINCIPAL_NAME"
@@ -67,6 +154,47 @@ const (
 	kubeloginClientSecret              = "AAD_SERVICE_PRINCIPAL_CLIENT_SECRET"
 	kubeloginClientCertificatePath     = "AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE"
 	kubeloginClientCertificatePassword = "AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE_PASSWORD"
+	kubeloginTenantID                  = "AAD_TENANT_ID"
+	kubeloginServerID                  = "AAD_SERVER_ID"
+	kubeloginEnvironment               = "AAD_ENVIRONMENT"
+	kubeloginTokenCacheDir             = "AAD_TOKEN_CACHE_DIR"
+	kubeloginFederatedTokenFile        = "AAD_FEDERATED_TOKEN_FILE"
+	kubeloginAuthorityHost             = "AAD_AUTHORITY_HOST"
+	kubeloginIdentityResourceID        = "AAD_IDENTITY_RESOURCE_ID"
+	kubeloginLegacy                    = "AAD_LEGACY"
+	kubeloginLegacyAudience            = "AAD_LEGACY_AUDIENCE"
+	kubeloginSendCertificateChain      = "AAD_SEND_CERTIFICATE_CHAIN"
+	kubeloginMTLSPoP                   = "AAD_MTLS_POP"
+	kubeloginOpenBrowser               = "AAD_OPEN_BROWSER"
+	kubeloginNMIEndpoint               = "AAD_NMI_ENDPOINT"
+	kubeloginTokenPrefix               = "AAD_TOKEN_PREFIX"
+	kubeloginTokenType                 = "AAD_TOKEN_TYPE"
+	kubeloginUseAzureRMEnvVars         = "AAD_USE_AZURERM_ENV_VARS"
+	kubeloginTimeout                   = "AAD_TIMEOUT"
+	kubeloginMetadataCacheTTL          = "AAD_METADATA_CACHE_TTL"
+	kubeloginReuseRefreshToken         = "AAD_REUSE_REFRESH_TOKEN_ACROSS_AUDIENCES"
+	kubeloginTrustJWTExp               = "AAD_TRUST_JWT_EXP"
+	kubeloginMaxCacheAge               = "AAD_MAX_CACHE_AGE"
+	kubeloginTokenCacheReadOnly        = "AAD_TOKEN_CACHE_READ_ONLY"
+	kubeloginDeviceCodePollInterval    = "AAD_DEVICE_CODE_POLL_INTERVAL"
+	kubeloginDeviceCodeTimeout         = "AAD_DEVICE_CODE_TIMEOUT"
+	kubeloginSudoCacheBehavior         = "AAD_SUDO_CACHE_BEHAVIOR"
+	kubeloginTLSCADir                  = "AAD_TLS_CA_DIR"
+	kubeloginAzureRegion               = "AAD_AZURE_REGION"
+	kubeloginShowClaims                = "AAD_SHOW_CLAIMS"
+	kubeloginRulesFile                 = "AAD_RULES_FILE"
+	kubeloginCacheAzureCLIToken        = "AAD_CACHE_AZURECLI_TOKEN"
+	kubeloginAzureCLIUseAzidentity     = "AAD_AZURECLI_USE_AZIDENTITY"
+	kubeloginServerIDShortcuts         = "AAD_SERVER_ID_SHORTCUTS"
+	kubeloginPolicy                    = "AAD_POLICY"
+	kubeloginRecord                    = "AAD_RECORD"
+	kubeloginReplay                    = "AAD_REPLAY"
+	kubeloginExpiryJitter              = "AAD_EXPIRY_JITTER"
+	kubeloginB2CPolicy                 = "AAD_B2C_POLICY"
+	kubeloginFailFast                  = "AAD_FAIL_FAST"
+	kubeloginSignKey                   = "AAD_SIGN_KEY"
+	kubeloginSignatureFile             = "AAD_SIGNATURE_FILE"
+	kubeloginAccountAlias              = "AAD_ACCOUNT_ALIAS"
 
 	// env vars used by Terraform
 	terraformClientID                  = "ARM_CLIENT_ID"
@@ -85,6 +213,49 @@ const (
 	azureTenantID                  = "AZURE_TENANT_ID"
 	azureUsername                  = "AZURE_USERNAME"
 	azurePassword                  = "AZURE_PASSWORD"
+	azureLoginMethod               = "AZURE_LOGIN_METHOD"
+	azureServerID                  = "AZURE_SERVER_ID"
+	azureEnvironment               = "AZURE_ENVIRONMENT"
+	azureTokenCacheDir             = "AZURE_TOKEN_CACHE_DIR"
+	azureIdentityResourceID        = "AZURE_IDENTITY_RESOURCE_ID"
+	azureLegacy                    = "AZURE_LEGACY"
+	azureLegacyAudience            = "AZURE_LEGACY_AUDIENCE"
+	azureSendCertificateChain      = "AZURE_SEND_CERTIFICATE_CHAIN"
+	azureMTLSPoP                   = "AZURE_MTLS_POP"
+	azureOpenBrowser               = "AZURE_OPEN_BROWSER"
+	azureNMIEndpoint               = "AZURE_NMI_ENDPOINT"
+	azureTokenPrefix               = "AZURE_TOKEN_PREFIX"
+	azureTokenType                 = "AZURE_TOKEN_TYPE"
+	azureUseAzureRMEnvVars         = "AZURE_USE_AZURERM_ENV_VARS"
+	azureTimeout                   = "AZURE_TIMEOUT"
+	azureMetadataCacheTTL          = "AZURE_METADATA_CACHE_TTL"
+	azureReuseRefreshToken         = "AZURE_REUSE_REFRESH_TOKEN_ACROSS_AUDIENCES"
+	azureTrustJWTExp               = "AZURE_TRUST_JWT_EXP"
+	azureMaxCacheAge               = "AZURE_MAX_CACHE_AGE"
+	azureTokenCacheReadOnly        = "AZURE_TOKEN_CACHE_READ_ONLY"
+	azureDeviceCodePollInterval    = "AZURE_DEVICE_CODE_POLL_INTERVAL"
+	azureDeviceCodeTimeout         = "AZURE_DEVICE_CODE_TIMEOUT"
+	azureSudoCacheBehavior         = "AZURE_SUDO_CACHE_BEHAVIOR"
+	azureTLSCADir                  = "AZURE_TLS_CA_DIR"
+	// azureRegionalAuthorityName is the region of the regional token endpoint used by Azure SDKs and MSAL
+	azureRegionalAuthorityName = "AZURE_REGIONAL_AUTHORITY_NAME"
+	azureShowClaims            = "AZURE_SHOW_CLAIMS"
+	azureRulesFile             = "AZURE_RULES_FILE"
+	azureCacheAzureCLIToken    = "AZURE_CACHE_AZURECLI_TOKEN"
+	azureAzureCLIUseAzidentity = "AZURE_AZURECLI_USE_AZIDENTITY"
+	azurePolicy                = "AZURE_POLICY"
+	azureRecord                = "AZURE_RECORD"
+	azureReplay                = "AZURE_REPLAY"
+	azureExpiryJitter          = "AZURE_EXPIRY_JITTER"
+	azureB2CPolicy             = "AZURE_B2C_POLICY"
+	azureFailFast              = "AZURE_FAIL_FAST"
+	azureSignKey               = "AZURE_SIGN_KEY"
+	azureSignatureFile         = "AZURE_SIGNATURE_FILE"
+	azureAccountAlias          = "AZURE_ACCOUNT_ALIAS"
+
+	// env vars populated by downward API, used in nmi login with explicit NMI endpoint
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
 )
 
 var (
@@ -93,7 +264,9 @@ var (
 )
 
 func init() {
-	supportedLogin = []string{DeviceCodeLogin, InteractiveLogin, ServicePrincipalLogin, ROPCLogin, MSILogin, AzureCLILogin, WorkloadIdentityLogin}
+	for _, m := range loginMethods {
+		supportedLogin = append(supportedLogin, m.Name)
+	}
 }
 
 func GetSupportedLogins() string {
@@ -102,151 +275,314 @@ func GetSupportedLogins() string {
 
 func NewOptions() Options {
 	return Options{
-		LoginMethod:   DeviceCodeLogin,
-		Environment:   defaultEnvironmentName,
-		TokenCacheDir: DefaultTokenCacheDir,
+		LoginMethod:       DeviceCodeLogin,
+		Environment:       defaultEnvironmentName,
+		TokenCacheDir:     DefaultTokenCacheDir,
+		TokenType:         TokenTypeAccess,
+		SudoCacheBehavior: SudoCacheBehaviorSeparate,
 	}
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&o.LoginMethod, "login", "l", o.LoginMethod,
-		fmt.Sprintf("Login method. Supported methods: %s. It may be specified in %s environment variable", GetSupportedLogins(), loginMethod))
+		fmt.Sprintf("Login method. Supported methods: %s, or the name of a login plugin %s<name> on PATH. It may be specified in %s environment variable", GetSupportedLogins(), loginplugin.BinaryPrefix, loginMethod))
 	fs.StringVar(&o.ClientID, "client-id", o.ClientID,
 		fmt.Sprintf("AAD client application ID. It may be specified in %s or %s environment variable", kubeloginClientID, azureClientID))
 	fs.StringVar(&o.ClientSecret, "client-secret", o.ClientSecret,
-		fmt.Sprintf("AAD client application secret. Used in spn login. It may be specified in %s or %s environment variable", kubeloginClientSecret, azureClientSecret))
+		fmt.Sprintf("AAD client application secret, or its secret source, e.g. file:<path>. Used in spn login. It may be specified in %s or %s environment variable", kubeloginClientSecret, azureClientSecret))
 	fs.StringVar(&o.ClientCert, "client-certificate", o.ClientCert,
 		fmt.Sprintf("AAD client cert in pfx. Used in spn login. It may be specified in %s or %s environment variable", kubeloginClientCertificatePath, azureClientCertificatePath))
 	fs.StringVar(&o.ClientCertPassword, "client-certificate-password", o.ClientCertPassword,
-		fmt.Sprintf("Password for AAD client cert. Used in spn login. It may be specified in %s or %s environment variable", kubeloginClientCertificatePassword, azureClientCertificatePassword))
+		fmt.Sprintf("Password for AAD client cert, or its secret source, e.g. env:<name>. Used in spn login. It may be specified in %s or %s environment variable", kubeloginClientCertificatePassword, azureClientCertificatePassword))
+	fs.BoolVar(&o.SendCertificateChain, "send-certificate-chain", o.SendCertificateChain,
+		"Send the whole certificate chain in x5c header of the client assertion for Subject Name + Issuer authentication. Used in spn login with client certificate")
+	fs.BoolVar(&o.MTLSPoP, "mtls-pop", o.MTLSPoP,
+		"get a token bound to the client certificate (mtls_pop) from the mutual TLS token endpoint. Used in spn login with client certificate, for API servers enforcing token binding")
 	fs.StringVar(&o.Username, "username", o.Username,
 		fmt.Sprintf("user name for ropc login flow. It may be specified in %s or %s environment variable", kubeloginROPCUsername, azureUsername))
 	fs.StringVar(&o.Password, "password", o.Password,
-		fmt.Sprintf("password for ropc login flow. It may be specified in %s or %s environment variable", kubeloginROPCPassword, azurePassword))
+		fmt.Sprintf("password for ropc login flow, or its secret source, e.g. keyring:<service>/<account>. It may be specified in %s or %s environment variable", kubeloginROPCPassword, azurePassword))
 	fs.StringVar(&o.IdentityResourceID, "identity-resource-id", o.IdentityResourceID, "Managed Identity resource id.")
-	fs.StringVar(&o.ServerID, "server-id", o.ServerID, "AAD server application ID")
+	fs.StringVar(&o.NMIEndpoint, "nmi-endpoint", o.NMIEndpoint,
+		fmt.Sprintf("aad-pod-identity NMI endpoint, e.g. http://127.0.0.1:2579. Used in nmi login. When it is not specified, the IMDS endpoint intercepted by NMI is used. Otherwise, pod name and namespace are read from %s and %s environment variables", podNameEnv, podNamespaceEnv))
+	fs.StringVar(&o.ServerID, "server-id", o.ServerID,
+		fmt.Sprintf("AAD server application ID, or a shortcut of a well-known application ID in the environment: aks for AKS managed AAD, arm for Azure Resource Manager, e.g. of AKS Trusted Access. Shortcuts may be added or overridden as <name>=<application ID>[,...] in %s environment variable", kubeloginServerIDShortcuts))
 	fs.StringVar(&o.FederatedTokenFile, "federated-token-file", o.FederatedTokenFile,
-		fmt.Sprintf("Workload Identity federated token file. It may be specified in %s environment variable", azureFederatedTokenFile))
+		fmt.Sprintf("Workload Identity federated token file, or its secret source, e.g. cmd:<command>. It may be specified in %s environment variable", azureFederatedTokenFile))
 	fs.StringVar(&o.AuthorityHost, "authority-host", o.AuthorityHost,
-		fmt.Sprintf("Workload Identity authority host. It may be specified in %s environment variable", azureAuthorityHost))
+		fmt.Sprintf("Workload Identity authority host, or the host of the B2C tenant of --b2c-policy, e.g. https://contoso.b2clogin.com/. It may be specified in %s environment variable", azureAuthorityHost))
+	fs.StringVar(&o.B2CPolicy, "b2c-policy", o.B2CPolicy,
+		fmt.Sprintf("user flow or custom policy, e.g. B2C_1_signin, of the Azure AD B2C tenant of --tenant-id to login with. --server-id is the scope of the API, e.g. https://contoso.onmicrosoft.com/api/access. Used in %s login. It may be specified in %s or %s environment variable",
+			strings.Join(getLoginMethodNames(func(m LoginMethodCapabilities) bool { return m.B2C }), " and "), kubeloginB2CPolicy, azureB2CPolicy))
 	fs.StringVar(&o.TokenCacheDir, "token-cache-dir", o.TokenCacheDir, "directory to cache token")
+	fs.BoolVar(&o.TokenCacheReadOnly, "token-cache-read-only", o.TokenCacheReadOnly,
+		"read the token cache but never write to the token cache directory, e.g. a pre-warmed cache mounted read-only. Refreshed and acquired tokens are kept in memory for the lifetime of the process")
+	fs.StringVar(&o.SudoCacheBehavior, "sudo-cache-behavior", o.SudoCacheBehavior,
+		fmt.Sprintf("what to do when running as root with sudo and the token cache directory belongs to the invoking user. Supported values: %s caches the tokens in the home directory of root, %s gives the cached files to the invoking user, %s fails, %s writes root owned files anyway",
+			SudoCacheBehaviorSeparate, SudoCacheBehaviorChown, SudoCacheBehaviorRefuse, SudoCacheBehaviorIgnore))
+	fs.StringVar(&o.TLSCADir, "tls-ca-dir", o.TLSCADir,
+		"directory of PEM encoded CA certificates to trust in addition to the system roots, e.g. of a TLS inspecting proxy. Applied to the requests of all login methods and to Azure CLI")
+	fs.StringVar(&o.AzureRegion, "azure-region", o.AzureRegion,
+		fmt.Sprintf("Azure region, e.g. westus2, of the regional token endpoint to send token requests to, failing over to the global authority when either is degraded. Used in spn and workloadidentity login. It may be specified in %s or %s environment variable", kubeloginAzureRegion, azureRegionalAuthorityName))
+	fs.BoolVar(&o.ShowClaims, "show-claims", o.ShowClaims,
+		"print oid, upn, idtyp, the number of groups, and wids of the token to standard error, to verify the identity and groups seen by the cluster. The summary is also logged at verbosity 5")
+	fs.BoolVar(&o.CacheAzureCLIToken, "cache-azurecli-token", o.CacheAzureCLIToken,
+		"cache the token of azurecli login in the token cache directory until it expires instead of running Azure CLI on every call. The cached token is discarded when az login, az logout, or az account set changes the Azure CLI profile")
+	fs.BoolVar(&o.AzureCLIUseAzidentity, "azurecli-use-azidentity", o.AzureCLIUseAzidentity,
+		fmt.Sprintf("get the token of azurecli login with the AzureCLICredential of azidentity, which runs az found in PATH through a shell, instead of running Azure CLI directly. The Azure CLI of %s and the CA certificates of --tls-ca-dir are not used. It may be specified in %s or %s environment variable", azureCLIPathEnv, kubeloginAzureCLIUseAzidentity, azureAzureCLIUseAzidentity))
+	fs.StringVar(&o.Policy, "policy", o.Policy,
+		fmt.Sprintf("CEL expression evaluated against the claims of the token and the options, e.g. claims.tid == tenantID, which must be true for the token to be returned. Prefix with %s to read the expression from a file. It may be specified in %s or %s environment variable", policyFilePrefix, kubeloginPolicy, azurePolicy))
+	fs.StringVar(&o.Record, "record", o.Record,
+		fmt.Sprintf("file to record the HTTP requests and responses of the login method to, with tokens and secrets redacted, e.g. to reproduce a problem with --replay. It may be specified in %s or %s environment variable", kubeloginRecord, azureRecord))
+	fs.StringVar(&o.Replay, "replay", o.Replay,
+		fmt.Sprintf("file of HTTP responses recorded with --record to reply to the requests of the login method instead of the network. It may be specified in %s or %s environment variable", kubeloginReplay, azureReplay))
+	fs.StringVar(&o.SignKey, "sign-key", o.SignKey,
+		fmt.Sprintf("file of the PEM private key, e.g. ECDSA P-256, to sign the ExecCredential written to standard output with. The detached signature is written to --signature-file and verified with verify-exec-credential. It may be specified in %s or %s environment variable", kubeloginSignKey, azureSignKey))
+	fs.StringVar(&o.SignatureFile, "signature-file", o.SignatureFile,
+		fmt.Sprintf("file to write the detached JWS signature of the ExecCredential to. Required with --sign-key. It may be specified in %s or %s environment variable", kubeloginSignatureFile, azureSignatureFile))
+	fs.StringVar(&o.AccountAlias, "account-alias", o.AccountAlias,
+		fmt.Sprintf("name of the token cache of the account to login with, e.g. work, so that the tokens of several identities for the same server ID are cached side by side. Defaults to the alias set by accounts switch. %s is the token cache directory itself. It may be specified in %s or %s environment variable", DefaultAccountAlias, kubeloginAccountAlias, azureAccountAlias))
+	fs.StringVar(&o.RulesFile, "rules-file", o.RulesFile,
+		fmt.Sprintf("YAML or JSON file of rules mapping API server patterns, e.g. *.prod.contoso.com, to get-token options. The options of the first rule matching the API server passed by kubectl with provideClusterInfo are applied, unless set by flags. It may be specified in %s or %s environment variable", kubeloginRulesFile, azureRulesFile))
 	fs.StringVarP(&o.TenantID, "tenant-id", "t", o.TenantID, fmt.Sprintf("AAD tenant ID. It may be specified in %s environment variable", azureTenantID))
-	fs.StringVarP(&o.Environment, "environment", "e", o.Environment, "Azure environment name")
+	fs.StringVarP(&o.Environment, "environment", "e", o.Environment,
+		fmt.Sprintf("Azure environment name. Supported environments: %s. Aliases such as AzureCloud, china, mooncake, usgov, and german are also accepted", getSupportedEnvironments()))
 	fs.BoolVar(&o.IsLegacy, "legacy", o.IsLegacy, "set to true to get token with 'spn:' prefix in audience claim")
+	fs.StringVar(&o.LegacyAudience, "legacy-audience", o.LegacyAudience,
+		fmt.Sprintf("whether to get token with 'spn:' prefix in audience claim. Supported values: %s, %s, %s. %s tries without the prefix first and falls back to the prefix. It overrides --legacy",
+			LegacyAudienceOn, LegacyAudienceOff, LegacyAudienceAuto, LegacyAudienceAuto))
+	fs.BoolVar(&o.OpenBrowser, "open-browser", o.OpenBrowser, "open the verification URL in the browser. Used in devicecode login")
+	fs.DurationVar(&o.DeviceCodePollInterval, "device-code-poll-interval", o.DeviceCodePollInterval,
+		"how often to check whether the user completed devicecode login, e.g. 10s. It cannot be shorter than the interval returned by Azure AD, which is used by default")
+	fs.DurationVar(&o.DeviceCodeTimeout, "device-code-timeout", o.DeviceCodeTimeout,
+		"how long to wait for the user to complete devicecode login, e.g. 1h. A new device code is prompted when the previous one expires within the timeout. By default, the login fails when the device code expires")
+	fs.StringVar(&o.TokenPrefix, "token-prefix", o.TokenPrefix,
+		"prefix prepended to the token returned to kubectl, e.g. Pomerium- for an authenticating proxy in front of the API server expecting a wrapped token")
+	fs.StringVar(&o.TokenType, "token-type", o.TokenType,
+		fmt.Sprintf("type of token returned to kubectl. Supported values: %s, %s. %s is only supported in %s and %s login, for API servers validating ID tokens",
+			TokenTypeAccess, TokenTypeID, TokenTypeID, DeviceCodeLogin, ROPCLogin))
+	fs.DurationVar(&o.Timeout, "timeout", o.Timeout,
+		fmt.Sprintf("timeout of acquiring a token, e.g. 30s. Azure CLI is killed when it does not complete within the timeout, which defaults to %s in azurecli login. No timeout by default in other login methods", defaultAzureCLITimeout))
+	fs.DurationVar(&o.MetadataCacheTTL, "metadata-cache-ttl", o.MetadataCacheTTL,
+		fmt.Sprintf("how long instance discovery and OpenID configuration documents of the authority are cached in the token cache directory. Used in interactive login, where it defaults to %s, and workloadidentity login, where the cache is disabled by default so that no files are written, e.g. to a read-only root filesystem. A negative value disables the cache", defaultMetadataCacheTTL))
+	fs.BoolVar(&o.ReuseRefreshToken, "reuse-refresh-token-across-audiences", o.ReuseRefreshToken,
+		fmt.Sprintf("when there is no usable token for the server ID, acquire it with a refresh token cached for another server ID of the same client ID and tenant ID instead of prompting the user again. Used in %s login",
+			strings.Join(getLoginMethodNames(func(m LoginMethodCapabilities) bool { return m.Refresh }), " and ")))
+	fs.BoolVar(&o.TrustJWTExp, "trust-jwt-exp", o.TrustJWTExp,
+		"decide when the token expires from the exp claim of the JWT instead of the expiry returned by the token endpoint, both for the token cache and the expirationTimestamp returned to kubectl")
+	fs.DurationVar(&o.ExpiryJitter, "expiry-jitter", o.ExpiryJitter,
+		fmt.Sprintf("refresh the token and have kubectl run the plugin again up to this long, e.g. 5m, before the token expires, at an offset stable for the host and the token, so that many hosts given tokens at the same moment do not all refresh at the same instant. At most %s. It may be specified in %s or %s environment variable", maxExpiryJitter, kubeloginExpiryJitter, azureExpiryJitter))
+	fs.BoolVar(&o.FailFast, "fail-fast", o.FailFast,
+		fmt.Sprintf("check DNS, TCP, and HTTP connectivity to the authority, or the identity endpoint of the login method, within %s before refreshing or acquiring a token, and fail with exit code %d and the step which failed instead of waiting for the retries of the login method. It may be specified in %s or %s environment variable", probeTimeout, ExitCodeNetworkError, kubeloginFailFast, azureFailFast))
+	fs.DurationVar(&o.MaxCacheAge, "max-cache-age", o.MaxCacheAge,
+		"force the user to authenticate again when the last authentication is older than the limit, e.g. 24h, regardless of whether the cached refresh token is still valid. No limit by default")
 	fs.BoolVar(&o.UseAzureRMTerraformEnv, "use-azurerm-env-vars", o.UseAzureRMTerraformEnv,
 		"Use environment variable names of Terraform Azure Provider (ARM_CLIENT_ID, ARM_CLIENT_SECRET, ARM_CLIENT_CERTIFICATE_PATH, ARM_CLIENT_CERTIFICATE_PASSWORD, ARM_TENANT_ID)")
 }
 
 func (o *Options) Validate() error {
-	foundValidLoginMethod := false
-	for _, v := range supportedLogin {
-		if o.LoginMethod == v {
-			foundValidLoginMethod = true
+	if o.rulesErr != nil {
+		return o.rulesErr
+	}
+
+	method, ok := getLoginMethod(o.LoginMethod)
+	if !ok {
+		if _, err := findLoginPlugin(o.LoginMethod); err != nil {
+			return fmt.Errorf("'%s' is not a supported login method. Supported method is one of %s, or a login plugin %s%s on PATH", o.LoginMethod, GetSupportedLogins(), loginplugin.BinaryPrefix, o.LoginMethod)
 		}
 	}
 
-	if !foundValidLoginMethod {
-		return fmt.Errorf("'%s' is not a supported login method. Supported method is one of %s", o.LoginMethod, GetSupportedLogins())
+	if _, err := lookupCloudEnvironment(o.Environment); err != nil {
+		return err
 	}
-	return nil
-}
 
-func (o *Options) UpdateFromEnv() {
-	o.tokenCacheFile = getCacheFileName(o)
+	switch o.LegacyAudience {
+	case "", LegacyAudienceOn, LegacyAudienceOff, LegacyAudienceAuto:
+	default:
+		return fmt.Errorf("'%s' is not a supported legacy audience mode. Supported mode is one of %s, %s, %s", o.LegacyAudience, LegacyAudienceOn, LegacyAudienceOff, LegacyAudienceAuto)
+	}
 
-	if o.UseAzureRMTerraformEnv {
-		if v, ok := os.LookupEnv(terraformClientID); ok {
-			o.ClientID = v
-		}
-		if v, ok := os.LookupEnv(terraformClientSecret); ok {
-			o.ClientSecret = v
-		}
-		if v, ok := os.LookupEnv(terraformClientCertificatePath); ok {
-			o.ClientCert = v
-		}
-		if v, ok := os.LookupEnv(terraformClientCertificatePassword); ok {
-			o.ClientCertPassword = v
-		}
-		if v, ok := os.LookupEnv(terraformTenantID); ok {
-			o.TenantID = v
-		}
-	} else {
-		if v, ok := os.LookupEnv(kubeloginClientID); ok {
-			o.ClientID = v
+	switch o.TokenType {
+	case "", TokenTypeAccess:
+	case TokenTypeID:
+		if !method.IDToken {
+			return fmt.Errorf("token type '%s' is only supported in %s login", TokenTypeID, strings.Join(getLoginMethodNames(func(m LoginMethodCapabilities) bool { return m.IDToken }), " and "))
 		}
-		if v, ok := os.LookupEnv(azureClientID); ok {
-			o.ClientID = v
-		}
-		if v, ok := os.LookupEnv(kubeloginClientSecret); ok {
-			o.ClientSecret = v
-		}
-		if v, ok := os.LookupEnv(azureClientSecret); ok {
-			o.ClientSecret = v
-		}
-		if v, ok := os.LookupEnv(kubeloginClientCertificatePath); ok {
-			o.ClientCert = v
-		}
-		if v, ok := os.LookupEnv(azureClientCertificatePath); ok {
-			o.ClientCert = v
+	default:
+		return fmt.Errorf("'%s' is not a supported token type. Supported type is one of %s, %s", o.TokenType, TokenTypeAccess, TokenTypeID)
+	}
+
+	if o.MTLSPoP && o.LoginMethod != ServicePrincipalLogin {
+		return fmt.Errorf("mtls_pop token is only supported in %s login", ServicePrincipalLogin)
+	}
+
+	if o.AzureRegion != "" && !strings.EqualFold(o.AzureRegion, azureRegionAutoDetect) && !azureRegionPattern.MatchString(strings.ToLower(o.AzureRegion)) {
+		return fmt.Errorf("'%s' is not a valid Azure region. Specify the name of the region such as westus2", o.AzureRegion)
+	}
+
+	if o.B2CPolicy != "" {
+		if !method.B2C {
+			return fmt.Errorf("B2C policy is only supported in %s login", strings.Join(getLoginMethodNames(func(m LoginMethodCapabilities) bool { return m.B2C }), " and "))
 		}
-		if v, ok := os.LookupEnv(kubeloginClientCertificatePassword); ok {
-			o.ClientCertPassword = v
+		if !b2cPolicyPattern.MatchString(o.B2CPolicy) {
+			return fmt.Errorf("'%s' is not a valid B2C policy. Specify the name of the user flow or custom policy such as B2C_1_signin", o.B2CPolicy)
 		}
-		if v, ok := os.LookupEnv(azureClientCertificatePassword); ok {
-			o.ClientCertPassword = v
+		if o.IsLegacy {
+			return fmt.Errorf("B2C policy is not supported in legacy mode")
 		}
-		if v, ok := os.LookupEnv(azureTenantID); ok {
-			o.TenantID = v
+		if o.TokenType == TokenTypeID {
+			return fmt.Errorf("B2C policy is not supported with %s token type", TokenTypeID)
 		}
 	}
 
-	if v, ok := os.LookupEnv(kubeloginROPCUsername); ok {
-		o.Username = v
+	if o.AccountAlias != "" {
+		if err := ValidateAccountAlias(o.AccountAlias); err != nil {
+			return err
+		}
 	}
-	if v, ok := os.LookupEnv(azureUsername); ok {
-		o.Username = v
+
+	if o.SignKey != "" && o.SignatureFile == "" {
+		return fmt.Errorf("--signature-file is required with --sign-key")
 	}
-	if v, ok := os.LookupEnv(kubeloginROPCPassword); ok {
-		o.Password = v
+
+	if o.ExpiryJitter < 0 || o.ExpiryJitter > maxExpiryJitter {
+		return fmt.Errorf("expiry jitter must be between 0 and %s, got %s", maxExpiryJitter, o.ExpiryJitter)
 	}
-	if v, ok := os.LookupEnv(azurePassword); ok {
-		o.Password = v
+
+	switch o.SudoCacheBehavior {
+	case "", SudoCacheBehaviorSeparate, SudoCacheBehaviorChown, SudoCacheBehaviorIgnore:
+	case SudoCacheBehaviorRefuse:
+		if _, ok := getSudoUserOfCacheDir(o.TokenCacheDir); ok {
+			return fmt.Errorf("refusing to write root owned files to token cache directory %s of the user running sudo. Run without sudo or use --sudo-cache-behavior", o.TokenCacheDir)
+		}
+	default:
+		return fmt.Errorf("'%s' is not a supported sudo cache behavior. Supported behavior is one of %s, %s, %s, %s", o.SudoCacheBehavior, SudoCacheBehaviorSeparate, SudoCacheBehaviorChown, SudoCacheBehaviorRefuse, SudoCacheBehaviorIgnore)
 	}
-	if v, ok := os.LookupEnv(loginMethod); ok {
-		o.LoginMethod = v
+	return nil
+}
+
+// UpdateFromEnv sets the options from environment variables, which take precedence over the current values of the options
+func (o *Options) UpdateFromEnv() {
+	o.UpdateFromEnvWithFlags(nil)
+}
+
+// UpdateFromEnvWithFlags sets the options from environment variables with the precedence:
+// flags explicitly set in fs > options of the matching rule of --rules-file > environment variables > default values.
+// fs must contain the flags registered by AddFlags. When fs is nil, it behaves the same as UpdateFromEnv.
+func (o *Options) UpdateFromEnvWithFlags(fs *pflag.FlagSet) {
+	if fs == nil {
+		fs = pflag.NewFlagSet("", pflag.ContinueOnError)
+		o.AddFlags(fs)
 	}
+	o.rulesErr = applyLoginRules(o, fs)
+	resolveFromEnv(o, fs)
+	o.complete(os.Getenv(kubeloginServerIDShortcuts))
+}
 
-	if o.LoginMethod == WorkloadIdentityLogin {
-		if v, ok := os.LookupEnv(azureClientID); ok {
-			o.ClientID = v
-		}
-		if v, ok := os.LookupEnv(azureFederatedTokenFile); ok {
-			o.FederatedTokenFile = v
-		}
-		if v, ok := os.LookupEnv(azureAuthorityHost); ok {
-			o.AuthorityHost = v
-		}
+// Complete resolves the options derived from the ones set, e.g. the token cache file, the same way UpdateFromEnv does,
+// without reading the options from environment variables nor --rules-file.
+// It is used by programs setting the options in code, whose values are not to be overridden by the environment.
+// The variables set by the platform rather than the user, e.g. the pod of nmi login, are still read.
+func (o *Options) Complete() {
+	o.complete("")
+}
+
+// complete resolves the derived options with serverIDShortcuts, the server ID shortcuts of AAD_SERVER_ID_SHORTCUTS
+func (o *Options) complete(serverIDShortcuts string) {
+	if o.LoginMethod == NMILogin {
+		o.podName = os.Getenv(podNameEnv)
+		o.podNamespace = os.Getenv(podNamespaceEnv)
 	}
+	if o.LoginMethod == CloudShellLogin {
+		o.cloudShellEndpoint = os.Getenv(msiEndpointEnv)
+	}
+
+	// aliases of the same environment share the token cache
+	o.Environment = resolveEnvironmentName(o.Environment)
+	o.ServerID = resolveServerIDShortcut(o.ServerID, o.Environment, serverIDShortcuts)
+	o.updateTokenCacheDirForSudo()
+	o.updateAccountAlias()
+	o.updateLegacyFromLegacyAudience()
+	o.tokenCacheFile = getCacheFileName(o)
 }
 
 func (o *Options) String() string {
-	return fmt.Sprintf("Login Method: %s, Environment: %s, TenantID: %s, ServerID: %s, ClientID: %s, IsLegacy: %t, msiResourceID: %s, tokenCacheDir: %s, tokenCacheFile: %s",
+	return fmt.Sprintf("Login Method: %s, Environment: %s, TenantID: %s, ServerID: %s, ClientID: %s, IsLegacy: %t, LegacyAudience: %s, msiResourceID: %s, tokenCacheDir: %s, tokenCacheFile: %s",
 		o.LoginMethod,
 		o.Environment,
 		o.TenantID,
 		o.ServerID,
 		o.ClientID,
 		o.IsLegacy,
+		o.LegacyAudience,
 		o.IdentityResourceID,
 		o.TokenCacheDir,
 		o.tokenCacheFile)
 }
 
+// updateLegacyFromLegacyAudience sets IsLegacy according to --legacy-audience.
+// In auto mode, the audience variant which worked last time is read from cache metadata.
+func (o *Options) updateLegacyFromLegacyAudience() {
+	switch o.LegacyAudience {
+	case LegacyAudienceOn:
+		o.IsLegacy = true
+	case LegacyAudienceOff:
+		o.IsLegacy = false
+	case LegacyAudienceAuto:
+		o.IsLegacy = false
+		m, err := readCacheMetadata(getCacheMetadataFileName(o))
+		if err != nil {
+			logf(5, "unable to read cache metadata: %s", err)
+		} else if m.LegacyAudience != nil {
+			o.IsLegacy = *m.LegacyAudience
+		}
+	}
+}
+
 func getCacheFileName(o *Options) string {
-	// format: ${environment}-${server-id}-${client-id}-${tenant-id}[_legacy].json
-	cacheFileNameFormat := "%s-%s-%s-%s.json"
+	return getCacheFileNameForServerID(o, o.ServerID)
+}
+
+// getServerIDFromCacheFileName returns the server ID in the token cache file name of the options
+func getServerIDFromCacheFileName(o *Options, file string) string {
+	pattern := getCacheFileNameForServerID(o, "*")
+	i := strings.Index(pattern, "*")
+	return strings.TrimSuffix(strings.TrimPrefix(file, pattern[:i]), pattern[i+1:])
+}
+
+// getCacheFileNameForServerID returns the token cache file name of the options with serverID instead of o.ServerID
+func getCacheFileNameForServerID(o *Options, serverID string) string {
+	// format: [accounts/${account-alias}/]${environment}-${server-id}-${client-id}-${tenant-id}[_${b2c-policy}][_legacy][_id][_azurecli].json
+	cacheFileName := fmt.Sprintf("%s-%s-%s-%s", o.Environment, serverID, o.ClientID, o.TenantID)
+	if o.B2CPolicy != "" {
+		// the tokens of the policies of a B2C tenant have different claims
+		cacheFileName += "_" + strings.ToLower(o.B2CPolicy)
+	}
 	if o.IsLegacy {
-		cacheFileNameFormat = "%s-%s-%s-%s_legacy.json"
+		cacheFileName += "_legacy"
+	}
+	if o.TokenType == TokenTypeID {
+		cacheFileName += "_id"
+	}
+	if o.LoginMethod == AzureCLILogin {
+		// the token of Azure CLI is not interchangeable with the ones of other login methods without client ID
+		cacheFileName += "_azurecli"
+	}
+	return filepath.Join(getAccountCacheDir(o.TokenCacheDir, o.accountAlias), cacheFileName+".json")
+}
+
+// updateAccountAlias sets the alias of the token cache from --account-alias, or from the alias set by accounts switch
+func (o *Options) updateAccountAlias() {
+	alias := o.AccountAlias
+	if alias == "" {
+		var err error
+		if alias, err = GetCurrentAccountAlias(o.TokenCacheDir); err != nil {
+			logf(5, "using the default account: %s", err)
+		}
+	}
+	// the default account is the token cache directory itself
+	if alias == DefaultAccountAlias {
+		alias = ""
 	}
-	return filepath.Join(o.TokenCacheDir, fmt.Sprintf(cacheFileNameFormat, o.Environment, o.ServerID, o.ClientID, o.TenantID))
+	o.accountAlias = alias
 }
@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -36,6 +37,137 @@ func TestOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid legacy audience mode should return error", func(t *testing.T) {
+		o := NewOptions()
+		o.LegacyAudience = "maybe"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a supported legacy audience mode") {
+			t.Fatalf("unsupported legacy audience mode should return unsupported error. got: %s", err)
+		}
+	})
+
+	t.Run("legacy audience on should produce legacy token cache file", func(t *testing.T) {
+		o := NewOptions()
+		o.LegacyAudience = LegacyAudienceOn
+		o.UpdateFromEnv()
+		if !o.IsLegacy || !strings.HasSuffix(o.tokenCacheFile, "_legacy.json") {
+			t.Fatalf("expected legacy token cache file, got %s", o.tokenCacheFile)
+		}
+	})
+
+	t.Run("id token type should only be supported in delegated login", func(t *testing.T) {
+		o := NewOptions()
+		o.TokenType = TokenTypeID
+		if err := o.Validate(); err != nil {
+			t.Fatalf("id token type should be supported in devicecode login. got: %s", err)
+		}
+		o.LoginMethod = MSILogin
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is only supported in devicecode and ropc login") {
+			t.Fatalf("id token type should not be supported in msi login. got: %s", err)
+		}
+		o.TokenType = "refresh"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a supported token type") {
+			t.Fatalf("unsupported token type should return unsupported error. got: %s", err)
+		}
+	})
+
+	t.Run("id token type should produce separate token cache file", func(t *testing.T) {
+		o := NewOptions()
+		o.TokenType = TokenTypeID
+		o.UpdateFromEnv()
+		if !strings.HasSuffix(o.tokenCacheFile, "_id.json") {
+			t.Fatalf("expected id token cache file, got %s", o.tokenCacheFile)
+		}
+	})
+
+	t.Run("expiry jitter should be limited", func(t *testing.T) {
+		o := NewOptions()
+		o.ExpiryJitter = 5 * time.Minute
+		if err := o.Validate(); err != nil {
+			t.Fatalf("expected 5m expiry jitter to be valid. got: %s", err)
+		}
+		o.ExpiryJitter = time.Hour
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "expiry jitter must be between 0 and 30m0s") {
+			t.Fatalf("expected too long expiry jitter to return error. got: %v", err)
+		}
+	})
+
+	t.Run("b2c policy should be limited to devicecode and interactive login", func(t *testing.T) {
+		o := NewOptions()
+		o.LoginMethod = DeviceCodeLogin
+		o.B2CPolicy = "B2C_1A_signin"
+		if err := o.Validate(); err != nil {
+			t.Fatalf("expected b2c policy to be valid in devicecode login. got: %s", err)
+		}
+		o.LoginMethod = ServicePrincipalLogin
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "B2C policy is only supported in devicecode and interactive login") {
+			t.Fatalf("expected b2c policy in spn login to return error. got: %v", err)
+		}
+		o.LoginMethod = InteractiveLogin
+		o.B2CPolicy = "B2C_1A/signin"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a valid B2C policy") {
+			t.Fatalf("expected invalid b2c policy to return error. got: %v", err)
+		}
+	})
+
+	t.Run("b2c policy should produce separate token cache file", func(t *testing.T) {
+		o := NewOptions()
+		o.B2CPolicy = "B2C_1A_signin"
+		o.UpdateFromEnv()
+		if !strings.HasSuffix(o.tokenCacheFile, "_b2c_1a_signin.json") {
+			t.Fatalf("expected b2c token cache file, got %s", o.tokenCacheFile)
+		}
+	})
+
+	t.Run("signature file should be required with sign key", func(t *testing.T) {
+		o := NewOptions()
+		o.SignKey = "key.pem"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "--signature-file is required with --sign-key") {
+			t.Fatalf("expected sign key without signature file to return error. got: %v", err)
+		}
+		o.SignatureFile = "cred.jws"
+		if err := o.Validate(); err != nil {
+			t.Fatalf("expected sign key with signature file to be valid. got: %s", err)
+		}
+	})
+
+	t.Run("account alias should produce token cache file under the directory of the account", func(t *testing.T) {
+		o := NewOptions()
+		o.TokenCacheDir = t.TempDir()
+		o.AccountAlias = "work"
+		o.UpdateFromEnv()
+		if err := o.Validate(); err != nil {
+			t.Fatalf("option validation failed: %s", err)
+		}
+		dir := filepath.Dir(o.tokenCacheFile)
+		if expected := filepath.Join(o.TokenCacheDir, "accounts", "work"); dir != expected {
+			t.Fatalf("token cache directory is expected to be %s, got %s", expected, dir)
+		}
+		if dir := filepath.Dir(getCacheMetadataFileName(&o)); dir != filepath.Join(o.TokenCacheDir, "accounts", "work") {
+			t.Fatalf("expected the cache metadata to be under the directory of the account, got %s", dir)
+		}
+		o.AccountAlias = "Work"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a valid account alias") {
+			t.Fatalf("expected invalid account alias to return error. got: %v", err)
+		}
+	})
+
+	t.Run("account set by accounts switch should be used without account alias", func(t *testing.T) {
+		o := NewOptions()
+		o.TokenCacheDir = t.TempDir()
+		if err := SwitchAccount(o.TokenCacheDir, "personal"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		o.UpdateFromEnv()
+		if dir := filepath.Dir(o.tokenCacheFile); dir != filepath.Join(o.TokenCacheDir, "accounts", "personal") {
+			t.Fatalf("expected token cache file of the current account, got %s", o.tokenCacheFile)
+		}
+		o.AccountAlias = DefaultAccountAlias
+		o.UpdateFromEnv()
+		if dir := filepath.Dir(o.tokenCacheFile); dir != o.TokenCacheDir {
+			t.Fatalf("expected token cache file of the default account, got %s", o.tokenCacheFile)
+		}
+	})
+
 	t.Run("invalid login method should return error", func(t *testing.T) {
 		o := NewOptions()
 		o.LoginMethod = "unsupported"
@@ -84,7 +216,7 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				Password:           password,
 				TenantID:           tenantID,
 				LoginMethod:        DeviceCodeLogin,
-				tokenCacheFile:     "---.json",
+				tokenCacheFile:     "--clientID-tenantID.json",
 			},
 		},
 		{
@@ -106,7 +238,7 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				ClientCertPassword:     certPassword,
 				TenantID:               tenantID,
 				LoginMethod:            DeviceCodeLogin,
-				tokenCacheFile:         "---.json",
+				tokenCacheFile:         "--clientID-tenantID.json",
 			},
 		},
 		{
@@ -134,7 +266,7 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				LoginMethod:        WorkloadIdentityLogin,
 				AuthorityHost:      authorityHost,
 				FederatedTokenFile: tokenFile,
-				tokenCacheFile:     "---.json",
+				tokenCacheFile:     "--clientID-tenantID.json",
 			},
 		},
 	}
@@ -0,0 +1,357 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// names of the stages of the token pipeline, in the order they run
+const (
+	stageCacheLookup    = "cache-lookup"
+	stageValidate       = "validate"
+	stageLock           = "lock"
+	stageRefresh        = "refresh"
+	stageOtherAudiences = "other-audiences"
+	stageInteractive    = "interactive"
+	stageAcquire        = "acquire"
+	stagePersist        = "persist"
+	stageRecordUsage    = "record-usage"
+	stageEmit           = "emit"
+)
+
+// tokenState is passed along the stages of the token pipeline
+type tokenState struct {
+	// token is the cached token after cache lookup, and the token returned once a stage is done
+	token adal.Token
+	// done is set by the stage which returned the token without acquiring a new one, e.g. from cache,
+	// so that only the stages with runWhenDone run afterwards
+	done bool
+	// emit is set when the token is written to standard output for kubectl, i.e. by Do rather than Token
+	emit bool
+	// refreshed is set by the stage which acquired the token with a refresh token instead of the provider,
+	// so that the token is persisted once the stages after acquire, e.g. --policy, allowed it
+	refreshed bool
+	// refreshedFrom is the cache metadata file of the other audience whose refresh token acquired the token
+	refreshedFrom string
+	// cleanups run in reverse order when the pipeline completes, e.g. to release the token cache lock
+	cleanups []func()
+}
+
+// tokenStage is a step of getting the token for kubectl. A stage returning an error stops the pipeline.
+type tokenStage struct {
+	name string
+	run  func(p *execCredentialPlugin, s *tokenState) error
+	// runWhenDone is set for the stages which run after a previous stage decided the token
+	runWhenDone bool
+}
+
+// defaultTokenStages returns the stages of get-token:
+// cache lookup → validation → lock → refresh → acquire → persist → usage recording → emit
+func defaultTokenStages() []tokenStage {
+	return []tokenStage{
+		{name: stageCacheLookup, run: (*execCredentialPlugin).lookupTokenCache},
+		{name: stageValidate, run: (*execCredentialPlugin).validateCachedToken},
+		{name: stageLock, run: (*execCredentialPlugin).lockTokenCache},
+		{name: stageRefresh, run: (*execCredentialPlugin).refreshCachedToken},
+		{name: stageOtherAudiences, run: (*execCredentialPlugin).refreshOtherAudiences},
+		{name: stageInteractive, run: (*execCredentialPlugin).checkInteractive},
+		{name: stageAcquire, run: (*execCredentialPlugin).acquireToken},
+		{name: stagePersist, run: (*execCredentialPlugin).persistToken},
+		{name: stageRecordUsage, run: (*execCredentialPlugin).recordTokenUsage, runWhenDone: true},
+		{name: stageEmit, run: (*execCredentialPlugin).emitToken, runWhenDone: true},
+	}
+}
+
+// insertTokenStage returns stages with stage inserted after the stage named after, e.g. a policy check after validation.
+// stage is appended when there is no stage named after.
+func insertTokenStage(stages []tokenStage, after string, stage tokenStage) []tokenStage {
+	inserted := make([]tokenStage, 0, len(stages)+1)
+	for i, s := range stages {
+		inserted = append(inserted, s)
+		if s.name == after {
+			inserted = append(inserted, stage)
+			return append(inserted, stages[i+1:]...)
+		}
+	}
+	return append(inserted, stage)
+}
+
+// runTokenStages runs the stages of the plugin, or the default stages when none are set
+func (p *execCredentialPlugin) runTokenStages(s *tokenState) error {
+	defer func() {
+		for i := len(s.cleanups) - 1; i >= 0; i-- {
+			s.cleanups[i]()
+		}
+	}()
+	stages := p.stages
+	if stages == nil {
+		stages = defaultTokenStages()
+	}
+	for _, stage := range stages {
+		if s.done && !stage.runWhenDone {
+			continue
+		}
+		p.o.log.logf(10, "running %s stage", stage.name)
+		if err := stage.run(p, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockTokenCache holds the lock until the token is persisted so that concurrent processes
+// wait and reuse the token from cache instead of refreshing it again.
+// It only runs when the cached token cannot be used, so that a cache hit never waits for the lock,
+// and looks up the token cache again once the lock is held, since the process which held it may have refreshed the token.
+func (p *execCredentialPlugin) lockTokenCache(s *tokenState) error {
+	if p.disableTokenCache || p.cacheLocker == nil {
+		return nil
+	}
+	unlock, err := p.cacheLocker(p.o.tokenCacheFile)
+	if err != nil {
+		p.o.log.logf(5, "continue without token cache lock: %s", err)
+		return nil
+	}
+	s.cleanups = append(s.cleanups, unlock)
+	if err := p.lookupTokenCache(s); err != nil {
+		return err
+	}
+	return p.validateCachedToken(s)
+}
+
+// lookupTokenCache reads the cached token, discarding it when it must not be used anymore
+func (p *execCredentialPlugin) lookupTokenCache(s *tokenState) error {
+	if p.disableTokenCache {
+		return nil
+	}
+	token, err := p.tokenCache.Read(p.o.tokenCacheFile)
+	if err != nil {
+		return fmt.Errorf("unable to read from token cache: %s, err: %s", p.o.tokenCacheFile, err)
+	}
+	token = p.withJWTExpiry(token)
+	if p.o.MaxCacheAge > 0 && !token.IsZero() && isMaxCacheAgeExceeded(getCacheMetadataFileName(p.o), p.o.MaxCacheAge, p.getClock().Now()) {
+		p.o.log.logf(5, "last authentication is older than %s, will login again", p.o.MaxCacheAge)
+		token = adal.Token{}
+	}
+	if p.o.LoginMethod == AzureCLILogin && !token.IsZero() && isAzureCLITokenStale(p.o.tokenCacheFile) {
+		p.o.log.logf(5, "Azure CLI profile changed after the token was cached, will run Azure CLI again")
+		token = adal.Token{}
+	}
+	s.token = token
+	return nil
+}
+
+// isCachedTokenForAudience is true when the cached token is issued for the target audience
+func (p *execCredentialPlugin) isCachedTokenForAudience(s *tokenState) bool {
+	return s.token.Resource == getTargetAudience(p.o) && !s.token.IsZero()
+}
+
+// validateCachedToken returns the cached token when it is not expired
+func (p *execCredentialPlugin) validateCachedToken(s *tokenState) error {
+	if p.isCachedTokenForAudience(s) && !willExpireIn(p.getClock(), s.token, expirationDelta+p.getExpiryJitter(s.token)) {
+		p.o.log.logf(10, "access token is still valid. will return")
+		s.done = true
+	}
+	return nil
+}
+
+// refreshCachedToken refreshes the expired cached token when it has a refresh token
+func (p *execCredentialPlugin) refreshCachedToken(s *tokenState) error {
+	if !p.isCachedTokenForAudience(s) {
+		return nil
+	}
+	if method, _ := getLoginMethod(p.o.LoginMethod); !method.Refresh || s.token.RefreshToken == "" {
+		p.o.log.logf(5, "there is no refresh token")
+		return nil
+	}
+
+	p.o.log.logf(10, "getting refresher")
+	oAuthConfig, err := getOAuthConfigForOptions(p.o)
+	if err != nil {
+		return fmt.Errorf("unable to get oAuthConfig: %s", err)
+	}
+	cached := s.token
+	refresher, err := p.refresher(*oAuthConfig, p.o.ClientID, p.o.ServerID, p.o.TenantID, p.o.TokenType, p.o.Timeout, &cached)
+	if err != nil {
+		return fmt.Errorf("failed to get refresher: %s", err)
+	}
+	p.o.log.logf(5, "refresh token")
+	token, err := refresher.Token()
+	// if refresh fails, we will login using token provider
+	if err != nil {
+		p.o.log.logf(5, "refresh failed, will continue to login: %s", err)
+		return nil
+	}
+	token = p.withJWTExpiry(token)
+	warnClockSkew(p.getClock(), token)
+
+	p.o.log.logf(10, "token refreshed")
+	// the token is persisted once it is allowed, the same as an acquired token
+	s.token = token
+	s.refreshed = true
+	return nil
+}
+
+// refreshOtherAudiences acquires the token with a refresh token cached for another server ID with --reuse-refresh-token-across-audiences
+func (p *execCredentialPlugin) refreshOtherAudiences(s *tokenState) error {
+	if s.refreshed || !p.o.ReuseRefreshToken || p.disableTokenCache {
+		return nil
+	}
+	token, metadataFile, ok, err := p.tokenFromOtherAudiences()
+	if err != nil {
+		return err
+	}
+	if ok {
+		s.token = token
+		s.refreshed = true
+		s.refreshedFrom = metadataFile
+	}
+	return nil
+}
+
+// checkInteractive fails instead of prompting the user when kubectl does not run the exec plugin interactively
+func (p *execCredentialPlugin) checkInteractive(s *tokenState) error {
+	if method, _ := getLoginMethod(p.o.LoginMethod); !method.Interactive || s.refreshed {
+		return nil
+	}
+	interactive, err := isInteractiveFromExecInfoEnv()
+	if err != nil {
+		return err
+	}
+	if !interactive {
+		return &ExitCodeError{
+			Code: ExitCodeInteractiveLoginRequired,
+			Err:  fmt.Errorf("%s login requires user interaction but the exec plugin is not run interactively", p.o.LoginMethod),
+		}
+	}
+	return nil
+}
+
+// acquireToken runs the underlying provider, retrying with 'spn:' prefix in audience claim with --legacy-audience auto
+func (p *execCredentialPlugin) acquireToken(s *tokenState) error {
+	if s.refreshed {
+		return nil
+	}
+	p.o.log.logf(5, "acquire new token")
+	token, err := p.provider.Token()
+	// only a missing resource principal is retried, so that other failures, e.g. a cancelled sign-in, are not hidden
+	if isResourceNotFound(err) && p.o.LegacyAudience == LegacyAudienceAuto && !p.o.IsLegacy {
+		p.o.log.logf(5, "resource of the audience without 'spn:' prefix was not found, will retry with the prefix: %s", err)
+		token, err = p.tokenWithLegacyAudience()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	s.token = p.withJWTExpiry(token)
+	warnClockSkew(p.getClock(), s.token)
+	return nil
+}
+
+// persistToken writes the acquired token and the cache metadata to the token cache directory
+func (p *execCredentialPlugin) persistToken(s *tokenState) error {
+	if s.refreshed {
+		return p.persistRefreshedToken(s)
+	}
+	// the time of authentication is also reported by token-cache stats, so it is recorded without --max-cache-age
+	recordAuthentication := !p.disableTokenCache
+	// a read-only token cache directory is never written, including the cache metadata
+	if (p.o.LegacyAudience == LegacyAudienceAuto || recordAuthentication) && !p.o.TokenCacheReadOnly {
+		if err := updateCacheMetadata(getCacheMetadataFileName(p.o), func(m *cacheMetadata) {
+			if p.o.LegacyAudience == LegacyAudienceAuto {
+				// remember which audience variant worked to skip probing next time
+				isLegacy := p.o.IsLegacy
+				m.LegacyAudience = &isLegacy
+			}
+			if recordAuthentication {
+				// in UTC so that the metadata does not depend on the time zone of the machine
+				now := p.getClock().Now().UTC()
+				m.AuthenticatedAt = &now
+			}
+		}); err != nil {
+			p.o.log.logf(5, "unable to write cache metadata: %s", err)
+		}
+	}
+
+	if !p.disableTokenCache {
+		if err := p.tokenCache.Write(p.o.tokenCacheFile, s.token); err != nil {
+			return fmt.Errorf("unable to write to token cache: %s, err: %s", p.o.tokenCacheFile, err)
+		}
+	}
+	return nil
+}
+
+// persistRefreshedToken writes the token acquired with a refresh token, whose user did not authenticate again
+func (p *execCredentialPlugin) persistRefreshedToken(s *tokenState) error {
+	if err := p.tokenCache.Write(p.o.tokenCacheFile, s.token); err != nil {
+		return fmt.Errorf("failed to write to store: %s", err)
+	}
+	if s.refreshedFrom != "" && p.o.MaxCacheAge > 0 && !p.o.TokenCacheReadOnly {
+		// the token is as old as the one of the other audience it is acquired with
+		otherMetadata, _ := readCacheMetadata(s.refreshedFrom)
+		if err := updateCacheMetadata(getCacheMetadataFileName(p.o), func(m *cacheMetadata) {
+			m.AuthenticatedAt = otherMetadata.AuthenticatedAt
+		}); err != nil {
+			p.o.log.logf(5, "unable to write cache metadata: %s", err)
+		}
+	}
+	return nil
+}
+
+// recordTokenUsage records when the token was returned in the cache metadata, which token-cache stats reports
+func (p *execCredentialPlugin) recordTokenUsage(*tokenState) error {
+	if p.disableTokenCache || p.o.TokenCacheReadOnly {
+		return nil
+	}
+	file := getCacheMetadataFileName(p.o)
+	now := p.getClock().Now().UTC()
+	if m, err := readCacheMetadata(file); err == nil && m.LastUsedAt != nil {
+		if since := now.Sub(*m.LastUsedAt); since >= 0 && since < lastUsedResolution {
+			return nil
+		}
+	}
+	if err := updateCacheMetadata(file, func(m *cacheMetadata) {
+		m.LastUsedAt = &now
+	}); err != nil {
+		p.o.log.logf(5, "unable to write cache metadata: %s", err)
+	}
+	return nil
+}
+
+// emitToken writes the ExecCredential with the token to standard output for kubectl
+func (p *execCredentialPlugin) emitToken(s *tokenState) error {
+	if !s.emit {
+		return nil
+	}
+	token := s.token
+	p.showClaims(token)
+	// have kubectl run the plugin again when the plugin refreshes the token, and with --trust-jwt-exp,
+	// when the plugin would no longer return the token from cache, i.e. at the same instant validateCachedToken does
+	offset := p.getExpiryJitter(token)
+	if p.o.TrustJWTExp {
+		offset += expirationDelta
+	}
+	if offset > 0 {
+		token.ExpiresOn = json.Number(strconv.FormatInt(token.Expires().Add(-offset).Unix(), 10))
+		token.ExpiresIn = ""
+	}
+	// the prefix is only applied to the token handed to kubectl, the cached token stays untouched
+	token.AccessToken = p.o.TokenPrefix + token.AccessToken
+	if p.signer == nil {
+		return p.execCredentialWriter.Write(token, os.Stdout)
+	}
+	// the exact bytes read by kubectl are signed
+	var buf bytes.Buffer
+	if err := p.execCredentialWriter.Write(token, &buf); err != nil {
+		return err
+	}
+	if err := writeExecCredentialSignature(p.o.SignatureFile, p.signer, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to sign the ExecCredential: %w", err)
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
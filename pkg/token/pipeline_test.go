@@ -0,0 +1,237 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+)
+
+func stageNames(stages []tokenStage) []string {
+	names := make([]string, 0, len(stages))
+	for _, s := range stages {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func TestInsertTokenStage(t *testing.T) {
+	noop := func(*execCredentialPlugin, *tokenState) error { return nil }
+	stages := []tokenStage{{name: "a", run: noop}, {name: "b", run: noop}}
+
+	testData := []struct {
+		name     string
+		after    string
+		expected []string
+	}{
+		{
+			name:     "stage should be inserted after the named stage",
+			after:    "a",
+			expected: []string{"a", "policy", "b"},
+		},
+		{
+			name:     "stage should be appended after the last stage",
+			after:    "b",
+			expected: []string{"a", "b", "policy"},
+		},
+		{
+			name:     "stage should be appended when the named stage is not found",
+			after:    "unknown",
+			expected: []string{"a", "b", "policy"},
+		},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			inserted := insertTokenStage(stages, data.after, tokenStage{name: "policy", run: noop})
+			if got := stageNames(inserted); !reflect.DeepEqual(got, data.expected) {
+				t.Fatalf("expected stages %v, got %v", data.expected, got)
+			}
+			if got := stageNames(stages); !reflect.DeepEqual(got, []string{"a", "b"}) {
+				t.Fatalf("expected the stages to be left untouched, got %v", got)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginCustomStage(t *testing.T) {
+	const cacheFile = "cacheFile"
+	expiredToken := adal.Token{
+		AccessToken: "expiredToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())),
+	}
+	newToken := adal.Token{
+		AccessToken: "newToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+
+	t.Run("failing stage should stop the pipeline", func(t *testing.T) {
+		ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+		defer ctrl.Finish()
+		tokenCache.EXPECT().Read(cacheFile).Return(expiredToken, nil)
+
+		policyErr := errors.New("login is not allowed")
+		plugin := execCredentialPlugin{
+			o: &Options{
+				TokenCacheDir:  t.TempDir(),
+				LoginMethod:    MSILogin,
+				tokenCacheFile: cacheFile,
+			},
+			tokenCache:           tokenCache,
+			provider:             tokenProvider,
+			execCredentialWriter: pluginWriter,
+			stages: insertTokenStage(defaultTokenStages(), stageValidate, tokenStage{
+				name: "policy",
+				run:  func(*execCredentialPlugin, *tokenState) error { return policyErr },
+			}),
+		}
+		if err := plugin.Do(); !errors.Is(err, policyErr) {
+			t.Fatalf("expected error %s, got %v", policyErr, err)
+		}
+	})
+
+	t.Run("stage should see the acquired token before it is persisted", func(t *testing.T) {
+		ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+		defer ctrl.Finish()
+		tokenCache.EXPECT().Read(cacheFile).Return(expiredToken, nil)
+		tokenProvider.EXPECT().Token().Return(newToken, nil)
+		tokenCache.EXPECT().Write(cacheFile, newToken).Return(nil)
+		pluginWriter.EXPECT().Write(newToken, os.Stdout).Return(nil)
+
+		var seen []string
+		plugin := execCredentialPlugin{
+			o: &Options{
+				TokenCacheDir:  t.TempDir(),
+				LoginMethod:    MSILogin,
+				tokenCacheFile: cacheFile,
+			},
+			tokenCache:           tokenCache,
+			provider:             tokenProvider,
+			execCredentialWriter: pluginWriter,
+			stages: insertTokenStage(defaultTokenStages(), stageAcquire, tokenStage{
+				name: "audit",
+				run: func(_ *execCredentialPlugin, s *tokenState) error {
+					seen = append(seen, s.token.AccessToken)
+					return nil
+				},
+			}),
+		}
+		if err := plugin.Do(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(seen, []string{newToken.AccessToken}) {
+			t.Fatalf("expected the stage to see %s, got %v", newToken.AccessToken, seen)
+		}
+	})
+
+	t.Run("stages should be skipped once the token is returned from cache", func(t *testing.T) {
+		ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+		defer ctrl.Finish()
+		tokenCache.EXPECT().Read(cacheFile).Return(newToken, nil)
+
+		ran := false
+		plugin := execCredentialPlugin{
+			o: &Options{
+				TokenCacheDir:  t.TempDir(),
+				LoginMethod:    MSILogin,
+				tokenCacheFile: cacheFile,
+			},
+			tokenCache:           tokenCache,
+			provider:             tokenProvider,
+			execCredentialWriter: pluginWriter,
+			stages: insertTokenStage(defaultTokenStages(), stageValidate, tokenStage{
+				name: "audit",
+				run: func(*execCredentialPlugin, *tokenState) error {
+					ran = true
+					return nil
+				},
+			}),
+		}
+		token, err := plugin.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token.AccessToken != newToken.AccessToken {
+			t.Fatalf("expected the cached token, got %s", token.AccessToken)
+		}
+		if ran {
+			t.Fatalf("expected the stage to be skipped")
+		}
+	})
+}
+
+func TestExecCredentialPluginTokenCacheLock(t *testing.T) {
+	const cacheFile = "cacheFile"
+	expiredToken := adal.Token{
+		AccessToken: "expiredToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())),
+	}
+	newToken := adal.Token{
+		AccessToken: "newToken",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+
+	t.Run("cache hit should not take the lock", func(t *testing.T) {
+		ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+		defer ctrl.Finish()
+		tokenCache.EXPECT().Read(cacheFile).Return(newToken, nil)
+
+		plugin := execCredentialPlugin{
+			o: &Options{
+				TokenCacheDir:  t.TempDir(),
+				LoginMethod:    MSILogin,
+				tokenCacheFile: cacheFile,
+			},
+			tokenCache:           tokenCache,
+			provider:             tokenProvider,
+			execCredentialWriter: pluginWriter,
+			cacheLocker: func(string) (func(), error) {
+				t.Fatalf("expected the token cache not to be locked")
+				return nil, nil
+			},
+		}
+		if _, err := plugin.Token(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("token refreshed by another process while waiting for the lock should be reused", func(t *testing.T) {
+		ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+		defer ctrl.Finish()
+		gomock.InOrder(
+			tokenCache.EXPECT().Read(cacheFile).Return(expiredToken, nil),
+			tokenCache.EXPECT().Read(cacheFile).Return(newToken, nil),
+		)
+
+		locked, unlocked := 0, 0
+		plugin := execCredentialPlugin{
+			o: &Options{
+				TokenCacheDir:  t.TempDir(),
+				LoginMethod:    MSILogin,
+				tokenCacheFile: cacheFile,
+			},
+			tokenCache:           tokenCache,
+			provider:             tokenProvider,
+			execCredentialWriter: pluginWriter,
+			cacheLocker: func(string) (func(), error) {
+				locked++
+				return func() { unlocked++ }, nil
+			},
+		}
+		token, err := plugin.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if token.AccessToken != newToken.AccessToken {
+			t.Fatalf("expected the token refreshed by another process, got %s", token.AccessToken)
+		}
+		if locked != 1 || unlocked != 1 {
+			t.Fatalf("expected the lock to be taken and released once, got %d and %d", locked, unlocked)
+		}
+	})
+}
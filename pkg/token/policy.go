@@ -0,0 +1,109 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/google/cel-go/cel"
+)
+
+const (
+	stagePolicy = "policy"
+
+	// policyFilePrefix is the prefix of --policy reading the expression from the file, e.g. @/etc/kubelogin/policy.cel
+	policyFilePrefix = "@"
+)
+
+// tokenPolicy is the CEL expression of --policy, deciding whether the token may be returned to kubectl
+type tokenPolicy struct {
+	expression string
+	program    cel.Program
+}
+
+// newTokenPolicy compiles the CEL expression of --policy, or returns nil when no policy is set.
+// The expression is evaluated with the variables:
+// claims (the claims of the token), serverID, clientID, tenantID, loginMethod, environment, and now (the current time).
+func newTokenPolicy(policy string) (*tokenPolicy, error) {
+	if policy == "" {
+		return nil, nil
+	}
+	expression := policy
+	if strings.HasPrefix(policy, policyFilePrefix) {
+		data, err := os.ReadFile(strings.TrimPrefix(policy, policyFilePrefix))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read policy: %s", err)
+		}
+		expression = strings.TrimSpace(string(data))
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("serverID", cel.StringType),
+		cel.Variable("clientID", cel.StringType),
+		cel.Variable("tenantID", cel.StringType),
+		cel.Variable("loginMethod", cel.StringType),
+		cel.Variable("environment", cel.StringType),
+		cel.Variable("now", cel.TimestampType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create policy environment: %s", err)
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("unable to compile policy %q: %s", expression, issues.Err())
+	}
+	if !cel.BoolType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("policy %q must evaluate to bool, got %s", expression, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile policy %q: %s", expression, err)
+	}
+	return &tokenPolicy{expression: expression, program: program}, nil
+}
+
+// evaluate returns an error with ExitCodePolicyDenied unless the policy evaluates to true.
+// The policy fails closed: an expression failing to evaluate, e.g. on a claim missing from the token, denies the token.
+func (p *tokenPolicy) evaluate(o *Options, token adal.Token, now time.Time) error {
+	claims := map[string]interface{}{}
+	if err := parseJWTClaims("token", token.AccessToken, &claims); err != nil {
+		o.log.logf(5, "evaluating policy without token claims: %s", err)
+	}
+	out, _, err := p.program.Eval(map[string]interface{}{
+		"claims":      claims,
+		"serverID":    o.ServerID,
+		"clientID":    o.ClientID,
+		"tenantID":    o.TenantID,
+		"loginMethod": o.LoginMethod,
+		"environment": o.Environment,
+		"now":         now,
+	})
+	if err != nil {
+		return &ExitCodeError{
+			Code: ExitCodePolicyDenied,
+			Err:  fmt.Errorf("token denied by policy %q: %s", p.expression, err),
+		}
+	}
+	if allowed, ok := out.Value().(bool); !ok || !allowed {
+		return &ExitCodeError{
+			Code: ExitCodePolicyDenied,
+			Err:  fmt.Errorf("token denied by policy %q", p.expression),
+		}
+	}
+	o.log.logf(5, "token allowed by policy")
+	return nil
+}
+
+// policyStage checks the token against policy before it is returned, including the tokens returned from cache
+func policyStage(policy *tokenPolicy) tokenStage {
+	return tokenStage{
+		name: stagePolicy,
+		run: func(p *execCredentialPlugin, s *tokenState) error {
+			return policy.evaluate(p.o, s.token, p.getClock().Now())
+		},
+		runWhenDone: true,
+	}
+}
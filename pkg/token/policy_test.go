@@ -0,0 +1,322 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/kubelogin/pkg/token/mock_token"
+)
+
+func TestNewTokenPolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.cel")
+	if err := os.WriteFile(policyFile, []byte("claims.tid == tenantID\n"), 0600); err != nil {
+		t.Fatalf("unable to write policy file: %s", err)
+	}
+
+	testCases := []struct {
+		name        string
+		policy      string
+		expectedErr string
+		expression  string
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:       "expression",
+			policy:     `serverID != "prod"`,
+			expression: `serverID != "prod"`,
+		},
+		{
+			name:       "expression from file",
+			policy:     policyFilePrefix + policyFile,
+			expression: "claims.tid == tenantID",
+		},
+		{
+			name:        "missing file",
+			policy:      policyFilePrefix + filepath.Join(t.TempDir(), "missing.cel"),
+			expectedErr: "unable to read policy",
+		},
+		{
+			name:        "invalid expression",
+			policy:      "claims.tid ==",
+			expectedErr: "unable to compile policy",
+		},
+		{
+			name:        "unknown variable",
+			policy:      `audience == "prod"`,
+			expectedErr: "unable to compile policy",
+		},
+		{
+			name:        "expression not evaluating to bool",
+			policy:      "serverID",
+			expectedErr: "must evaluate to bool",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := newTokenPolicy(tc.policy)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.expression == "" {
+				if policy != nil {
+					t.Fatalf("expected no policy, got %q", policy.expression)
+				}
+				return
+			}
+			if policy.expression != tc.expression {
+				t.Fatalf("expected expression %q, got %q", tc.expression, policy.expression)
+			}
+		})
+	}
+}
+
+func TestTokenPolicyEvaluate(t *testing.T) {
+	accessToken := newUnsignedJWT(t, map[string]interface{}{
+		"aud": "6dae42f8-4368-4678-94ff-3960e28e3630",
+		"tid": "tenantID",
+	})
+	o := &Options{
+		LoginMethod: DeviceCodeLogin,
+		ServerID:    "6dae42f8-4368-4678-94ff-3960e28e3630",
+		TenantID:    "tenantID",
+		Environment: defaultEnvironmentName,
+	}
+	businessHours := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2023, 5, 1, 23, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		policy  string
+		token   string
+		now     time.Time
+		allowed bool
+	}{
+		{
+			name:    "audience on the allowlist",
+			policy:  `claims.aud in ["6dae42f8-4368-4678-94ff-3960e28e3630"]`,
+			token:   accessToken,
+			allowed: true,
+		},
+		{
+			name:   "audience not on the allowlist",
+			policy: `claims.aud in ["797f4846-ba00-4fd7-ba43-dac1f8f63013"]`,
+			token:  accessToken,
+		},
+		{
+			name:    "options",
+			policy:  `claims.tid == tenantID && loginMethod == "devicecode" && environment == "AzurePublicCloud"`,
+			token:   accessToken,
+			allowed: true,
+		},
+		{
+			name:    "within business hours",
+			policy:  `now.getHours("UTC") >= 9 && now.getHours("UTC") < 18`,
+			token:   accessToken,
+			now:     businessHours,
+			allowed: true,
+		},
+		{
+			name:   "outside business hours",
+			policy: `now.getHours("UTC") >= 9 && now.getHours("UTC") < 18`,
+			token:  accessToken,
+			now:    night,
+		},
+		{
+			name:   "missing claim",
+			policy: `claims.groups.exists(g, g == "admins")`,
+			token:  accessToken,
+		},
+		{
+			name:   "token without claims",
+			policy: `claims.tid == tenantID`,
+			token:  "opaque",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := newTokenPolicy(tc.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			err = policy.evaluate(o, adal.Token{AccessToken: tc.token}, tc.now)
+			if tc.allowed {
+				if err != nil {
+					t.Fatalf("expected the token to be allowed, got %s", err)
+				}
+				return
+			}
+			if !ErrorContains(err, "token denied by policy") {
+				t.Fatalf("expected the token to be denied, got %v", err)
+			}
+			if code := GetExitCode(err); code != ExitCodePolicyDenied {
+				t.Fatalf("expected exit code %d, got %d", ExitCodePolicyDenied, code)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginPolicy(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	// the token returned from cache is checked as well
+	cachedToken := adal.Token{
+		AccessToken: newUnsignedJWT(t, map[string]interface{}{"tid": "otherTenantID"}),
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}
+	tokenCache.EXPECT().Read(cacheFile).Return(cachedToken, nil)
+
+	policy, err := newTokenPolicy("claims.tid == tenantID")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plugin := execCredentialPlugin{
+		o: &Options{
+			TokenCacheDir:  t.TempDir(),
+			LoginMethod:    MSILogin,
+			TenantID:       "tenantID",
+			tokenCacheFile: cacheFile,
+		},
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		stages:               getTokenStages(&Options{}, policy),
+	}
+	err = plugin.Do()
+	if !ErrorContains(err, "token denied by policy") {
+		t.Fatalf("expected the token to be denied, got %v", err)
+	}
+	if code := GetExitCode(err); code != ExitCodePolicyDenied {
+		t.Fatalf("expected exit code %d, got %d", ExitCodePolicyDenied, code)
+	}
+}
+
+func TestExecCredentialPluginPolicyDeniedTokenNotCached(t *testing.T) {
+	ctrl, _, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+
+	o := &Options{
+		TokenCacheDir: t.TempDir(),
+		LoginMethod:   DeviceCodeLogin,
+		ServerID:      "serverID",
+		TenantID:      "tenantID",
+	}
+	o.tokenCacheFile = getCacheFileName(o)
+	tokenProvider.EXPECT().Token().Return(adal.Token{
+		AccessToken: newUnsignedJWT(t, map[string]interface{}{"tid": "otherTenantID"}),
+		Resource:    "serverID",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}, nil)
+
+	policy, err := newTokenPolicy("claims.tid == tenantID")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plugin := execCredentialPlugin{
+		o:                    o,
+		tokenCache:           &defaultTokenCache{},
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		stages:               getTokenStages(o, policy),
+	}
+	if err := plugin.Do(); !ErrorContains(err, "token denied by policy") {
+		t.Fatalf("expected the token to be denied, got %v", err)
+	}
+	if _, err := os.Stat(o.tokenCacheFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the denied token not to be cached, got %v", err)
+	}
+}
+
+func TestExecCredentialPluginPolicyDeniedRefreshedTokenNotCached(t *testing.T) {
+	testCases := []struct {
+		name string
+		// otherAudience caches the refresh token for another server ID used with --reuse-refresh-token-across-audiences
+		otherAudience bool
+	}{
+		{name: "refreshed token"},
+		{name: "token refreshed with the refresh token of another audience", otherAudience: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl, _, tokenProvider, pluginWriter := setupMocks(t)
+			defer ctrl.Finish()
+			refreshProvider := mock_token.NewMockTokenProvider(ctrl)
+
+			o := &Options{
+				LoginMethod:       DeviceCodeLogin,
+				ClientID:          "clientID",
+				TenantID:          "tenantID",
+				ServerID:          "serverID",
+				Environment:       defaultEnvironmentName,
+				TokenCacheDir:     t.TempDir(),
+				ReuseRefreshToken: tc.otherAudience,
+			}
+			o.tokenCacheFile = getCacheFileName(o)
+			cacheFile := o.tokenCacheFile
+			cached := adal.Token{
+				AccessToken:  "expiredToken",
+				RefreshToken: "refreshToken",
+				Resource:     "serverID",
+				ExpiresOn:    json.Number(fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())),
+			}
+			if tc.otherAudience {
+				cacheFile = getCacheFileNameForServerID(o, "otherServer")
+				cached.Resource = "otherServer"
+			}
+			if err := adal.SaveToken(cacheFile, 0600, cached); err != nil {
+				t.Fatalf("unable to save token: %s", err)
+			}
+			refreshProvider.EXPECT().Token().Return(adal.Token{
+				AccessToken: newUnsignedJWT(t, map[string]interface{}{"tid": "otherTenantID"}),
+				Resource:    "serverID",
+				ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+			}, nil)
+
+			policy, err := newTokenPolicy("claims.tid == tenantID")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			plugin := execCredentialPlugin{
+				o:                    o,
+				tokenCache:           &defaultTokenCache{},
+				provider:             tokenProvider,
+				execCredentialWriter: pluginWriter,
+				refresher: func(adal.OAuthConfig, string, string, string, string, time.Duration, *adal.Token) (TokenProvider, error) {
+					return refreshProvider, nil
+				},
+				stages: getTokenStages(o, policy),
+			}
+			if err := plugin.Do(); !ErrorContains(err, "token denied by policy") {
+				t.Fatalf("expected the token to be denied, got %v", err)
+			}
+
+			if tc.otherAudience {
+				if _, err := os.Stat(o.tokenCacheFile); !os.IsNotExist(err) {
+					t.Fatalf("expected the denied token not to be cached, got %v", err)
+				}
+				return
+			}
+			token, err := adal.LoadToken(o.tokenCacheFile)
+			if err != nil {
+				t.Fatalf("unable to load token: %s", err)
+			}
+			if token.AccessToken != cached.AccessToken {
+				t.Fatalf("expected the denied token not to replace the cached token, got %s", token.AccessToken)
+			}
+		})
+	}
+}
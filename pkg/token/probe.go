@@ -0,0 +1,122 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const stageProbe = "probe"
+
+// probeTimeout bounds all steps of the connectivity precheck of --fail-fast,
+// so that automation fails within a couple of seconds instead of after the retries of the libraries
+var probeTimeout = 2 * time.Second
+
+// probeStage checks the connectivity to the endpoint of the login method before the token is refreshed or acquired.
+// It does not run when the cached token is returned.
+func probeStage() tokenStage {
+	return tokenStage{name: stageProbe, run: (*execCredentialPlugin).probeConnectivity}
+}
+
+func (p *execCredentialPlugin) probeConnectivity(*tokenState) error {
+	endpoint, err := getProbeEndpoint(p.o)
+	if err != nil {
+		return err
+	}
+	if endpoint == "" {
+		p.o.log.logf(5, "no endpoint to probe in %s login", p.o.LoginMethod)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := probeEndpoint(ctx, endpoint, p.o.getHTTPSettings().sharedTransport(), p.o.log); err != nil {
+		return &ExitCodeError{
+			Code: ExitCodeNetworkError,
+			Err:  fmt.Errorf("connectivity precheck of %s login failed: %w", p.o.LoginMethod, err),
+		}
+	}
+	p.o.log.logf(5, "probed %s in %s", endpoint, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// getProbeEndpoint returns the endpoint the login method sends its requests to,
+// or an empty string when the login method has none known to kubelogin, e.g. a login plugin
+func getProbeEndpoint(o *Options) (string, error) {
+	switch o.LoginMethod {
+	case MSILogin:
+		return adal.GetMSIEndpoint()
+	case NMILogin:
+		return o.NMIEndpoint, nil
+	case CloudShellLogin:
+		return o.cloudShellEndpoint, nil
+	case WorkloadIdentityLogin:
+		if o.AuthorityHost != "" {
+			return o.AuthorityHost, nil
+		}
+	}
+	if _, ok := getLoginMethod(o.LoginMethod); !ok {
+		return "", nil
+	}
+	oAuthConfig, err := getOAuthConfigForOptions(o)
+	if err != nil {
+		return "", fmt.Errorf("unable to get oAuthConfig: %s", err)
+	}
+	return oAuthConfig.AuthorityEndpoint.String(), nil
+}
+
+// probeEndpoint resolves the host of the endpoint, connects to it, and sends a HEAD request to the endpoint.
+// The proxy of the transport is resolved and connected to instead when the endpoint is reached through it.
+// Any response of the endpoint, including an error status, passes the probe.
+func probeEndpoint(ctx context.Context, endpoint string, transport *http.Transport, log *logSink) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	target, via := u, ""
+	if transport.Proxy != nil {
+		proxy, err := transport.Proxy(req)
+		if err != nil {
+			return fmt.Errorf("unable to get the proxy of %s: %w", u.Host, err)
+		}
+		if proxy != nil {
+			target, via = proxy, " of proxy "+proxy.Host
+		}
+	}
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = "443"
+		if target.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return fmt.Errorf("DNS lookup of %s%s failed: %w", host, via, err)
+		}
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return fmt.Errorf("TCP connection to %s%s failed: %w", net.JoinHostPort(host, port), via, err)
+	}
+	conn.Close()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP HEAD %s failed: %w", u.Redacted(), err)
+	}
+	resp.Body.Close()
+	log.logf(10, "HEAD %s returned %s", u.Redacted(), resp.Status)
+	return nil
+}
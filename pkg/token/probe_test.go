@@ -0,0 +1,173 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+)
+
+// newClosedEndpoint returns the URL of a port nothing listens on
+func newClosedEndpoint(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	endpoint := "http://" + l.Addr().String() + "/"
+	l.Close()
+	return endpoint
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("expected HEAD request, got %s", r.Method)
+		}
+		// any response of the endpoint passes the probe
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+	closed := newClosedEndpoint(t)
+
+	testCases := []struct {
+		name        string
+		endpoint    string
+		proxy       string
+		expectedErr string
+	}{
+		{
+			name:     "reachable endpoint should pass",
+			endpoint: server.URL,
+		},
+		{
+			name:        "unresolvable host should fail with DNS lookup",
+			endpoint:    "https://login.invalid/",
+			expectedErr: "DNS lookup of login.invalid failed",
+		},
+		{
+			name:        "closed port should fail with TCP connection",
+			endpoint:    closed,
+			expectedErr: "TCP connection to " + closed[len("http://"):len(closed)-1] + " failed",
+		},
+		{
+			name:        "proxy should be connected to instead of the endpoint",
+			endpoint:    "https://login.invalid/",
+			proxy:       closed,
+			expectedErr: "of proxy " + closed[len("http://"):len(closed)-1] + " failed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport := &http.Transport{}
+			if tc.proxy != "" {
+				proxy, _ := url.Parse(tc.proxy)
+				transport.Proxy = http.ProxyURL(proxy)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			err := probeEndpoint(ctx, tc.endpoint, transport, nil)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetProbeEndpoint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{
+			name:     "authority of the environment should be probed",
+			options:  Options{LoginMethod: DeviceCodeLogin, Environment: "AzurePublicCloud", TenantID: "tenantID"},
+			expected: "https://login.microsoftonline.com/tenantID",
+		},
+		{
+			name:     "authority host of workload identity should be probed",
+			options:  Options{LoginMethod: WorkloadIdentityLogin, AuthorityHost: "https://login.contoso.com/"},
+			expected: "https://login.contoso.com/",
+		},
+		{
+			name:     "NMI endpoint should be probed",
+			options:  Options{LoginMethod: NMILogin, NMIEndpoint: "http://localhost:2579/host/token/"},
+			expected: "http://localhost:2579/host/token/",
+		},
+		{
+			name:    "login plugin should not be probed",
+			options: Options{LoginMethod: "broker"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, err := getProbeEndpoint(&tc.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if endpoint != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, endpoint)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginFailFast(t *testing.T) {
+	const cacheFile = "cacheFile"
+	ctrl, tokenCache, tokenProvider, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+	o := &Options{
+		TokenCacheDir:  t.TempDir(),
+		LoginMethod:    NMILogin,
+		ServerID:       "serverID",
+		NMIEndpoint:    newClosedEndpoint(t),
+		tokenCacheFile: cacheFile,
+	}
+	plugin := execCredentialPlugin{
+		o:                    o,
+		tokenCache:           tokenCache,
+		provider:             tokenProvider,
+		execCredentialWriter: pluginWriter,
+		disableTokenCache:    true,
+		stages:               insertTokenStage(defaultTokenStages(), stageValidate, probeStage()),
+	}
+
+	// the provider is not run when the endpoint is unreachable
+	start := time.Now()
+	err := plugin.Do()
+	if !ErrorContains(err, "connectivity precheck of nmi login failed: TCP connection") {
+		t.Fatalf("expected the precheck to fail, got %v", err)
+	}
+	if code := GetExitCode(err); code != ExitCodeNetworkError {
+		t.Fatalf("expected exit code %d, got %d", ExitCodeNetworkError, code)
+	}
+	if elapsed := time.Since(start); elapsed > probeTimeout {
+		t.Fatalf("expected the precheck to fail within %s, took %s", probeTimeout, elapsed)
+	}
+
+	// the endpoint is not probed when the cached token is returned
+	plugin.disableTokenCache = false
+	tokenCache.EXPECT().Read(cacheFile).Return(adal.Token{
+		AccessToken: "accessToken",
+		Resource:    "serverID",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}, nil)
+	pluginWriter.EXPECT().Write(gomock.Any(), gomock.Any()).Return(nil)
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("expected the cached token to be returned, got %s", err)
+	}
+}
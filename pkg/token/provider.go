@@ -15,25 +15,63 @@ type TokenProvider interface {
 }
 
 func newTokenProvider(o *Options) (TokenProvider, error) {
-	oAuthConfig, err := getOAuthConfig(o.Environment, o.TenantID, o.IsLegacy)
+	oAuthConfig, err := getOAuthConfigForOptions(o)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get oAuthConfig. isLegacy: %t, err: %s", o.IsLegacy, err)
 	}
+	cloud, err := lookupCloudEnvironment(o.Environment)
+	if err != nil {
+		return nil, err
+	}
+	if (o.LoginMethod == MSILogin || o.LoginMethod == NMILogin) && !cloud.imds {
+		return nil, fmt.Errorf("%s login is not supported in %s since managed identities are not available", o.LoginMethod, cloud.name)
+	}
+	settings := o.getHTTPSettings()
+	secrets := o.getSecrets()
 	switch o.LoginMethod {
 	case DeviceCodeLogin:
-		return newDeviceCodeTokenProvider(*oAuthConfig, o.ClientID, o.ServerID, o.TenantID)
+		return newDeviceCodeTokenProvider(*oAuthConfig, o.ClientID, o.ServerID, o.TenantID, o.OpenBrowser, o.TokenType, o.Timeout, o.DeviceCodePollInterval, o.DeviceCodeTimeout, settings.newHTTPClient(), o.log)
 	case InteractiveLogin:
-		return newInteractiveTokenProvider(*oAuthConfig, o.ClientID, o.ServerID, o.TenantID)
+		if o.B2CPolicy != "" {
+			return newB2CInteractiveTokenProvider(*oAuthConfig, o.ClientID, o.ServerID, o.Timeout, settings.newHTTPClient())
+		}
+		return newInteractiveTokenProvider(*oAuthConfig, o.ClientID, o.ServerID, o.TenantID, o.Timeout, newMetadataCacheClient(settings, o.TokenCacheDir, getMetadataCacheTTL(o.MetadataCacheTTL, defaultMetadataCacheTTL), o.TokenCacheReadOnly))
 	case ServicePrincipalLogin:
-		return newServicePrincipalToken(*oAuthConfig, o.ClientID, o.ClientSecret, o.ClientCert, o.ClientCertPassword, o.ServerID, o.TenantID)
+		return newServicePrincipalToken(*oAuthConfig, o.ClientID, secrets.clientSecret, o.ClientCert, secrets.clientCertPassword, o.ServerID, o.TenantID, o.SendCertificateChain, o.MTLSPoP, o.Timeout, settings.newHTTPClient(), settings.newTLSConfig())
 	case ROPCLogin:
-		return newResourceOwnerToken(*oAuthConfig, o.ClientID, o.Username, o.Password, o.ServerID, o.TenantID)
+		return newResourceOwnerToken(*oAuthConfig, o.ClientID, o.Username, secrets.password, o.ServerID, o.TenantID, o.TokenType, o.Timeout, settings.newHTTPClient())
 	case MSILogin:
-		return newManagedIdentityToken(o.ClientID, o.IdentityResourceID, o.ServerID)
+		provider, err := newManagedIdentityToken(o.ClientID, o.IdentityResourceID, o.ServerID, o.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return withMemoryTokenCache(provider, o.log, MSILogin, o.ClientID, o.IdentityResourceID, o.ServerID), nil
 	case AzureCLILogin:
-		return newAzureCLIToken(o.ServerID, o.TenantID)
+		return newAzureCLIToken(o.ServerID, o.TenantID, o.Timeout, o.AzureCLIUseAzidentity, settings.extraCAs, o.log)
+	case CloudShellLogin:
+		return newCloudShellToken(o.ServerID, o.cloudShellEndpoint, o.Timeout, settings.newHTTPClient())
+	case NMILogin:
+		return newNMIToken(o.ClientID, o.ServerID, o.NMIEndpoint, o.podName, o.podNamespace, o.Timeout, settings.newHTTPClient())
 	case WorkloadIdentityLogin:
-		return newWorkloadIdentityToken(o.ClientID, o.FederatedTokenFile, o.AuthorityHost, o.ServerID, o.TenantID)
+		authorityHost := o.AuthorityHost
+		if authorityHost == "" {
+			// the workload identity webhook injects AZURE_AUTHORITY_HOST, fall back to the authority of the environment otherwise
+			authorityHost = oAuthConfig.AuthorityEndpoint.Scheme + "://" + oAuthConfig.AuthorityEndpoint.Host + "/"
+		}
+		provider, err := newWorkloadIdentityToken(o.ClientID, o.FederatedTokenFile, authorityHost, o.ServerID, o.TenantID, o.Timeout, newMetadataCacheClient(settings, o.TokenCacheDir, getMetadataCacheTTL(o.MetadataCacheTTL, 0), o.TokenCacheReadOnly), settings.newHTTPClient())
+		if err != nil {
+			return nil, err
+		}
+		return withMemoryTokenCache(provider, o.log, WorkloadIdentityLogin, o.ClientID, o.TenantID, authorityHost, o.FederatedTokenFile, o.ServerID), nil
+	}
+
+	// login methods which are not built in are run by the login plugin on PATH
+	if path, err := findLoginPlugin(o.LoginMethod); err == nil {
+		authorityHost := o.AuthorityHost
+		if authorityHost == "" {
+			authorityHost = oAuthConfig.AuthorityEndpoint.Scheme + "://" + oAuthConfig.AuthorityEndpoint.Host + "/"
+		}
+		return newLoginPluginToken(path, o, authorityHost), nil
 	}
 
 	return nil, errors.New("unsupported token provider")
@@ -58,8 +96,9 @@ func getOAuthConfig(envName, tenantID string, isLegacy bool) (*adal.OAuthConfig,
 }
 
 func getAzureEnvironment(environment string) (azure.Environment, error) {
-	if environment == "" {
-		environment = defaultEnvironmentName
+	cloud, err := lookupCloudEnvironment(environment)
+	if err != nil {
+		return azure.Environment{}, err
 	}
-	return azure.EnvironmentFromName(environment)
+	return cloud.azureEnvironment()
 }
@@ -0,0 +1,120 @@
+package token
+
+import (
+	"crypto/sha256"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redactedValue = "<" + redacted + ">"
+
+var (
+	// JWTs start with the base64url encoded '{"' of the JOSE header
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// credentials sent in form encoded token requests, e.g. in error messages quoting the request
+	formCredentialPattern = regexp.MustCompile(`(?i)\b(client_secret|client_assertion|assertion|refresh_token|access_token|id_token|device_code|password)=[^&\s"']+`)
+	// credentials in JSON token requests and responses, e.g. in error messages quoting the response body
+	jsonCredentialPattern = regexp.MustCompile(`(?i)"(client_secret|client_assertion|assertion|refresh_token|access_token|id_token|device_code|password)"\s*:\s*"[^"]*"`)
+
+	secretsMu sync.RWMutex
+	// secrets holds the digests of the client secrets and passwords of the options, which do not have a recognizable format.
+	// The digests are kept instead of the secrets, which would otherwise stay in memory for the lifetime of the process.
+	secrets []secretDigest
+)
+
+// minSecretLength avoids redacting common words when a short secret is registered
+const minSecretLength = 4
+
+// secretDigest is the SHA-256 digest of a secret of the length
+type secretDigest struct {
+	length int
+	sum    [sha256.Size]byte
+}
+
+// registerSecrets makes redact scrub the values wherever they appear
+func registerSecrets(values ...[]byte) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, v := range values {
+		if len(v) < minSecretLength {
+			continue
+		}
+		d := secretDigest{length: len(v), sum: sha256.Sum256(v)}
+		if !containsSecretDigest(secrets, d) {
+			secrets = append(secrets, d)
+		}
+	}
+}
+
+func containsSecretDigest(digests []secretDigest, d secretDigest) bool {
+	for _, digest := range digests {
+		if digest == d {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecret replaces the substrings of s whose digest is the one of the secret
+func redactSecret(s string, secret secretDigest) string {
+	var b strings.Builder
+	last := 0
+	window := make([]byte, secret.length)
+	defer zeroBytes(window)
+	for i := 0; i+secret.length <= len(s); {
+		copy(window, s[i:])
+		if sha256.Sum256(window) != secret.sum {
+			i++
+			continue
+		}
+		b.WriteString(s[last:i])
+		b.WriteString(redactedValue)
+		i += secret.length
+		last = i
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// redact scrubs JWTs, credentials of token requests and responses, and registered secrets from s
+func redact(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redactedValue)
+	s = formCredentialPattern.ReplaceAllString(s, "${1}="+redactedValue)
+	s = jsonCredentialPattern.ReplaceAllString(s, `"${1}":"`+redactedValue+`"`)
+
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = redactSecret(s, secret)
+	}
+	return s
+}
+
+// redactedError reports the redacted message of err while keeping err in the chain,
+// so that errors.As still finds the ExitCodeError or net.Error deciding the exit code
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps err so that its message does not leak tokens or secrets
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*redactedError); ok {
+		return err
+	}
+	return &redactedError{err: err}
+}
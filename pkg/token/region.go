@@ -0,0 +1,157 @@
+package token
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// azureRegionAutoDetect is the region MSAL detects from IMDS, which is not supported
+const azureRegionAutoDetect = "TryAutoDetect"
+
+var azureRegionPattern = regexp.MustCompile("^[a-z0-9]+$")
+
+// authorityHosts are the hosts a token request is sent to, in the order of preference
+type authorityHosts struct {
+	global   string
+	regional string
+
+	mu sync.Mutex
+	// preferGlobal is set when the regional token endpoint is degraded, and unset when the global one is
+	preferGlobal bool
+}
+
+// order returns the host to send the token request to, and the one to fail over to
+func (h *authorityHosts) order() (string, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.preferGlobal {
+		return h.global, h.regional
+	}
+	return h.regional, h.global
+}
+
+// degraded makes the other host preferred for the following token requests
+func (h *authorityHosts) degraded(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.preferGlobal = host == h.regional
+}
+
+// supportsAzureRegion is true for the login methods of confidential clients, the only ones served by the regional token endpoints
+func supportsAzureRegion(loginMethod string) bool {
+	return loginMethod == ServicePrincipalLogin || loginMethod == WorkloadIdentityLogin
+}
+
+// getAuthorityHosts returns the hosts of the global and regional token endpoints of the options.
+// It returns nil when no region is set, or when the login method does not support regional token endpoints.
+func getAuthorityHosts(o *Options) (*authorityHosts, error) {
+	if o.AzureRegion == "" {
+		return nil, nil
+	}
+	if strings.EqualFold(o.AzureRegion, azureRegionAutoDetect) {
+		o.log.logf(5, "ignoring %s region, specify the name of the region to use regional token endpoints", azureRegionAutoDetect)
+		return nil, nil
+	}
+	if !supportsAzureRegion(o.LoginMethod) {
+		o.log.logf(5, "ignoring --azure-region in %s login, regional token endpoints only serve %s and %s login", o.LoginMethod, ServicePrincipalLogin, WorkloadIdentityLogin)
+		return nil, nil
+	}
+	cloud, err := lookupCloudEnvironment(o.Environment)
+	if err != nil {
+		return nil, err
+	}
+	if cloud.regionalAuthorityHost == "" {
+		return nil, fmt.Errorf("regional token endpoints are not available in %s", cloud.name)
+	}
+
+	var global string
+	if o.LoginMethod == WorkloadIdentityLogin && o.AuthorityHost != "" {
+		u, err := url.Parse(o.AuthorityHost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse authority host: %s", err)
+		}
+		global = u.Host
+	} else {
+		oAuthConfig, err := getOAuthConfig(o.Environment, o.TenantID, o.IsLegacy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get oAuthConfig. isLegacy: %t, err: %s", o.IsLegacy, err)
+		}
+		global = oAuthConfig.TokenEndpoint.Host
+	}
+	return &authorityHosts{
+		global:   global,
+		regional: strings.ToLower(o.AzureRegion) + "." + cloud.regionalAuthorityHost,
+	}, nil
+}
+
+// wrap returns base sending token requests to the regional token endpoint when --azure-region is set, i.e. h is not nil
+func (h *authorityHosts) wrap(log *logSink, base http.RoundTripper) http.RoundTripper {
+	if h == nil {
+		return base
+	}
+	return &regionalAuthorityTransport{base: base, hosts: h, log: log}
+}
+
+// regionalAuthorityTransport sends token requests to the preferred of the regional and the global token endpoints,
+// and sends them again to the other one when the preferred one is degraded
+type regionalAuthorityTransport struct {
+	base  http.RoundTripper
+	hosts *authorityHosts
+	log   *logSink
+}
+
+func (t *regionalAuthorityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.isTokenRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+	preferred, fallback := t.hosts.order()
+	resp, err := t.send(req, preferred)
+	if !isAuthorityDegraded(req, resp, err) || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	if err == nil {
+		// the response of the degraded endpoint is replaced by the one of the other endpoint
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		err = fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	t.log.logf(5, "token endpoint %s is degraded, failing over to %s: %s", preferred, fallback, err)
+	t.hosts.degraded(preferred)
+	return t.send(req, fallback)
+}
+
+// isTokenRequest is true for the requests to the token endpoint of the authority, in v1 and v2
+func (t *regionalAuthorityTransport) isTokenRequest(req *http.Request) bool {
+	if req.Method != http.MethodPost || (req.URL.Host != t.hosts.global && req.URL.Host != t.hosts.regional) {
+		return false
+	}
+	return strings.HasSuffix(req.URL.Path, "/oauth2/token") || strings.HasSuffix(req.URL.Path, "/oauth2/v2.0/token")
+}
+
+func (t *regionalAuthorityTransport) send(req *http.Request, host string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Host = host
+	r.Host = host
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return t.base.RoundTrip(r)
+}
+
+// isAuthorityDegraded is true when the token endpoint is unreachable, failing, or throttling,
+// while errors of the request, such as invalid credentials, are returned as is
+func isAuthorityDegraded(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
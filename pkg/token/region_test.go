@@ -0,0 +1,212 @@
+package token
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetAuthorityHosts(t *testing.T) {
+	testCases := []struct {
+		name             string
+		options          Options
+		expectedGlobal   string
+		expectedRegional string
+		expectedErr      string
+	}{
+		{
+			name:    "no region",
+			options: Options{LoginMethod: ServicePrincipalLogin},
+		},
+		{
+			name:             "spn login",
+			options:          Options{LoginMethod: ServicePrincipalLogin, TenantID: "tenantID", AzureRegion: "WestUS2"},
+			expectedGlobal:   "login.microsoftonline.com",
+			expectedRegional: "westus2.login.microsoft.com",
+		},
+		{
+			name:             "spn login in AzureChinaCloud",
+			options:          Options{LoginMethod: ServicePrincipalLogin, TenantID: "tenantID", Environment: "china", AzureRegion: "chinaeast2"},
+			expectedGlobal:   "login.chinacloudapi.cn",
+			expectedRegional: "chinaeast2.login.chinacloudapi.cn",
+		},
+		{
+			name: "workloadidentity login with authority host",
+			options: Options{
+				LoginMethod:   WorkloadIdentityLogin,
+				TenantID:      "tenantID",
+				AuthorityHost: "https://login.microsoftonline.com/",
+				AzureRegion:   "eastus",
+			},
+			expectedGlobal:   "login.microsoftonline.com",
+			expectedRegional: "eastus.login.microsoft.com",
+		},
+		{
+			name:    "region detected by MSAL",
+			options: Options{LoginMethod: ServicePrincipalLogin, TenantID: "tenantID", AzureRegion: "TryAutoDetect"},
+		},
+		{
+			name:    "public client login",
+			options: Options{LoginMethod: DeviceCodeLogin, TenantID: "tenantID", AzureRegion: "eastus"},
+		},
+		{
+			name:        "environment without regional token endpoints",
+			options:     Options{LoginMethod: ServicePrincipalLogin, TenantID: "tenantID", Environment: "german", AzureRegion: "germanycentral"},
+			expectedErr: "regional token endpoints are not available in AzureGermanCloud",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts, err := getAuthorityHosts(&tc.options)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if tc.expectedRegional == "" {
+				if hosts != nil {
+					t.Fatalf("expected no regional authority, got %+v", hosts)
+				}
+				return
+			}
+			if hosts.global != tc.expectedGlobal || hosts.regional != tc.expectedRegional {
+				t.Fatalf("expected %s and %s, got %s and %s", tc.expectedRegional, tc.expectedGlobal, hosts.regional, hosts.global)
+			}
+		})
+	}
+}
+
+// fakeAuthorities responds to the requests with the status code of their host, and records the hosts and bodies
+type fakeAuthorities struct {
+	status   map[string]int
+	requests []string
+}
+
+func (f *fakeAuthorities) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	f.requests = append(f.requests, req.URL.Host+" "+string(body))
+	status, ok := f.status[req.URL.Host]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestRegionalAuthorityTransport(t *testing.T) {
+	const (
+		global   = "login.microsoftonline.com"
+		regional = "westus2.login.microsoft.com"
+		form     = "grant_type=client_credentials"
+	)
+	tokenRequest := func(t *testing.T, host, path string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "https://"+host+"/tenantID"+path, strings.NewReader(form))
+		if err != nil {
+			t.Fatalf("failed to create request: %s", err)
+		}
+		return req
+	}
+
+	testCases := []struct {
+		name             string
+		status           map[string]int
+		requests         []*http.Request
+		expectedStatus   int
+		expectedRequests []string
+	}{
+		{
+			name:             "regional token endpoint",
+			status:           map[string]int{regional: http.StatusOK, global: http.StatusOK},
+			requests:         []*http.Request{tokenRequest(t, global, "/oauth2/token")},
+			expectedStatus:   http.StatusOK,
+			expectedRequests: []string{regional + " " + form},
+		},
+		{
+			name:             "regional token endpoint unreachable",
+			status:           map[string]int{global: http.StatusOK},
+			requests:         []*http.Request{tokenRequest(t, global, "/oauth2/v2.0/token")},
+			expectedStatus:   http.StatusOK,
+			expectedRequests: []string{regional + " " + form, global + " " + form},
+		},
+		{
+			name:   "regional token endpoint degraded, then the global one",
+			status: map[string]int{regional: http.StatusServiceUnavailable, global: http.StatusOK},
+			requests: []*http.Request{
+				tokenRequest(t, global, "/oauth2/token"),
+				tokenRequest(t, global, "/oauth2/token"),
+			},
+			expectedStatus: http.StatusOK,
+			// the global authority is preferred after the regional one is degraded
+			expectedRequests: []string{regional + " " + form, global + " " + form, global + " " + form},
+		},
+		{
+			name:             "invalid credentials",
+			status:           map[string]int{regional: http.StatusUnauthorized, global: http.StatusOK},
+			requests:         []*http.Request{tokenRequest(t, global, "/oauth2/token")},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedRequests: []string{regional + " " + form},
+		},
+		{
+			name:             "not a token request",
+			status:           map[string]int{regional: http.StatusOK, global: http.StatusOK},
+			requests:         []*http.Request{tokenRequest(t, global, "/oauth2/devicecode")},
+			expectedStatus:   http.StatusOK,
+			expectedRequests: []string{global + " " + form},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := &fakeAuthorities{status: tc.status}
+			transport := &regionalAuthorityTransport{base: base, hosts: &authorityHosts{global: global, regional: regional}}
+			var resp *http.Response
+			for _, req := range tc.requests {
+				var err error
+				resp, err = transport.RoundTrip(req)
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+			}
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("expected status code %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if strings.Join(base.requests, "\n") != strings.Join(tc.expectedRequests, "\n") {
+				t.Fatalf("expected requests %q, got %q", tc.expectedRequests, base.requests)
+			}
+		})
+	}
+}
+
+func TestRegionalAuthorityTransportFailsOverToRegional(t *testing.T) {
+	const (
+		global   = "login.microsoftonline.com"
+		regional = "westus2.login.microsoft.com"
+	)
+	base := &fakeAuthorities{status: map[string]int{regional: http.StatusOK, global: http.StatusInternalServerError}}
+	hosts := &authorityHosts{global: global, regional: regional, preferGlobal: true}
+	transport := &regionalAuthorityTransport{base: base, hosts: hosts}
+
+	req, err := http.NewRequest(http.MethodPost, "https://"+global+"/tenantID/oauth2/token", strings.NewReader("form"))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(base.requests) != 2 || !strings.HasPrefix(base.requests[1], regional) {
+		t.Fatalf("expected failing over to the regional token endpoint, got %d after %q", resp.StatusCode, base.requests)
+	}
+	if hosts.preferGlobal {
+		t.Fatalf("expected the regional token endpoint to be preferred again")
+	}
+}
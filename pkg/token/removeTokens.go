@@ -0,0 +1,57 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// GetTokenCacheDirs returns the token cache directories remove-tokens removes: dir, and with all,
+// the directories get-token may cache tokens in as well, i.e. the ones set in AAD_TOKEN_CACHE_DIR and AZURE_TOKEN_CACHE_DIR
+// and the default one. The token files, cache metadata, lock files, and authority metadata of all login methods,
+// including the tokens of azurecli login with --cache-azurecli-token, are in these directories.
+func GetTokenCacheDirs(dir string, all bool) []string {
+	candidates := []string{dir}
+	if all {
+		candidates = append(candidates, os.Getenv(kubeloginTokenCacheDir), os.Getenv(azureTokenCacheDir), DefaultTokenCacheDir)
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, d := range candidates {
+		if d == "" || seen[filepath.Clean(d)] {
+			continue
+		}
+		seen[filepath.Clean(d)] = true
+		dirs = append(dirs, d)
+	}
+	return dirs
+}
+
+// RemoveTokenCaches removes the token cache directories. With dryRun, the files which would be removed
+// are written to w instead. Directories which do not exist are skipped.
+func RemoveTokenCaches(dirs []string, dryRun bool, w io.Writer) error {
+	for _, dir := range dirs {
+		if !dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				logf(5, "unable to delete tokens cache in '%s': %s", dir, err)
+			}
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				fmt.Fprintf(w, "would remove %s\n", path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("unable to list tokens cache in '%s': %w", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package token
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetTokenCacheDirs(t *testing.T) {
+	t.Setenv(kubeloginTokenCacheDir, "/tmp/aad")
+	t.Setenv(azureTokenCacheDir, "/tmp/aad/")
+
+	if got := GetTokenCacheDirs("/tmp/flag", false); !reflect.DeepEqual(got, []string{"/tmp/flag"}) {
+		t.Fatalf("expected only the directory of the flag, got %v", got)
+	}
+	expected := []string{"/tmp/flag", "/tmp/aad", DefaultTokenCacheDir}
+	if got := GetTokenCacheDirs("/tmp/flag", true); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected directories %v, got %v", expected, got)
+	}
+}
+
+func TestRemoveTokenCaches(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "AzurePublicCloud-serverID-clientID-tenantID.json")
+	metadataFile := filepath.Join(dir, metadataCacheDirName, "metadata.json")
+	for _, file := range []string{tokenFile, metadataFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatalf("unable to create directory: %s", err)
+		}
+		if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+			t.Fatalf("unable to write file: %s", err)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	t.Run("dry run should list the files", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := RemoveTokenCaches([]string{dir, missing}, true, &out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expected := "would remove " + tokenFile + "\nwould remove " + metadataFile + "\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+		if _, err := os.Stat(tokenFile); err != nil {
+			t.Fatalf("expected the token file to be kept, got %s", err)
+		}
+	})
+
+	t.Run("token caches should be removed", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := RemoveTokenCaches([]string{dir, missing}, false, &out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Fatalf("expected the token cache directory to be removed, got %v", err)
+		}
+		if out.Len() != 0 {
+			t.Fatalf("expected no output, got %q", out.String())
+		}
+	})
+}
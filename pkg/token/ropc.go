@@ -3,6 +3,8 @@ package token
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 )
@@ -10,20 +12,23 @@ import (
 type resourceOwnerToken struct {
 	clientID    string
 	username    string
-	password    string
+	password    []byte
 	resourceID  string
 	tenantID    string
+	tokenType   string
+	timeout     time.Duration
 	oAuthConfig adal.OAuthConfig
+	httpClient  *http.Client
 }
 
-func newResourceOwnerToken(oAuthConfig adal.OAuthConfig, clientID, username, password, resourceID, tenantID string) (TokenProvider, error) {
+func newResourceOwnerToken(oAuthConfig adal.OAuthConfig, clientID, username string, password []byte, resourceID, tenantID, tokenType string, timeout time.Duration, httpClient *http.Client) (TokenProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("clientID cannot be empty")
 	}
 	if username == "" {
 		return nil, errors.New("username cannot be empty")
 	}
-	if password == "" {
+	if len(password) == 0 {
 		return nil, errors.New("password cannot be empty")
 	}
 	if resourceID == "" {
@@ -39,7 +44,10 @@ func newResourceOwnerToken(oAuthConfig adal.OAuthConfig, clientID, username, pas
 		password:    password,
 		resourceID:  resourceID,
 		tenantID:    tenantID,
+		tokenType:   tokenType,
+		timeout:     timeout,
 		oAuthConfig: oAuthConfig,
+		httpClient:  httpClient,
 	}, nil
 }
 
@@ -48,20 +56,32 @@ func (p *resourceOwnerToken) Token() (adal.Token, error) {
 	callback := func(t adal.Token) error {
 		return nil
 	}
+	// adal takes the password as a string, which is only referenced by spt during this call
 	spt, err := adal.NewServicePrincipalTokenFromUsernamePassword(
 		p.oAuthConfig,
 		p.clientID,
 		p.username,
-		p.password,
+		string(p.password),
 		p.resourceID,
 		callback)
 	if err != nil {
 		return emptyToken, fmt.Errorf("failed to create service principal token from username password: %s", err)
 	}
 
-	err = spt.Refresh()
+	spt.SetSender(p.httpClient)
+	idTokenSender := newIDTokenSender(p.httpClient)
+	if p.tokenType == TokenTypeID {
+		spt.SetSender(idTokenSender)
+	}
+
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	err = spt.RefreshWithContext(ctx)
 	if err != nil {
 		return emptyToken, err
 	}
+	if p.tokenType == TokenTypeID {
+		return withIDToken(spt.Token(), idTokenSender.idToken)
+	}
 	return spt.Token(), nil
 }
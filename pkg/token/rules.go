@@ -0,0 +1,138 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// loginRules is the format of --rules-file, e.g.
+//
+//	rules:
+//	  - server: "*.prod.contoso.com"
+//	    options:
+//	      login: spn
+//	  - server: "*.dev.*"
+//	    options:
+//	      login: devicecode
+type loginRules struct {
+	Rules []loginRule `json:"rules"`
+}
+
+// loginRule applies the options, keyed by get-token flag names without dashes, to the API servers matching the server pattern
+type loginRule struct {
+	// Server is a path.Match pattern of the host of the API server, or of its URL when the pattern has a scheme
+	Server  string            `json:"server"`
+	Options map[string]string `json:"options"`
+}
+
+// execInfoCluster is the part of KUBERNETES_EXEC_INFO passed by kubectl with provideClusterInfo which is matched by the rules
+type execInfoCluster struct {
+	Spec struct {
+		Cluster *struct {
+			Server string `json:"server"`
+		} `json:"cluster"`
+	} `json:"spec"`
+}
+
+// applyLoginRules sets the options of the first rule of --rules-file matching the API server in KUBERNETES_EXEC_INFO
+// with the precedence: flags explicitly set in fs > options of the rule > environment variables.
+// It must run before resolveFromEnv, since the applied options are marked as set in fs.
+func applyLoginRules(o *Options, fs *pflag.FlagSet) error {
+	if f := fs.Lookup("rules-file"); f != nil && !f.Changed {
+		for _, name := range []string{kubeloginRulesFile, azureRulesFile} {
+			if v, ok := os.LookupEnv(name); ok {
+				o.RulesFile = v
+			}
+		}
+	}
+	if o.RulesFile == "" {
+		return nil
+	}
+	server, err := getServerFromExecInfoEnv()
+	if err != nil {
+		return err
+	}
+	if server == "" {
+		logf(5, "ignoring --rules-file, the API server is not passed by kubectl. Set provideClusterInfo: true in the exec stanza of kubeconfig")
+		return nil
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return fmt.Errorf("failed to parse API server URL: %w", err)
+	}
+	rules, err := readLoginRules(o.RulesFile)
+	if err != nil {
+		return err
+	}
+	for i, rule := range rules.Rules {
+		ok, err := rule.matches(u)
+		if err != nil {
+			return fmt.Errorf("invalid server pattern %q of rule %d in rules file: %w", rule.Server, i+1, err)
+		}
+		if !ok {
+			continue
+		}
+		logf(5, "applying rule %d of rules file %s to %s", i+1, o.RulesFile, server)
+		for name, value := range rule.Options {
+			f := fs.Lookup(name)
+			if f == nil || name == "rules-file" {
+				return fmt.Errorf("unknown option %s of rule %d in rules file", name, i+1)
+			}
+			if f.Changed {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value of option %s of rule %d in rules file: %w", name, i+1, err)
+			}
+		}
+		return nil
+	}
+	logf(5, "no rule of rules file %s matches %s", o.RulesFile, server)
+	return nil
+}
+
+func readLoginRules(file string) (*loginRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	var rules loginRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", file, err)
+	}
+	return &rules, nil
+}
+
+// matches is true when the pattern of the rule matches the host, without port, of the API server,
+// or its URL when the pattern has a scheme
+func (r loginRule) matches(server *url.URL) (bool, error) {
+	if strings.Contains(r.Server, "://") {
+		return path.Match(r.Server, server.String())
+	}
+	return path.Match(r.Server, server.Hostname())
+}
+
+// getServerFromExecInfoEnv returns the URL of the API server in KUBERNETES_EXEC_INFO,
+// which is empty unless provideClusterInfo is set in the exec stanza of kubeconfig
+func getServerFromExecInfoEnv() (string, error) {
+	env := os.Getenv(execInfoEnv)
+	if env == "" {
+		return "", nil
+	}
+	var execInfo execInfoCluster
+	if err := json.Unmarshal([]byte(env), &execInfo); err != nil {
+		return "", fmt.Errorf("cannot unmarshal %q to ExecCredential: %w", env, err)
+	}
+	if execInfo.Spec.Cluster == nil {
+		return "", nil
+	}
+	return execInfo.Spec.Cluster.Server, nil
+}
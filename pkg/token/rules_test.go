@@ -0,0 +1,158 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const testRules = `rules:
+  - server: "*.prod.contoso.com"
+    options:
+      login: spn
+      environment: AzureChinaCloud
+  - server: "*.dev.*"
+    options:
+      login: devicecode
+      timeout: 1m
+  - server: "https://10.0.0.*:6443"
+    options:
+      login: azurecli
+`
+
+func TestApplyLoginRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		server   string
+		args     []string
+		env      map[string]string
+		expected func(o Options) bool
+	}{
+		{
+			name:   "options of the rule matching the host should be applied",
+			server: "https://aks.eastus.prod.contoso.com:443",
+			expected: func(o Options) bool {
+				return o.LoginMethod == ServicePrincipalLogin && o.Environment == "AzureChinaCloud"
+			},
+		},
+		{
+			name:     "first matching rule should be applied",
+			server:   "https://aks.dev.contoso.com",
+			expected: func(o Options) bool { return o.LoginMethod == DeviceCodeLogin && o.Timeout.String() == "1m0s" },
+		},
+		{
+			name:     "pattern with scheme should match the URL",
+			server:   "https://10.0.0.4:6443",
+			expected: func(o Options) bool { return o.LoginMethod == AzureCLILogin },
+		},
+		{
+			name:     "no rule matching should keep the options",
+			server:   "https://aks.staging.contoso.com",
+			env:      map[string]string{loginMethod: MSILogin},
+			expected: func(o Options) bool { return o.LoginMethod == MSILogin },
+		},
+		{
+			name:     "flag should take precedence over the rule",
+			server:   "https://aks.prod.contoso.com",
+			args:     []string{"--login", ROPCLogin},
+			expected: func(o Options) bool { return o.LoginMethod == ROPCLogin && o.Environment == "AzureChinaCloud" },
+		},
+		{
+			name:     "rule should take precedence over env var",
+			server:   "https://aks.prod.contoso.com",
+			env:      map[string]string{loginMethod: MSILogin, kubeloginClientID: "envClientID"},
+			expected: func(o Options) bool { return o.LoginMethod == ServicePrincipalLogin && o.ClientID == "envClientID" },
+		},
+		{
+			name: "rules should be ignored without cluster info",
+			expected: func(o Options) bool {
+				return o.LoginMethod == DeviceCodeLogin && o.Environment == defaultEnvironmentName
+			},
+		},
+	}
+
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesFile, []byte(testRules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.server != "" {
+				t.Setenv(execInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"cluster":{"server":"`+tc.server+`","config":{"foo":"bar"}},"interactive":false}}`)
+			} else {
+				t.Setenv(execInfoEnv, "")
+			}
+			t.Setenv(kubeloginRulesFile, rulesFile)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			o := NewOptions()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			o.AddFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			o.UpdateFromEnvWithFlags(fs)
+			if o.rulesErr != nil {
+				t.Fatalf("unexpected error: %s", o.rulesErr)
+			}
+			if !tc.expected(o) {
+				t.Fatalf("unexpected options: %s, timeout: %s", o.String(), o.Timeout)
+			}
+		})
+	}
+}
+
+func TestApplyLoginRulesErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{
+			name:  "unknown option",
+			rules: "rules:\n- server: '*'\n  options:\n    foo: bar\n",
+			err:   "unknown option foo of rule 1 in rules file",
+		},
+		{
+			name:  "rules file option",
+			rules: "rules:\n- server: '*'\n  options:\n    rules-file: other.yaml\n",
+			err:   "unknown option rules-file of rule 1 in rules file",
+		},
+		{
+			name:  "invalid value",
+			rules: "rules:\n- server: '*'\n  options:\n    timeout: soon\n",
+			err:   "invalid value of option timeout of rule 1 in rules file",
+		},
+		{
+			name:  "invalid pattern",
+			rules: "rules:\n- server: '['\n",
+			err:   `invalid server pattern "[" of rule 1 in rules file`,
+		},
+		{
+			name:  "invalid file",
+			rules: "rules: foo",
+			err:   "failed to parse rules file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(rulesFile, []byte(tc.rules), 0600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv(execInfoEnv, `{"spec":{"cluster":{"server":"https://aks.contoso.com"}}}`)
+
+			o := NewOptions()
+			o.RulesFile = rulesFile
+			o.UpdateFromEnv()
+			if !ErrorContains(o.Validate(), tc.err) {
+				t.Fatalf("expected error containing %q, actual: %v", tc.err, o.Validate())
+			}
+		})
+	}
+}
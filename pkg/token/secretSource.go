@@ -0,0 +1,328 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// schemes of secret sources, e.g. --client-secret file:/path/to/secret
+const (
+	secretSchemeValue    = "value"
+	secretSchemeFile     = "file"
+	secretSchemeEnv      = "env"
+	secretSchemeCommand  = "cmd"
+	secretSchemeKeyring  = "keyring"
+	secretSchemeKeyVault = "keyvault"
+
+	keyVaultAPIVersion    = "7.4"
+	secretCommandTimeout  = 30 * time.Second
+	secretKeyVaultTimeout = 30 * time.Second
+)
+
+var secretSchemes = []string{secretSchemeValue, secretSchemeFile, secretSchemeEnv, secretSchemeCommand, secretSchemeKeyring, secretSchemeKeyVault}
+
+// SecretSource provides the value of a secret-bearing option, e.g. the client secret.
+// The secret is returned as bytes, which the caller zeroes once the secret is no longer needed.
+type SecretSource interface {
+	Secret(ctx context.Context) ([]byte, error)
+}
+
+// ParseSecretSource returns the source of the secret specified as <scheme>:<reference>:
+//   - value:<secret> is the secret itself
+//   - file:<path> reads the secret from the file
+//   - env:<name> reads the secret from the environment variable
+//   - cmd:<command> [args...] uses the standard output of the command, which is not run in a shell
+//   - keyring:<service>/<account> reads the secret from the keychain on macOS or the Secret Service on Linux
+//   - keyvault:https://<vault>.vault.azure.net/secrets/<name>[/<version>] reads the secret from Azure Key Vault
+//     with the credential of the environment, managed identity, or Azure CLI
+//
+// Without one of the schemes, spec is the secret itself, so that existing secrets keep working.
+func ParseSecretSource(spec string) (SecretSource, error) {
+	return parseSecretSource(spec, secretSchemeValue, defaultHTTPSettings.newHTTPClient())
+}
+
+// parseSecretSource returns the source of spec, using defaultScheme when spec does not start with a scheme.
+// The requests to Key Vault are sent with httpClient.
+func parseSecretSource(spec, defaultScheme string, httpClient *http.Client) (SecretSource, error) {
+	scheme, ref := defaultScheme, spec
+	if i := strings.Index(spec, ":"); i > 0 && isSecretScheme(spec[:i]) {
+		scheme, ref = spec[:i], spec[i+1:]
+	}
+
+	switch scheme {
+	case secretSchemeValue:
+		return valueSecretSource(ref), nil
+	case secretSchemeFile:
+		return fileSecretSource(ref), nil
+	case secretSchemeEnv:
+		return envSecretSource(ref), nil
+	case secretSchemeCommand:
+		args := strings.Fields(ref)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s secret source requires a command", secretSchemeCommand)
+		}
+		return commandSecretSource(args), nil
+	case secretSchemeKeyring:
+		i := strings.LastIndex(ref, "/")
+		if i <= 0 || i == len(ref)-1 {
+			return nil, fmt.Errorf("%s secret source requires <service>/<account>, got %q", secretSchemeKeyring, ref)
+		}
+		return keyringSecretSource{service: ref[:i], account: ref[i+1:]}, nil
+	case secretSchemeKeyVault:
+		return newKeyVaultSecretSource(ref, httpClient)
+	}
+	return nil, fmt.Errorf("'%s' is not a supported secret source. Supported source is one of %s", scheme, strings.Join(secretSchemes, ", "))
+}
+
+func isSecretScheme(s string) bool {
+	for _, scheme := range secretSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret returns the secret from the source specified by spec, or nil when spec is empty
+func resolveSecret(name, spec string, httpClient *http.Client) ([]byte, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	source, err := parseSecretSource(spec, secretSchemeValue, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	secret, err := source.Secret(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// resolvedSecrets are the secrets of ClientSecret, ClientCertPassword, and Password read from their sources.
+// They are kept as bytes instead of strings of the options, so that they can be zeroed.
+type resolvedSecrets struct {
+	clientSecret       []byte
+	clientCertPassword []byte
+	password           []byte
+}
+
+// resolveSecrets reads the secrets of the secret-bearing options from their sources for the token providers.
+// The federated token is read by workload identity login on every token request since it is rotated.
+func (o *Options) resolveSecrets() error {
+	httpClient := o.getHTTPSettings().newHTTPClient()
+	secrets := &resolvedSecrets{}
+	for _, s := range []struct {
+		name   string
+		spec   string
+		secret *[]byte
+	}{
+		{name: "client secret", spec: o.ClientSecret, secret: &secrets.clientSecret},
+		{name: "client certificate password", spec: o.ClientCertPassword, secret: &secrets.clientCertPassword},
+		{name: "password", spec: o.Password, secret: &secrets.password},
+	} {
+		secret, err := resolveSecret(s.name, s.spec, httpClient)
+		if err != nil {
+			secrets.zero()
+			return err
+		}
+		*s.secret = secret
+	}
+	o.secrets = secrets
+	return nil
+}
+
+// getSecrets returns the secrets resolved by New, or none before
+func (o *Options) getSecrets() *resolvedSecrets {
+	if o.secrets == nil {
+		return &resolvedSecrets{}
+	}
+	return o.secrets
+}
+
+// zero overwrites the secrets once they are no longer needed, e.g. when the plugin cannot be created
+func (s *resolvedSecrets) zero() {
+	if s == nil {
+		return
+	}
+	zeroBytes(s.clientSecret)
+	zeroBytes(s.clientCertPassword)
+	zeroBytes(s.password)
+}
+
+type valueSecretSource string
+
+func (s valueSecretSource) Secret(context.Context) ([]byte, error) {
+	return []byte(s), nil
+}
+
+type fileSecretSource string
+
+func (s fileSecretSource) Secret(context.Context) ([]byte, error) {
+	data, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	// editors and echo add a trailing newline
+	return bytes.TrimSpace(data), nil
+}
+
+type envSecretSource string
+
+func (s envSecretSource) Secret(context.Context) ([]byte, error) {
+	secret, ok := os.LookupEnv(string(s))
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", string(s))
+	}
+	return []byte(secret), nil
+}
+
+type commandSecretSource []string
+
+func (s commandSecretSource) Secret(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretCommandTimeout)
+	defer cancel()
+	output, err := runCommand(ctx, s[0], s[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(output), nil
+}
+
+type keyringSecretSource struct {
+	service string
+	account string
+}
+
+func (s keyringSecretSource) Secret(ctx context.Context) ([]byte, error) {
+	name, args, err := keyringCommand(s.service, s.account)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, secretCommandTimeout)
+	defer cancel()
+	output, err := runCommand(ctx, name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s from keyring: %w", s.service, s.account, err)
+	}
+	return bytes.TrimSpace(output), nil
+}
+
+type keyVaultSecretSource struct {
+	secretURL  string
+	scope      string
+	credential azcore.TokenCredential
+	client     *http.Client
+}
+
+// newKeyVaultSecretSource returns the source of the secret in secretURL, e.g. https://myvault.vault.azure.net/secrets/mysecret
+func newKeyVaultSecretSource(secretURL string, httpClient *http.Client) (*keyVaultSecretSource, error) {
+	u, err := url.Parse(secretURL)
+	if err != nil || u.Scheme != "https" || !strings.HasPrefix(strings.Trim(u.Path, "/"), "secrets/") {
+		return nil, fmt.Errorf("%s secret source requires https://<vault>/secrets/<name>, got %q", secretSchemeKeyVault, secretURL)
+	}
+	// the vault name is the first label of the host, e.g. vault.azure.net or vault.azure.cn is the resource
+	i := strings.Index(u.Hostname(), ".")
+	if i < 0 {
+		return nil, fmt.Errorf("%s secret source requires the host of the vault, got %q", secretSchemeKeyVault, u.Hostname())
+	}
+	return &keyVaultSecretSource{
+		secretURL: secretURL,
+		scope:     "https://" + u.Hostname()[i+1:] + "/.default",
+		client:    httpClient,
+	}, nil
+}
+
+func (s *keyVaultSecretSource) Secret(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretKeyVaultTimeout)
+	defer cancel()
+
+	credential := s.credential
+	if credential == nil {
+		cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: azcore.ClientOptions{Transport: s.client},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credential for Key Vault: %w", err)
+		}
+		credential = cred
+	}
+	accessToken, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{s.scope}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token for Key Vault: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.secretURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Key Vault request: %w", err)
+	}
+	q := req.URL.Query()
+	q.Set("api-version", keyVaultAPIVersion)
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Authorization", "Bearer "+accessToken.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send Key Vault request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Key Vault response: %w", err)
+	}
+	defer zeroBytes(body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Key Vault request failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Value *secretBytes `json:"value"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Key Vault response: %w", err)
+	}
+	if secret.Value == nil {
+		return nil, errors.New("Key Vault response does not have the secret value")
+	}
+	return *secret.Value, nil
+}
+
+// secretBytes is a JSON string unmarshaled into bytes instead of a string, which could not be zeroed
+type secretBytes []byte
+
+func (b *secretBytes) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' {
+		return errors.New("secret value is not a string")
+	}
+	if bytes.IndexByte(data, '\\') < 0 {
+		*b = append([]byte(nil), data[1:len(data)-1]...)
+		return nil
+	}
+	// unescaping is left to encoding/json for the rare secrets with escaped characters, whose string cannot be zeroed
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*b = []byte(s)
+	return nil
+}
+
+// zeroBytes overwrites b, e.g. the buffer a secret or a private key was read into, once it is no longer needed
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
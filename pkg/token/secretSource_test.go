@@ -0,0 +1,349 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestParseSecretSource(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %s", err)
+	}
+	t.Setenv("KUBELOGIN_TEST_SECRET", "env-secret")
+
+	testCases := []struct {
+		name        string
+		spec        string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "plain secret",
+			spec:     "s3cr3t~value",
+			expected: "s3cr3t~value",
+		},
+		{
+			name:     "secret with colon",
+			spec:     "abc:def",
+			expected: "abc:def",
+		},
+		{
+			name:     "value",
+			spec:     "value:file:not-a-file",
+			expected: "file:not-a-file",
+		},
+		{
+			name:     "file",
+			spec:     "file:" + secretFile,
+			expected: "file-secret",
+		},
+		{
+			name:        "missing file",
+			spec:        "file:" + filepath.Join(t.TempDir(), "missing"),
+			expectedErr: "no such file or directory",
+		},
+		{
+			name:     "env",
+			spec:     "env:KUBELOGIN_TEST_SECRET",
+			expected: "env-secret",
+		},
+		{
+			name:        "missing env",
+			spec:        "env:KUBELOGIN_TEST_SECRET_MISSING",
+			expectedErr: "environment variable KUBELOGIN_TEST_SECRET_MISSING is not set",
+		},
+		{
+			name:     "cmd",
+			spec:     "cmd:echo cmd-secret",
+			expected: "cmd-secret",
+		},
+		{
+			name:        "empty cmd",
+			spec:        "cmd: ",
+			expectedErr: "cmd secret source requires a command",
+		},
+		{
+			name:        "keyring without account",
+			spec:        "keyring:kubelogin",
+			expectedErr: "keyring secret source requires <service>/<account>",
+		},
+		{
+			name:        "keyvault without secret",
+			spec:        "keyvault:https://myvault.vault.azure.net/keys/mykey",
+			expectedErr: "keyvault secret source requires https://<vault>/secrets/<name>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, err := ParseSecretSource(tc.spec)
+			var secret []byte
+			if err == nil {
+				secret, err = source.Secret(context.Background())
+			}
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if string(secret) != tc.expected {
+				t.Fatalf("expected secret %q, got %q", tc.expected, secret)
+			}
+		})
+	}
+}
+
+func TestParseSecretSourceDefaultScheme(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %s", err)
+	}
+	for _, spec := range []string{tokenFile, "file:" + tokenFile, "cmd:cat " + tokenFile} {
+		source, err := parseSecretSource(spec, secretSchemeFile, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		secret, err := source.Secret(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if string(secret) != "federated-token" {
+			t.Fatalf("%s: expected secret %q, got %q", spec, "federated-token", secret)
+		}
+	}
+}
+
+type fakeCredential struct {
+	scopes []string
+}
+
+func (c *fakeCredential) GetToken(_ context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.scopes = options.Scopes
+	return azcore.AccessToken{Token: "vault-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestKeyVaultSecretSource(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer vault-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("api-version") != keyVaultAPIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/secrets/mysecret":
+			fmt.Fprint(w, `{"value":"vault-secret","id":"https://myvault.vault.azure.net/secrets/mysecret/1"}`)
+		case "/secrets/escaped":
+			fmt.Fprint(w, `{"value":"vault-\"secret\u0021","id":"https://myvault.vault.azure.net/secrets/escaped/1"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":"SecretNotFound"}}`)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		path        string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "secret",
+			path:     "/secrets/mysecret",
+			expected: "vault-secret",
+		},
+		{
+			name:     "secret with escaped characters",
+			path:     "/secrets/escaped",
+			expected: `vault-"secret!`,
+		},
+		{
+			name:        "missing secret",
+			path:        "/secrets/missing",
+			expectedErr: "Key Vault request failed with status code 404",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, err := newKeyVaultSecretSource("https://myvault.vault.azure.net"+tc.path, http.DefaultClient)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if source.scope != "https://vault.azure.net/.default" {
+				t.Fatalf("expected scope %q, got %q", "https://vault.azure.net/.default", source.scope)
+			}
+			credential := &fakeCredential{}
+			source.secretURL = server.URL + tc.path
+			source.credential = credential
+			source.client = server.Client()
+
+			secret, err := source.Secret(context.Background())
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if string(secret) != tc.expected {
+				t.Fatalf("expected secret %q, got %q", tc.expected, secret)
+			}
+			if len(credential.scopes) != 1 || credential.scopes[0] != source.scope {
+				t.Fatalf("expected token for %s, got %v", source.scope, credential.scopes)
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("KUBELOGIN_TEST_CLIENT_SECRET", "client-secret")
+	o := &Options{
+		ClientSecret:       "env:KUBELOGIN_TEST_CLIENT_SECRET",
+		ClientCertPassword: "value:cert-password",
+		Password:           "password",
+	}
+	if err := o.resolveSecrets(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if string(o.secrets.clientSecret) != "client-secret" || string(o.secrets.clientCertPassword) != "cert-password" || string(o.secrets.password) != "password" {
+		t.Fatalf("unexpected secrets: %q, %q, %q", o.secrets.clientSecret, o.secrets.clientCertPassword, o.secrets.password)
+	}
+	// the secrets read from their sources are not copied to the strings of the options
+	if o.ClientSecret != "env:KUBELOGIN_TEST_CLIENT_SECRET" || o.ClientCertPassword != "value:cert-password" || o.Password != "password" {
+		t.Fatalf("expected the options to keep the secret sources, got %q, %q, %q", o.ClientSecret, o.ClientCertPassword, o.Password)
+	}
+
+	o.secrets.zero()
+	for _, secret := range [][]byte{o.secrets.clientSecret, o.secrets.clientCertPassword, o.secrets.password} {
+		if !bytes.Equal(secret, make([]byte, len(secret))) {
+			t.Fatalf("expected secret to be zeroed, actual: %q", secret)
+		}
+	}
+
+	o = &Options{Password: "env:KUBELOGIN_TEST_PASSWORD_MISSING"}
+	if err := o.resolveSecrets(); !ErrorContains(err, "failed to get password: environment variable") {
+		t.Fatalf("expected error getting the password, got %v", err)
+	}
+}
+
+// maskedSecret is a secret kept masked by the test, so that the test itself does not leave it in the heap
+type maskedSecret []byte
+
+func newMaskedSecret(t *testing.T) maskedSecret {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("unable to generate secret: %s", err)
+	}
+	secret := make([]byte, hex.EncodedLen(len(b)))
+	hex.Encode(secret, b)
+	zeroBytes(b)
+	return maskedSecret(secret).mask()
+}
+
+// mask returns the secret of the masked secret, and the other way around
+func (s maskedSecret) mask() maskedSecret {
+	b := make([]byte, len(s))
+	for i := range s {
+		b[i] = s[i] ^ 0x5a
+	}
+	return b
+}
+
+func TestSecretsDoNotLingerInHeap(t *testing.T) {
+	masked := newMaskedSecret(t)
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	secret := masked.mask()
+	if err := os.WriteFile(secretFile, append(secret, '\n'), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %s", err)
+	}
+	zeroBytes(secret)
+
+	sent := false
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		secret := masked.mask()
+		sent = bytes.Contains(body, secret)
+		zeroBytes(secret)
+		zeroBytes(body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"access_token":"accessToken","token_type":"Bearer","expires_in":"3600","expires_on":"1700000000","resource":"serverID"}`)),
+			Request:    r,
+		}, nil
+	})}
+
+	o := &Options{ClientSecret: "file:" + secretFile}
+	if err := o.resolveSecrets(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	registerSecrets(o.secrets.clientSecret)
+	oAuthConfig, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", "tenantID")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	provider, err := newServicePrincipalToken(*oAuthConfig, "clientID", o.secrets.clientSecret, "", nil, "serverID", "tenantID", false, false, time.Minute, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := provider.Token(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !sent {
+		t.Fatal("expected the client secret to be sent")
+	}
+
+	// the bytes held by the options and the token provider are the only copy of the secret,
+	// so no secret is left in the live objects of the heap once they are zeroed
+	o.secrets.zero()
+	dump, err := os.Create(filepath.Join(t.TempDir(), "heapdump"))
+	if err != nil {
+		t.Fatalf("failed to create heap dump: %s", err)
+	}
+	defer dump.Close()
+	// the second collection clears the victim caches of sync.Pool
+	runtime.GC()
+	runtime.GC()
+	debug.WriteHeapDump(dump.Fd())
+	runtime.KeepAlive(provider)
+	runtime.KeepAlive(o)
+
+	data, err := os.ReadFile(dump.Name())
+	if err != nil {
+		t.Fatalf("failed to read heap dump: %s", err)
+	}
+	secret = masked.mask()
+	found := bytes.Contains(data, secret)
+	zeroBytes(secret)
+	if found {
+		t.Fatal("expected the secret not to be left in the heap")
+	}
+}
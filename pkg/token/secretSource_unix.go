@@ -0,0 +1,14 @@
+//go:build !windows
+
+package token
+
+import "runtime"
+
+// keyringCommand returns the command printing the password of the account of the service in the keyring,
+// which is the login keychain on macOS and the Secret Service, e.g. GNOME Keyring, on Linux
+func keyringCommand(service, account string) (string, []string, error) {
+	if runtime.GOOS == "darwin" {
+		return "security", []string{"find-generic-password", "-s", service, "-a", account, "-w"}, nil
+	}
+	return "secret-tool", []string{"lookup", "service", service, "account", account}, nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package token
+
+import "errors"
+
+// keyringCommand is not supported on Windows, which does not have a command line reading the Credential Manager
+func keyringCommand(string, string) (string, []string, error) {
+	return "", nil, errors.New("keyring secret source is not supported on Windows")
+}
@@ -2,11 +2,14 @@ package token
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 	"golang.org/x/crypto/pkcs12"
@@ -18,23 +21,30 @@ const (
 )
 
 type servicePrincipalToken struct {
-	clientID           string
-	clientSecret       string
-	clientCert         string
-	clientCertPassword string
-	resourceID         string
-	tenantID           string
-	oAuthConfig        adal.OAuthConfig
+	clientID             string
+	clientSecret         []byte
+	clientCert           string
+	clientCertPassword   []byte
+	resourceID           string
+	tenantID             string
+	sendCertificateChain bool
+	mtlsPoP              bool
+	mtlsPoPEndpoint      string
+	timeout              time.Duration
+	oAuthConfig          adal.OAuthConfig
+	httpClient           *http.Client
+	// tlsConfig trusts the CAs of the HTTP client, and is extended with the client certificate for the mtls_pop token
+	tlsConfig *tls.Config
 }
 
-func newServicePrincipalToken(oAuthConfig adal.OAuthConfig, clientID, clientSecret, clientCert, clientCertPassword, resourceID, tenantID string) (TokenProvider, error) {
+func newServicePrincipalToken(oAuthConfig adal.OAuthConfig, clientID string, clientSecret []byte, clientCert string, clientCertPassword []byte, resourceID, tenantID string, sendCertificateChain, mtlsPoP bool, timeout time.Duration, httpClient *http.Client, tlsConfig *tls.Config) (TokenProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("clientID cannot be empty")
 	}
-	if clientSecret == "" && clientCert == "" {
+	if len(clientSecret) == 0 && clientCert == "" {
 		return nil, errors.New("both clientSecret and clientcert cannot be empty")
 	}
-	if clientSecret != "" && clientCert != "" {
+	if len(clientSecret) != 0 && clientCert != "" {
 		return nil, errors.New("client secret and client certificate cannot be set at the same time. Only one has to be specified")
 	}
 	if resourceID == "" {
@@ -43,15 +53,32 @@ func newServicePrincipalToken(oAuthConfig adal.OAuthConfig, clientID, clientSecr
 	if tenantID == "" {
 		return nil, errors.New("tenantID cannot be empty")
 	}
+	var mtlsPoPEndpoint string
+	if mtlsPoP {
+		if clientCert == "" {
+			return nil, errors.New("mtls_pop token requires client certificate")
+		}
+		var err error
+		mtlsPoPEndpoint, err = getMTLSPoPTokenEndpoint(oAuthConfig, tenantID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &servicePrincipalToken{
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-		clientCert:         clientCert,
-		clientCertPassword: clientCertPassword,
-		resourceID:         resourceID,
-		tenantID:           tenantID,
-		oAuthConfig:        oAuthConfig,
+		clientID:             clientID,
+		clientSecret:         clientSecret,
+		clientCert:           clientCert,
+		clientCertPassword:   clientCertPassword,
+		resourceID:           resourceID,
+		tenantID:             tenantID,
+		sendCertificateChain: sendCertificateChain,
+		mtlsPoP:              mtlsPoP,
+		mtlsPoPEndpoint:      mtlsPoPEndpoint,
+		timeout:              timeout,
+		oAuthConfig:          oAuthConfig,
+		httpClient:           httpClient,
+		tlsConfig:            tlsConfig,
 	}, nil
 }
 
@@ -66,11 +93,12 @@ func (p *servicePrincipalToken) Token() (adal.Token, error) {
 		err error
 	)
 
-	if p.clientSecret != "" {
+	if len(p.clientSecret) != 0 {
+		// adal takes the secret as a string, which is only referenced by spt during this call
 		spt, err = adal.NewServicePrincipalToken(
 			p.oAuthConfig,
 			p.clientID,
-			p.clientSecret,
+			string(p.clientSecret),
 			p.resourceID,
 			callback)
 		if err != nil {
@@ -81,32 +109,81 @@ func (p *servicePrincipalToken) Token() (adal.Token, error) {
 		if err != nil {
 			return emptyToken, fmt.Errorf("failed to read the certificate file (%s): %w", p.clientCert, err)
 		}
+		// the pfx file holds the private key, which is only needed in decoded form
+		defer zeroBytes(certData)
 
-		// Get the certificate and private key from pfx file
-		cert, rsaPrivateKey, err := decodePkcs12(certData, p.clientCertPassword)
-		if err != nil {
-			return emptyToken, fmt.Errorf("failed to decode pkcs12 certificate while creating spt: %w", err)
+		if p.mtlsPoP {
+			return p.mtlsPoPToken(certData)
 		}
+		if p.sendCertificateChain {
+			spt, err = p.newServicePrincipalTokenFromCertificateChain(certData, callback)
+			if err != nil {
+				return emptyToken, err
+			}
+		} else {
+			// Get the certificate and private key from pfx file
+			cert, rsaPrivateKey, err := decodePkcs12(certData, string(p.clientCertPassword))
+			if err != nil {
+				return emptyToken, fmt.Errorf("failed to decode pkcs12 certificate while creating spt: %w", err)
+			}
 
-		spt, err = adal.NewServicePrincipalTokenFromCertificate(
-			p.oAuthConfig,
-			p.clientID,
-			cert,
-			rsaPrivateKey,
-			p.resourceID,
-			callback)
-		if err != nil {
-			return emptyToken, fmt.Errorf("failed to create service principal token using cert: %s", err)
+			spt, err = adal.NewServicePrincipalTokenFromCertificate(
+				p.oAuthConfig,
+				p.clientID,
+				cert,
+				rsaPrivateKey,
+				p.resourceID,
+				callback)
+			if err != nil {
+				return emptyToken, fmt.Errorf("failed to create service principal token using cert: %s", err)
+			}
 		}
 	}
 
-	err = spt.Refresh()
+	spt.SetSender(p.httpClient)
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	err = spt.RefreshWithContext(ctx)
 	if err != nil {
 		return emptyToken, err
 	}
 	return spt.Token(), nil
 }
 
+// mtlsPoPToken gets a token bound to the client certificate from the mutual TLS token endpoint
+func (p *servicePrincipalToken) mtlsPoPToken(certData []byte) (adal.Token, error) {
+	chain, rsaPrivateKey, err := decodePkcs12Chain(certData, string(p.clientCertPassword))
+	if err != nil {
+		return adal.Token{}, fmt.Errorf("failed to decode pkcs12 certificate chain for mtls_pop token: %w", err)
+	}
+	ctx, cancel := newTimeoutContext(p.timeout)
+	defer cancel()
+	return requestMTLSPoPToken(ctx, newMTLSClient(chain, rsaPrivateKey, p.tlsConfig), p.mtlsPoPEndpoint, p.clientID, p.resourceID)
+}
+
+// newServicePrincipalTokenFromCertificateChain creates a service principal token whose client assertion
+// carries the whole certificate chain of the pfx file in x5c header
+func (p *servicePrincipalToken) newServicePrincipalTokenFromCertificateChain(certData []byte, callback adal.TokenRefreshCallback) (*adal.ServicePrincipalToken, error) {
+	chain, rsaPrivateKey, err := decodePkcs12Chain(certData, string(p.clientCertPassword))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pkcs12 certificate chain while creating spt: %w", err)
+	}
+	secret, err := newCertificateChainSecret(p.oAuthConfig, p.clientID, chain, rsaPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	spt, err := adal.NewServicePrincipalTokenWithSecret(
+		p.oAuthConfig,
+		p.clientID,
+		p.resourceID,
+		secret,
+		callback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service principal token using cert chain: %s", err)
+	}
+	return spt, nil
+}
+
 func isPublicKeyEqual(key1, key2 *rsa.PublicKey) bool {
 	if key1.N == nil || key2.N == nil {
 		return false
@@ -209,3 +286,43 @@ func decodePkcs12(pkcs []byte, password string) (*x509.Certificate, *rsa.Private
 
 	return parseKeyPairFromPEMBlock(pemData)
 }
+
+// decodePkcs12Chain returns the certificate chain with the certificate matching the private key first
+func decodePkcs12Chain(pkcs []byte, password string) ([]*x509.Certificate, *rsa.PrivateKey, error) {
+	blocks, err := pkcs12.ToPEM(pkcs, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		pemData []byte
+	)
+
+	for _, b := range blocks {
+		pemData = append(pemData, pem.EncodeToMemory(b)...)
+	}
+
+	leaf, privateKey, err := parseKeyPairFromPEMBlock(pemData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain := []*x509.Certificate{leaf}
+	certPEM, _ := splitPEMBlock(pemData)
+	for {
+		var certBlock *pem.Block
+		certBlock, certPEM = pem.Decode(certPEM)
+		if certBlock == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse certificate. %w", err)
+		}
+		if !cert.Equal(leaf) {
+			chain = append(chain, cert)
+		}
+	}
+
+	return chain, privateKey, nil
+}
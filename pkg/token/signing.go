@@ -0,0 +1,252 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// execCredentialSignatureType is the typ header of the detached JWS signatures of ExecCredentials,
+// so that a signature of another payload made with the same key is not accepted
+const execCredentialSignatureType = "kubelogin-exec-credential+jws"
+
+// WithExecCredentialSigner signs the ExecCredentials written by the ExecCredentialPlugin with s, e.g. a key held by a TPM,
+// instead of the key of --sign-key. The detached signature is written to --signature-file.
+// Supported keys are ECDSA P-256 and P-384, Ed25519, and RSA keys.
+func WithExecCredentialSigner(s crypto.Signer) Option {
+	return func(po *pluginOptions) {
+		po.signer = s
+	}
+}
+
+// jwsHeader is the protected header of the detached JWS
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// loadSigningKey reads the unencrypted PEM private key in PKCS #8, SEC 1, or PKCS #1 format from the file
+func loadSigningKey(file string) (crypto.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found in %s", file)
+	}
+	s, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the signing key in %s: %w", file, err)
+	}
+	return s, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s is not a supported private key. Use an unencrypted PKCS #8, EC, or RSA private key", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot sign", key)
+	}
+	if _, _, err := getJWSAlgorithm(s.Public()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParsePublicKey parses the PEM public key, certificate, or private key whose public key verifies the signatures
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM public key found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	s, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return s.Public(), nil
+}
+
+// getJWSAlgorithm returns the JWS algorithm of the key, and the hash the payload is signed with
+func getJWSAlgorithm(key crypto.PublicKey) (string, crypto.Hash, error) {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ES384", crypto.SHA384, nil
+		}
+		return "", 0, fmt.Errorf("ECDSA curve %s is not supported for signing. Use P-256 or P-384", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "EdDSA", 0, nil
+	case *rsa.PublicKey:
+		return "RS256", crypto.SHA256, nil
+	}
+	return "", 0, fmt.Errorf("%T is not supported for signing. Use an ECDSA, Ed25519, or RSA key", key)
+}
+
+// GetKeyID returns the ID of the key in the signatures, the base64url encoded SHA-256 of its PKIX public key
+func GetKeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// SignExecCredential returns the JWS of the payload with detached content (RFC 7515, appendix F), i.e. <header>..<signature>
+func SignExecCredential(s crypto.Signer, payload []byte) (string, error) {
+	alg, hash, err := getJWSAlgorithm(s.Public())
+	if err != nil {
+		return "", err
+	}
+	kid, err := GetKeyID(s.Public())
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(jwsHeader{Algorithm: alg, KeyID: kid, Type: execCredentialSignatureType})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+	input := []byte(encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload))
+
+	digest := input
+	if hash != 0 {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	sig, err := s.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign: %w", err)
+	}
+	if k, ok := s.Public().(*ecdsa.PublicKey); ok {
+		// JWS signatures of ECDSA are R || S rather than ASN.1
+		if sig, err = ecdsaASN1ToJWS(sig, (k.Curve.Params().BitSize+7)/8); err != nil {
+			return "", err
+		}
+	}
+	return encodedHeader + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyExecCredential verifies the detached JWS returned by SignExecCredential against the payload and the public key
+func VerifyExecCredential(payload []byte, signature string, key crypto.PublicKey) error {
+	parts := strings.Split(strings.TrimSpace(signature), ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return errors.New("signature is not a JWS with detached content")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid header of the signature: %w", err)
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return fmt.Errorf("invalid header of the signature: %w", err)
+	}
+	if header.Type != execCredentialSignatureType {
+		return fmt.Errorf("signature of type %q is not a signature of an ExecCredential", header.Type)
+	}
+	alg, hash, err := getJWSAlgorithm(key)
+	if err != nil {
+		return err
+	}
+	// the algorithm is decided by the key rather than by the header
+	if header.Algorithm != alg {
+		return fmt.Errorf("signature algorithm %s does not match the %s key", header.Algorithm, alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	input := []byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload))
+	digest := input
+	if hash != 0 {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	valid := false
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) == 2*size {
+			valid = ecdsa.Verify(k, digest, new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:]))
+		}
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, digest, sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+	}
+	if !valid {
+		return errors.New("signature does not match the ExecCredential")
+	}
+	return nil
+}
+
+func ecdsaASN1ToJWS(der []byte, size int) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("invalid ECDSA signature: %w", err)
+	}
+	out := make([]byte, 2*size)
+	sig.R.FillBytes(out[:size])
+	sig.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// writeExecCredentialSignature writes the detached signature of the ExecCredential to the file
+func writeExecCredentialSignature(file string, s crypto.Signer, payload []byte) error {
+	signature, err := SignExecCredential(s, payload)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, []byte(signature+"\n"), 0644); err != nil {
+		return fmt.Errorf("unable to write the signature: %w", err)
+	}
+	return nil
+}
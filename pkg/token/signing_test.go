@@ -0,0 +1,241 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+)
+
+func newSigningKeys(t *testing.T) map[string]crypto.Signer {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	return map[string]crypto.Signer{"ES256": p256, "ES384": p384, "EdDSA": ed, "RS256": rsaKey}
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("unable to write key: %s", err)
+	}
+	return file
+}
+
+func TestSignExecCredential(t *testing.T) {
+	payload := []byte(`{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","status":{"token":"token"}}` + "\n")
+	keys := newSigningKeys(t)
+	for alg, key := range keys {
+		t.Run(alg, func(t *testing.T) {
+			signature, err := SignExecCredential(key, payload)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := VerifyExecCredential(payload, signature+"\n", key.Public()); err != nil {
+				t.Fatalf("expected the signature to be valid, got %s", err)
+			}
+
+			tampered := append([]byte{}, payload...)
+			tampered[len(tampered)-5] = 'X'
+			if err := VerifyExecCredential(tampered, signature, key.Public()); !ErrorContains(err, "signature does not match the ExecCredential") {
+				t.Fatalf("expected the modified ExecCredential to be rejected, got %v", err)
+			}
+			other := keys["ES256"]
+			if alg == "ES256" {
+				other = keys["ES384"]
+			}
+			if err := VerifyExecCredential(payload, signature, other.Public()); err == nil {
+				t.Fatal("expected the signature to be rejected with another key")
+			}
+		})
+	}
+
+	if err := VerifyExecCredential(payload, "eyJhbGciOiJub25lIn0.e30.", keys["ES256"].Public()); !ErrorContains(err, "not a JWS with detached content") {
+		t.Fatalf("expected a JWS with content to be rejected, got %v", err)
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	keys := newSigningKeys(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(keys["EdDSA"])
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(keys["ES256"].(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	unsupported, err := x509.MarshalECPrivateKey(p224)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+
+	testCases := []struct {
+		name        string
+		file        string
+		expectedErr string
+	}{
+		{name: "PKCS #8", file: writePEM(t, "PRIVATE KEY", pkcs8)},
+		{name: "EC", file: writePEM(t, "EC PRIVATE KEY", sec1)},
+		{name: "RSA", file: writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(keys["RS256"].(*rsa.PrivateKey)))},
+		{name: "encrypted", file: writePEM(t, "ENCRYPTED PRIVATE KEY", pkcs8), expectedErr: "ENCRYPTED PRIVATE KEY is not a supported private key"},
+		{name: "unsupported curve", file: writePEM(t, "EC PRIVATE KEY", unsupported), expectedErr: "ECDSA curve P-224 is not supported"},
+		{name: "missing", file: filepath.Join(t.TempDir(), "missing.pem"), expectedErr: "unable to read the signing key"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := loadSigningKey(tc.file)
+			if tc.expectedErr != "" {
+				if !ErrorContains(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// the public key is parsed from the private key file as well
+			data, _ := os.ReadFile(tc.file)
+			public, err := ParsePublicKey(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if kid, _ := GetKeyID(public); kid == "" {
+				t.Fatalf("expected the key ID of %T", key)
+			}
+		})
+	}
+}
+
+func TestExecCredentialPluginSignsExecCredential(t *testing.T) {
+	ctrl, tokenCache, _, pluginWriter := setupMocks(t)
+	defer ctrl.Finish()
+	key := newSigningKeys(t)["ES256"]
+	dir := t.TempDir()
+	o := &Options{
+		TokenCacheDir:  dir,
+		LoginMethod:    DeviceCodeLogin,
+		ServerID:       "serverID",
+		SignatureFile:  filepath.Join(dir, "cred.jws"),
+		tokenCacheFile: "cacheFile",
+	}
+	tokenCache.EXPECT().Read("cacheFile").Return(adal.Token{
+		AccessToken: "accessToken",
+		Resource:    "serverID",
+		ExpiresOn:   json.Number(fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix())),
+	}, nil)
+	pluginWriter.EXPECT().Write(gomock.Any(), gomock.Any()).DoAndReturn(func(_ adal.Token, w io.Writer) error {
+		_, err := fmt.Fprintln(w, `{"kind":"ExecCredential"}`)
+		return err
+	})
+
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatalf("unable to create file: %s", err)
+	}
+	defer stdout.Close()
+	orig := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = orig }()
+
+	plugin := execCredentialPlugin{o: o, tokenCache: tokenCache, execCredentialWriter: pluginWriter, signer: key}
+	if err := plugin.Do(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	os.Stdout = orig
+
+	written, _ := os.ReadFile(stdout.Name())
+	signature, err := os.ReadFile(o.SignatureFile)
+	if err != nil {
+		t.Fatalf("expected the signature to be written, got %s", err)
+	}
+	if err := VerifyExecCredential(written, string(signature), key.Public()); err != nil {
+		t.Fatalf("expected the signature of the written ExecCredential %q to be valid, got %s", written, err)
+	}
+}
+
+func TestNewRequiresSignatureFileWithSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	o := NewOptions()
+	o.LoginMethod = MSILogin
+	o.ServerID = "serverID"
+	o.TokenCacheDir = t.TempDir()
+	o.UpdateFromEnv()
+	// the signer is not known to Validate, which callers run before New
+	if err := o.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = New(&o, WithExecCredentialSigner(key))
+	if !ErrorContains(err, "--signature-file is required to sign the ExecCredential") || GetExitCode(err) != ExitCodeConfigError {
+		t.Fatalf("expected signer without signature file to return config error, got %v", err)
+	}
+}
+
+func TestNewTokenProviderRejectsExecCredentialOptions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	testData := []struct {
+		name   string
+		update func(o *Options)
+		opts   []Option
+		option string
+	}{
+		{name: "token prefix", update: func(o *Options) { o.TokenPrefix = "prefix-" }, option: "--token-prefix"},
+		{name: "sign key", update: func(o *Options) { o.SignKey = "key.pem"; o.SignatureFile = "signature" }, option: "signing"},
+		{name: "signer", update: func(o *Options) {}, opts: []Option{WithExecCredentialSigner(key)}, option: "signing"},
+		{name: "signature file", update: func(o *Options) { o.SignatureFile = "signature" }, option: "--signature-file"},
+		{name: "show claims", update: func(o *Options) { o.ShowClaims = true }, option: "--show-claims"},
+	}
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			o := NewOptions()
+			o.LoginMethod = MSILogin
+			o.ServerID = "serverID"
+			o.TokenCacheDir = t.TempDir()
+			data.update(&o)
+			o.Complete()
+			_, err := NewTokenProvider(&o, data.opts...)
+			if !ErrorContains(err, data.option+" is not supported by a token provider") || GetExitCode(err) != ExitCodeConfigError {
+				t.Fatalf("expected %s to be rejected with config error, got %v", data.option, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package token
+
+import (
+	"fmt"
+	"time"
+)
+
+// CredentialStatus describes the credential cached for the options
+type CredentialStatus struct {
+	// Valid is true when the cached token can be used without refreshing it
+	Valid bool
+	// ExpiresIn is the remaining lifetime of the cached token
+	ExpiresIn time.Duration
+	// Refreshable is true when the cached token carries a refresh token
+	Refreshable bool
+}
+
+func (s CredentialStatus) String() string {
+	if s.Valid {
+		return fmt.Sprintf("valid, expires in %s", s.ExpiresIn.Round(time.Second))
+	}
+	if s.Refreshable {
+		return "expired, refresh token available"
+	}
+	return "no valid credential"
+}
+
+// GetCredentialStatus returns the status of the credential in the token cache without making network calls.
+// o must have been resolved by UpdateFromEnv.
+func GetCredentialStatus(o *Options) (CredentialStatus, error) {
+	return getCredentialStatus(o, realClock{})
+}
+
+func getCredentialStatus(o *Options, c clock) (CredentialStatus, error) {
+	if method, _ := getLoginMethodOfOptions(o); !method.Cache {
+		return CredentialStatus{}, fmt.Errorf("%s login does not cache tokens", o.LoginMethod)
+	}
+	token, err := (&defaultTokenCache{}).Read(o.tokenCacheFile)
+	if err != nil {
+		return CredentialStatus{}, fmt.Errorf("unable to read from token cache: %s, err: %w", o.tokenCacheFile, err)
+	}
+	// the token is valid as long as get-token would return it from cache
+	token = withTrustedJWTExpiry(o, token)
+	if token.IsZero() || token.Resource != getTargetAudience(o) {
+		return CredentialStatus{}, nil
+	}
+	if o.MaxCacheAge > 0 && isMaxCacheAgeExceeded(getCacheMetadataFileName(o), o.MaxCacheAge, c.Now()) {
+		return CredentialStatus{}, nil
+	}
+	if o.LoginMethod == AzureCLILogin && isAzureCLITokenStale(o.tokenCacheFile) {
+		return CredentialStatus{}, nil
+	}
+	return CredentialStatus{
+		Valid:       !willExpireIn(c, token, expirationDelta+getExpiryJitter(o, token)),
+		ExpiresIn:   timeUntilExpiry(c, token),
+		Refreshable: token.RefreshToken != "",
+	}, nil
+}
@@ -0,0 +1,123 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestGetCredentialStatus(t *testing.T) {
+	const serverID = "serverID"
+	expiresOn := func(d time.Duration) json.Number {
+		return json.Number(fmt.Sprintf("%d", time.Now().Add(d).Unix()))
+	}
+	testData := []struct {
+		name           string
+		loginMethod    string
+		trustJWTExp    bool
+		cachedToken    *adal.Token
+		expectedStatus func(s CredentialStatus) bool
+		expectedError  string
+	}{
+		{
+			name:          "login method without token cache",
+			loginMethod:   MSILogin,
+			expectedError: "msi login does not cache tokens",
+		},
+		{
+			name:           "no cached token",
+			loginMethod:    DeviceCodeLogin,
+			expectedStatus: func(s CredentialStatus) bool { return !s.Valid && !s.Refreshable },
+		},
+		{
+			name:        "valid cached token",
+			loginMethod: DeviceCodeLogin,
+			cachedToken: &adal.Token{AccessToken: "a", RefreshToken: "r", Resource: serverID, ExpiresOn: expiresOn(time.Hour)},
+			expectedStatus: func(s CredentialStatus) bool {
+				return s.Valid && s.Refreshable && s.ExpiresIn > 59*time.Minute
+			},
+		},
+		{
+			name:           "expired cached token with refresh token",
+			loginMethod:    ROPCLogin,
+			cachedToken:    &adal.Token{AccessToken: "a", RefreshToken: "r", Resource: serverID, ExpiresOn: expiresOn(-time.Hour)},
+			expectedStatus: func(s CredentialStatus) bool { return !s.Valid && s.Refreshable },
+		},
+		{
+			name:        "cached token expiring by exp claim with --trust-jwt-exp",
+			loginMethod: DeviceCodeLogin,
+			trustJWTExp: true,
+			cachedToken: &adal.Token{
+				AccessToken: newUnsignedJWT(t, map[string]interface{}{"exp": time.Now().Add(30 * time.Second).Unix()}),
+				Resource:    serverID,
+				ExpiresOn:   expiresOn(time.Hour),
+			},
+			expectedStatus: func(s CredentialStatus) bool { return !s.Valid && s.ExpiresIn < time.Minute },
+		},
+		{
+			name:           "cached token for other audience",
+			loginMethod:    DeviceCodeLogin,
+			cachedToken:    &adal.Token{AccessToken: "a", Resource: "spn:" + serverID, ExpiresOn: expiresOn(time.Hour)},
+			expectedStatus: func(s CredentialStatus) bool { return !s.Valid },
+		},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			o := &Options{
+				LoginMethod:    data.loginMethod,
+				ServerID:       serverID,
+				TrustJWTExp:    data.trustJWTExp,
+				tokenCacheFile: filepath.Join(t.TempDir(), "cache.json"),
+			}
+			if data.cachedToken != nil {
+				if err := adal.SaveToken(o.tokenCacheFile, 0600, *data.cachedToken); err != nil {
+					t.Fatalf("unable to save token: %s", err)
+				}
+			}
+			status, err := GetCredentialStatus(o)
+			if data.expectedError != "" {
+				if !ErrorContains(err, data.expectedError) {
+					t.Fatalf("expected error: %s, actual: %v", data.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !data.expectedStatus(status) {
+				t.Fatalf("unexpected status: %+v", status)
+			}
+		})
+	}
+}
+
+func TestGetCredentialStatusExpiryJitter(t *testing.T) {
+	token := adal.Token{AccessToken: "a", Resource: "serverID", ExpiresOn: json.Number(fmt.Sprintf("%d", time.Now().Add(5*time.Minute).Unix()))}
+	o := &Options{LoginMethod: DeviceCodeLogin, ServerID: "serverID", ExpiryJitter: 30 * time.Minute}
+	// find a token cache file whose jitter the token expires within, so that get-token would refresh it
+	dir := t.TempDir()
+	for i := 0; o.tokenCacheFile == "" || getExpiryJitter(o, token) <= 5*time.Minute; i++ {
+		o.tokenCacheFile = filepath.Join(dir, fmt.Sprintf("cache%d.json", i))
+	}
+	if err := adal.SaveToken(o.tokenCacheFile, 0600, token); err != nil {
+		t.Fatalf("unable to save token: %s", err)
+	}
+
+	status, err := GetCredentialStatus(o)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.Valid {
+		t.Fatalf("expected token expiring within the jitter to be invalid, got %+v", status)
+	}
+
+	o.ExpiryJitter = 0
+	if status, _ := GetCredentialStatus(o); !status.Valid {
+		t.Fatalf("expected token to be valid without jitter, got %+v", status)
+	}
+}
@@ -0,0 +1,109 @@
+package token
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// SudoCacheBehaviorSeparate caches the tokens of root in the token cache directory in the home directory of root
+	SudoCacheBehaviorSeparate = "separate"
+	// SudoCacheBehaviorChown keeps the token cache directory and gives the files written to it to the invoking user
+	SudoCacheBehaviorChown = "chown"
+	// SudoCacheBehaviorRefuse fails instead of writing root owned files to the token cache directory
+	SudoCacheBehaviorRefuse = "refuse"
+	// SudoCacheBehaviorIgnore writes to the token cache directory as root
+	SudoCacheBehaviorIgnore = "ignore"
+
+	sudoUIDEnv = "SUDO_UID"
+	sudoGIDEnv = "SUDO_GID"
+)
+
+// sudoUser is the user who invoked kubelogin with sudo
+type sudoUser struct {
+	uid int
+	gid int
+}
+
+// getSudoUser returns the invoking user when kubelogin runs as root with sudo
+func getSudoUser() (sudoUser, bool) {
+	if os.Geteuid() != 0 {
+		return sudoUser{}, false
+	}
+	uid, err := strconv.Atoi(os.Getenv(sudoUIDEnv))
+	if err != nil || uid == 0 {
+		return sudoUser{}, false
+	}
+	gid, err := strconv.Atoi(os.Getenv(sudoGIDEnv))
+	if err != nil {
+		gid = -1
+	}
+	return sudoUser{uid: uid, gid: gid}, true
+}
+
+// getSudoUserOfCacheDir returns the invoking user when kubelogin runs as root with sudo
+// and the token cache directory is in a directory of the invoking user, e.g. because sudo kept HOME.
+// The token cache directory itself may not exist yet, or be owned by root after an earlier run with sudo.
+func getSudoUserOfCacheDir(dir string) (sudoUser, bool) {
+	u, ok := getSudoUser()
+	if !ok || dir == "" {
+		return sudoUser{}, false
+	}
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		if uid, ok := fileOwner(dir); ok && uid == u.uid {
+			return u, true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return sudoUser{}, false
+		}
+	}
+}
+
+// getRootTokenCacheDir returns the default token cache directory in the home directory of root
+func getRootTokenCacheDir() (string, error) {
+	root, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the home directory of root: %w", err)
+	}
+	return filepath.Join(root.HomeDir, ".kube", "cache", "kubelogin"), nil
+}
+
+// updateTokenCacheDirForSudo moves the token cache of root out of the token cache directory of the invoking user,
+// so that root owned files do not break kubelogin run by the invoking user afterwards
+func (o *Options) updateTokenCacheDirForSudo() {
+	if o.SudoCacheBehavior != "" && o.SudoCacheBehavior != SudoCacheBehaviorSeparate {
+		return
+	}
+	if _, ok := getSudoUserOfCacheDir(o.TokenCacheDir); !ok {
+		return
+	}
+	dir, err := getRootTokenCacheDir()
+	if err != nil {
+		logf(5, "keeping token cache directory %s: %s", o.TokenCacheDir, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: running as root with sudo, caching tokens in %s instead of %s of the invoking user. Use --sudo-cache-behavior to change it\n", dir, o.TokenCacheDir)
+	o.TokenCacheDir = dir
+}
+
+// chownTokenCacheDir gives the files in the token cache directory which are owned by root to the invoking user
+func chownTokenCacheDir(dir string, u sudoUser, log *logSink) {
+	err := filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if uid, ok := fileOwner(path); ok && uid == 0 {
+			if err := os.Lchown(path, u.uid, u.gid); err != nil {
+				log.logf(5, "unable to change the owner of %s: %s", path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.logf(5, "unable to change the owner of token cache directory %s: %s", dir, err)
+	}
+}
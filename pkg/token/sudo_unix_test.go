@@ -0,0 +1,113 @@
+//go:build !windows
+
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const invokingUID = 4242
+
+// newSudoUserCacheDir simulates sudo keeping HOME of the invoking user, which owns the token cache directory
+func newSudoUserCacheDir(t *testing.T) string {
+	if os.Geteuid() != 0 {
+		t.Skip("running as root is required")
+	}
+	home := t.TempDir()
+	if err := os.Chown(home, invokingUID, invokingUID); err != nil {
+		t.Fatalf("unable to change the owner of %s: %s", home, err)
+	}
+	t.Setenv(sudoUIDEnv, "4242")
+	t.Setenv(sudoGIDEnv, "4242")
+	return filepath.Join(home, ".kube", "cache", "kubelogin")
+}
+
+func TestGetSudoUserOfCacheDir(t *testing.T) {
+	dir := newSudoUserCacheDir(t)
+	u, ok := getSudoUserOfCacheDir(dir)
+	if !ok || u.uid != invokingUID || u.gid != invokingUID {
+		t.Fatalf("expected the not yet existing cache directory to belong to the invoking user, got %+v, %t", u, ok)
+	}
+
+	if _, ok := getSudoUserOfCacheDir(t.TempDir()); ok {
+		t.Fatal("expected the directory owned by root not to belong to the invoking user")
+	}
+
+	t.Setenv(sudoUIDEnv, "")
+	if _, ok := getSudoUserOfCacheDir(dir); ok {
+		t.Fatal("expected no invoking user without sudo")
+	}
+}
+
+func TestSudoCacheBehavior(t *testing.T) {
+	rootDir, err := getRootTokenCacheDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testCases := []struct {
+		behavior    string
+		expectedDir func(string) string
+		expectedErr string
+	}{
+		{
+			behavior:    SudoCacheBehaviorSeparate,
+			expectedDir: func(string) string { return rootDir },
+		},
+		{
+			behavior:    SudoCacheBehaviorChown,
+			expectedDir: func(dir string) string { return dir },
+		},
+		{
+			behavior:    SudoCacheBehaviorIgnore,
+			expectedDir: func(dir string) string { return dir },
+		},
+		{
+			behavior:    SudoCacheBehaviorRefuse,
+			expectedDir: func(dir string) string { return dir },
+			expectedErr: "refusing to write root owned files",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.behavior, func(t *testing.T) {
+			dir := newSudoUserCacheDir(t)
+			o := NewOptions()
+			o.ServerID = "serverID"
+			o.TokenCacheDir = dir
+			o.SudoCacheBehavior = tc.behavior
+			o.UpdateFromEnv()
+
+			if expected := tc.expectedDir(dir); o.TokenCacheDir != expected {
+				t.Fatalf("expected token cache directory %s, got %s", expected, o.TokenCacheDir)
+			}
+			if err := o.Validate(); tc.expectedErr != "" && !ErrorContains(err, tc.expectedErr) || tc.expectedErr == "" && err != nil {
+				t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestChownTokenCacheDir(t *testing.T) {
+	dir := newSudoUserCacheDir(t)
+	file := filepath.Join(dir, "token.json")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("unable to create %s: %s", dir, err)
+	}
+	if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+		t.Fatalf("unable to write %s: %s", file, err)
+	}
+
+	u, ok := getSudoUserOfCacheDir(dir)
+	if !ok {
+		t.Fatal("expected the cache directory to belong to the invoking user")
+	}
+	chownTokenCacheDir(dir, u, nil)
+	for _, path := range []string{dir, file} {
+		if uid, _ := fileOwner(path); uid != invokingUID {
+			t.Fatalf("expected %s to be owned by %d, got %d", path, invokingUID, uid)
+		}
+	}
+}
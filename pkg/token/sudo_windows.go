@@ -0,0 +1,8 @@
+//go:build windows
+
+package token
+
+// fileOwner is not supported on Windows, which does not have sudo
+func fileOwner(string) (int, bool) {
+	return 0, false
+}
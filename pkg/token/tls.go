@@ -0,0 +1,229 @@
+package token
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// requestsCABundleEnv is the CA bundle of python requests, which is used by Azure CLI
+const requestsCABundleEnv = "REQUESTS_CA_BUNDLE"
+
+// systemCABundleFiles are the well known locations of the PEM bundle of the system roots,
+// used as the base of the CA bundle passed to Azure CLI, which does not use the system trust store
+var systemCABundleFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // macOS, Alpine
+}
+
+// httpSettings are the trusted CAs, the pool size, the regional authority, and the cassette of the HTTP clients of a plugin.
+// They are set up from the options by newHTTPSettings, and kept on the options of each plugin, so that the plugins
+// of a process, e.g. a program using kubelogin as a library, do not change the HTTP clients of one another.
+type httpSettings struct {
+	// rootCAs trusts the system roots and the CAs of --tls-ca-dir, and extraCAs holds those CAs in PEM.
+	// They are nil when only the system roots are trusted.
+	rootCAs  *x509.CertPool
+	extraCAs []byte
+	// maxIdleConnsPerHost is the number of idle connections to Azure AD kept per host by the transport, for processes
+	// acquiring many tokens, and zero to use the default of net/http
+	maxIdleConnsPerHost int
+	// regionalAuthority holds the token endpoint hosts of --azure-region, and is nil when token requests are only sent to the global authority
+	regionalAuthority *authorityHosts
+	// cassette records or replays the HTTP traffic of token providers with --record or --replay, and is nil otherwise
+	cassette *httpCassette
+	log      *logSink
+
+	mu sync.Mutex
+	// transport is shared by the HTTP clients of the settings trusting the CAs of --tls-ca-dir
+	transport *http.Transport
+}
+
+// defaultHTTPSettings only trust the system roots. They are the settings of options not passed to New, e.g. in tests.
+var defaultHTTPSettings = &httpSettings{}
+
+// systemRootsTransports are the transports of the settings only trusting the system roots by the pool size,
+// shared by all plugins of the process, so that a long running process, e.g. a controller using kubelogin as a library,
+// keeps the HTTP/2 connections and TLS sessions to Azure AD across token requests instead of a handshake for every token
+var systemRootsTransports = struct {
+	mu         sync.Mutex
+	byPoolSize map[int]*http.Transport
+}{byPoolSize: map[int]*http.Transport{}}
+
+// newHTTPSettings returns the settings of the HTTP clients of all login methods, and Azure CLI, of the options
+func newHTTPSettings(o *Options) (*httpSettings, error) {
+	if o.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("max idle connections per host cannot be negative: %d", o.MaxIdleConnsPerHost)
+	}
+	s := &httpSettings{maxIdleConnsPerHost: o.MaxIdleConnsPerHost, log: o.log}
+	if o.TLSCADir != "" {
+		pool, pem, err := loadCertPool(o.log, o.TLSCADir)
+		if err != nil {
+			return nil, err
+		}
+		s.rootCAs, s.extraCAs = pool, pem
+	}
+	hosts, err := getAuthorityHosts(o)
+	if err != nil {
+		return nil, err
+	}
+	s.regionalAuthority = hosts
+	if s.cassette, err = newHTTPCassette(o); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// getHTTPSettings returns the settings of the HTTP clients of the options set up by New, or defaultHTTPSettings
+func (o *Options) getHTTPSettings() *httpSettings {
+	if o.http == nil {
+		return defaultHTTPSettings
+	}
+	return o.http
+}
+
+// loadCertPool returns the pool of the system roots, which are read from the Windows certificate store
+// and the macOS keychain on these platforms, extended with the CAs in the files of caDir
+func loadCertPool(log *logSink, caDir string) (*x509.CertPool, []byte, error) {
+	entries, err := os.ReadDir(caDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read TLS CA directory: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.logf(5, "unable to load the system roots, only trusting the CAs in %s: %s", caDir, err)
+		pool = x509.NewCertPool()
+	}
+
+	var pems bytes.Buffer
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := filepath.Join(caDir, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			log.logf(5, "skipping %s without PEM encoded certificates", file)
+			continue
+		}
+		pems.Write(bytes.TrimSpace(data))
+		pems.WriteString("\n")
+	}
+	if pems.Len() == 0 {
+		return nil, nil, fmt.Errorf("no PEM encoded certificates found in TLS CA directory %s", caDir)
+	}
+	return pool, pems.Bytes(), nil
+}
+
+// newTLSConfig returns the TLS configuration trusting the CAs of the settings, with the minimum version used by adal and autorest
+func (s *httpSettings) newTLSConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: s.rootCAs}
+}
+
+// newHTTPTransport returns a copy of http.DefaultTransport trusting the CAs of the settings
+func (s *httpSettings) newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = s.newTLSConfig()
+	return transport
+}
+
+// sharedTransport returns the transport shared by the HTTP clients of the settings, with the size of the pool of idle connections.
+// It is shared with the other plugins of the process as well when only the system roots are trusted.
+// TLS sessions are resumed from its session cache when a connection to Azure AD is established again.
+func (s *httpSettings) sharedTransport() *http.Transport {
+	if s.rootCAs == nil {
+		systemRootsTransports.mu.Lock()
+		defer systemRootsTransports.mu.Unlock()
+		if transport, ok := systemRootsTransports.byPoolSize[s.maxIdleConnsPerHost]; ok {
+			return transport
+		}
+		transport := s.newPooledTransport()
+		systemRootsTransports.byPoolSize[s.maxIdleConnsPerHost] = transport
+		return transport
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == nil {
+		s.transport = s.newPooledTransport()
+	}
+	return s.transport
+}
+
+// newPooledTransport returns the transport of sharedTransport caching TLS sessions, with the pool of idle connections of the settings
+func (s *httpSettings) newPooledTransport() *http.Transport {
+	transport := s.newHTTPTransport()
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	if s.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = s.maxIdleConnsPerHost
+		if transport.MaxIdleConns < s.maxIdleConnsPerHost {
+			transport.MaxIdleConns = s.maxIdleConnsPerHost
+		}
+	}
+	return transport
+}
+
+// newHTTPClient returns an http.Client trusting the CAs of the settings and sending token requests to the regional authority
+// of --azure-region. Every token request is sent with it, or the client of newMTLSClient extending newTLSConfig.
+func (s *httpSettings) newHTTPClient() *http.Client {
+	return &http.Client{Transport: s.cassette.wrap(s.regionalAuthority.wrap(s.log, s.sharedTransport()))}
+}
+
+// azureCLICABundleEnv returns the environment having Azure CLI trust extraCAs, the CAs of --tls-ca-dir.
+// Azure CLI only trusts the bundle in REQUESTS_CA_BUNDLE, so the CAs are appended to a copy of it,
+// or of the system bundle. The returned function removes the copy.
+func azureCLICABundleEnv(log *logSink, extraCAs []byte) ([]string, func(), error) {
+	if extraCAs == nil {
+		return nil, func() {}, nil
+	}
+	base, err := readBaseCABundle()
+	if err != nil {
+		return nil, nil, err
+	}
+	if base == nil {
+		log.logf(5, "no CA bundle found to add the CAs of --tls-ca-dir to, set %s for Azure CLI", requestsCABundleEnv)
+		return nil, func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "kubelogin-ca-bundle-*.pem")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA bundle for Azure CLI: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+	_, err = f.Write(append(append(bytes.TrimSpace(base), '\n'), extraCAs...))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write CA bundle for Azure CLI: %w", err)
+	}
+	return []string{requestsCABundleEnv + "=" + f.Name()}, cleanup, nil
+}
+
+// readBaseCABundle returns the CA bundle set in REQUESTS_CA_BUNDLE, or the PEM bundle of the system roots.
+// It returns nil when neither is found, e.g. on Windows.
+func readBaseCABundle() ([]byte, error) {
+	if file := os.Getenv(requestsCABundleEnv); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", requestsCABundleEnv, err)
+		}
+		return data, nil
+	}
+	for _, file := range systemCABundleFiles {
+		if data, err := os.ReadFile(file); err == nil {
+			return data, nil
+		}
+	}
+	return nil, nil
+}
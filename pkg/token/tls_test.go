@@ -0,0 +1,208 @@
+package token
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// writeServerCA writes the certificate of server to a PEM file in a new directory and returns the directory
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	dir := t.TempDir()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dir, "proxy-ca.pem"), data, 0600); err != nil {
+		t.Fatalf("failed to write CA file: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	return dir
+}
+
+func TestNewHTTPSettingsTLSCADir(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := defaultHTTPSettings.newHTTPClient().Get(server.URL); err == nil {
+		t.Fatalf("expected the CA of the server not to be trusted without --tls-ca-dir")
+	}
+
+	settings, err := newHTTPSettings(&Options{TLSCADir: writeServerCA(t, server)})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	resp, err := settings.newHTTPClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the CA in --tls-ca-dir to be trusted, got %s", err)
+	}
+	resp.Body.Close()
+	// MSAL uses its own client unless the metadata cache client is passed
+	resp, err = newMetadataCacheClient(settings, t.TempDir(), 0, false).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the metadata cache client to trust the CA in --tls-ca-dir, got %s", err)
+	}
+	resp.Body.Close()
+
+	// the settings of other options do not trust the CA of an earlier --tls-ca-dir
+	other, err := newHTTPSettings(&Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, err := other.newHTTPClient().Get(server.URL); err == nil {
+		t.Fatalf("expected the CA of the server not to be trusted without --tls-ca-dir")
+	}
+}
+
+func TestNewHTTPSettingsTLSCADirWithoutCertificates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	if _, err := newHTTPSettings(&Options{TLSCADir: dir}); !ErrorContains(err, "no PEM encoded certificates found in TLS CA directory") {
+		t.Fatalf("expected error for directory without certificates, got %v", err)
+	}
+	if _, err := newHTTPSettings(&Options{TLSCADir: filepath.Join(dir, "missing")}); !ErrorContains(err, "failed to read TLS CA directory") {
+		t.Fatalf("expected error for missing directory, got %v", err)
+	}
+}
+
+func TestAzureCLICABundleEnv(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	env, cleanup, err := azureCLICABundleEnv(nil, nil)
+	if err != nil || env != nil {
+		t.Fatalf("expected no environment without --tls-ca-dir, got %v, %v", env, err)
+	}
+	cleanup()
+
+	baseBundle := filepath.Join(t.TempDir(), "base.pem")
+	if err := os.WriteFile(baseBundle, []byte("# base bundle\n"), 0600); err != nil {
+		t.Fatalf("failed to write base bundle: %s", err)
+	}
+	t.Setenv(requestsCABundleEnv, baseBundle)
+	settings, err := newHTTPSettings(&Options{TLSCADir: writeServerCA(t, server)})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	env, cleanup, err = azureCLICABundleEnv(nil, settings.extraCAs)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(env) != 1 || !strings.HasPrefix(env[0], requestsCABundleEnv+"=") {
+		t.Fatalf("expected %s in environment, got %v", requestsCABundleEnv, env)
+	}
+	bundle := strings.TrimPrefix(env[0], requestsCABundleEnv+"=")
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatalf("failed to read the CA bundle: %s", err)
+	}
+	if !strings.HasPrefix(string(data), "# base bundle\n-----BEGIN CERTIFICATE-----") {
+		t.Fatalf("expected the CA to be appended to the base bundle, got %q", data)
+	}
+	cleanup()
+	if _, err := os.Stat(bundle); !os.IsNotExist(err) {
+		t.Fatalf("expected the CA bundle to be removed, got %v", err)
+	}
+}
+
+func TestSharedHTTPTransport(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	settings, err := newHTTPSettings(&Options{TLSCADir: writeServerCA(t, server)})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	// the clients of different token providers share the connection
+	for i := 0; i < 3; i++ {
+		resp, err := settings.newHTTPClient().Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("expected the connection to be reused, got %d connections", n)
+	}
+
+	if settings.sharedTransport().TLSClientConfig.ClientSessionCache == nil {
+		t.Fatalf("expected TLS sessions to be cached")
+	}
+	resized, err := newHTTPSettings(&Options{MaxIdleConnsPerHost: 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if transport := resized.sharedTransport(); transport == settings.sharedTransport() || transport.MaxIdleConnsPerHost != 50 {
+		t.Fatalf("expected a transport with 50 idle connections per host, got %d", transport.MaxIdleConnsPerHost)
+	}
+	other, err := newHTTPSettings(&Options{MaxIdleConnsPerHost: 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if other.sharedTransport() != resized.sharedTransport() {
+		t.Fatalf("expected the settings only trusting the system roots to share the transport")
+	}
+	if _, err := newHTTPSettings(&Options{MaxIdleConnsPerHost: -1}); !ErrorContains(err, "cannot be negative") {
+		t.Fatalf("expected error for negative pool size, got %v", err)
+	}
+}
+
+func TestHTTPSettingsOfConcurrentPlugins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caDir := writeServerCA(t, server)
+
+	// plugins created at the same time, e.g. by a program using kubelogin as a library, keep their own settings
+	plugins := make([]*execCredentialPlugin, 8)
+	errs := make([]error, len(plugins))
+	var wg sync.WaitGroup
+	for i := range plugins {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			o := NewOptions()
+			o.LoginMethod = MSILogin
+			o.ServerID = "serverID"
+			o.TokenCacheDir = t.TempDir()
+			if i%2 == 0 {
+				o.TLSCADir = caDir
+				o.AzureRegion = "westus2"
+				o.LoginMethod = ServicePrincipalLogin
+				o.ClientID, o.ClientSecret, o.TenantID = "clientID", "clientSecret", "tenantID"
+			}
+			plugins[i], errs[i] = newExecCredentialPlugin(&o, pluginOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, p := range plugins {
+		if errs[i] != nil {
+			t.Fatalf("unexpected error: %s", errs[i])
+		}
+		_, err := p.o.http.newHTTPClient().Get(server.URL)
+		if trusted := err == nil; trusted != (i%2 == 0) {
+			t.Fatalf("expected plugin %d to trust the CA of --tls-ca-dir %t, got %v", i, i%2 == 0, err)
+		}
+		if regional := p.o.http.regionalAuthority != nil; regional != (i%2 == 0) {
+			t.Fatalf("expected plugin %d to use the regional authority %t", i, i%2 == 0)
+		}
+	}
+}
@@ -4,6 +4,10 @@ package token
 
 import (
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
@@ -48,3 +52,63 @@ func (*defaultTokenCache) Write(file string, token adal.Token) error {
 	}
 	return nil
 }
+
+// GetCachedServerIDs returns the server IDs of the tokens cached in tokenCacheDir, sorted and without duplicates.
+// Files which are not token cache files are skipped.
+func GetCachedServerIDs(tokenCacheDir string) ([]string, error) {
+	files, err := os.ReadDir(tokenCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	serverIDs := []string{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" || strings.HasSuffix(f.Name(), ".metadata.json") {
+			continue
+		}
+		token, err := adal.LoadToken(filepath.Join(tokenCacheDir, f.Name()))
+		if err != nil || token.Resource == "" {
+			continue
+		}
+		// tokens with 'spn:' prefix in audience claim are cached for the same server ID
+		serverID := strings.TrimPrefix(token.Resource, "spn:")
+		if !seen[serverID] {
+			seen[serverID] = true
+			serverIDs = append(serverIDs, serverID)
+		}
+	}
+	sort.Strings(serverIDs)
+	return serverIDs, nil
+}
+
+// readOnlyTokenCache reads the tokens from the underlying cache but never writes to it.
+// Written tokens, e.g. refreshed ones, are kept in memory for the lifetime of the process.
+type readOnlyTokenCache struct {
+	cache  TokenCache
+	mu     sync.Mutex
+	tokens map[string]adal.Token
+}
+
+func newReadOnlyTokenCache(cache TokenCache) *readOnlyTokenCache {
+	return &readOnlyTokenCache{
+		cache:  cache,
+		tokens: map[string]adal.Token{},
+	}
+}
+
+func (c *readOnlyTokenCache) Read(file string) (adal.Token, error) {
+	c.mu.Lock()
+	token, ok := c.tokens[file]
+	c.mu.Unlock()
+	if ok {
+		return token, nil
+	}
+	return c.cache.Read(file)
+}
+
+func (c *readOnlyTokenCache) Write(file string, token adal.Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[file] = token
+	return nil
+}
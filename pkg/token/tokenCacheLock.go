@@ -0,0 +1,131 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// how long to wait for another process to finish refreshing the same token
+	defaultCacheLockTimeout = 10 * time.Second
+	// a lock older than this is considered left behind by a crashed process
+	defaultCacheLockStaleAfter = 5 * time.Minute
+	cacheLockRetryInterval     = 100 * time.Millisecond
+)
+
+var errCacheLockTimeout = errors.New("timed out waiting for token cache lock")
+
+// cacheLocker locks the token cache file and returns the function to unlock it
+type cacheLocker func(file string) (func(), error)
+
+// newFileCacheLocker returns a cacheLocker which serializes token acquisition across processes
+// using a lock file next to the token cache file, so that when many kubectl processes start
+// at the same time only one of them refreshes the token and the others reuse the result.
+// The lock file holds the owner token of the process holding the lock, whose modification time is refreshed
+// while the lock is held, so that a login taking longer than staleAfter keeps its lock,
+// and a process only removes the lock file it owns.
+func newFileCacheLocker(timeout, staleAfter time.Duration, log *logSink) cacheLocker {
+	return func(file string) (func(), error) {
+		lockFile := file + ".lock"
+		if err := os.MkdirAll(filepath.Dir(lockFile), 0700); err != nil {
+			return nil, fmt.Errorf("unable to create token cache directory: %w", err)
+		}
+		owner, err := newLockOwner()
+		if err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		for {
+			f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err == nil {
+				_, werr := f.WriteString(owner)
+				if cerr := f.Close(); werr == nil {
+					werr = cerr
+				}
+				if werr != nil {
+					_ = os.Remove(lockFile)
+					return nil, fmt.Errorf("unable to write token cache lock %s: %w", lockFile, werr)
+				}
+				return holdFileCacheLock(lockFile, owner, staleAfter, log), nil
+			}
+			if !os.IsExist(err) {
+				return nil, fmt.Errorf("unable to create token cache lock %s: %w", lockFile, err)
+			}
+			if info, err := os.Stat(lockFile); err == nil && time.Since(info.ModTime()) > staleAfter {
+				// the lock is removed only when it is still held by the owner found stale,
+				// not when another waiting process already replaced it
+				if staleOwner, err := os.ReadFile(lockFile); err == nil && isLockOwner(lockFile, string(staleOwner)) {
+					log.logf(5, "removing stale token cache lock %s", lockFile)
+					_ = os.Remove(lockFile)
+					continue
+				}
+			}
+			if time.Now().After(deadline) {
+				return nil, errCacheLockTimeout
+			}
+			time.Sleep(cacheLockRetryInterval)
+		}
+	}
+}
+
+// holdFileCacheLock refreshes the modification time of the lock file owned by owner until the returned unlock function
+// is called, which removes the lock file unless it is owned by another process
+func holdFileCacheLock(lockFile, owner string, staleAfter time.Duration, log *logSink) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(staleAfter / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !isLockOwner(lockFile, owner) {
+					log.logf(5, "token cache lock %s is no longer owned by this process", lockFile)
+					return
+				}
+				now := time.Now()
+				if err := os.Chtimes(lockFile, now, now); err != nil {
+					log.logf(5, "unable to refresh token cache lock %s: %s", lockFile, err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			if !isLockOwner(lockFile, owner) {
+				log.logf(5, "not removing token cache lock %s owned by another process", lockFile)
+				return
+			}
+			if err := os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+				log.logf(5, "unable to remove token cache lock %s: %s", lockFile, err)
+			}
+		})
+	}
+}
+
+// newLockOwner returns the owner token written to the lock file, the pid with a random value
+// since pids are reused, e.g. by processes in different containers sharing the token cache
+func newLockOwner() (string, error) {
+	random, err := newRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%s", os.Getpid(), random), nil
+}
+
+// isLockOwner returns true when the lock file holds the owner token
+func isLockOwner(lockFile, owner string) bool {
+	data, err := os.ReadFile(lockFile)
+	return err == nil && string(data) == owner
+}
@@ -0,0 +1,114 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileCacheLocker(t *testing.T) {
+	t.Run("lock should be exclusive until unlocked", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cache", "token.json")
+		locker := newFileCacheLocker(200*time.Millisecond, time.Minute, nil)
+
+		unlock, err := locker(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := locker(file); !errors.Is(err, errCacheLockTimeout) {
+			t.Fatalf("expected lock timeout, actual: %v", err)
+		}
+
+		unlock()
+		unlock, err = locker(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		unlock()
+	})
+
+	t.Run("waiting process should acquire lock once released", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "token.json")
+		locker := newFileCacheLocker(5*time.Second, time.Minute, nil)
+
+		unlock, err := locker(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			unlock()
+		}()
+		unlock, err = locker(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		unlock()
+	})
+
+	t.Run("stale lock should be removed", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "token.json")
+		lockFile := file + ".lock"
+		if err := os.WriteFile(lockFile, nil, 0600); err != nil {
+			t.Fatalf("unable to create lock file: %s", err)
+		}
+		staleTime := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(lockFile, staleTime, staleTime); err != nil {
+			t.Fatalf("unable to change lock file time: %s", err)
+		}
+
+		unlock, err := newFileCacheLocker(200*time.Millisecond, time.Minute, nil)(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		unlock()
+		if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+			t.Fatalf("expected lock file to be removed, actual: %v", err)
+		}
+	})
+
+	t.Run("lock held longer than staleAfter should not be removed", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "token.json")
+		staleAfter := 300 * time.Millisecond
+
+		unlock, err := newFileCacheLocker(200*time.Millisecond, staleAfter, nil)(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer unlock()
+		time.Sleep(2 * staleAfter)
+		if _, err := newFileCacheLocker(200*time.Millisecond, staleAfter, nil)(file); !errors.Is(err, errCacheLockTimeout) {
+			t.Fatalf("expected lock timeout, actual: %v", err)
+		}
+	})
+
+	t.Run("unlock should not remove lock owned by another process", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "token.json")
+		lockFile := file + ".lock"
+
+		unlock, err := newFileCacheLocker(200*time.Millisecond, time.Minute, nil)(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		owner, err := os.ReadFile(lockFile)
+		if err != nil {
+			t.Fatalf("unable to read lock file: %s", err)
+		}
+		if !strings.HasPrefix(string(owner), fmt.Sprintf("%d-", os.Getpid())) {
+			t.Fatalf("expected owner token with the pid in lock file, actual: %q", owner)
+		}
+
+		// another process removed the lock as stale and acquired it
+		if err := os.WriteFile(lockFile, []byte("1-other"), 0600); err != nil {
+			t.Fatalf("unable to write lock file: %s", err)
+		}
+		unlock()
+		if data, err := os.ReadFile(lockFile); err != nil || string(data) != "1-other" {
+			t.Fatalf("expected lock file of another process to be kept, actual: %q, %v", data, err)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+func TestGetCachedServerIDs(t *testing.T) {
+	dir := t.TempDir()
+	o := &Options{
+		Environment:   defaultEnvironmentName,
+		ClientID:      "clientID",
+		TenantID:      "tenantID",
+		TokenCacheDir: dir,
+	}
+	tokens := map[string]adal.Token{
+		getCacheFileNameForServerID(o, "serverB"):                                            {AccessToken: "a", Resource: "serverB"},
+		getCacheFileNameForServerID(o, "serverA"):                                            {AccessToken: "a", Resource: "serverA"},
+		getCacheFileNameForServerID(&Options{TokenCacheDir: dir, IsLegacy: true}, "serverA"): {AccessToken: "a", Resource: "spn:serverA"},
+	}
+	for file, token := range tokens {
+		if err := adal.SaveToken(file, 0600, token); err != nil {
+			t.Fatalf("unable to write token cache: %s", err)
+		}
+	}
+	// files other than tokens are skipped
+	if err := writeCacheMetadata(getCacheMetadataFileName(o), cacheMetadata{}); err != nil {
+		t.Fatalf("unable to write cache metadata: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0600); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	serverIDs, err := GetCachedServerIDs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"serverA", "serverB"}; !reflect.DeepEqual(serverIDs, expected) {
+		t.Fatalf("expected server IDs %v, got %v", expected, serverIDs)
+	}
+
+	if _, err := GetCachedServerIDs(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error reading a missing token cache directory")
+	}
+}